@@ -5,13 +5,16 @@ import (
 	"errors"
 	"time"
 
+	"github.com/RTradeLtd/Pay/tracker"
 	"github.com/RTradeLtd/config/v2"
 	pb "github.com/gcash/bchd/bchrpc/pb"
 	chainhash "github.com/gcash/bchd/chaincfg/chainhash"
 	"github.com/gcash/bchutil"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
 )
 
 var (
@@ -42,6 +45,9 @@ var (
 type Client struct {
 	pb.BchrpcClient
 	confirmationCount int
+	// tracker is used to wait for new blocks, and
+	// is only set once TrackBlocks has been called
+	tracker *tracker.Tracker
 }
 
 // Opts is used to configure our BCH gRPC connection
@@ -75,7 +81,42 @@ func NewClient(ctx context.Context, cfg *config.TemporalConfig, devMode bool) (*
 		confirmationCount = prodConfirmationCount
 	}
 	dev = devMode
-	return &Client{pb.NewBchrpcClient(gConn), confirmationCount}, nil
+	return &Client{BchrpcClient: pb.NewBchrpcClient(gConn), confirmationCount: confirmationCount}, nil
+}
+
+// TrackBlocks is used to subscribe to new blocks from bchd, so that payments waiting
+// on confirmations are checked once per block instead of on a timer. The subscription
+// lasts until the context is cancelled
+func (c *Client) TrackBlocks(ctx context.Context, l *zap.SugaredLogger) {
+	c.tracker = tracker.New(pauseDuration())
+	go c.tracker.Run(ctx, l, &blockSource{c: c})
+}
+
+// blockSource is a tracker.Source using the block subscription of bchd
+type blockSource struct {
+	c *Client
+}
+
+// Subscribe is used to send the height of each new block to heights
+func (bs *blockSource) Subscribe(ctx context.Context, heights chan<- uint64) error {
+	stream, err := bs.c.SubscribeBlocks(ctx, &pb.SubscribeBlocksRequest{})
+	if err != nil {
+		return err
+	}
+	for {
+		block, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if block.GetType() != pb.BlockNotification_CONNECTED {
+			continue
+		}
+		select {
+		case heights <- uint64(block.GetBlock().GetHeight()):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 }
 
 // GetTx is used to retrieve a transaction
@@ -117,9 +158,30 @@ func (c *Client) IsConfirmed(ctx context.Context, tx *pb.GetTransactionResponse)
 	return errors.New(ErrTxNotConfirmed)
 }
 
+// TxBlockHash is used to retrieve the hash of the block containing a transaction,
+// returning an empty hash once the transaction is no longer part of the active chain
+func (c *Client) TxBlockHash(ctx context.Context, hash string) (string, error) {
+	tx, err := c.GetTx(ctx, hash)
+	if status.Code(err) == codes.NotFound {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	// transactions returned to the mempool by a reorg have no block
+	if c.GetConfirmationCount(tx) <= 0 || len(tx.GetTransaction().GetBlockHash()) == 0 {
+		return "", nil
+	}
+	blockHash, err := chainhash.NewHash(tx.GetTransaction().GetBlockHash())
+	if err != nil {
+		return "", err
+	}
+	return blockHash.String(), nil
+}
+
 // ProcessPaymentTx is used to process a payment transaction
 func (c *Client) ProcessPaymentTx(ctx context.Context, l *zap.SugaredLogger, expectedValue float64, hash, depositAddress string) error {
 	l.Info("getting tx from blockchain")
+	seen := c.seenHeight()
 	tx, err := c.GetTx(ctx, hash)
 	if err != nil {
 		return err
@@ -142,12 +204,15 @@ func (c *Client) ProcessPaymentTx(ctx context.Context, l *zap.SugaredLogger, exp
 	// dissallow processing times longer than 3 hours
 	killTime := time.Now().Add(time.Hour * 3)
 	// wait for some blocks to pass
-	c.pause()
+	if err := c.wait(ctx, seen); err != nil {
+		return err
+	}
 	for {
 		if time.Now().UnixNano() > killTime.UnixNano() {
 			return errors.New("timeout occured while waiting for transaction to confirm")
 		}
 		l.Info("checking if tx is confirmed")
+		seen = c.seenHeight()
 		// refetch tx from blockchain
 		tx, err = c.GetTx(ctx, hash)
 		if err != nil {
@@ -159,7 +224,9 @@ func (c *Client) ProcessPaymentTx(ctx context.Context, l *zap.SugaredLogger, exp
 			return nil
 		}
 		l.Info("tx not confirmed, waiting for confirmations")
-		c.pause()
+		if err := c.wait(ctx, seen); err != nil {
+			return err
+		}
 	}
 }
 
@@ -183,10 +250,31 @@ func (c *Client) getTotalValueOfTx(tx *pb.GetTransactionResponse, depositAddress
 	return amt.ToBCH()
 }
 
+// seenHeight returns the height of the last block seen by the tracker, if any
+func (c *Client) seenHeight() uint64 {
+	if c.tracker != nil {
+		return c.tracker.Height()
+	}
+	return 0
+}
+
+// wait is used to wait for a block above the seen height if we are tracking
+// blocks, otherwise it pauses for roughly the duration of a block
+func (c *Client) wait(ctx context.Context, seen uint64) error {
+	if c.tracker != nil {
+		return c.tracker.Wait(ctx, seen)
+	}
+	c.pause()
+	return nil
+}
+
 func (c *Client) pause() {
+	time.Sleep(pauseDuration())
+}
+
+func pauseDuration() time.Duration {
 	if dev {
-		time.Sleep(time.Second * 5)
-	} else {
-		time.Sleep(time.Minute * 10)
+		return time.Second * 5
 	}
+	return time.Minute * 10
 }
@@ -3,12 +3,17 @@ package bch
 import (
 	"context"
 	"errors"
+	"io"
 	"testing"
 
 	"github.com/RTradeLtd/Pay/log"
 	"github.com/RTradeLtd/Pay/mocks"
 	"github.com/RTradeLtd/config/v2"
 	pb "github.com/gcash/bchd/bchrpc/pb"
+	chainhash "github.com/gcash/bchd/chaincfg/chainhash"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var (
@@ -100,6 +105,35 @@ func Test_GetCurrentBlockHeight(t *testing.T) {
 	}
 }
 
+func Test_TxBlockHash(t *testing.T) {
+	blockHash, err := chainhash.NewHashFromStr(txHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, fbc := newMockClient()
+	fbc.GetTransactionReturnsOnCall(0, &pb.GetTransactionResponse{
+		Transaction: &pb.Transaction{Confirmations: 2, BlockHash: blockHash[:]},
+	}, nil)
+	// returned to the mempool by a reorg
+	fbc.GetTransactionReturnsOnCall(1, &pb.GetTransactionResponse{
+		Transaction: &pb.Transaction{},
+	}, nil)
+	fbc.GetTransactionReturnsOnCall(2, nil, status.Error(codes.NotFound, "transaction not found"))
+	fbc.GetTransactionReturnsOnCall(3, nil, errors.New("hello"))
+	for _, want := range []string{txHash, "", ""} {
+		hash, err := c.TxBlockHash(context.Background(), txHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash != want {
+			t.Fatalf("TxBlockHash() = %v, want %v", hash, want)
+		}
+	}
+	if _, err := c.TxBlockHash(context.Background(), txHash); err == nil {
+		t.Fatal("error expected")
+	}
+}
+
 func Test_IsConfirmed_Success(t *testing.T) {
 	c, fbc := newMockClient()
 	fbc.GetTransactionReturnsOnCall(0, &pb.GetTransactionResponse{
@@ -234,3 +268,39 @@ func newMockClient() (*Client, *mocks.FakeBchrpcClient) {
 	c.BchrpcClient = fbc
 	return c, fbc
 }
+
+// fakeBlockStream is a fake block subscription
+type fakeBlockStream struct {
+	grpc.ClientStream
+	blocks []*pb.BlockNotification
+}
+
+func (fs *fakeBlockStream) Recv() (*pb.BlockNotification, error) {
+	if len(fs.blocks) == 0 {
+		return nil, io.EOF
+	}
+	block := fs.blocks[0]
+	fs.blocks = fs.blocks[1:]
+	return block, nil
+}
+
+func Test_Subscribe(t *testing.T) {
+	c, fbc := newMockClient()
+	fbc.SubscribeBlocksReturns(&fakeBlockStream{blocks: []*pb.BlockNotification{
+		{Type: pb.BlockNotification_CONNECTED, Block: &pb.BlockInfo{Height: 600}},
+		{Type: pb.BlockNotification_DISCONNECTED, Block: &pb.BlockInfo{Height: 600}},
+		{Type: pb.BlockNotification_CONNECTED, Block: &pb.BlockInfo{Height: 601}},
+	}}, nil)
+	heights := make(chan uint64, 3)
+	if err := (&blockSource{c: c}).Subscribe(context.Background(), heights); err != io.EOF {
+		t.Fatal("expected stream to end", err)
+	}
+	close(heights)
+	var got []uint64
+	for height := range heights {
+		got = append(got, height)
+	}
+	if len(got) != 2 || got[0] != 600 || got[1] != 601 {
+		t.Fatal("bad heights received", got)
+	}
+}
@@ -0,0 +1,200 @@
+package btc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/Pay/log"
+)
+
+var (
+	txHash = "011db9a9b0c3e95b4551418643ad995974c4e590e47cba107388d6939dbf97b6"
+)
+
+// fakeNode is a fake bitcoind json-rpc server
+type fakeNode struct {
+	height int32
+	// transactions returned by successive getrawtransaction calls
+	txs   []string
+	calls int
+}
+
+func (fn *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string `json:"method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	switch req.Method {
+	case "getblockcount":
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": fn.height})
+	case "getrawtransaction":
+		tx := fn.txs[fn.calls]
+		if fn.calls < len(fn.txs)-1 {
+			fn.calls++
+		}
+		// an empty transaction is one the node doesn't know about
+		if tx == "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"result":null,"error":{"code":-5,"message":"No such mempool or blockchain transaction"}}`))
+			return
+		}
+		w.Write([]byte(`{"result":` + tx + `}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"code":-32601,"message":"Method not found"}}`))
+	}
+}
+
+func newFakeClient(t *testing.T, fn *fakeNode) (*Client, func()) {
+	srv := httptest.NewServer(fn)
+	c, err := NewClient("http://user:pass@"+srv.Listener.Addr().String(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.confirmationCount = 3
+	return c, srv.Close
+}
+
+func Test_Integration(t *testing.T) {
+	url := os.Getenv("BTC_RPC")
+	if url == "" {
+		t.Skip("BTC_RPC not set, skipping regtest integration")
+	}
+	c, err := NewClient(url, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetCurrentBlockHeight(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_GetCurrentBlockHeight(t *testing.T) {
+	c, done := newFakeClient(t, &fakeNode{height: 500})
+	defer done()
+	height, err := c.GetCurrentBlockHeight(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 500 {
+		t.Fatal("bad height recovered")
+	}
+}
+
+func Test_IsConfirmed(t *testing.T) {
+	tests := []struct {
+		name    string
+		tx      string
+		wantErr string
+	}{
+		{"success", `{"confirmations":6,"locktime":501}`, ""},
+		{"locktime", `{"confirmations":6,"locktime":901}`, ErrTxNotConfirmedLockTime},
+		{"unconfirmed", `{"confirmations":0,"locktime":501}`, ErrTxNotConfirmed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := newFakeClient(t, &fakeNode{height: 600, txs: []string{tt.tx}})
+			defer done()
+			tx, err := c.GetTx(context.Background(), txHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = c.IsConfirmed(context.Background(), tx)
+			if (err != nil) != (tt.wantErr != "") {
+				t.Fatalf("IsConfirmed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && err.Error() != tt.wantErr {
+				t.Fatal("wrong error message returned")
+			}
+		})
+	}
+}
+
+func Test_GetTotalValueOfTx(t *testing.T) {
+	c, done := newFakeClient(t, &fakeNode{txs: []string{`{"vout":[
+		{"value":0.1,"scriptPubKey":{"address":"world"}},
+		{"value":0.2,"scriptPubKey":{"addresses":["world"]}},
+		{"value":5,"scriptPubKey":{"addresses":["world","hello"]}},
+		{"value":7,"scriptPubKey":{"address":"hello"}}
+	]}`}})
+	defer done()
+	tx, err := c.GetTx(context.Background(), txHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := c.getTotalValueOfTx(tx, "world"); value != 0.3 {
+		t.Fatal("bad value returned", value)
+	}
+}
+
+func Test_ProcessPaymentTx(t *testing.T) {
+	c, done := newFakeClient(t, &fakeNode{height: 999, txs: []string{
+		`{"confirmations":0,"locktime":501,"vout":[{"value":1,"scriptPubKey":{"address":"world"}}]}`,
+		`{"confirmations":1,"locktime":501,"vout":[{"value":1,"scriptPubKey":{"address":"world"}}]}`,
+		`{"confirmations":5,"locktime":501,"vout":[{"value":1,"scriptPubKey":{"address":"world"}}]}`,
+	}})
+	defer done()
+	logger, err := log.NewLogger("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ProcessPaymentTx(context.Background(), logger, 2, txHash, "world"); err == nil {
+		t.Fatal("error expected")
+	} else if err.Error() != ErrTxTooLowValue {
+		t.Fatal("wrong error message returned")
+	}
+	if err := c.ProcessPaymentTx(context.Background(), logger, 1, txHash, "world"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_ProcessPaymentTx_Cancelled(t *testing.T) {
+	c, done := newFakeClient(t, &fakeNode{height: 999, txs: []string{
+		`{"confirmations":0,"locktime":501,"vout":[{"value":1,"scriptPubKey":{"address":"world"}}]}`,
+	}})
+	defer done()
+	logger, err := log.NewLogger("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the payment deadline is honoured while waiting on confirmations
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	if err := c.ProcessPaymentTx(ctx, logger, 1, txHash, "world"); err != context.DeadlineExceeded {
+		t.Fatalf("ProcessPaymentTx() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func Test_TxBlockHash(t *testing.T) {
+	tests := []struct {
+		name string
+		tx   string
+		want string
+	}{
+		{"confirmed", `{"txid":"abc","confirmations":2,"blockhash":"def"}`, "def"},
+		{"reorged", `{"txid":"abc","confirmations":0,"blockhash":"def"}`, ""},
+		{"mempool", `{"txid":"abc"}`, ""},
+		{"dropped", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := newFakeClient(t, &fakeNode{txs: []string{tt.tx}})
+			defer done()
+			hash, err := c.TxBlockHash(context.Background(), txHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hash != tt.want {
+				t.Fatalf("TxBlockHash() = %v, want %v", hash, tt.want)
+			}
+		})
+	}
+}
@@ -4,15 +4,25 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"math/big"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"syscall"
+	"time"
 
+	"github.com/RTradeLtd/Pay/dash"
+	"github.com/RTradeLtd/Pay/deposit"
+	"github.com/RTradeLtd/Pay/ethereum"
 	"github.com/RTradeLtd/Pay/log"
 	"github.com/RTradeLtd/Pay/queue"
 	"github.com/RTradeLtd/Pay/server"
+	"github.com/RTradeLtd/Pay/settings"
+	paySigner "github.com/RTradeLtd/Pay/signer"
+	"github.com/RTradeLtd/Pay/store"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/jinzhu/gorm"
 
 	"github.com/RTradeLtd/cmd/v2"
@@ -34,6 +44,8 @@ var (
 	ctx    context.Context
 	cancel context.CancelFunc
 	signer pbSigner.SignerClient
+	// paySettings configures our own services, and is loaded alongside the TemporalConfig
+	paySettings *settings.Settings
 )
 
 // command-line flags
@@ -72,6 +84,120 @@ func baseFlagSet() *flag.FlagSet {
 	return f
 }
 
+// ethOpts returns the configuration of our ethereum client
+func ethOpts() ethereum.Opts {
+	gwei := func(value uint64) *big.Int {
+		if value == 0 {
+			return nil
+		}
+		return new(big.Int).Mul(new(big.Int).SetUint64(value), big.NewInt(1000000000))
+	}
+	eth := paySettings.Ethereum
+	return ethereum.Opts{
+		GasOracle:     eth.GasOracle,
+		GasBlocks:     eth.GasBlocks,
+		GasPercentile: eth.GasPercentile,
+		GasFloor:      gwei(eth.GasFloor),
+		GasCeiling:    gwei(eth.GasCeiling),
+		Tx: ethereum.TxOpts{
+			Timeout:     eth.TxTimeout.Duration(),
+			BumpPercent: eth.TxBump,
+			MaxAttempts: eth.TxAttempts,
+		},
+		Signer: paySigner.Opts{RemoteURL: eth.Signer.URL, RemoteAccount: eth.Signer.Account},
+	}
+}
+
+// signerOpts returns the options selecting a payment key
+func signerOpts(key settings.Key) paySigner.Opts {
+	return paySigner.Opts{
+		RemoteURL:     key.URL,
+		RemoteAccount: key.Account,
+		KeyFile:       key.KeyFile,
+		KeyPass:       key.KeyPass,
+	}
+}
+
+// serverOpts returns the configuration of our grpc server
+func serverOpts() (server.Opts, error) {
+	s := paySettings.Signer
+	opts := server.Opts{
+		XPubs: map[string]string{
+			deposit.BCH:  paySettings.XPubs.BCH,
+			deposit.BTC:  paySettings.XPubs.BTC,
+			deposit.DASH: paySettings.XPubs.DASH,
+		},
+		DevMode:   *devMode,
+		Signer:    signerOpts(s.Key),
+		ENSSigner: ethOpts().Signer,
+		TypedDomain: paySigner.TypedDomain{
+			Name:    s.Typed.Name,
+			Version: s.Typed.Version,
+			ChainID: big.NewInt(s.Typed.ChainID),
+		},
+		TypedExpiry: s.Typed.Expiry.Duration(),
+	}
+	if s.Typed.VerifyingContract != "" {
+		if !common.IsHexAddress(s.Typed.VerifyingContract) {
+			return opts, fmt.Errorf("invalid verifying contract %s", s.Typed.VerifyingContract)
+		}
+		opts.TypedDomain.VerifyingContract = common.HexToAddress(s.Typed.VerifyingContract)
+	}
+	if s.RotateAt == "" {
+		return opts, nil
+	}
+	at, err := time.Parse(time.RFC3339, s.RotateAt)
+	if err != nil {
+		return opts, err
+	}
+	opts.NextSigner = signerOpts(s.Next)
+	opts.RotateAt = at
+	opts.RotationOverlap = s.RotateOverlap.Duration()
+	return opts, nil
+}
+
+// ethConnectionType returns the type of connection to make to ethereum
+func ethConnectionType(cfg config.TemporalConfig) string {
+	var connectionType string
+	if cfg.Ethereum.Connection.INFURA.URL != "" {
+		connectionType = "infura"
+	}
+	if cfg.Ethereum.Connection.RPC.IP != "" &&
+		cfg.Ethereum.Connection.RPC.Port != "" {
+		connectionType = "rpc"
+	}
+	return connectionType
+}
+
+// adminEmail returns the address notified of reversed payments and expiring ens names
+func adminEmail(cfg config.TemporalConfig) string {
+	if paySettings.AdminEmail != "" {
+		return paySettings.AdminEmail
+	}
+	return cfg.Sendgrid.EmailAddress
+}
+
+// reorgOpts returns the configuration of the payment reorg watcher
+func reorgOpts(cfg config.TemporalConfig) queue.ReorgOpts {
+	return queue.ReorgOpts{
+		Window:        paySettings.Reorg.Window.Duration(),
+		Interval:      paySettings.Reorg.Interval.Duration(),
+		MissingChecks: paySettings.Reorg.MissingChecks,
+		AdminEmail:    adminEmail(cfg),
+	}
+}
+
+// renewalOpts returns the configuration of the ens name expiry monitor
+func renewalOpts(cfg config.TemporalConfig) queue.RenewalOpts {
+	return queue.RenewalOpts{
+		Interval:   paySettings.ENS.RenewInterval.Duration(),
+		Warning:    paySettings.ENS.RenewWarning.Duration(),
+		AutoRenew:  paySettings.ENS.AutoRenew,
+		Credits:    paySettings.ENS.RenewCredits,
+		AdminEmail: adminEmail(cfg),
+	}
+}
+
 func logPath(base, file string) (logPath string) {
 	if base == "" {
 		logPath = filepath.Join(base, file)
@@ -86,6 +212,11 @@ func newDB(cfg config.TemporalConfig, noSSL bool) (*gorm.DB, error) {
 	if err != nil {
 		return nil, err
 	}
+	if *dbMigrate {
+		if err := store.Migrate(dbm.DB); err != nil {
+			return nil, err
+		}
+	}
 	return dbm.DB, nil
 }
 
@@ -109,7 +240,7 @@ var commands = map[string]cmd.Cmd{
 						fmt.Println("failed to start db", err)
 						os.Exit(1)
 					}
-					quitChannel := make(chan os.Signal)
+					quitChannel := make(chan os.Signal, 1)
 					signal.Notify(quitChannel, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
 					waitGroup := &sync.WaitGroup{}
 					go func() {
@@ -123,6 +254,13 @@ var commands = map[string]cmd.Cmd{
 							fmt.Println("failed to start queue", err)
 							os.Exit(1)
 						}
+						qm.ENSOpts = ethOpts()
+						qm.RegisterCredits = paySettings.ENS.RegisterCredits
+						qm.RenewalOpts = renewalOpts(cfg)
+						qm.BatchOpts = queue.BatchOpts{
+							Window: paySettings.ENS.BatchWindow.Duration(),
+							Size:   paySettings.ENS.BatchSize,
+						}
 						waitGroup.Add(1)
 						err = qm.ConsumeMessages(ctx, waitGroup, db, &cfg)
 						if err != nil && err.Error() != queue.ErrReconnect {
@@ -156,9 +294,17 @@ var commands = map[string]cmd.Cmd{
 								fmt.Println("failed to start db", err)
 								os.Exit(1)
 							}
-							quitChannel := make(chan os.Signal)
+							if err := queue.RecoverPayments(queue.EthPaymentConfirmationQueue, &cfg, db, logger); err != nil {
+								fmt.Println("failed to recover pending payments", err)
+								os.Exit(1)
+							}
+							quitChannel := make(chan os.Signal, 1)
 							signal.Notify(quitChannel, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
 							waitGroup := &sync.WaitGroup{}
+							if err := queue.WatchReorgs(ctx, waitGroup, queue.EthPaymentConfirmationQueue, &cfg, db, logger, reorgOpts(cfg)); err != nil {
+								fmt.Println("failed to watch payments for reorgs", err)
+								os.Exit(1)
+							}
 							go func() {
 								fmt.Println(closeMessage)
 								<-quitChannel
@@ -200,9 +346,24 @@ var commands = map[string]cmd.Cmd{
 								fmt.Println("failed to start db", err)
 								os.Exit(1)
 							}
-							quitChannel := make(chan os.Signal)
+							queue.RegisterPaymentProcessor(
+								queue.DashPaymentConfirmationQueue,
+								queue.NewDASHProcessorWithOpts(dash.Opts{
+									Backend: paySettings.Dash.Backend,
+									RPCURL:  paySettings.Dash.RPC,
+								}),
+							)
+							if err := queue.RecoverPayments(queue.DashPaymentConfirmationQueue, &cfg, db, logger); err != nil {
+								fmt.Println("failed to recover pending payments", err)
+								os.Exit(1)
+							}
+							quitChannel := make(chan os.Signal, 1)
 							signal.Notify(quitChannel, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
 							waitGroup := &sync.WaitGroup{}
+							if err := queue.WatchReorgs(ctx, waitGroup, queue.DashPaymentConfirmationQueue, &cfg, db, logger, reorgOpts(cfg)); err != nil {
+								fmt.Println("failed to watch payments for reorgs", err)
+								os.Exit(1)
+							}
 							go func() {
 								fmt.Println(closeMessage)
 								<-quitChannel
@@ -244,9 +405,17 @@ var commands = map[string]cmd.Cmd{
 								fmt.Println("failed to start db", err)
 								os.Exit(1)
 							}
-							quitChannel := make(chan os.Signal)
+							if err := queue.RecoverPayments(queue.BitcoinCashPaymentConfirmationQueue, &cfg, db, logger); err != nil {
+								fmt.Println("failed to recover pending payments", err)
+								os.Exit(1)
+							}
+							quitChannel := make(chan os.Signal, 1)
 							signal.Notify(quitChannel, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
 							waitGroup := &sync.WaitGroup{}
+							if err := queue.WatchReorgs(ctx, waitGroup, queue.BitcoinCashPaymentConfirmationQueue, &cfg, db, logger, reorgOpts(cfg)); err != nil {
+								fmt.Println("failed to watch payments for reorgs", err)
+								os.Exit(1)
+							}
 							go func() {
 								fmt.Println(closeMessage)
 								<-quitChannel
@@ -274,6 +443,171 @@ var commands = map[string]cmd.Cmd{
 							waitGroup.Wait()
 						},
 					},
+					"btc": cmd.Cmd{
+						Blurb:       "Bitcoin payment confirmation queue",
+						Description: "Used to process and confirm BTC payments",
+						Action: func(cfg config.TemporalConfig, args map[string]string) {
+							logger, err := log.NewLogger(logPath(cfg.LogDir, "btc_consumer.log"), *devMode)
+							if err != nil {
+								fmt.Println("failed to start logger", err)
+								os.Exit(1)
+							}
+							db, err := newDB(cfg, *dbNoSSL)
+							if err != nil {
+								fmt.Println("failed to start db", err)
+								os.Exit(1)
+							}
+							queue.RegisterPaymentProcessor(
+								queue.BitcoinPaymentConfirmationQueue,
+								queue.NewBTCProcessor(paySettings.Nodes.BTC, *devMode),
+							)
+							if err := queue.RecoverPayments(queue.BitcoinPaymentConfirmationQueue, &cfg, db, logger); err != nil {
+								fmt.Println("failed to recover pending payments", err)
+								os.Exit(1)
+							}
+							quitChannel := make(chan os.Signal, 1)
+							signal.Notify(quitChannel, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
+							waitGroup := &sync.WaitGroup{}
+							if err := queue.WatchReorgs(ctx, waitGroup, queue.BitcoinPaymentConfirmationQueue, &cfg, db, logger, reorgOpts(cfg)); err != nil {
+								fmt.Println("failed to watch payments for reorgs", err)
+								os.Exit(1)
+							}
+							go func() {
+								fmt.Println(closeMessage)
+								<-quitChannel
+								cancel()
+							}()
+							for {
+								qm, err := queue.New(queue.BitcoinPaymentConfirmationQueue, &cfg, logger, *devMode)
+								if err != nil {
+									fmt.Println("failed to start queue", err)
+									os.Exit(1)
+								}
+								waitGroup.Add(1)
+								err = qm.ConsumeMessages(ctx, waitGroup, db, &cfg)
+								if err != nil && err.Error() != queue.ErrReconnect {
+									fmt.Println("failed to consume messages", err)
+									os.Exit(1)
+								} else if err != nil && err.Error() == queue.ErrReconnect {
+									continue
+								}
+								// this will only be true if we had a graceful exit to the queue process, aka CTRL+C
+								if err == nil {
+									break
+								}
+							}
+							waitGroup.Wait()
+						},
+					},
+					"xmr": cmd.Cmd{
+						Blurb:       "Monero payment confirmation queue",
+						Description: "Used to process and confirm XMR payments",
+						Action: func(cfg config.TemporalConfig, args map[string]string) {
+							logger, err := log.NewLogger(logPath(cfg.LogDir, "xmr_consumer.log"), *devMode)
+							if err != nil {
+								fmt.Println("failed to start logger", err)
+								os.Exit(1)
+							}
+							db, err := newDB(cfg, *dbNoSSL)
+							if err != nil {
+								fmt.Println("failed to start db", err)
+								os.Exit(1)
+							}
+							if err := queue.RecoverPayments(queue.MoneroPaymentConfirmationQueue, &cfg, db, logger); err != nil {
+								fmt.Println("failed to recover pending payments", err)
+								os.Exit(1)
+							}
+							quitChannel := make(chan os.Signal, 1)
+							signal.Notify(quitChannel, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
+							waitGroup := &sync.WaitGroup{}
+							go func() {
+								fmt.Println(closeMessage)
+								<-quitChannel
+								cancel()
+							}()
+							for {
+								qm, err := queue.New(queue.MoneroPaymentConfirmationQueue, &cfg, logger, *devMode)
+								if err != nil {
+									fmt.Println("failed to start queue", err)
+									os.Exit(1)
+								}
+								waitGroup.Add(1)
+								err = qm.ConsumeMessages(ctx, waitGroup, db, &cfg)
+								if err != nil && err.Error() != queue.ErrReconnect {
+									fmt.Println("failed to consume messages", err)
+									os.Exit(1)
+								} else if err != nil && err.Error() == queue.ErrReconnect {
+									continue
+								}
+								// this will only be true if we had a graceful exit to the queue process, aka CTRL+C
+								if err == nil {
+									break
+								}
+							}
+							waitGroup.Wait()
+						},
+					},
+				},
+			},
+		},
+	},
+	"tx": cmd.Cmd{
+		Blurb:         "ethereum transaction commands",
+		Description:   "Used to manage the ethereum transactions sent by the ens queue",
+		ChildRequired: true,
+		Children: map[string]cmd.Cmd{
+			"cancel": cmd.Cmd{
+				Blurb:       "cancel a stuck transaction",
+				Description: "Replaces the pending transaction with the given nonce by a zero value transfer to ourselves",
+				Args:        []string{"nonce"},
+				Action: func(cfg config.TemporalConfig, args map[string]string) {
+					nonce, err := strconv.ParseUint(args["nonce"], 10, 64)
+					if err != nil {
+						fmt.Println("invalid nonce", err)
+						os.Exit(1)
+					}
+					db, err := newDB(cfg, *dbNoSSL)
+					if err != nil {
+						fmt.Println("failed to start db", err)
+						os.Exit(1)
+					}
+					attempts, err := store.NewTxAttemptManager(db).FindAttempts(nonce)
+					if err != nil {
+						fmt.Println("failed to find transaction attempts", err)
+						os.Exit(1)
+					} else if len(attempts) == 0 {
+						fmt.Println("no transaction was sent with nonce", nonce)
+						os.Exit(1)
+					}
+					client, err := ethereum.NewClientWithOpts(&cfg, ethConnectionType(cfg), ethOpts())
+					if err != nil {
+						fmt.Println("failed to connect to ethereum", err)
+						os.Exit(1)
+					}
+					if err := client.UnlockAccountFromConfig(&cfg); err != nil {
+						fmt.Println("failed to unlock account", err)
+						os.Exit(1)
+					}
+					client.Tx.Recorder = store.NewTxAttemptManager(db)
+					last := attempts[len(attempts)-1]
+					stuck, pending, err := client.ETH.TransactionByHash(ctx, common.HexToHash(last.Hash))
+					if err != nil {
+						fmt.Println("failed to find transaction", err)
+						os.Exit(1)
+					} else if !pending {
+						fmt.Println("transaction has already been mined")
+						os.Exit(1)
+					}
+					cancelled, err := client.Tx.Cancel(ctx, client.Auth, last.Operation, stuck)
+					if err != nil {
+						fmt.Println("failed to cancel transaction", err)
+						os.Exit(1)
+					}
+					if !cancelled {
+						fmt.Println("transaction was mined before it could be cancelled")
+						return
+					}
+					fmt.Println("transaction cancelled")
 				},
 			},
 		},
@@ -285,14 +619,14 @@ var commands = map[string]cmd.Cmd{
 		Children: map[string]cmd.Cmd{
 			"server": cmd.Cmd{
 				Blurb:       "run the grpc server",
-				Description: "runs our gRPC API server to generate signed messages",
+				Description: "runs our gRPC API server to generate signed messages and deposit addresses",
 				Action: func(cfg config.TemporalConfig, args map[string]string) {
 					logger, err := log.NewLogger(logPath(cfg.LogDir, "pay_grpc_server.log"), *devMode)
 					if err != nil {
 						fmt.Println("failed to start logger", err.Error())
 						os.Exit(1)
 					}
-					quitChannel := make(chan os.Signal)
+					quitChannel := make(chan os.Signal, 1)
 					signal.Notify(quitChannel, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
 					waitGroup := &sync.WaitGroup{}
 					go func() {
@@ -300,7 +634,22 @@ var commands = map[string]cmd.Cmd{
 						<-quitChannel
 						cancel()
 					}()
-					if err := server.RunServer(ctx, waitGroup, cfg, logger); err != nil {
+					opts, err := serverOpts()
+					if err != nil {
+						fmt.Println("invalid payment signer configuration", err)
+						os.Exit(1)
+					}
+					// the payment contract is checked to accept our payment keys
+					if opts.Contract, err = ethereum.NewClient(&cfg, ethConnectionType(cfg)); err != nil {
+						fmt.Println("failed to connect to ethereum", err)
+						os.Exit(1)
+					}
+					// signed payment messages are recorded in the database
+					if opts.DB, err = newDB(cfg, *dbNoSSL); err != nil {
+						fmt.Println("failed to start db", err)
+						os.Exit(1)
+					}
+					if err := server.RunServer(ctx, waitGroup, cfg, logger, opts); err != nil {
 						fmt.Println("an error occurred while running grpc server", err.Error())
 						os.Exit(1)
 					}
@@ -340,6 +689,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	// load the settings of our own services
+	if paySettings, err = settings.Load(*configPath); err != nil {
+		println("failed to load pay settings at", *configPath, err.Error())
+		os.Exit(1)
+	}
+
 	// load arguments
 	flags := map[string]string{
 		"certFilePath":  tCfg.API.Connection.Certificates.CertPath,
@@ -0,0 +1,157 @@
+package dash
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+
+	ch "github.com/RTradeLtd/ChainRider-Go/dash"
+)
+
+const (
+	// duffsPerDash is the number of duffs in one DASH
+	duffsPerDash = 1e8
+
+	// ErrTransactionNotFound is an error used to indicate that a backend does
+	// not know of a transaction, either in a block or in its mempool
+	ErrTransactionNotFound = "transaction not found"
+)
+
+// Backend is used to retrieve transaction and chain information
+// needed to verify dash payments
+type Backend interface {
+	// Transaction is used to retrieve a transaction by its hash,
+	// failing with ErrTransactionNotFound for unknown transactions
+	Transaction(hash string) (*Transaction, error)
+	// BlockHeight is used to retrieve the current height of the chain
+	BlockHeight() (int, error)
+	// AddressTransactions is used to retrieve the hashes of the
+	// transactions, including unconfirmed ones, sent to an address
+	AddressTransactions(address string) ([]string, error)
+}
+
+// Transaction is a dash transaction as returned by a Backend
+type Transaction struct {
+	Hash          string
+	Confirmations int
+	Locktime      int
+	// BlockHash is the hash of the block containing the
+	// transaction, and is empty for unconfirmed transactions
+	BlockHash string
+	// InstantLock indicates the transaction has been locked through
+	// InstantSend, or is included in a ChainLocked block, meaning
+	// it can not be double spent and may be considered confirmed
+	InstantLock bool
+	Outputs     []Output
+}
+
+// Output is an output of a dash transaction
+type Output struct {
+	Addresses []string
+	Duffs     int64
+}
+
+// chainRiderBackend is a Backend using the chainrider api
+type chainRiderBackend struct {
+	c *ch.Client
+}
+
+// Transaction is used to retrieve a transaction from chainrider
+func (cb *chainRiderBackend) Transaction(hash string) (*Transaction, error) {
+	resp, err := cb.transactionByHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	tx := &Transaction{
+		Hash:          resp.TxID,
+		Confirmations: resp.Confirmations,
+		Locktime:      resp.Locktime,
+		BlockHash:     resp.BlockHash,
+		InstantLock:   resp.TxLock,
+	}
+	for _, vout := range resp.Vout {
+		value, err := strconv.ParseFloat(vout.Value, 64)
+		if err != nil {
+			return nil, err
+		}
+		tx.Outputs = append(tx.Outputs, Output{
+			Addresses: vout.ScriptPubKey.Addresses,
+			Duffs:     dashToDuffs(value),
+		})
+	}
+	return tx, nil
+}
+
+// transactionByHash is used to retrieve a transaction from chainrider. Unlike the
+// chainrider client, unknown transactions are told apart from failed requests by
+// the status of the response, as chainrider answers them with a plain text 404
+func (cb *chainRiderBackend) transactionByHash(hash string) (*ch.TransactionByHashResponse, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/tx/%s?token=%s", cb.c.URL, hash, cb.c.Token), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := cb.c.HC.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errors.New(ErrTransactionNotFound)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("chainrider returned status %d: %s", resp.StatusCode, body)
+	}
+	tx := &ch.TransactionByHashResponse{}
+	if err := json.Unmarshal(body, tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// BlockHeight is used to retrieve the height of the last block known to chainrider
+func (cb *chainRiderBackend) BlockHeight() (int, error) {
+	blockHash, err := cb.c.GetLastBlockHash()
+	if err != nil {
+		return 0, err
+	}
+	block, err := cb.c.GetBlockByHash(blockHash.LastBlockHash)
+	if err != nil {
+		return 0, err
+	}
+	return block.Height, nil
+}
+
+// AddressTransactions is used to retrieve the transactions for an address from chainrider.
+// Only the first page of results is returned, which is sufficient for deposit addresses
+// as they are only used for a single payment
+func (cb *chainRiderBackend) AddressTransactions(address string) ([]string, error) {
+	resp, err := cb.c.TransactionsForAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	var hashes []string
+	for _, tx := range resp.Transactions {
+		hashes = append(hashes, tx.TxID)
+	}
+	return hashes, nil
+}
+
+// dashToDuffs converts a dash value into duffs
+func dashToDuffs(value float64) int64 {
+	return int64(math.Round(value * duffsPerDash))
+}
@@ -1,10 +1,13 @@
 package dash
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	ch "github.com/RTradeLtd/ChainRider-Go/dash"
+	"github.com/RTradeLtd/Pay/tracker"
 	"github.com/RTradeLtd/config/v2"
 	"go.uber.org/zap"
 )
@@ -13,23 +16,60 @@ const (
 	devConfirmationCount  = int(3)
 	prodConfirmationCount = int(6)
 	dev                   = false
+
+	// BackendChainRider verifies transactions through the chainrider api
+	BackendChainRider = "chainrider"
+	// BackendDashd verifies transactions through our own dashd node
+	BackendDashd = "dashd"
+)
+
+var (
+	// pollInterval is the time waited between checks for new transactions
+	pollInterval = time.Minute * 4
+	// blockPollInterval is the time waited between checks for new blocks
+	blockPollInterval = time.Second * 30
 )
 
-// DashClient is our connection to the dash blockchain via chainrider api
+// DashClient is our connection to the dash blockchain. Payment forwards are
+// managed through the chainrider api, while transactions are verified through
+// the configured Backend, which may either be chainrider or our own dashd node
 type DashClient struct {
 	C                 *ch.Client
+	Backend           Backend
 	ConfirmationCount int
+	// tracker is used to wait for new blocks, and
+	// is only set once TrackBlocks has been called
+	tracker *tracker.Tracker
 }
 
-// ProcessPaymentOpts are parameters needed to validate a payment
+// Opts are used to configure our dash client
+type Opts struct {
+	// Backend selects the backend transactions are verified
+	// through, defaulting to BackendChainRider
+	Backend string
+	// RPCURL is the json-rpc url of our dashd node, including
+	// credentials, and is required by BackendDashd
+	RPCURL string
+}
+
+// ProcessPaymentOpts are parameters needed to validate a payment. Payments
+// are made either through a payment forward, or directly to a deposit address
 type ProcessPaymentOpts struct {
 	Number         int64
 	ChargeAmount   float64
 	PaymentForward *ch.GetPaymentForwardByIDResponse
+	DepositAddress string
 }
 
 // GenerateDashClient is used to generate our dash client to process transactions
+// through chainrider
 func GenerateDashClient(cfg *config.TemporalConfig) (*DashClient, error) {
+	return NewDashClient(cfg, Opts{})
+}
+
+// NewDashClient is used to generate our dash client, selecting the backend
+// used to verify transactions based on the given options
+func NewDashClient(cfg *config.TemporalConfig, o Opts) (*DashClient, error) {
 	opts := &ch.ConfigOpts{
 		APIVersion:      "v1",
 		DigitalCurrency: "dash",
@@ -41,7 +81,22 @@ func GenerateDashClient(cfg *config.TemporalConfig) (*DashClient, error) {
 	}
 	c := ch.NewClient(opts)
 	dc := &DashClient{
-		C: c,
+		C:       c,
+		Backend: &chainRiderBackend{c: c},
+	}
+	switch o.Backend {
+	case "", BackendChainRider:
+	case BackendDashd:
+		if o.RPCURL == "" {
+			return nil, errors.New("dashd backend requires a json-rpc url")
+		}
+		backend, err := newRPCBackend(o.RPCURL)
+		if err != nil {
+			return nil, err
+		}
+		dc.Backend = backend
+	default:
+		return nil, fmt.Errorf("unsupported dash backend %s", o.Backend)
 	}
 	if dev {
 		dc.ConfirmationCount = devConfirmationCount
@@ -51,23 +106,22 @@ func GenerateDashClient(cfg *config.TemporalConfig) (*DashClient, error) {
 	return dc, nil
 }
 
-// ProcessPayment is used to process a dash based payment
-func (dc *DashClient) ProcessPayment(opts *ProcessPaymentOpts, l *zap.SugaredLogger) error {
+// ProcessPayment is used to process a dash based payment made through a payment
+// forward, until it is covered or the context is cancelled
+func (dc *DashClient) ProcessPayment(ctx context.Context, opts *ProcessPaymentOpts, l *zap.SugaredLogger) error {
 	var (
 		toProcessTransactions []ch.ProcessedTxObject
 		processedTransactions = make(map[string]bool)
 		totalAmountSent       float64
 		paymentForwardID      = opts.PaymentForward.PaymentForwardID
 	)
-	killTime := time.Now().Add(time.Minute * 90)
 	if len(opts.PaymentForward.ProcessedTxs) == 0 {
 		l.Info("no transactions detected, sleeping for 4 minutes")
-		time.Sleep(time.Minute * 4)
+		if err := sleep(ctx, pollInterval); err != nil {
+			return err
+		}
 	}
 	for {
-		if time.Now().UnixNano() > killTime.UnixNano() {
-			return errors.New("timeout occured while waiting for transaction")
-		}
 		l.Info("checking for txs to process")
 		paymentForward, err := dc.C.GetPaymentForwardByID(paymentForwardID)
 		if err != nil {
@@ -76,7 +130,9 @@ func (dc *DashClient) ProcessPayment(opts *ProcessPaymentOpts, l *zap.SugaredLog
 		if len(paymentForward.ProcessedTxs) == 0 {
 			l.Info("no transactions detected, sleeping for 4 minutes")
 			// no processed transactions yet, sleep for 4 minutes
-			time.Sleep(time.Minute * 4)
+			if err := sleep(ctx, pollInterval); err != nil {
+				return err
+			}
 			continue
 		}
 		l.Info("new transaction(s) detected, ensuring we haven't already processed them")
@@ -88,12 +144,14 @@ func (dc *DashClient) ProcessPayment(opts *ProcessPaymentOpts, l *zap.SugaredLog
 		}
 		if len(toProcessTransactions) == 0 {
 			l.Info("all transactions have already been processed, waiting for new ones")
-			time.Sleep(time.Minute * 4)
+			if err := sleep(ctx, pollInterval); err != nil {
+				return err
+			}
 			continue
 		}
 		// process the actual transactions
 		for _, tx := range toProcessTransactions {
-			if _, err = dc.ProcessTransaction(tx.TransactionHash, killTime, l); err != nil {
+			if _, err = dc.ProcessTransaction(ctx, tx.TransactionHash, l); err != nil {
 				return err
 			}
 			txValueFloat := ch.DuffsToDash(float64(int64(tx.ReceivedAmountDuffs)))
@@ -111,58 +169,188 @@ func (dc *DashClient) ProcessPayment(opts *ProcessPaymentOpts, l *zap.SugaredLog
 		// clear to process transactions
 		toProcessTransactions = []ch.ProcessedTxObject{}
 		// sleep temporarily
-		time.Sleep(time.Minute * 4)
-		continue
+		if err := sleep(ctx, pollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// ProcessDepositPayment is used to process a dash based payment made directly to
+// a deposit address. The payment may be split across multiple transactions, each of
+// which must be confirmed, until the total value sent covers the charge amount or
+// the context, carrying the deadline of the payment, is cancelled
+func (dc *DashClient) ProcessDepositPayment(ctx context.Context, opts *ProcessPaymentOpts, l *zap.SugaredLogger) error {
+	var (
+		processedTransactions = make(map[string]bool)
+		totalAmountSent       float64
+	)
+	for {
+		l.Info("checking for txs sent to deposit address")
+		hashes, err := dc.Backend.AddressTransactions(opts.DepositAddress)
+		if err != nil {
+			return err
+		}
+		var toProcessTransactions []string
+		for _, hash := range hashes {
+			if !processedTransactions[hash] {
+				toProcessTransactions = append(toProcessTransactions, hash)
+			}
+		}
+		if len(toProcessTransactions) == 0 {
+			l.Infof("no new transactions detected, sleeping for %v minutes", pollInterval.Minutes())
+			if err := sleep(ctx, pollInterval); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, hash := range toProcessTransactions {
+			tx, err := dc.ProcessTransaction(ctx, hash, l)
+			if err != nil {
+				return err
+			}
+			totalAmountSent = totalAmountSent + getTotalValueOfTx(tx, opts.DepositAddress)
+			processedTransactions[hash] = true
+		}
+		if totalAmountSent >= opts.ChargeAmount {
+			l.Info("total amount sent is the total amount expected, finished processing")
+			return nil
+		}
+		l.Infow("funds received, but still less than total amount expected", "amount_received", totalAmountSent)
+		if err := sleep(ctx, pollInterval); err != nil {
+			return err
+		}
 	}
 }
 
-// ProcessTransaction is used to process a tx and wait for confirmations
-func (dc *DashClient) ProcessTransaction(txHash string, killTime time.Time, logger *zap.SugaredLogger) (*ch.TransactionByHashResponse, error) {
+// ProcessTransaction is used to process a tx and wait for confirmations,
+// until the context is cancelled
+func (dc *DashClient) ProcessTransaction(ctx context.Context, txHash string, logger *zap.SugaredLogger) (*Transaction, error) {
 	logger.Info("getting transaction hash to confirm")
-	tx, err := dc.C.TransactionByHash(txHash)
+	seen := dc.seenHeight()
+	tx, err := dc.Backend.Transaction(txHash)
 	if err != nil {
 		return nil, err
 	}
-	if tx.Confirmations >= dc.ConfirmationCount {
+	if dc.isConfirmed(tx) {
 		logger.Info("transaction is confirmed, validating lock time and returning")
 		return tx, dc.ValidateLockTime(tx.Locktime)
 	}
-	// determine time to sleep in minutes
-	// we multiply by 2 since 1 confirmation means 1 block, for which block time is 2 minutes
-	timeToSleep := time.Minute * time.Duration((dc.ConfirmationCount-tx.Confirmations)*2)
-	logger.Infof("transaction not yet confirmed, sleeping for %v minutes", timeToSleep.Minutes())
-	time.Sleep(timeToSleep)
+	if err := dc.waitForConfirmations(ctx, tx, seen, logger); err != nil {
+		return nil, err
+	}
 	for {
-		if time.Now().UnixNano() > killTime.UnixNano() {
-			return nil, errors.New("timeout occured while waiting for transaction")
-		}
 		logger.Info("getting transaction hash to confirm")
-		tx, err = dc.C.TransactionByHash(txHash)
+		seen = dc.seenHeight()
+		tx, err = dc.Backend.Transaction(txHash)
 		if err != nil {
 			return nil, err
 		}
-		if tx.Confirmations >= dc.ConfirmationCount {
+		if dc.isConfirmed(tx) {
 			logger.Info("transaction confirmed")
 			return tx, dc.ValidateLockTime(tx.Locktime)
 		}
-		timeToSleep := time.Minute * time.Duration((dc.ConfirmationCount-tx.Confirmations)*2)
-		logger.Infof("transaction not yet confirmed, sleeping for %v minutes", timeToSleep.Minutes())
-		time.Sleep(timeToSleep)
+		if err := dc.waitForConfirmations(ctx, tx, seen, logger); err != nil {
+			return nil, err
+		}
 	}
 }
 
+// TrackBlocks is used to poll the backend for new blocks on behalf of all payments
+// waiting on confirmations, so that they are checked once per block instead of each
+// sleeping for the expected confirmation time. Polling lasts until the context is cancelled
+func (dc *DashClient) TrackBlocks(ctx context.Context, l *zap.SugaredLogger) {
+	// fall back to checking once per block time if polling fails
+	dc.tracker = tracker.New(time.Minute * 2)
+	go dc.tracker.Run(ctx, l, &tracker.PollSource{
+		Interval: blockPollInterval,
+		Height: func(ctx context.Context) (uint64, error) {
+			height, err := dc.Backend.BlockHeight()
+			return uint64(height), err
+		},
+	})
+}
+
+// seenHeight returns the height of the last block seen by the tracker, if any
+func (dc *DashClient) seenHeight() uint64 {
+	if dc.tracker != nil {
+		return dc.tracker.Height()
+	}
+	return 0
+}
+
+// waitForConfirmations is used to wait for a block above the seen height if we are
+// tracking blocks, otherwise for the time the remaining confirmations are expected to
+// take. Either returns early with the error of the context once it is cancelled
+func (dc *DashClient) waitForConfirmations(ctx context.Context, tx *Transaction, seen uint64, logger *zap.SugaredLogger) error {
+	if dc.tracker != nil {
+		logger.Info("transaction not yet confirmed, waiting for next block")
+		return dc.tracker.Wait(ctx, seen)
+	}
+	// determine time to sleep in minutes
+	// we multiply by 2 since 1 confirmation means 1 block, for which block time is 2 minutes
+	timeToSleep := time.Minute * time.Duration((dc.ConfirmationCount-tx.Confirmations)*2)
+	logger.Infof("transaction not yet confirmed, sleeping for %v minutes", timeToSleep.Minutes())
+	return sleep(ctx, timeToSleep)
+}
+
 // ValidateLockTime is used to validate the given lock time compared to the current block height
 func (dc *DashClient) ValidateLockTime(locktime int) error {
-	blockHash, err := dc.C.GetLastBlockHash()
+	height, err := dc.Backend.BlockHeight()
 	if err != nil {
 		return err
 	}
-	block, err := dc.C.GetBlockByHash(blockHash.LastBlockHash)
-	if err != nil {
-		return err
-	}
-	if locktime > block.Height {
+	if locktime > height {
 		return errors.New("locktime is greater than block height")
 	}
 	return nil
 }
+
+// TxBlockHash is used to retrieve the hash of the block containing a transaction,
+// returning an empty hash once the transaction is no longer part of the active chain
+func (dc *DashClient) TxBlockHash(hash string) (string, error) {
+	tx, err := dc.Backend.Transaction(hash)
+	if err != nil && err.Error() == ErrTransactionNotFound {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	// transactions in blocks which have been reorged out have no confirmations
+	if tx.Confirmations <= 0 {
+		return "", nil
+	}
+	return tx.BlockHash, nil
+}
+
+// sleep is used to wait for the given duration, returning
+// early with the error of the context once it is cancelled
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isConfirmed is used to check whether a transaction has enough confirmations,
+// or has been locked through InstantSend in which case it can't be double spent
+func (dc *DashClient) isConfirmed(tx *Transaction) bool {
+	return tx.InstantLock || tx.Confirmations >= dc.ConfirmationCount
+}
+
+// getTotalValueOfTx returns the value in DASH of the outputs of a tx sent to the deposit address
+func getTotalValueOfTx(tx *Transaction, depositAddress string) float64 {
+	// total value measured in duffs
+	var totalValue int64
+	for _, output := range tx.Outputs {
+		// ensure we only account for outputs whose sole
+		// recipient is our deposit address
+		if len(output.Addresses) != 1 || output.Addresses[0] != depositAddress {
+			continue
+		}
+		totalValue = totalValue + output.Duffs
+	}
+	return float64(totalValue) / duffsPerDash
+}
@@ -0,0 +1,99 @@
+package dash
+
+import (
+	"context"
+	"errors"
+
+	"github.com/RTradeLtd/Pay/jsonrpc"
+)
+
+// rpcBackend is a Backend using the json-rpc interface of our own dashd node.
+// The node must run with txindex enabled to look up arbitrary transactions,
+// and with addressindex enabled to look up the transactions of an address
+type rpcBackend struct {
+	rpc *jsonrpc.Client
+}
+
+// newRPCBackend is used to instantiate our dashd backend
+func newRPCBackend(url string) (*rpcBackend, error) {
+	rpc, err := jsonrpc.NewClient(url)
+	if err != nil {
+		return nil, err
+	}
+	return &rpcBackend{rpc: rpc}, nil
+}
+
+// Transaction is used to retrieve a transaction through getrawtransaction
+func (rb *rpcBackend) Transaction(hash string) (*Transaction, error) {
+	var resp struct {
+		TxID          string `json:"txid"`
+		Locktime      int    `json:"locktime"`
+		Confirmations int    `json:"confirmations"`
+		BlockHash     string `json:"blockhash"`
+		InstantLock   bool   `json:"instantlock"`
+		ChainLock     bool   `json:"chainlock"`
+		Vout          []struct {
+			Value        float64 `json:"value"`
+			ScriptPubKey struct {
+				Addresses []string `json:"addresses"`
+			} `json:"scriptPubKey"`
+		} `json:"vout"`
+	}
+	err := rb.rpc.Call(context.Background(), "getrawtransaction", []interface{}{hash, 1}, &resp)
+	if jsonrpc.IsCode(err, jsonrpc.CodeInvalidAddressOrKey) {
+		return nil, errors.New(ErrTransactionNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+	tx := &Transaction{
+		Hash:          resp.TxID,
+		Confirmations: resp.Confirmations,
+		Locktime:      resp.Locktime,
+		BlockHash:     resp.BlockHash,
+		InstantLock:   resp.InstantLock || resp.ChainLock,
+	}
+	for _, vout := range resp.Vout {
+		tx.Outputs = append(tx.Outputs, Output{
+			Addresses: vout.ScriptPubKey.Addresses,
+			Duffs:     dashToDuffs(vout.Value),
+		})
+	}
+	return tx, nil
+}
+
+// BlockHeight is used to retrieve the current height of our node
+func (rb *rpcBackend) BlockHeight() (int, error) {
+	var height int
+	if err := rb.rpc.Call(context.Background(), "getblockcount", []interface{}{}, &height); err != nil {
+		return 0, err
+	}
+	return height, nil
+}
+
+// AddressTransactions is used to retrieve the transactions sent to an address,
+// both from the chain through getaddresstxids and from the mempool through getaddressmempool
+func (rb *rpcBackend) AddressTransactions(address string) ([]string, error) {
+	params := []interface{}{map[string][]string{"addresses": {address}}}
+	var hashes []string
+	if err := rb.rpc.Call(context.Background(), "getaddresstxids", params, &hashes); err != nil {
+		return nil, err
+	}
+	var mempool []struct {
+		TxID string `json:"txid"`
+	}
+	if err := rb.rpc.Call(context.Background(), "getaddressmempool", params, &mempool); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, hash := range hashes {
+		seen[hash] = true
+	}
+	for _, entry := range mempool {
+		// the mempool contains an entry per input and output of a tx
+		if !seen[entry.TxID] {
+			seen[entry.TxID] = true
+			hashes = append(hashes, entry.TxID)
+		}
+	}
+	return hashes, nil
+}
@@ -0,0 +1,319 @@
+package dash
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ch "github.com/RTradeLtd/ChainRider-Go/dash"
+	"github.com/RTradeLtd/Pay/log"
+	"github.com/RTradeLtd/config/v2"
+	"go.uber.org/zap"
+)
+
+var (
+	txHash = "c8bd7c3a4b2a1f5ad7b1a1c0cd0a1f8b37c4c1d2b8a5d6bfb0d0a1a57e3c9f21"
+)
+
+// fakeNode is a fake dashd json-rpc server
+type fakeNode struct {
+	height int
+	tx     string
+	// transactions by hash, falling back to tx if not present
+	txs map[string]string
+	// address transactions returned by successive getaddresstxids calls
+	addressTxs [][]string
+	mempool    []string
+	calls      int
+}
+
+func (fn *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	switch req.Method {
+	case "getblockcount":
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": fn.height})
+	case "getrawtransaction":
+		var hash string
+		json.Unmarshal(req.Params[0], &hash)
+		tx, ok := fn.txs[hash]
+		if !ok {
+			tx = fn.tx
+		}
+		// an empty transaction is one the node doesn't know about
+		if tx == "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"result":null,"error":{"code":-5,"message":"No such mempool or blockchain transaction"}}`))
+			return
+		}
+		w.Write([]byte(`{"result":` + tx + `}`))
+	case "getaddresstxids":
+		hashes := fn.addressTxs[fn.calls]
+		if fn.calls < len(fn.addressTxs)-1 {
+			fn.calls++
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": hashes})
+	case "getaddressmempool":
+		var entries []map[string]string
+		for _, hash := range fn.mempool {
+			entries = append(entries, map[string]string{"txid": hash})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": entries})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"code":-32601,"message":"Method not found"}}`))
+	}
+}
+
+func newFakeClient(t *testing.T, fn *fakeNode) (*DashClient, func()) {
+	srv := httptest.NewServer(fn)
+	backend, err := newRPCBackend("http://user:pass@" + srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &DashClient{Backend: backend, ConfirmationCount: prodConfirmationCount}, srv.Close
+}
+
+func Test_RPCBackend_Transaction(t *testing.T) {
+	c, done := newFakeClient(t, &fakeNode{tx: `{"txid":"abc","locktime":10,"confirmations":2,"blockhash":"def","instantlock":true,"vout":[
+		{"value":0.1,"scriptPubKey":{"addresses":["world"]}},
+		{"value":1.23456789,"scriptPubKey":{"addresses":["hello"]}}
+	]}`})
+	defer done()
+	tx, err := c.Backend.Transaction(txHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Hash != "abc" || tx.Locktime != 10 || tx.Confirmations != 2 || tx.BlockHash != "def" || !tx.InstantLock {
+		t.Fatal("bad transaction returned", tx)
+	}
+	if len(tx.Outputs) != 2 || tx.Outputs[0].Duffs != 10000000 || tx.Outputs[1].Duffs != 123456789 {
+		t.Fatal("bad outputs returned", tx.Outputs)
+	}
+}
+
+func Test_TxBlockHash(t *testing.T) {
+	tests := []struct {
+		name string
+		tx   string
+		want string
+	}{
+		{"confirmed", `{"txid":"abc","confirmations":2,"blockhash":"def"}`, "def"},
+		{"reorged", `{"txid":"abc","confirmations":0,"blockhash":"def"}`, ""},
+		{"dropped", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := newFakeClient(t, &fakeNode{tx: tt.tx})
+			defer done()
+			hash, err := c.TxBlockHash(txHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hash != tt.want {
+				t.Fatalf("TxBlockHash() = %v, want %v", hash, tt.want)
+			}
+		})
+	}
+}
+
+func Test_IsConfirmed(t *testing.T) {
+	tests := []struct {
+		name string
+		tx   Transaction
+		want bool
+	}{
+		{"confirmations", Transaction{Confirmations: prodConfirmationCount}, true},
+		{"instantlock", Transaction{InstantLock: true}, true},
+		{"unconfirmed", Transaction{Confirmations: 1}, false},
+	}
+	dc := &DashClient{ConfirmationCount: prodConfirmationCount}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dc.isConfirmed(&tt.tx); got != tt.want {
+				t.Fatalf("isConfirmed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ProcessTransaction_InstantLock(t *testing.T) {
+	logger, err := log.NewLogger("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		tx      string
+		wantErr bool
+	}{
+		{"success", `{"txid":"abc","locktime":500,"confirmations":0,"instantlock":true}`, false},
+		{"chainlock", `{"txid":"abc","locktime":500,"confirmations":1,"chainlock":true}`, false},
+		{"locktime", `{"txid":"abc","locktime":700,"confirmations":0,"instantlock":true}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := newFakeClient(t, &fakeNode{height: 600, tx: tt.tx})
+			defer done()
+			// an instantsend locked tx should return without waiting for confirmations
+			_, err := c.ProcessTransaction(context.Background(), txHash, logger)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ProcessTransaction() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_GetTotalValueOfTx(t *testing.T) {
+	tx := &Transaction{Outputs: []Output{
+		{Addresses: []string{"world"}, Duffs: 10000000},
+		{Addresses: []string{"world"}, Duffs: 20000000},
+		{Addresses: []string{"world", "hello"}, Duffs: 500000000},
+		{Addresses: []string{"hello"}, Duffs: 700000000},
+	}}
+	if value := getTotalValueOfTx(tx, "world"); value != 0.3 {
+		t.Fatal("bad value returned", value)
+	}
+}
+
+func Test_RPCBackend_AddressTransactions(t *testing.T) {
+	c, done := newFakeClient(t, &fakeNode{
+		addressTxs: [][]string{{"a", "b"}},
+		mempool:    []string{"b", "c", "c"},
+	})
+	defer done()
+	hashes, err := c.Backend.AddressTransactions("world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 3 || hashes[0] != "a" || hashes[1] != "b" || hashes[2] != "c" {
+		t.Fatal("bad hashes returned", hashes)
+	}
+}
+
+func Test_ProcessDepositPayment(t *testing.T) {
+	pollInterval = time.Millisecond
+	logger, err := log.NewLogger("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the payment is split across two transactions, the second
+	// of which is only seen after the first has been processed
+	c, done := newFakeClient(t, &fakeNode{
+		height: 600,
+		txs: map[string]string{
+			"a": `{"txid":"a","confirmations":6,"vout":[{"value":0.5,"scriptPubKey":{"addresses":["world"]}}]}`,
+			"b": `{"txid":"b","confirmations":0,"instantlock":true,"vout":[
+				{"value":0.25,"scriptPubKey":{"addresses":["world"]}},
+				{"value":9,"scriptPubKey":{"addresses":["hello"]}}
+			]}`,
+		},
+		addressTxs: [][]string{{}, {"a"}, {"a"}, {"a", "b"}},
+	})
+	defer done()
+	if err := c.ProcessDepositPayment(context.Background(), &ProcessPaymentOpts{
+		Number:         1,
+		ChargeAmount:   0.75,
+		DepositAddress: "world",
+	}, logger); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_ProcessDepositPayment_Cancelled(t *testing.T) {
+	pollInterval = time.Hour
+	logger, err := log.NewLogger("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, done := newFakeClient(t, &fakeNode{height: 600, addressTxs: [][]string{{}}})
+	defer done()
+	// the payment deadline is honoured while polling for transactions
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	if err := c.ProcessDepositPayment(ctx, &ProcessPaymentOpts{
+		Number:         1,
+		ChargeAmount:   0.75,
+		DepositAddress: "world",
+	}, logger); err != context.DeadlineExceeded {
+		t.Fatalf("ProcessDepositPayment() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func Test_NewDashClient_Backend(t *testing.T) {
+	cfg := &config.TemporalConfig{}
+	if _, err := NewDashClient(cfg, Opts{Backend: BackendDashd}); err == nil {
+		t.Fatal("expected error selecting dashd without a json-rpc url")
+	}
+	if _, err := NewDashClient(cfg, Opts{Backend: "insight"}); err == nil {
+		t.Fatal("expected error selecting an unsupported backend")
+	}
+	dc, err := NewDashClient(cfg, Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := dc.Backend.(*chainRiderBackend); !ok {
+		t.Fatal("chainrider should be the default backend")
+	}
+}
+
+func Test_TrackBlocks(t *testing.T) {
+	blockPollInterval = time.Millisecond
+	c, done := newFakeClient(t, &fakeNode{height: 600})
+	defer done()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.TrackBlocks(ctx, zap.NewNop().Sugar())
+	for height := c.tracker.Height(); height != 600; height = c.tracker.Height() {
+		if err := c.tracker.Wait(ctx, height); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_ChainRiderTransaction(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    string
+		wantErr string
+	}{
+		{"found", http.StatusOK, `{"txid":"abc","confirmations":2,"blockhash":"def","vout":[]}`, "def", ""},
+		{"not found", http.StatusNotFound, "Not found", "", ErrTransactionNotFound},
+		// an outage must not be mistaken for an unknown transaction
+		{"outage", http.StatusBadGateway, "Bad Gateway", "", "chainrider returned status 502: Bad Gateway"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			cb := &chainRiderBackend{c: &ch.Client{URL: srv.URL, HC: srv.Client()}}
+			tx, err := cb.Transaction(txHash)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Transaction() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tx.BlockHash != tt.want {
+				t.Fatalf("Transaction() block hash = %v, want %v", tx.BlockHash, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+// Package deposit is used to derive per-payment deposit addresses for utxo based
+// blockchains from an account level extended public key (xpub). Only the xpub is
+// ever present on the payment processor, so funds can't be spent from it.
+// Addresses are derived from the external chain of the account, ie m/0/index
+package deposit
+
+import (
+	"errors"
+
+	"github.com/gcash/bchd/chaincfg"
+	"github.com/gcash/bchutil"
+	"github.com/gcash/bchutil/base58"
+	"github.com/gcash/bchutil/hdkeychain"
+)
+
+const (
+	// BCH is the blockchain name for bitcoin cash
+	BCH = "bch"
+	// BTC is the blockchain name for bitcoin
+	BTC = "btc"
+	// DASH is the blockchain name for dash
+	DASH = "dash"
+)
+
+var (
+	// ErrPrivateKey is an error used to indicate an extended private key was provided
+	ErrPrivateKey = "extended key must be a public key"
+	// ErrUnsupportedBlockchain is an error used to indicate the blockchain is not supported
+	ErrUnsupportedBlockchain = "unsupported blockchain"
+	// ErrIndexOutOfRange is an error used to indicate the index would require hardened derivation
+	ErrIndexOutOfRange = "derivation index out of range"
+)
+
+// p2pkh address versions for base58 encoded addresses
+var legacyVersions = map[string]struct{ main, test byte }{
+	BTC:  {0x00, 0x6f},
+	DASH: {0x4c, 0x8c},
+}
+
+// Deriver is used to derive deposit addresses for a single blockchain
+type Deriver struct {
+	blockchain string
+	// external is the external chain of the account, m/0
+	external *hdkeychain.ExtendedKey
+	devMode  bool
+}
+
+// NewDeriver is used to instantiate our deposit address deriver from an account xpub.
+// When in dev mode, testnet addresses are derived
+func NewDeriver(blockchain, xpub string, devMode bool) (*Deriver, error) {
+	if _, ok := legacyVersions[blockchain]; !ok && blockchain != BCH {
+		return nil, errors.New(ErrUnsupportedBlockchain)
+	}
+	key, err := hdkeychain.NewKeyFromString(xpub)
+	if err != nil {
+		return nil, err
+	}
+	if key.IsPrivate() {
+		return nil, errors.New(ErrPrivateKey)
+	}
+	external, err := key.Child(0)
+	if err != nil {
+		return nil, err
+	}
+	return &Deriver{blockchain: blockchain, external: external, devMode: devMode}, nil
+}
+
+// Blockchain returns the blockchain addresses are derived for
+func (d *Deriver) Blockchain() string {
+	return d.blockchain
+}
+
+// Address is used to derive the address at the given index of the external chain.
+// In the unlikely event the key at the index is invalid, hdkeychain.ErrInvalidChild
+// is returned and the next index should be used
+func (d *Deriver) Address(index uint32) (string, error) {
+	if index >= hdkeychain.HardenedKeyStart {
+		return "", errors.New(ErrIndexOutOfRange)
+	}
+	child, err := d.external.Child(index)
+	if err != nil {
+		return "", err
+	}
+	pub, err := child.ECPubKey()
+	if err != nil {
+		return "", err
+	}
+	return d.encode(bchutil.Hash160(pub.SerializeCompressed()))
+}
+
+// Next is used to derive the address at the given index, or if the key at the
+// index is invalid, at the next valid index. The index used is returned
+func (d *Deriver) Next(index uint32) (uint32, string, error) {
+	for {
+		addr, err := d.Address(index)
+		if err == hdkeychain.ErrInvalidChild {
+			index++
+			continue
+		}
+		return index, addr, err
+	}
+}
+
+// encode is used to encode a pubkey hash as a p2pkh address
+func (d *Deriver) encode(pkHash []byte) (string, error) {
+	if d.blockchain == BCH {
+		params := &chaincfg.MainNetParams
+		if d.devMode {
+			params = &chaincfg.TestNet3Params
+		}
+		addr, err := bchutil.NewAddressPubKeyHash(pkHash, params)
+		if err != nil {
+			return "", err
+		}
+		// bchd reports output addresses as cashaddr without a prefix
+		return addr.EncodeAddress(), nil
+	}
+	version := legacyVersions[d.blockchain].main
+	if d.devMode {
+		version = legacyVersions[d.blockchain].test
+	}
+	return base58.CheckEncode(pkHash, version), nil
+}
@@ -0,0 +1,142 @@
+package deposit
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/gcash/bchd/chaincfg"
+	"github.com/gcash/bchutil"
+	"github.com/gcash/bchutil/base58"
+	"github.com/gcash/bchutil/hdkeychain"
+)
+
+var (
+	// bip32 test vector 1
+	seed = "000102030405060708090a0b0c0d0e0f"
+	// m/0H of test vector 1
+	xpub = "xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw"
+	// identifier of the master key of test vector 1
+	masterID = "3442193e1bb70916e914552172cd4e2dbc9df811"
+)
+
+func Test_Encode(t *testing.T) {
+	pkHash, err := hex.DecodeString(masterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// btc
+	addr, err := (&Deriver{blockchain: BTC}).encode(pkHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "15mKKb2eos1hWa6tisdPwwDC1a5J1y9nma" {
+		t.Fatal("bad btc address", addr)
+	}
+	// dash
+	addr, err = (&Deriver{blockchain: DASH}).encode(pkHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, version, err := base58.CheckDecode(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 0x4c || hex.EncodeToString(decoded) != masterID || addr[0] != 'X' {
+		t.Fatal("bad dash address", addr)
+	}
+	// bch
+	addr, err = (&Deriver{blockchain: BCH}).encode(pkHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cashAddr, err := bchutil.DecodeAddress(addr, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(cashAddr.ScriptAddress()) != masterID {
+		t.Fatal("bad bch address", addr)
+	}
+}
+
+func Test_Address(t *testing.T) {
+	seedBytes, err := hex.DecodeString(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, err := hdkeychain.NewMaster(seedBytes, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := master.Child(hdkeychain.HardenedKeyStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	external, err := account.Child(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDeriver(BTC, xpub, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for index := uint32(0); index < 5; index++ {
+		addr, err := d.Address(index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[addr] {
+			t.Fatal("address derived twice", addr)
+		}
+		seen[addr] = true
+		// the address derived from the xpub must match the one derived from the private key
+		child, err := external.Child(index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := child.Address(&chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr != base58.CheckEncode(want.ScriptAddress(), 0x00) {
+			t.Fatal("public derivation does not match private derivation")
+		}
+	}
+	if _, err := d.Address(hdkeychain.HardenedKeyStart); err == nil || err.Error() != ErrIndexOutOfRange {
+		t.Fatal("expected index out of range error")
+	}
+}
+
+func Test_NewDeriver(t *testing.T) {
+	seedBytes, err := hex.DecodeString(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, err := hdkeychain.NewMaster(seedBytes, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		blockchain string
+		key        string
+		wantErr    string
+	}{
+		{"bch", BCH, xpub, ""},
+		{"btc", BTC, xpub, ""},
+		{"dash", DASH, xpub, ""},
+		{"private", BTC, master.String(), ErrPrivateKey},
+		{"unsupported", "ltc", xpub, ErrUnsupportedBlockchain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDeriver(tt.blockchain, tt.key, false)
+			if (err != nil) != (tt.wantErr != "") {
+				t.Fatalf("NewDeriver() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && err.Error() != tt.wantErr {
+				t.Fatal("wrong error message returned", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package ethereum
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gcash/bchd/chaincfg"
+	"github.com/gcash/bchutil"
+	"github.com/gcash/bchutil/base58"
+	"github.com/gcash/bchutil/bech32"
+)
+
+const (
+	// CoinTypeBTC is the SLIP-44 coin type of bitcoin
+	CoinTypeBTC = uint64(0)
+	// CoinTypeDASH is the SLIP-44 coin type of dash
+	CoinTypeDASH = uint64(5)
+	// CoinTypeETH is the SLIP-44 coin type of ethereum
+	CoinTypeETH = uint64(60)
+	// CoinTypeBCH is the SLIP-44 coin type of bitcoin cash
+	CoinTypeBCH = uint64(145)
+
+	// ErrUnsupportedCoinType is an error used to indicate that
+	// addresses of a coin type can't be set as address records
+	ErrUnsupportedCoinType = "unsupported coin type"
+	// ErrInvalidAddress is an error used to indicate that an
+	// address is not a valid mainnet address of its coin type
+	ErrInvalidAddress = "invalid address for coin type"
+)
+
+// base58 address versions of p2pkh and p2sh mainnet addresses
+var base58Versions = map[uint64]struct{ p2pkh, p2sh byte }{
+	CoinTypeBTC:  {0x00, 0x05},
+	CoinTypeDASH: {0x4c, 0x10},
+}
+
+// EncodeCoinAddress is used to encode an address into the binary format stored by
+// EIP-2304 address records. Ethereum addresses are stored as their 20 bytes, while
+// addresses of utxo based blockchains are stored as their output script
+func EncodeCoinAddress(coinType uint64, address string) ([]byte, error) {
+	switch coinType {
+	case CoinTypeETH:
+		if !common.IsHexAddress(address) {
+			return nil, errors.New(ErrInvalidAddress)
+		}
+		return common.HexToAddress(address).Bytes(), nil
+	case CoinTypeBCH:
+		if !strings.HasPrefix(strings.ToLower(address), "bitcoincash:") {
+			address = "bitcoincash:" + address
+		}
+		decoded, err := bchutil.DecodeAddress(address, &chaincfg.MainNetParams)
+		if err != nil || !decoded.IsForNet(&chaincfg.MainNetParams) {
+			return nil, errors.New(ErrInvalidAddress)
+		}
+		switch decoded.(type) {
+		case *bchutil.AddressPubKeyHash:
+			return p2pkhScript(decoded.ScriptAddress()), nil
+		case *bchutil.AddressScriptHash:
+			return p2shScript(decoded.ScriptAddress()), nil
+		}
+		return nil, errors.New(ErrInvalidAddress)
+	case CoinTypeBTC, CoinTypeDASH:
+		if coinType == CoinTypeBTC && strings.HasPrefix(strings.ToLower(address), "bc1") {
+			return segwitScript(address)
+		}
+		hash, version, err := base58.CheckDecode(address)
+		if err != nil || len(hash) != 20 {
+			return nil, errors.New(ErrInvalidAddress)
+		}
+		switch version {
+		case base58Versions[coinType].p2pkh:
+			return p2pkhScript(hash), nil
+		case base58Versions[coinType].p2sh:
+			return p2shScript(hash), nil
+		}
+		return nil, errors.New(ErrInvalidAddress)
+	default:
+		return nil, errors.New(ErrUnsupportedCoinType)
+	}
+}
+
+// segwitScript is used to encode a bech32 bitcoin address as its witness output script
+func segwitScript(address string) ([]byte, error) {
+	hrp, data, err := bech32.Decode(address)
+	if err != nil || hrp != "bc" || len(data) < 1 || data[0] > 16 {
+		return nil, errors.New(ErrInvalidAddress)
+	}
+	program, err := bech32.ConvertBits(data[1:], 5, 8, false)
+	if err != nil || len(program) < 2 || len(program) > 40 {
+		return nil, errors.New(ErrInvalidAddress)
+	}
+	// version 0 programs are pay to witness public key hash or script hash
+	if data[0] == 0 && len(program) != 20 && len(program) != 32 {
+		return nil, errors.New(ErrInvalidAddress)
+	}
+	version := data[0]
+	if version > 0 {
+		// OP_1 through OP_16
+		version += 0x50
+	}
+	return append([]byte{version, byte(len(program))}, program...), nil
+}
+
+// p2pkhScript returns the pay to public key hash output script of a hash160, ie
+// OP_DUP OP_HASH160 <hash> OP_EQUALVERIFY OP_CHECKSIG
+func p2pkhScript(hash []byte) []byte {
+	return append(append([]byte{0x76, 0xa9, 0x14}, hash...), 0x88, 0xac)
+}
+
+// p2shScript returns the pay to script hash output script of a hash160, ie
+// OP_HASH160 <hash> OP_EQUAL
+func p2shScript(hash []byte) []byte {
+	return append(append([]byte{0xa9, 0x14}, hash...), 0x87)
+}
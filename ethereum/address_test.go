@@ -0,0 +1,47 @@
+package ethereum
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/gcash/bchutil/base58"
+)
+
+func Test_EncodeCoinAddress(t *testing.T) {
+	hash, err := hex.DecodeString("62e907b15cbf27d5425399ebf6f0fb50ebb88f18")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// test vectors from EIP-2304
+	tests := []struct {
+		name     string
+		coinType uint64
+		address  string
+		want     string
+		wantErr  bool
+	}{
+		{"BTC-P2PKH", CoinTypeBTC, "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", "76a91462e907b15cbf27d5425399ebf6f0fb50ebb88f1888ac", false},
+		{"BTC-P2SH", CoinTypeBTC, "3Ai1JZ8pdJb2ksieUV8FsxSNVJCpoPi8W6", "a91462e907b15cbf27d5425399ebf6f0fb50ebb88f1887", false},
+		{"BTC-P2WPKH", CoinTypeBTC, "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", "0014751e76e8199196d454941c45d1b3a323f1433bd6", false},
+		{"BTC-BadChecksum", CoinTypeBTC, "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb", "", true},
+		{"BTC-Testnet", CoinTypeBTC, "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", "", true},
+		{"BCH", CoinTypeBCH, "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a", "76a91476a04053bda0a88bda5177b86a15c3b29f55987388ac", false},
+		{"BCH-NoPrefix", CoinTypeBCH, "qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a", "76a91476a04053bda0a88bda5177b86a15c3b29f55987388ac", false},
+		{"DASH", CoinTypeDASH, base58.CheckEncode(hash, 0x4c), "76a91462e907b15cbf27d5425399ebf6f0fb50ebb88f1888ac", false},
+		{"DASH-BitcoinAddress", CoinTypeDASH, "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", "", true},
+		{"ETH", CoinTypeETH, "0x314159265dD8dbb310642f98f50C066173C1259b", "314159265dd8dbb310642f98f50c066173c1259b", false},
+		{"ETH-Invalid", CoinTypeETH, "0x1234", "", true},
+		{"Unsupported", 2, "LaMT348PWRnrqeeWArpwQPbuanpXDZGEUz", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EncodeCoinAddress(tt.coinType, tt.address)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EncodeCoinAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if hex.EncodeToString(got) != tt.want {
+				t.Fatalf("EncodeCoinAddress() = %x, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package ethereum
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	ens "github.com/wealdtech/go-ens/v3"
+	"github.com/wealdtech/go-ens/v3/contracts/resolver"
+)
+
+// multicallABI is the abi of the multicall method of newer public resolvers,
+// which our resolver bindings predate
+const multicallABI = `[{"constant":false,"inputs":[
+	{"name":"data","type":"bytes[]"}
+],"name":"multicall","outputs":[
+	{"name":"results","type":"bytes[]"}
+],"payable":false,"stateMutability":"nonpayable","type":"function"}]`
+
+// multicallInterfaceID is the EIP-165 interface id of resolvers supporting multicall
+var multicallInterfaceID = [4]byte{0xac, 0x96, 0x50, 0xd8}
+
+var (
+	// resolverContract is the parsed abi of the public resolver
+	resolverContract abi.ABI
+	// multicallContract is the parsed abi of the resolver multicall method
+	multicallContract abi.ABI
+)
+
+func init() {
+	var err error
+	if resolverContract, err = abi.JSON(strings.NewReader(resolver.ContractABI)); err != nil {
+		panic(err)
+	}
+	if multicallContract, err = abi.JSON(strings.NewReader(multicallABI)); err != nil {
+		panic(err)
+	}
+}
+
+// RecordUpdate is an update to a record of a particular *.ipfstemporal.eth subdomain,
+// which may be batched with the updates of other subdomains sharing its resolver
+type RecordUpdate struct {
+	// Name is the subdomain being updated
+	Name string
+	// Operation names the update when recording its transaction
+	Operation string
+	resolver  *ens.Resolver
+	method    string
+	args      []interface{}
+	// verify checks the update once mined, and is ignored if nil
+	verify func() error
+}
+
+// ContentHashUpdate is used to create an update of the ipfs content hash of a
+// particular *.ipfstemporal.eth subdomain. The hash is encoded as an EIP-1577
+// contenthash, and read back once the update is mined
+func (c *Client) ContentHashUpdate(subName, parentName, hash string) (*RecordUpdate, error) {
+	contenthash, err := EncodeContenthash(hash)
+	if err != nil {
+		return nil, err
+	}
+	update, err := c.recordUpdate(subName, parentName, "update-content-hash", "setContenthash", contenthash)
+	if err != nil {
+		return nil, err
+	}
+	update.verify = func() error {
+		set, err := update.resolver.Contenthash()
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(set, contenthash) {
+			return errors.New(ErrContenthashMismatch)
+		}
+		return nil
+	}
+	return update, nil
+}
+
+// TextUpdate is used to create an update of a text record of a particular *.ipfstemporal.eth subdomain
+func (c *Client) TextUpdate(subName, parentName, key, value string) (*RecordUpdate, error) {
+	if !TextRecordKeys[key] {
+		return nil, errors.New(ErrUnsupportedTextKey)
+	}
+	return c.recordUpdate(subName, parentName, "set-text", "setText", key, value)
+}
+
+// CoinAddressUpdate is used to create an update of the address record of
+// a coin type, for a particular *.ipfstemporal.eth subdomain
+func (c *Client) CoinAddressUpdate(subName, parentName string, coinType uint64, address string) (*RecordUpdate, error) {
+	encoded, err := EncodeCoinAddress(coinType, address)
+	if err != nil {
+		return nil, err
+	}
+	// setAddr is overloaded, with the coin type variant bound as setAddr0
+	return c.recordUpdate(
+		subName, parentName, "set-coin-address", "setAddr0", new(big.Int).SetUint64(coinType), encoded)
+}
+
+// ApplyUpdates is used to apply record updates, returning the error of each update.
+// Updates of subdomains sharing a resolver which supports multicall are sent as a
+// single transaction. Should the batch fail, its updates are sent individually
+// so that a single bad update only fails its own request
+func (c *Client) ApplyUpdates(ctx context.Context, updates []*RecordUpdate) []error {
+	var (
+		errs    = make([]error, len(updates))
+		batches = make(map[common.Address][]int)
+		order   []common.Address
+	)
+	for i, update := range updates {
+		addr := update.resolver.ContractAddr
+		if _, ok := batches[addr]; !ok {
+			order = append(order, addr)
+		}
+		batches[addr] = append(batches[addr], i)
+	}
+	var wg sync.WaitGroup
+	for _, addr := range order {
+		wg.Add(1)
+		go func(indexes []int) {
+			defer wg.Done()
+			c.applyBatch(ctx, updates, indexes, errs)
+		}(batches[addr])
+	}
+	wg.Wait()
+	return errs
+}
+
+// applyBatch is used to apply the updates sharing a resolver, recording their errors
+func (c *Client) applyBatch(ctx context.Context, updates []*RecordUpdate, indexes []int, errs []error) {
+	if len(indexes) > 1 && c.supportsMulticall(updates[indexes[0]].resolver) {
+		err := c.multicall(ctx, updates, indexes)
+		if err == nil {
+			for _, i := range indexes {
+				if updates[i].verify != nil {
+					errs[i] = updates[i].verify()
+				}
+			}
+			return
+		}
+		// a cancelled batch was never mined, and its updates would likely get stuck again
+		if err.Error() == ErrTxCancelled {
+			for _, i := range indexes {
+				errs[i] = err
+			}
+			return
+		}
+	}
+	// updates are sent in order, so that later updates of a record win
+	for _, i := range indexes {
+		errs[i] = c.applyUpdate(ctx, updates[i])
+	}
+}
+
+// multicall is used to send the updates sharing a resolver as a single transaction
+func (c *Client) multicall(ctx context.Context, updates []*RecordUpdate, indexes []int) error {
+	batch := make([]*RecordUpdate, 0, len(indexes))
+	for _, i := range indexes {
+		batch = append(batch, updates[i])
+	}
+	calls, err := encodeCalls(batch)
+	if err != nil {
+		return err
+	}
+	contract := bind.NewBoundContract(batch[0].resolver.ContractAddr, multicallContract, c.ETH, c.ETH, c.ETH)
+	return c.sendTx(ctx, "multicall", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return contract.Transact(opts, "multicall", calls)
+	})
+}
+
+// applyUpdate is used to send a single update, verifying it once mined
+func (c *Client) applyUpdate(ctx context.Context, update *RecordUpdate) error {
+	contract := bind.NewBoundContract(update.resolver.ContractAddr, resolverContract, c.ETH, c.ETH, c.ETH)
+	if err := c.sendTx(ctx, update.Operation, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return contract.Transact(opts, update.method, update.args...)
+	}); err != nil {
+		return err
+	}
+	if update.verify != nil {
+		return update.verify()
+	}
+	return nil
+}
+
+// supportsMulticall is used to check whether a resolver supports multicall,
+// treating resolvers which can't tell us as not supporting it
+func (c *Client) supportsMulticall(r *ens.Resolver) bool {
+	ok, err := r.Contract.SupportsInterface(nil, multicallInterfaceID)
+	return err == nil && ok
+}
+
+// recordUpdate is used to create an update calling a resolver method for a subdomain
+func (c *Client) recordUpdate(subName, parentName, operation, method string, args ...interface{}) (*RecordUpdate, error) {
+	name := c.GetCombinedName(subName, parentName)
+	r, err := ens.NewResolver(c.ETH, name)
+	if err != nil {
+		return nil, err
+	}
+	node, err := ens.NameHash(name)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordUpdate{
+		Name:      name,
+		Operation: operation,
+		resolver:  r,
+		method:    method,
+		args:      append([]interface{}{node}, args...),
+	}, nil
+}
+
+// encodeCalls is used to encode updates as the resolver calls of a multicall
+func encodeCalls(updates []*RecordUpdate) ([][]byte, error) {
+	calls := make([][]byte, 0, len(updates))
+	for _, update := range updates {
+		call, err := resolverContract.Pack(update.method, update.args...)
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, call)
+	}
+	return calls, nil
+}
@@ -0,0 +1,51 @@
+package ethereum
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	ens "github.com/wealdtech/go-ens/v3"
+)
+
+func Test_MulticallInterfaceID(t *testing.T) {
+	// the interface of a single method is identified by its selector
+	if id := multicallContract.Methods["multicall"].ID(); !bytes.Equal(id, multicallInterfaceID[:]) {
+		t.Fatalf("multicall selector %x, want %x", id, multicallInterfaceID)
+	}
+}
+
+func Test_EncodeCalls(t *testing.T) {
+	node, err := ens.NameHash("test.ipfstemporal.eth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates := []*RecordUpdate{
+		{method: "setContenthash", args: []interface{}{node, []byte{0xe3, 0x01}}},
+		{method: "setText", args: []interface{}{node, "url", "https://example.com"}},
+		{method: "setAddr0", args: []interface{}{node, big.NewInt(int64(CoinTypeBTC)), []byte{0x76, 0xa9}}},
+	}
+	calls, err := encodeCalls(updates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != len(updates) {
+		t.Fatalf("encoded %v calls, want %v", len(calls), len(updates))
+	}
+	for i, update := range updates {
+		if id := resolverContract.Methods[update.method].ID(); !bytes.Equal(calls[i][:4], id) {
+			t.Fatalf("call %v selector %x, want %x", i, calls[i][:4], id)
+		}
+		if !bytes.Equal(calls[i][4:36], node[:]) {
+			t.Fatalf("call %v is not for the subdomain node", i)
+		}
+	}
+	if _, err := multicallContract.Pack("multicall", calls); err != nil {
+		t.Fatal(err)
+	}
+	// a call the resolver doesn't support fails the encoding of the batch
+	updates = append(updates, &RecordUpdate{method: "setText", args: []interface{}{node}})
+	if _, err := encodeCalls(updates); err == nil {
+		t.Fatal("expected error encoding bad call")
+	}
+}
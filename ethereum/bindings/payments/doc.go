@@ -0,0 +1,5 @@
+// Package payments is the go binding of the payment contract, generated by abigen
+// from Payments.abi through `make gen`. Payments.abi must be kept in sync with the
+// abi exported when the payment contract is compiled, and the binding regenerated
+// whenever it changes
+package payments
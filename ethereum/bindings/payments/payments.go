@@ -0,0 +1,345 @@
+// Code generated - DO NOT EDIT.
+// This file is a generated binding and any manual changes will be lost.
+
+package payments
+
+import (
+	"math/big"
+	"strings"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var (
+	_ = big.NewInt
+	_ = strings.NewReader
+	_ = ethereum.NotFound
+	_ = abi.U256
+	_ = bind.Bind
+	_ = common.Big1
+	_ = types.BloomLookup
+	_ = event.NewSubscription
+)
+
+// PaymentsABI is the input ABI used to generate the binding from.
+const PaymentsABI = "[{\"anonymous\":false,\"inputs\":[{\"indexed\":true,\"name\":\"payer\",\"type\":\"address\"},{\"indexed\":false,\"name\":\"paymentNumber\",\"type\":\"uint256\"},{\"indexed\":false,\"name\":\"paymentMethod\",\"type\":\"uint8\"},{\"indexed\":false,\"name\":\"chargeAmountInWei\",\"type\":\"uint256\"}],\"name\":\"PaymentMade\",\"type\":\"event\"},{\"constant\":true,\"inputs\":[{\"name\":\"_signer\",\"type\":\"address\"}],\"name\":\"isSigner\",\"outputs\":[{\"name\":\"\",\"type\":\"bool\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"}]"
+
+// Payments is an auto generated Go binding around an Ethereum contract.
+type Payments struct {
+	PaymentsCaller     // Read-only binding to the contract
+	PaymentsTransactor // Write-only binding to the contract
+	PaymentsFilterer   // Log filterer for contract events
+}
+
+// PaymentsCaller is an auto generated read-only Go binding around an Ethereum contract.
+type PaymentsCaller struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// PaymentsTransactor is an auto generated write-only Go binding around an Ethereum contract.
+type PaymentsTransactor struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// PaymentsFilterer is an auto generated log filtering Go binding around an Ethereum contract events.
+type PaymentsFilterer struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// PaymentsSession is an auto generated Go binding around an Ethereum contract,
+// with pre-set call and transact options.
+type PaymentsSession struct {
+	Contract     *Payments         // Generic contract binding to set the session for
+	CallOpts     bind.CallOpts     // Call options to use throughout this session
+	TransactOpts bind.TransactOpts // Transaction auth options to use throughout this session
+}
+
+// PaymentsCallerSession is an auto generated read-only Go binding around an Ethereum contract,
+// with pre-set call options.
+type PaymentsCallerSession struct {
+	Contract *PaymentsCaller // Generic contract caller binding to set the session for
+	CallOpts bind.CallOpts   // Call options to use throughout this session
+}
+
+// PaymentsTransactorSession is an auto generated write-only Go binding around an Ethereum contract,
+// with pre-set transact options.
+type PaymentsTransactorSession struct {
+	Contract     *PaymentsTransactor // Generic contract transactor binding to set the session for
+	TransactOpts bind.TransactOpts   // Transaction auth options to use throughout this session
+}
+
+// PaymentsRaw is an auto generated low-level Go binding around an Ethereum contract.
+type PaymentsRaw struct {
+	Contract *Payments // Generic contract binding to access the raw methods on
+}
+
+// PaymentsCallerRaw is an auto generated low-level read-only Go binding around an Ethereum contract.
+type PaymentsCallerRaw struct {
+	Contract *PaymentsCaller // Generic read-only contract binding to access the raw methods on
+}
+
+// PaymentsTransactorRaw is an auto generated low-level write-only Go binding around an Ethereum contract.
+type PaymentsTransactorRaw struct {
+	Contract *PaymentsTransactor // Generic write-only contract binding to access the raw methods on
+}
+
+// NewPayments creates a new instance of Payments, bound to a specific deployed contract.
+func NewPayments(address common.Address, backend bind.ContractBackend) (*Payments, error) {
+	contract, err := bindPayments(address, backend, backend, backend)
+	if err != nil {
+		return nil, err
+	}
+	return &Payments{PaymentsCaller: PaymentsCaller{contract: contract}, PaymentsTransactor: PaymentsTransactor{contract: contract}, PaymentsFilterer: PaymentsFilterer{contract: contract}}, nil
+}
+
+// NewPaymentsCaller creates a new read-only instance of Payments, bound to a specific deployed contract.
+func NewPaymentsCaller(address common.Address, caller bind.ContractCaller) (*PaymentsCaller, error) {
+	contract, err := bindPayments(address, caller, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &PaymentsCaller{contract: contract}, nil
+}
+
+// NewPaymentsTransactor creates a new write-only instance of Payments, bound to a specific deployed contract.
+func NewPaymentsTransactor(address common.Address, transactor bind.ContractTransactor) (*PaymentsTransactor, error) {
+	contract, err := bindPayments(address, nil, transactor, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &PaymentsTransactor{contract: contract}, nil
+}
+
+// NewPaymentsFilterer creates a new log filterer instance of Payments, bound to a specific deployed contract.
+func NewPaymentsFilterer(address common.Address, filterer bind.ContractFilterer) (*PaymentsFilterer, error) {
+	contract, err := bindPayments(address, nil, nil, filterer)
+	if err != nil {
+		return nil, err
+	}
+	return &PaymentsFilterer{contract: contract}, nil
+}
+
+// bindPayments binds a generic wrapper to an already deployed contract.
+func bindPayments(address common.Address, caller bind.ContractCaller, transactor bind.ContractTransactor, filterer bind.ContractFilterer) (*bind.BoundContract, error) {
+	parsed, err := abi.JSON(strings.NewReader(PaymentsABI))
+	if err != nil {
+		return nil, err
+	}
+	return bind.NewBoundContract(address, parsed, caller, transactor, filterer), nil
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_Payments *PaymentsRaw) Call(opts *bind.CallOpts, result interface{}, method string, params ...interface{}) error {
+	return _Payments.Contract.PaymentsCaller.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_Payments *PaymentsRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _Payments.Contract.PaymentsTransactor.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_Payments *PaymentsRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _Payments.Contract.PaymentsTransactor.contract.Transact(opts, method, params...)
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_Payments *PaymentsCallerRaw) Call(opts *bind.CallOpts, result interface{}, method string, params ...interface{}) error {
+	return _Payments.Contract.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_Payments *PaymentsTransactorRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _Payments.Contract.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_Payments *PaymentsTransactorRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _Payments.Contract.contract.Transact(opts, method, params...)
+}
+
+// IsSigner is a free data retrieval call binding the contract method 0x7df73e27.
+//
+// Solidity: function isSigner(address _signer) constant returns(bool)
+func (_Payments *PaymentsCaller) IsSigner(opts *bind.CallOpts, _signer common.Address) (bool, error) {
+	var (
+		ret0 = new(bool)
+	)
+	out := ret0
+	err := _Payments.contract.Call(opts, out, "isSigner", _signer)
+	return *ret0, err
+}
+
+// IsSigner is a free data retrieval call binding the contract method 0x7df73e27.
+//
+// Solidity: function isSigner(address _signer) constant returns(bool)
+func (_Payments *PaymentsSession) IsSigner(_signer common.Address) (bool, error) {
+	return _Payments.Contract.IsSigner(&_Payments.CallOpts, _signer)
+}
+
+// IsSigner is a free data retrieval call binding the contract method 0x7df73e27.
+//
+// Solidity: function isSigner(address _signer) constant returns(bool)
+func (_Payments *PaymentsCallerSession) IsSigner(_signer common.Address) (bool, error) {
+	return _Payments.Contract.IsSigner(&_Payments.CallOpts, _signer)
+}
+
+// PaymentsPaymentMadeIterator is returned from FilterPaymentMade and is used to iterate over the raw logs and unpacked data for PaymentMade events raised by the Payments contract.
+type PaymentsPaymentMadeIterator struct {
+	Event *PaymentsPaymentMade // Event containing the contract specifics and raw log
+
+	contract *bind.BoundContract // Generic contract to use for unpacking event data
+	event    string              // Event name to use for unpacking event data
+
+	logs chan types.Log        // Log channel receiving the found contract events
+	sub  ethereum.Subscription // Subscription for errors, completion and termination
+	done bool                  // Whether the subscription completed delivering logs
+	fail error                 // Occurred error to stop iteration
+}
+
+// Next advances the iterator to the subsequent event, returning whether there
+// are any more events found. In case of a retrieval or parsing error, false is
+// returned and Error() can be queried for the exact failure.
+func (it *PaymentsPaymentMadeIterator) Next() bool {
+	// If the iterator failed, stop iterating
+	if it.fail != nil {
+		return false
+	}
+	// If the iterator completed, deliver directly whatever's available
+	if it.done {
+		select {
+		case log := <-it.logs:
+			it.Event = new(PaymentsPaymentMade)
+			if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+				it.fail = err
+				return false
+			}
+			it.Event.Raw = log
+			return true
+
+		default:
+			return false
+		}
+	}
+	// Iterator still in progress, wait for either a data or an error event
+	select {
+	case log := <-it.logs:
+		it.Event = new(PaymentsPaymentMade)
+		if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+			it.fail = err
+			return false
+		}
+		it.Event.Raw = log
+		return true
+
+	case err := <-it.sub.Err():
+		it.done = true
+		it.fail = err
+		return it.Next()
+	}
+}
+
+// Error returns any retrieval or parsing error occurred during filtering.
+func (it *PaymentsPaymentMadeIterator) Error() error {
+	return it.fail
+}
+
+// Close terminates the iteration process, releasing any pending underlying
+// resources.
+func (it *PaymentsPaymentMadeIterator) Close() error {
+	it.sub.Unsubscribe()
+	return nil
+}
+
+// PaymentsPaymentMade represents a PaymentMade event raised by the Payments contract.
+type PaymentsPaymentMade struct {
+	Payer             common.Address
+	PaymentNumber     *big.Int
+	PaymentMethod     uint8
+	ChargeAmountInWei *big.Int
+	Raw               types.Log // Blockchain specific contextual infos
+}
+
+// FilterPaymentMade is a free log retrieval operation binding the contract event 0xd18793644b4cb4ec0f937f8153dc09112d762775084c0ae5b4c21a7b91f6909f.
+//
+// Solidity: event PaymentMade(address indexed payer, uint256 paymentNumber, uint8 paymentMethod, uint256 chargeAmountInWei)
+func (_Payments *PaymentsFilterer) FilterPaymentMade(opts *bind.FilterOpts, payer []common.Address) (*PaymentsPaymentMadeIterator, error) {
+
+	var payerRule []interface{}
+	for _, payerItem := range payer {
+		payerRule = append(payerRule, payerItem)
+	}
+
+	logs, sub, err := _Payments.contract.FilterLogs(opts, "PaymentMade", payerRule)
+	if err != nil {
+		return nil, err
+	}
+	return &PaymentsPaymentMadeIterator{contract: _Payments.contract, event: "PaymentMade", logs: logs, sub: sub}, nil
+}
+
+// WatchPaymentMade is a free log subscription operation binding the contract event 0xd18793644b4cb4ec0f937f8153dc09112d762775084c0ae5b4c21a7b91f6909f.
+//
+// Solidity: event PaymentMade(address indexed payer, uint256 paymentNumber, uint8 paymentMethod, uint256 chargeAmountInWei)
+func (_Payments *PaymentsFilterer) WatchPaymentMade(opts *bind.WatchOpts, sink chan<- *PaymentsPaymentMade, payer []common.Address) (event.Subscription, error) {
+
+	var payerRule []interface{}
+	for _, payerItem := range payer {
+		payerRule = append(payerRule, payerItem)
+	}
+
+	logs, sub, err := _Payments.contract.WatchLogs(opts, "PaymentMade", payerRule)
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case log := <-logs:
+				// New log arrived, parse the event and forward to the user
+				event := new(PaymentsPaymentMade)
+				if err := _Payments.contract.UnpackLog(event, "PaymentMade", log); err != nil {
+					return err
+				}
+				event.Raw = log
+
+				select {
+				case sink <- event:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// ParsePaymentMade is a log parse operation binding the contract event 0xd18793644b4cb4ec0f937f8153dc09112d762775084c0ae5b4c21a7b91f6909f.
+//
+// Solidity: event PaymentMade(address indexed payer, uint256 paymentNumber, uint8 paymentMethod, uint256 chargeAmountInWei)
+func (_Payments *PaymentsFilterer) ParsePaymentMade(log types.Log) (*PaymentsPaymentMade, error) {
+	event := new(PaymentsPaymentMade)
+	if err := _Payments.contract.UnpackLog(event, "PaymentMade", log); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
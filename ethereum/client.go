@@ -4,19 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"math/big"
 	"strings"
 	"sync"
-	"time"
 
+	"github.com/RTradeLtd/Pay/signer"
+	"github.com/RTradeLtd/Pay/tracker"
 	"github.com/RTradeLtd/config/v2"
+	geth "github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
-	"github.com/ethereum/go-ethereum/accounts/keystore"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/onrik/ethrpc"
 	ens "github.com/wealdtech/go-ens/v3"
 )
@@ -37,52 +38,100 @@ type Client struct {
 	RTCAddress             string
 	PaymentContractAddress string
 	ConfirmationCount      int
-	// enables locking for write transactions
-	// to prevent issues with nonce reuse
+	// enables locking for writes to our own names. As
+	// nonces are reserved by our transaction manager,
+	// subdomain writes are free to run concurrently
 	txMux sync.Mutex
+	// tracker is used to wait for new blocks, and
+	// is only set once TrackBlocks has been called
+	tracker *tracker.Tracker
+	// GasOracle determines the gas price of our transactions,
+	// which is bounded by GasFloor and GasCeiling when set
+	GasOracle  GasOracle
+	GasFloor   *big.Int
+	GasCeiling *big.Int
+	// Tx sends our transactions, replacing those which get stuck
+	Tx *TxManager
+	// signerOpts selects the signer unlocked from our config
+	signerOpts signer.Opts
+}
+
+// Opts is used to configure our ethereum client
+type Opts struct {
+	// GasOracle selects the gas price oracle, defaulting to GasOracleNode
+	GasOracle string
+	// GasBlocks and GasPercentile configure the percentile gas price oracle
+	GasBlocks     int
+	GasPercentile int
+	// GasFloor and GasCeiling bound the gas price in wei, and are ignored if nil
+	GasFloor   *big.Int
+	GasCeiling *big.Int
+	// Tx configures the replacement of stuck transactions
+	Tx TxOpts
+	// Signer selects the signer of our transactions, allowing
+	// our key to be held by a remote signer
+	Signer signer.Opts
 }
 
 // NewClient is used to generate our Ethereum client wrapper
 func NewClient(cfg *config.TemporalConfig, connectionType string) (*Client, error) {
+	return NewClientWithOpts(cfg, connectionType, Opts{})
+}
+
+// NewClientWithOpts is used to generate our Ethereum client wrapper,
+// allowing the gas pricing of our transactions to be configured
+func NewClientWithOpts(cfg *config.TemporalConfig, connectionType string, opts Opts) (*Client, error) {
 	var (
-		err       error
-		eClient   *ethclient.Client
-		rpcClient *ethrpc.EthRPC
-		count     int
+		url   string
+		count int
 	)
 	switch connectionType {
 	case "infura":
-		eClient, err = ethclient.Dial(cfg.Ethereum.Connection.INFURA.URL)
-		if err != nil {
-			return nil, err
-		}
-		rpcClient = ethrpc.New(cfg.Ethereum.Connection.INFURA.URL)
+		url = cfg.Ethereum.Connection.INFURA.URL
 	case "rpc":
-		url := fmt.Sprintf("http://%s:%s", cfg.Ethereum.Connection.RPC.IP, cfg.Ethereum.Connection.RPC.Port)
-		eClient, err = ethclient.Dial(url)
-		if err != nil {
+		url = fmt.Sprintf("http://%s:%s", cfg.Ethereum.Connection.RPC.IP, cfg.Ethereum.Connection.RPC.Port)
+	default:
+		return nil, errors.New("invalid connection type")
+	}
+	rawClient, err := rpc.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	eClient := ethclient.NewClient(rawClient)
+	var oracle GasOracle = NewNodeOracle(eClient)
+	switch opts.GasOracle {
+	case "", GasOracleNode:
+	case GasOraclePercentile:
+		if oracle, err = NewPercentileOracle(rawClient, opts.GasBlocks, opts.GasPercentile, oracle); err != nil {
 			return nil, err
 		}
-		rpcClient = ethrpc.New(url)
 	default:
-		return nil, errors.New("invalid connection type")
+		return nil, errors.New("invalid gas oracle")
 	}
 	if dev {
 		count = devConfirmationCount
 	} else {
 		count = prodConfirmationCount
 	}
-	return &Client{
+	c := &Client{
 		ETH:                    eClient,
-		RPC:                    rpcClient,
+		RPC:                    ethrpc.New(url),
 		RTCAddress:             cfg.Ethereum.Contracts.RTCAddress,
 		PaymentContractAddress: cfg.Ethereum.Contracts.PaymentContractAddress,
-		ConfirmationCount:      count}, nil
+		ConfirmationCount:      count,
+		GasOracle:              oracle,
+		GasFloor:               opts.GasFloor,
+		GasCeiling:             opts.GasCeiling,
+		signerOpts:             opts.Signer}
+	txOpts := opts.Tx
+	txOpts.GasCeiling = opts.GasCeiling
+	c.Tx = NewTxManager(eClient, c.gasPrice, txOpts)
+	return c, nil
 }
 
 // SetResolver is used to check if name
 // doesnt have a public resolver, set it
-func (c *Client) SetResolver(name string) error {
+func (c *Client) SetResolver(ctx context.Context, name string) error {
 	c.txMux.Lock()
 	defer c.txMux.Unlock()
 	nm, err := ens.NewName(c.ETH, name)
@@ -100,154 +149,79 @@ func (c *Client) SetResolver(name string) error {
 	if err != nil {
 		return err
 	}
-	c.Auth.GasPrice = c.getGasPrice()
-	tx, err := nm.SetResolverAddress(pubResolver, c.Auth)
-	if err != nil {
-		return err
-	}
-	if rcpt, err := bind.WaitMined(context.Background(), c.ETH, tx); err != nil {
-		return err
-	} else if rcpt.Status != 1 {
-		return errors.New("tx with incorrect status")
-	}
-	return nil
-}
-
-// RegisterName is used to register an ENS name
-func (c *Client) RegisterName(name string) error {
-	c.txMux.Lock()
-	defer c.txMux.Unlock()
-	contract, err := ens.NewName(c.ETH, name)
-	if err != nil {
-		return err
-	}
-	// calculate rent cost for 1 year
-	cost, err := getRentCost(contract, 31536000)
-	if err != nil {
-		return err
-	}
-	c.Auth.GasPrice = c.getGasPrice()
-	// start the initial registration step
-	tx, secret, err := contract.RegisterStageOne(c.Auth.From, c.Auth)
-	if err != nil {
-		return err
-	}
-	if rcpt, err := bind.WaitMined(context.Background(), c.ETH, tx); err != nil {
-		return err
-	} else if rcpt.Status != 1 {
-		return errors.New("tx with incorrect status")
-	}
-	// get the specified registration step interval period
-	sleepDuration, err := contract.RegistrationInterval()
-	if err != nil {
-		return err
-	}
-	// sleep for the specified duration plus an additional minute
-	time.Sleep(sleepDuration + time.Minute)
-	// set rent cost as tx value
-	c.Auth.Value = cost
-	// defer reset of tx value
-	defer func() {
-		c.Auth.Value = big.NewInt(0)
-	}()
-	c.Auth.GasPrice = c.getGasPrice()
-	// start the final registration step
-	tx, err = contract.RegisterStageTwo(c.Auth.From, secret, c.Auth)
-	if err != nil {
-		return err
-	}
-	if rcpt, err := bind.WaitMined(context.Background(), c.ETH, tx); err != nil {
-		return err
-	} else if rcpt.Status != 1 {
-		return errors.New("tx with incorrect status")
-	}
-	return nil
+	return c.sendTx(ctx, "set-resolver", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return nm.SetResolverAddress(pubResolver, opts)
+	})
 }
 
 // RegisterSubDomain is used to register a subdomain under
 // ipfstemporal.eth, allowing it to be updated with a content hash
-func (c *Client) RegisterSubDomain(subName, parentName string) error {
-	c.txMux.Lock()
-	defer c.txMux.Unlock()
+func (c *Client) RegisterSubDomain(ctx context.Context, subName, parentName string) error {
 	// create a registry contract handler
 	contract, err := ens.NewRegistry(c.ETH)
 	if err != nil {
 		return err
 	}
-	c.Auth.GasPrice = c.getGasPrice()
 	// create the subdomain, setting the name, and marking us as the owner
 	// this ensure we can manage the subdomain
-	tx, err := contract.SetSubdomainOwner(
-		c.Auth,
-		parentName,
-		subName,
-		c.Auth.From,
-	)
-	if err != nil {
-		return err
-	}
-	if rcpt, err := bind.WaitMined(context.Background(), c.ETH, tx); err != nil {
+	if err := c.sendTx(ctx, "register-subdomain", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return contract.SetSubdomainOwner(
+			opts,
+			parentName,
+			subName,
+			c.Auth.From,
+		)
+	}); err != nil {
 		return err
-	} else if rcpt.Status != 1 {
-		return errors.New("tx with incorrect status")
 	}
 	pubResolver, err := ens.PublicResolverAddress(c.ETH)
 	if err != nil {
 		return err
 	}
-	c.Auth.GasPrice = c.getGasPrice()
-	tx, err = contract.SetResolver(
-		c.Auth,
-		c.GetCombinedName(subName, parentName),
-		pubResolver,
-	)
-	if err != nil {
-		return err
-	}
-	if rcpt, err := bind.WaitMined(context.Background(), c.ETH, tx); err != nil {
-		return err
-	} else if rcpt.Status != 1 {
-		return errors.New("tx with incorrect status")
-	}
-	return nil
+	return c.sendTx(ctx, "set-subdomain-resolver", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return contract.SetResolver(
+			opts,
+			c.GetCombinedName(subName, parentName),
+			pubResolver,
+		)
+	})
 }
 
 // UpdateContentHash is used to update the ipfs content hash
-// of a particular *.ipfstemporal.eth subdomain
-func (c *Client) UpdateContentHash(subName, parentName, hash string) error {
-	c.txMux.Lock()
-	defer c.txMux.Unlock()
-	resolver, err := ens.NewResolver(c.ETH, c.GetCombinedName(subName, parentName))
-	if err != nil {
-		return err
-	}
-	c.Auth.GasPrice = c.getGasPrice()
-	tx, err := resolver.SetContenthash(c.Auth, []byte(hash))
+// of a particular *.ipfstemporal.eth subdomain. The hash is
+// encoded as an EIP-1577 contenthash, and read back once mined
+func (c *Client) UpdateContentHash(ctx context.Context, subName, parentName, hash string) error {
+	update, err := c.ContentHashUpdate(subName, parentName, hash)
 	if err != nil {
 		return err
 	}
-	if rcpt, err := bind.WaitMined(context.Background(), c.ETH, tx); err != nil {
-		return err
-	} else if rcpt.Status != 1 {
-		return errors.New("tx with incorrect status")
-	}
-	return nil
+	return c.applyUpdate(ctx, update)
 }
 
-// UnlockAccountFromConfig generates a bind transactor opts from temporal config
+// UnlockAccountFromConfig generates a bind transactor opts from temporal config,
+// or from the remote signer selected when the client was created
 func (c *Client) UnlockAccountFromConfig(cfg *config.TemporalConfig) error {
-	fileBytes, err := ioutil.ReadFile(cfg.Ethereum.Account.KeyFile)
-	if err != nil {
-		return err
-	}
-	pk, err := keystore.DecryptKey(fileBytes, cfg.Ethereum.Account.KeyPass)
+	s, err := signer.New(cfg, c.signerOpts)
 	if err != nil {
 		return err
 	}
-	c.Auth = bind.NewKeyedTransactor(pk.PrivateKey)
+	c.UnlockSigner(s)
 	return nil
 }
 
+// UnlockSigner generates a bind transactor opts signing our transactions with the given signer
+func (c *Client) UnlockSigner(s signer.Signer) {
+	c.Auth = &bind.TransactOpts{
+		From: s.Address(),
+		Signer: func(txSigner types.Signer, address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if address != s.Address() {
+				return nil, errors.New("not authorized to sign this account")
+			}
+			return s.SignTx(txSigner, tx)
+		},
+	}
+}
+
 // UnlockAccount is used to unlck our main account
 func (c *Client) UnlockAccount(keys ...string) error {
 	var (
@@ -267,26 +241,39 @@ func (c *Client) UnlockAccount(keys ...string) error {
 }
 
 // ProcessPaymentTx is used to process an ethereum/rtc based
-// credit purchase
-func (c *Client) ProcessPaymentTx(txHash string) error {
+// credit purchase, until the context is cancelled
+func (c *Client) ProcessPaymentTx(ctx context.Context, txHash string) error {
 	fmt.Println("getting tx receipt")
 	hash := common.HexToHash(txHash)
-	tx, pending, err := c.ETH.TransactionByHash(context.Background(), hash)
+	tx, pending, err := c.ETH.TransactionByHash(ctx, hash)
 	if err != nil {
 		return err
 	}
 	fmt.Printf("tx receipt:\n%+v\n", tx)
 	if pending {
-		_, err := bind.WaitMined(context.Background(), c.ETH, tx)
+		_, err := bind.WaitMined(ctx, c.ETH, tx)
 		if err != nil {
 			return err
 		}
 	}
-	return c.WaitForConfirmations(tx)
+	return c.WaitForConfirmations(ctx, tx)
+}
+
+// TxBlockHash is used to retrieve the hash of the block containing a transaction,
+// returning an empty hash once the transaction is no longer part of the canonical chain
+func (c *Client) TxBlockHash(ctx context.Context, txHash string) (string, error) {
+	rcpt, err := c.ETH.TransactionReceipt(ctx, common.HexToHash(txHash))
+	if err == geth.NotFound {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return rcpt.BlockHash.String(), nil
 }
 
-// WaitForConfirmations is used to wait for enough block confirmations for a tx to be considered valid
-func (c *Client) WaitForConfirmations(tx *types.Transaction) error {
+// WaitForConfirmations is used to wait for enough block confirmations for a tx to be
+// considered valid, until the context is cancelled
+func (c *Client) WaitForConfirmations(ctx context.Context, tx *types.Transaction) error {
 	fmt.Println("getting tx receipt")
 	rcpt, err := c.RPC.EthGetTransactionReceipt(tx.Hash().String())
 	if err != nil {
@@ -321,13 +308,16 @@ func (c *Client) WaitForConfirmations(tx *types.Transaction) error {
 	for {
 		fmt.Println("current confirmations ", currentConfirmations)
 		fmt.Println("confirmations needed ", confirmationsNeeded)
+		seen := c.seenHeight()
 		currentBlock, err = c.RPC.EthBlockNumber()
 		if err != nil {
 			return err
 		}
-		// if we get a block that was the same as last, temporarily sleep
+		// if we get a block that was the same as last, wait for the next one
 		if currentBlock == lastBlockChecked {
-			time.Sleep(time.Second * 15)
+			if err := c.waitForBlock(ctx, seen); err != nil {
+				return err
+			}
 		}
 		lastBlockChecked = currentBlock
 		// set current confirmations to difference between current block and confirmed block
@@ -351,7 +341,7 @@ func (c *Client) WaitForConfirmations(tx *types.Transaction) error {
 		return errors.New("no logs were emitted")
 	}
 	// refetch the transaction receipt, using go-ethereum
-	tx, _, err = c.ETH.TransactionByHash(context.Background(), tx.Hash())
+	tx, _, err = c.ETH.TransactionByHash(ctx, tx.Hash())
 	if err != nil {
 		return err
 	}
@@ -372,14 +362,6 @@ func (c *Client) WaitForConfirmations(tx *types.Transaction) error {
 	return nil
 }
 
-func getRentCost(en *ens.Name, rentSeconds int64) (*big.Int, error) {
-	costSec, err := en.RentCost()
-	if err != nil {
-		return nil, err
-	}
-	return new(big.Int).Mul(costSec, big.NewInt(rentSeconds)), nil
-}
-
 // GetCombinedName is used to return a combined ens name
 func (c *Client) GetCombinedName(subName, parentName string) string {
 	// ensure that if the first character is not a .
@@ -395,8 +377,20 @@ func (c *Client) GetCombinedName(subName, parentName string) string {
 	return subName + parentName
 }
 
-func (c *Client) getGasPrice() *big.Int {
-	gprice := new(big.Int)
-	gprice.SetString("5000000000", 10)
-	return gprice
+// sendTx is used to send a transaction through our transaction manager,
+// waiting for it to be mined until ctx is cancelled
+func (c *Client) sendTx(ctx context.Context, operation string, send func(opts *bind.TransactOpts) (*types.Transaction, error)) error {
+	_, err := c.Tx.Send(ctx, c.Auth, operation, send)
+	return err
+}
+
+// gasPrice is used to determine the gas price of our next transaction. As our
+// contract bindings only sign legacy transactions, on EIP-1559 networks the fees
+// given by the oracle are converted into an equivalent gas price
+func (c *Client) gasPrice(ctx context.Context) (*big.Int, error) {
+	fees, err := c.GasOracle.Fees(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return clampGasPrice(fees.Price(), c.GasFloor, c.GasCeiling), nil
 }
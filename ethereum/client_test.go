@@ -1,6 +1,7 @@
 package ethereum_test
 
 import (
+	"context"
 	"os"
 	"strconv"
 	"testing"
@@ -84,16 +85,28 @@ func TestENS(t *testing.T) {
 			}
 		})
 	}
-	if err := c.RegisterName(getName()); err != nil {
+	secret, err := ethereum.NewRegistrationSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CommitName(context.Background(), getName(), secret); err != nil {
+		t.Fatal(err)
+	}
+	minInterval, _, err := c.CommitmentIntervals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(minInterval + time.Minute)
+	if err := c.RevealName(context.Background(), getName(), secret); err != nil {
 		t.Fatal(err)
 	}
-	if err := c.SetResolver(getName()); err != nil {
+	if err := c.SetResolver(context.Background(), getName()); err != nil {
 		t.Fatal(err)
 	}
-	if err := c.RegisterSubDomain("ipfstemporal", getName()); err != nil {
+	if err := c.RegisterSubDomain(context.Background(), "ipfstemporal", getName()); err != nil {
 		t.Fatal(err)
 	}
-	if err := c.UpdateContentHash("ipfstemporal", getName(), testHash); err != nil {
+	if err := c.UpdateContentHash(context.Background(), "ipfstemporal", getName(), testHash); err != nil {
 		t.Fatal(err)
 	}
 }
@@ -0,0 +1,137 @@
+package ethereum
+
+import (
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/mr-tron/base58"
+	multihash "github.com/multiformats/go-multihash"
+)
+
+const (
+	// multicodec codes used by EIP-1577 contenthashes
+	codecIPFSNamespace = uint64(0xe3)
+	codecIPNSNamespace = uint64(0xe5)
+	codecDagPB         = uint64(0x70)
+	codecLibp2pKey     = uint64(0x72)
+
+	// ErrInvalidContent is an error used to indicate that content
+	// is neither an ipfs cid, nor an ipns name
+	ErrInvalidContent = "content must be an ipfs cid or ipns name"
+	// ErrContenthashMismatch is an error used to indicate that the contenthash
+	// read back from the resolver does not match the contenthash we set
+	ErrContenthashMismatch = "contenthash read back from resolver does not match"
+)
+
+// cidBase32 is the multibase base32 encoding used by CIDv1
+var cidBase32 = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// EncodeContenthash is used to encode content as an EIP-1577 contenthash. Content
+// is either an ipfs cid, optionally given as an /ipfs/ path or ipfs:// url, or
+// an ipns name given as an /ipns/ path or ipns:// url. CIDs may be v0 or v1,
+// while ipns names are either a peer id or a dnslink domain
+func EncodeContenthash(content string) ([]byte, error) {
+	namespace, value := codecIPFSNamespace, content
+	switch {
+	case strings.HasPrefix(content, "/ipfs/"):
+		value = strings.TrimPrefix(content, "/ipfs/")
+	case strings.HasPrefix(content, "ipfs://"):
+		value = strings.TrimPrefix(content, "ipfs://")
+	case strings.HasPrefix(content, "/ipns/"):
+		namespace, value = codecIPNSNamespace, strings.TrimPrefix(content, "/ipns/")
+	case strings.HasPrefix(content, "ipns://"):
+		namespace, value = codecIPNSNamespace, strings.TrimPrefix(content, "ipns://")
+	}
+	value = strings.TrimSuffix(value, "/")
+	if value == "" || strings.Contains(value, "/") {
+		return nil, errors.New(ErrInvalidContent)
+	}
+	var (
+		cid []byte
+		err error
+	)
+	if namespace == codecIPFSNamespace {
+		cid, err = parseCID(value, codecDagPB)
+	} else {
+		cid, err = parseIPNSName(value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(uvarint(namespace), cid...), nil
+}
+
+// parseIPNSName is used to parse an ipns name into a CIDv1 with the libp2p-key codec
+func parseIPNSName(name string) ([]byte, error) {
+	if cid, err := parseCID(name, codecLibp2pKey); err == nil {
+		return cid, nil
+	}
+	// names which aren't a peer id are dnslink domains, stored as an identity hash
+	if !strings.Contains(name, ".") {
+		return nil, errors.New(ErrInvalidContent)
+	}
+	hash, err := multihash.Encode([]byte(name), multihash.ID)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(uvarint(1), uvarint(codecLibp2pKey)...), hash...), nil
+}
+
+// parseCID is used to parse a CID into its binary CIDv1 form, with CIDv0
+// and bare base58 multihashes upgraded using the given codec
+func parseCID(value string, codec uint64) ([]byte, error) {
+	// CIDv0 are bare base58 encoded sha2-256 multihashes
+	if len(value) == 46 && strings.HasPrefix(value, "Qm") {
+		hash, err := multihash.FromB58String(value)
+		if err != nil {
+			return nil, errors.New(ErrInvalidContent)
+		}
+		return append(append(uvarint(1), uvarint(codec)...), hash...), nil
+	}
+	var (
+		decoded []byte
+		err     error
+	)
+	// CIDv1 are prefixed with their multibase
+	switch value[0] {
+	case 'b':
+		decoded, err = cidBase32.DecodeString(value[1:])
+	case 'B':
+		decoded, err = cidBase32.DecodeString(strings.ToLower(value[1:]))
+	case 'z':
+		decoded, err = base58.Decode(value[1:])
+	case 'f':
+		decoded, err = hex.DecodeString(value[1:])
+	default:
+		// peer ids may also be given as a bare base58 multihash
+		decoded, err = base58.Decode(value)
+		if err == nil {
+			if _, err := multihash.Cast(decoded); err == nil {
+				return append(append(uvarint(1), uvarint(codec)...), decoded...), nil
+			}
+		}
+		return nil, errors.New(ErrInvalidContent)
+	}
+	if err != nil {
+		return nil, errors.New(ErrInvalidContent)
+	}
+	version, n := binary.Uvarint(decoded)
+	if n <= 0 || version != 1 {
+		return nil, errors.New(ErrInvalidContent)
+	}
+	if _, m := binary.Uvarint(decoded[n:]); m <= 0 {
+		return nil, errors.New(ErrInvalidContent)
+	} else if _, err := multihash.Cast(decoded[n+m:]); err != nil {
+		return nil, errors.New(ErrInvalidContent)
+	}
+	return decoded, nil
+}
+
+// uvarint is used to encode a multicodec code
+func uvarint(code uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return buf[:binary.PutUvarint(buf, code)]
+}
@@ -0,0 +1,62 @@
+package ethereum
+
+import (
+	"encoding/hex"
+	"testing"
+
+	ens "github.com/wealdtech/go-ens/v3"
+)
+
+func Test_EncodeContenthash(t *testing.T) {
+	// test vector from EIP-1577
+	const (
+		cidV0 = "QmRAQB6YaCyidP37UdDnjFY5vQuiBrcqdyoW1CuDgwxkD4"
+		want  = "e3010170122029f2d17be6139079dc48696d1f582a8530eb9805b561eda517e22a892c7e3f1f"
+	)
+	wantBytes, err := hex.DecodeString(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cidV1 := "b" + cidBase32.EncodeToString(wantBytes[2:])
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{"CIDv0", cidV0, want, false},
+		{"Path", "/ipfs/" + cidV0, want, false},
+		{"URL", "ipfs://" + cidV0 + "/", want, false},
+		{"CIDv1", cidV1, want, false},
+		{"IPNS", "/ipns/" + cidV0, "e5010172122029f2d17be6139079dc48696d1f582a8530eb9805b561eda517e22a892c7e3f1f", false},
+		{"DNSLink", "ipns://temporal.cloud", "e5010172000e" + hex.EncodeToString([]byte("temporal.cloud")), false},
+		{"Empty", "", "", true},
+		{"Garbage", "not a cid", "", true},
+		{"BadCIDv1", "bnotacid", "", true},
+		{"SubPath", "/ipfs/" + cidV0 + "/index.html", "", true},
+		{"BadIPNS", "/ipns/notaname", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EncodeContenthash(tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EncodeContenthash() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if hex.EncodeToString(got) != tt.want {
+				t.Fatalf("EncodeContenthash() = %x, want %s", got, tt.want)
+			}
+		})
+	}
+	// the encoding must be understood by other ens tooling
+	encoded, err := EncodeContenthash(cidV1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := ens.ContenthashToString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != "/ipfs/"+cidV0 {
+		t.Fatalf("ContenthashToString() = %s, want /ipfs/%s", decoded, cidV0)
+	}
+}
@@ -0,0 +1,183 @@
+package ethereum
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	// GasOracleNode selects the gas price suggested by our node
+	GasOracleNode = "node"
+	// GasOraclePercentile selects a percentile of the gas prices paid in recent blocks
+	GasOraclePercentile = "percentile"
+
+	// ErrNoGasSamples is an error used to indicate that there were
+	// no transactions in recent blocks to determine gas prices from
+	ErrNoGasSamples = "no transactions in recent blocks to sample gas prices from"
+)
+
+// GasOracle is used to determine the fees to send our transactions with
+type GasOracle interface {
+	Fees(ctx context.Context) (*Fees, error)
+}
+
+// Fees are the fees to send a transaction with. On networks supporting
+// EIP-1559 the base fee and priority fee fields are set, otherwise only
+// the gas price is set
+type Fees struct {
+	GasPrice             *big.Int
+	BaseFee              *big.Int
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+}
+
+// Price returns the gas price of a legacy transaction paying these fees. As a
+// legacy transaction included on an EIP-1559 network pays its entire gas price,
+// rather than the maximum fee the price covers the highest base fee possible in
+// the next block plus the priority fee, bounded by the maximum fee
+func (f *Fees) Price() *big.Int {
+	if f.BaseFee == nil {
+		return f.GasPrice
+	}
+	// the base fee increases by at most 12.5% per block
+	price := new(big.Int).Mul(f.BaseFee, big.NewInt(9))
+	price.Add(price, big.NewInt(7))
+	price.Div(price, big.NewInt(8))
+	price.Add(price, f.MaxPriorityFeePerGas)
+	if price.Cmp(f.MaxFeePerGas) > 0 {
+		return new(big.Int).Set(f.MaxFeePerGas)
+	}
+	return price
+}
+
+// gasSuggester is used to retrieve the gas price suggested by a node
+type gasSuggester interface {
+	SuggestGasPrice(ctx context.Context) (*big.Int, error)
+}
+
+// rpcCaller is used to make raw json-rpc calls to a node
+type rpcCaller interface {
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+}
+
+// NodeOracle is a GasOracle using the gas price suggested by our node
+type NodeOracle struct {
+	eth gasSuggester
+}
+
+// NewNodeOracle is used to instantiate our node gas price oracle
+func NewNodeOracle(eth gasSuggester) *NodeOracle {
+	return &NodeOracle{eth: eth}
+}
+
+// Fees returns the gas price suggested by our node
+func (no *NodeOracle) Fees(ctx context.Context) (*Fees, error) {
+	price, err := no.eth.SuggestGasPrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Fees{GasPrice: price}, nil
+}
+
+// PercentileOracle is a GasOracle using a percentile of the fees paid by the
+// transactions of recent blocks. On networks supporting EIP-1559 the percentile
+// is taken of the priority fees paid above the base fee of each block
+type PercentileOracle struct {
+	rpc        rpcCaller
+	blocks     int
+	percentile int
+	// fallback is used when recent blocks contain no transactions
+	fallback GasOracle
+}
+
+// NewPercentileOracle is used to instantiate our percentile gas price oracle,
+// sampling the given number of blocks and falling back to the fallback oracle
+// should they contain no transactions
+func NewPercentileOracle(rpc rpcCaller, blocks, percentile int, fallback GasOracle) (*PercentileOracle, error) {
+	if blocks <= 0 {
+		return nil, errors.New("number of blocks to sample must be positive")
+	}
+	if percentile < 0 || percentile > 100 {
+		return nil, errors.New("percentile must be between 0 and 100")
+	}
+	return &PercentileOracle{rpc: rpc, blocks: blocks, percentile: percentile, fallback: fallback}, nil
+}
+
+// feeBlock is a block as returned by eth_getBlockByNumber, with only fee related fields
+type feeBlock struct {
+	BaseFee      *hexutil.Big `json:"baseFeePerGas"`
+	Transactions []struct {
+		// GasPrice of mined transactions is the effective gas price paid
+		GasPrice *hexutil.Big `json:"gasPrice"`
+	} `json:"transactions"`
+}
+
+// Fees returns the percentile of the fees paid in recent blocks
+func (po *PercentileOracle) Fees(ctx context.Context) (*Fees, error) {
+	var head hexutil.Uint64
+	if err := po.rpc.CallContext(ctx, &head, "eth_blockNumber"); err != nil {
+		return nil, err
+	}
+	var (
+		baseFee *big.Int
+		samples []*big.Int
+	)
+	for i := 0; i < po.blocks && uint64(i) <= uint64(head); i++ {
+		var block feeBlock
+		if err := po.rpc.CallContext(
+			ctx, &block, "eth_getBlockByNumber", hexutil.EncodeUint64(uint64(head)-uint64(i)), true,
+		); err != nil {
+			return nil, err
+		}
+		// the latest block determines whether eip-1559 is in use
+		if i == 0 && block.BaseFee != nil {
+			baseFee = block.BaseFee.ToInt()
+		}
+		for _, tx := range block.Transactions {
+			if tx.GasPrice == nil {
+				continue
+			}
+			sample := new(big.Int).Set(tx.GasPrice.ToInt())
+			if baseFee != nil {
+				// blocks from before the fork have no base fee to tip above
+				if block.BaseFee == nil {
+					continue
+				}
+				sample.Sub(sample, block.BaseFee.ToInt())
+			}
+			samples = append(samples, sample)
+		}
+	}
+	if len(samples) == 0 {
+		if po.fallback == nil {
+			return nil, errors.New(ErrNoGasSamples)
+		}
+		return po.fallback.Fees(ctx)
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Cmp(samples[j]) < 0 })
+	sample := samples[(len(samples)-1)*po.percentile/100]
+	if baseFee == nil {
+		return &Fees{GasPrice: sample}, nil
+	}
+	maxFee := new(big.Int).Mul(baseFee, big.NewInt(2))
+	return &Fees{
+		BaseFee:              baseFee,
+		MaxFeePerGas:         maxFee.Add(maxFee, sample),
+		MaxPriorityFeePerGas: sample,
+	}, nil
+}
+
+// clampGasPrice is used to bound a gas price, ignoring nil bounds
+func clampGasPrice(price, floor, ceiling *big.Int) *big.Int {
+	if floor != nil && price.Cmp(floor) < 0 {
+		return new(big.Int).Set(floor)
+	}
+	if ceiling != nil && price.Cmp(ceiling) > 0 {
+		return new(big.Int).Set(ceiling)
+	}
+	return price
+}
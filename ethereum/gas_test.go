@@ -0,0 +1,124 @@
+package ethereum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// fakeRPC is a fake node returning canned blocks, keyed by their hex number
+type fakeRPC struct {
+	head   string
+	blocks map[string]string
+}
+
+func (fr *fakeRPC) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	switch method {
+	case "eth_blockNumber":
+		return json.Unmarshal([]byte(`"`+fr.head+`"`), result)
+	case "eth_getBlockByNumber":
+		return json.Unmarshal([]byte(fr.blocks[args[0].(string)]), result)
+	}
+	return errors.New("method not found")
+}
+
+type fakeSuggester int64
+
+func (fs fakeSuggester) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(int64(fs)), nil
+}
+
+func Test_PercentileOracle_Legacy(t *testing.T) {
+	rpc := &fakeRPC{head: "0x2", blocks: map[string]string{
+		"0x2": `{"transactions":[{"gasPrice":"0x1"},{"gasPrice":"0x5"}]}`,
+		"0x1": `{"transactions":[{"gasPrice":"0x3"},{"gasPrice":"0x2"},{"gasPrice":"0x4"}]}`,
+		"0x0": `{"transactions":[{"gasPrice":"0x64"}]}`,
+	}}
+	oracle, err := NewPercentileOracle(rpc, 2, 50, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fees, err := oracle.Fees(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fees.BaseFee != nil || fees.Price().Int64() != 3 {
+		t.Fatal("bad fees returned", fees)
+	}
+}
+
+func Test_PercentileOracle_EIP1559(t *testing.T) {
+	rpc := &fakeRPC{head: "0x2", blocks: map[string]string{
+		"0x2": `{"baseFeePerGas":"0x64","transactions":[{"gasPrice":"0x65"},{"gasPrice":"0x6e"}]}`,
+		// the block before the fork has no base fee, so is ignored
+		"0x1": `{"transactions":[{"gasPrice":"0x1000"}]}`,
+	}}
+	oracle, err := NewPercentileOracle(rpc, 2, 100, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fees, err := oracle.Fees(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fees.BaseFee.Int64() != 100 || fees.MaxPriorityFeePerGas.Int64() != 10 || fees.MaxFeePerGas.Int64() != 210 {
+		t.Fatal("bad fees returned", fees)
+	}
+	// the next base fee is at most 112.5, rounded up
+	if price := fees.Price().Int64(); price != 123 {
+		t.Fatalf("Price() = %v, want 123", price)
+	}
+}
+
+func Test_PercentileOracle_Fallback(t *testing.T) {
+	rpc := &fakeRPC{head: "0x0", blocks: map[string]string{"0x0": `{"transactions":[]}`}}
+	oracle, err := NewPercentileOracle(rpc, 5, 50, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := oracle.Fees(context.Background()); err == nil || err.Error() != ErrNoGasSamples {
+		t.Fatalf("Fees() error = %v, want %v", err, ErrNoGasSamples)
+	}
+	oracle.fallback = NewNodeOracle(fakeSuggester(7))
+	fees, err := oracle.Fees(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fees.Price().Int64() != 7 {
+		t.Fatal("bad fees returned", fees)
+	}
+	if _, err := NewPercentileOracle(rpc, 0, 50, nil); err == nil {
+		t.Fatal("error expected")
+	}
+	if _, err := NewPercentileOracle(rpc, 5, 101, nil); err == nil {
+		t.Fatal("error expected")
+	}
+}
+
+func Test_GasPrice(t *testing.T) {
+	c := &Client{GasOracle: NewNodeOracle(fakeSuggester(50))}
+	tests := []struct {
+		name           string
+		floor, ceiling *big.Int
+		want           int64
+	}{
+		{"unbounded", nil, nil, 50},
+		{"floor", big.NewInt(60), nil, 60},
+		{"ceiling", nil, big.NewInt(40), 40},
+		{"within", big.NewInt(10), big.NewInt(100), 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.GasFloor, c.GasCeiling = tt.floor, tt.ceiling
+			price, err := c.gasPrice(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if price.Int64() != tt.want {
+				t.Fatalf("gasPrice() = %v, want %v", price, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package ethereum
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// maxNonceRetries is the number of times a transaction is resent
+// with a fresh nonce after being rejected for a nonce which is too low
+const maxNonceRetries = 3
+
+// nonceBackend is used to retrieve the next nonce of an account from our node
+type nonceBackend interface {
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+}
+
+// accountNonces is the local nonce state of a single account
+type accountNonces struct {
+	synced bool
+	// next is the nonce reserved when there are no released nonces to reuse
+	next uint64
+	// released are nonces which were reserved but never broadcast
+	released []uint64
+	// inFlight is the number of reserved nonces yet to be released or finished
+	inFlight int
+}
+
+// NonceManager is used to reserve nonces locally, allowing several transactions
+// from the same account to be broadcast without waiting for each other to be mined.
+// Nonces reserved by transactions which fail to broadcast are reused, so that they
+// don't leave a gap stalling every transaction after them, and whenever no
+// transactions are in flight the nonce is resynced with our node
+type NonceManager struct {
+	backend  nonceBackend
+	mux      sync.Mutex
+	accounts map[common.Address]*accountNonces
+}
+
+// NewNonceManager is used to instantiate our nonce manager
+func NewNonceManager(backend nonceBackend) *NonceManager {
+	return &NonceManager{backend: backend, accounts: make(map[common.Address]*accountNonces)}
+}
+
+// Sync is used to reset the nonce of an account to the next nonce known to
+// our node, and should be called at startup before any transactions are sent
+func (nm *NonceManager) Sync(ctx context.Context, account common.Address) error {
+	nm.mux.Lock()
+	defer nm.mux.Unlock()
+	return nm.sync(ctx, account, nm.account(account))
+}
+
+// Reserve is used to reserve the next nonce of an account, which must
+// be handed back through either Release or Finish once used
+func (nm *NonceManager) Reserve(ctx context.Context, account common.Address) (uint64, error) {
+	nm.mux.Lock()
+	defer nm.mux.Unlock()
+	an := nm.account(account)
+	// with nothing in flight our node knows of every transaction we sent,
+	// which recovers from any transactions dropped from its pool
+	if !an.synced || an.inFlight == 0 {
+		if err := nm.sync(ctx, account, an); err != nil {
+			return 0, err
+		}
+	}
+	an.inFlight++
+	return an.take(), nil
+}
+
+// Release is used to hand back a nonce which was never broadcast, so
+// that it is reused by the next transaction rather than left as a gap
+func (nm *NonceManager) Release(account common.Address, nonce uint64) {
+	nm.mux.Lock()
+	defer nm.mux.Unlock()
+	an := nm.account(account)
+	an.inFlight--
+	if nonce+1 == an.next {
+		an.next--
+		return
+	}
+	an.released = append(an.released, nonce)
+	sort.Slice(an.released, func(i, j int) bool { return an.released[i] < an.released[j] })
+}
+
+// Finish is used to hand back a nonce which was used by a broadcast transaction
+func (nm *NonceManager) Finish(account common.Address) {
+	nm.mux.Lock()
+	defer nm.mux.Unlock()
+	nm.account(account).inFlight--
+}
+
+// Skip is used after a transaction was rejected for a nonce which is too low,
+// reserving a fresh nonce in its place past any nonces used outside of the nonce
+// manager, without disturbing those reserved by transactions still in flight
+func (nm *NonceManager) Skip(ctx context.Context, account common.Address, used uint64) (uint64, error) {
+	nm.mux.Lock()
+	defer nm.mux.Unlock()
+	an := nm.account(account)
+	pending, err := nm.backend.PendingNonceAt(ctx, account)
+	if err != nil {
+		an.inFlight--
+		return 0, err
+	}
+	// our node may lag behind the node which rejected the transaction
+	if pending <= used {
+		pending = used + 1
+	}
+	if pending > an.next {
+		an.next = pending
+	}
+	var released []uint64
+	for _, nonce := range an.released {
+		if nonce >= pending {
+			released = append(released, nonce)
+		}
+	}
+	an.released = released
+	return an.take(), nil
+}
+
+// account returns the nonce state of an account, and must be called with mux held
+func (nm *NonceManager) account(account common.Address) *accountNonces {
+	an, ok := nm.accounts[account]
+	if !ok {
+		an = &accountNonces{}
+		nm.accounts[account] = an
+	}
+	return an
+}
+
+// sync is used to reset the nonce state of an account, and must be called with mux held
+func (nm *NonceManager) sync(ctx context.Context, account common.Address, an *accountNonces) error {
+	pending, err := nm.backend.PendingNonceAt(ctx, account)
+	if err != nil {
+		return err
+	}
+	an.next = pending
+	an.released = nil
+	an.synced = true
+	return nil
+}
+
+// take is used to take the lowest released nonce, or the next nonce should there be none
+func (an *accountNonces) take() uint64 {
+	if len(an.released) > 0 {
+		nonce := an.released[0]
+		an.released = an.released[1:]
+		return nonce
+	}
+	nonce := an.next
+	an.next++
+	return nonce
+}
+
+// isNonceTooLow is used to check whether a transaction was rejected
+// by our node as its nonce has already been used
+func isNonceTooLow(err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "nonce too low")
+}
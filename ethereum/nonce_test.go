@@ -0,0 +1,99 @@
+package ethereum
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type fakeNonceBackend struct {
+	pending uint64
+}
+
+func (fb *fakeNonceBackend) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return fb.pending, nil
+}
+
+func Test_NonceManager(t *testing.T) {
+	ctx := context.Background()
+	account := common.HexToAddress("0x1")
+	fb := &fakeNonceBackend{pending: 10}
+	nm := NewNonceManager(fb)
+	reserve := func(want uint64) {
+		t.Helper()
+		nonce, err := nm.Reserve(ctx, account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nonce != want {
+			t.Fatalf("reserved nonce %v, want %v", nonce, want)
+		}
+	}
+	// concurrent transactions get consecutive nonces
+	reserve(10)
+	reserve(11)
+	reserve(12)
+	// a nonce which was never broadcast is reused rather than left as a gap
+	nm.Release(account, 11)
+	reserve(11)
+	reserve(13)
+	// nonces used outside of the nonce manager are skipped
+	fb.pending = 20
+	nonce, err := nm.Skip(ctx, account, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce != 20 {
+		t.Fatalf("skipped to nonce %v, want 20", nonce)
+	}
+	// once nothing is in flight the node is authoritative, recovering
+	// from transactions which were dropped from its pool
+	for i := 0; i < 4; i++ {
+		nm.Finish(account)
+	}
+	fb.pending = 15
+	reserve(15)
+}
+
+func Test_TxManager_NonceTooLow(t *testing.T) {
+	fb := &fakeTxBackend{}
+	tm := NewTxManager(fb, func(context.Context) (*big.Int, error) {
+		return big.NewInt(100), nil
+	}, TxOpts{})
+	auth := &bind.TransactOpts{From: common.HexToAddress("0x1")}
+	var nonces []uint64
+	_, err := tm.broadcast(context.Background(), auth, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		nonces = append(nonces, opts.Nonce.Uint64())
+		return nil, errors.New("nonce too low")
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if len(nonces) != maxNonceRetries+1 {
+		t.Fatalf("sent %v times, want %v", len(nonces), maxNonceRetries+1)
+	}
+	// the node lags behind, so we move past the used nonces ourselves
+	for i, nonce := range nonces {
+		if nonce != uint64(5+i) {
+			t.Fatalf("attempt %v used nonce %v, want %v", i, nonce, 5+i)
+		}
+	}
+	// a failure unrelated to the nonce hands it back for reuse
+	if _, err := tm.broadcast(context.Background(), auth, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return nil, errors.New("execution reverted")
+	}); err == nil {
+		t.Fatal("expected error")
+	}
+	nonce, err := tm.Nonces.Reserve(context.Background(), auth.From)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce != 5 {
+		t.Fatalf("reserved nonce %v, want 5", nonce)
+	}
+}
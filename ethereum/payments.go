@@ -0,0 +1,139 @@
+package ethereum
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/RTradeLtd/Pay/ethereum/bindings/payments"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// PaymentMethodRTC is the payment method used by the payment contract for RTC payments
+	PaymentMethodRTC = uint8(0)
+	// PaymentMethodETH is the payment method used by the payment contract for ETH payments
+	PaymentMethodETH = uint8(1)
+
+	// ErrNoPaymentEvent is an error used to indicate that a transaction
+	// did not emit a payment event from the payment contract
+	ErrNoPaymentEvent = "no payment event emitted by the payment contract"
+	// ErrPaymentNumberMismatch is an error used to indicate that the
+	// payment number of a payment event does not match the payment
+	ErrPaymentNumberMismatch = "payment number does not match payment"
+	// ErrPaymentMethodMismatch is an error used to indicate that the
+	// payment method of a payment event does not match the payment
+	ErrPaymentMethodMismatch = "payment method does not match payment"
+	// ErrPaymentAmountMismatch is an error used to indicate that the
+	// charge amount of a payment event does not match the payment
+	ErrPaymentAmountMismatch = "charge amount does not match payment"
+	// ErrPayerMismatch is an error used to indicate that the
+	// payer of a payment event does not match the payment
+	ErrPayerMismatch = "payer does not match payment"
+)
+
+// paymentContract is the parsed abi of the payment contract binding
+var paymentContract abi.ABI
+
+func init() {
+	var err error
+	if paymentContract, err = abi.JSON(strings.NewReader(payments.PaymentsABI)); err != nil {
+		panic(err)
+	}
+}
+
+// PaymentEvent is a decoded PaymentMade event of the payment contract
+type PaymentEvent struct {
+	Payer             common.Address
+	PaymentNumber     *big.Int
+	PaymentMethod     uint8
+	ChargeAmountInWei *big.Int
+}
+
+// ExpectedPayment is the payment as recorded in our database,
+// which a payment event must match to be considered valid
+type ExpectedPayment struct {
+	Payer             common.Address
+	PaymentNumber     int64
+	PaymentMethod     uint8
+	ChargeAmountInWei *big.Int
+}
+
+// PaymentEvent is used to retrieve the payment event emitted by a transaction
+func (c *Client) PaymentEvent(ctx context.Context, txHash string) (*PaymentEvent, error) {
+	rcpt, err := c.ETH.TransactionReceipt(ctx, common.HexToHash(txHash))
+	if err != nil {
+		return nil, err
+	}
+	return decodePaymentEvent(rcpt.Logs, common.HexToAddress(c.PaymentContractAddress))
+}
+
+// PaymentSignerAccepted is used to check whether the payment contract accepts
+// payment messages signed by the given address. During a rotation of our payment
+// key the contract accepts both the current and next key
+func (c *Client) PaymentSignerAccepted(ctx context.Context, address common.Address) (bool, error) {
+	contract, err := payments.NewPaymentsCaller(common.HexToAddress(c.PaymentContractAddress), c.ETH)
+	if err != nil {
+		return false, err
+	}
+	return contract.IsSigner(&bind.CallOpts{Context: ctx}, address)
+}
+
+// Matches is used to check that a payment event matches the expected payment
+func (pe *PaymentEvent) Matches(expected *ExpectedPayment) error {
+	if pe.PaymentNumber.Cmp(big.NewInt(expected.PaymentNumber)) != 0 {
+		return errors.New(ErrPaymentNumberMismatch)
+	}
+	if pe.PaymentMethod != expected.PaymentMethod {
+		return errors.New(ErrPaymentMethodMismatch)
+	}
+	if pe.ChargeAmountInWei.Cmp(expected.ChargeAmountInWei) != 0 {
+		return errors.New(ErrPaymentAmountMismatch)
+	}
+	if pe.Payer != expected.Payer {
+		return errors.New(ErrPayerMismatch)
+	}
+	return nil
+}
+
+// PaymentMethod returns the payment contract method of a payment type
+func PaymentMethod(paymentType string) (uint8, error) {
+	switch strings.ToLower(paymentType) {
+	case "rtc":
+		return PaymentMethodRTC, nil
+	case "eth":
+		return PaymentMethodETH, nil
+	default:
+		return 0, errors.New("unsupported payment type " + paymentType)
+	}
+}
+
+// decodePaymentEvent is used to find and decode the payment event emitted by the
+// payment contract, ignoring logs emitted by other contracts such as the RTC token
+func decodePaymentEvent(logs []*types.Log, contract common.Address) (*PaymentEvent, error) {
+	filterer, err := payments.NewPaymentsFilterer(contract, nil)
+	if err != nil {
+		return nil, err
+	}
+	event := paymentContract.Events["PaymentMade"]
+	for _, log := range logs {
+		if log.Address != contract || len(log.Topics) != 2 || log.Topics[0] != event.ID() {
+			continue
+		}
+		made, err := filterer.ParsePaymentMade(*log)
+		if err != nil {
+			return nil, err
+		}
+		return &PaymentEvent{
+			Payer:             made.Payer,
+			PaymentNumber:     made.PaymentNumber,
+			PaymentMethod:     made.PaymentMethod,
+			ChargeAmountInWei: made.ChargeAmountInWei,
+		}, nil
+	}
+	return nil, errors.New(ErrNoPaymentEvent)
+}
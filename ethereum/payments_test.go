@@ -0,0 +1,73 @@
+package ethereum
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/RTradeLtd/Pay/server/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func Test_DecodePaymentEvent(t *testing.T) {
+	contract := common.HexToAddress("0x1")
+	payer := common.HexToAddress("0x2")
+	event := paymentContract.Events["PaymentMade"]
+	data, err := event.Inputs.NonIndexed().Pack(big.NewInt(5), PaymentMethodRTC, utils.FloatToBigInt(1.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	topics := []common.Hash{event.ID(), common.BytesToHash(payer.Bytes())}
+	logs := []*types.Log{
+		// an rtc transfer emitted by the token contract
+		{Address: common.HexToAddress("0x3"), Topics: topics, Data: data},
+		{Address: contract, Topics: topics, Data: data},
+	}
+	pe, err := decodePaymentEvent(logs, contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ExpectedPayment{
+		Payer:             payer,
+		PaymentNumber:     5,
+		PaymentMethod:     PaymentMethodRTC,
+		ChargeAmountInWei: big.NewInt(1500000000000000000),
+	}
+	if err := pe.Matches(&expected); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		modify  func(ep *ExpectedPayment)
+		wantErr string
+	}{
+		{"number", func(ep *ExpectedPayment) { ep.PaymentNumber = 6 }, ErrPaymentNumberMismatch},
+		{"method", func(ep *ExpectedPayment) { ep.PaymentMethod = PaymentMethodETH }, ErrPaymentMethodMismatch},
+		{"amount", func(ep *ExpectedPayment) { ep.ChargeAmountInWei = utils.FloatToBigInt(1) }, ErrPaymentAmountMismatch},
+		{"payer", func(ep *ExpectedPayment) { ep.Payer = contract }, ErrPayerMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := expected
+			tt.modify(&ep)
+			if err := pe.Matches(&ep); err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("Matches() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	if _, err := decodePaymentEvent(logs[:1], contract); err == nil || err.Error() != ErrNoPaymentEvent {
+		t.Fatalf("decodePaymentEvent() error = %v, want %v", err, ErrNoPaymentEvent)
+	}
+}
+
+func Test_PaymentMethod(t *testing.T) {
+	if method, err := PaymentMethod("RTC"); err != nil || method != PaymentMethodRTC {
+		t.Fatal("bad method returned for rtc")
+	}
+	if method, err := PaymentMethod("eth"); err != nil || method != PaymentMethodETH {
+		t.Fatal("bad method returned for eth")
+	}
+	if _, err := PaymentMethod("xmr"); err == nil {
+		t.Fatal("error expected")
+	}
+}
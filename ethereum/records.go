@@ -0,0 +1,99 @@
+package ethereum
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	ens "github.com/wealdtech/go-ens/v3"
+)
+
+const (
+	// ErrUnsupportedTextKey is an error used to indicate that
+	// users may not set text records with the given key
+	ErrUnsupportedTextKey = "unsupported text record key"
+	// ErrInvalidOwner is an error used to indicate that a
+	// subdomain can't be transferred to the given owner
+	ErrInvalidOwner = "subdomain can't be transferred to the zero address"
+	// ErrInvalidLabel is an error used to indicate that a
+	// subdomain label is not a valid, single, ens label
+	ErrInvalidLabel = "invalid subdomain label"
+)
+
+// TextRecordKeys are the EIP-634 text record keys users may set
+var TextRecordKeys = map[string]bool{
+	"url":         true,
+	"avatar":      true,
+	"email":       true,
+	"description": true,
+	"notice":      true,
+	"keywords":    true,
+	"com.github":  true,
+	"com.twitter": true,
+}
+
+// SetText is used to set a text record of a particular *.ipfstemporal.eth subdomain
+func (c *Client) SetText(ctx context.Context, subName, parentName, key, value string) error {
+	update, err := c.TextUpdate(subName, parentName, key, value)
+	if err != nil {
+		return err
+	}
+	return c.applyUpdate(ctx, update)
+}
+
+// SetCoinAddress is used to set the address record of a coin type,
+// for a particular *.ipfstemporal.eth subdomain
+func (c *Client) SetCoinAddress(ctx context.Context, subName, parentName string, coinType uint64, address string) error {
+	update, err := c.CoinAddressUpdate(subName, parentName, coinType, address)
+	if err != nil {
+		return err
+	}
+	return c.applyUpdate(ctx, update)
+}
+
+// TransferSubDomain is used to transfer ownership of a particular *.ipfstemporal.eth
+// subdomain to the given owner. Once transferred, we can no longer manage its records
+func (c *Client) TransferSubDomain(ctx context.Context, subName, parentName string, owner common.Address) error {
+	if owner == (common.Address{}) {
+		return errors.New(ErrInvalidOwner)
+	}
+	registry, err := ens.NewRegistry(c.ETH)
+	if err != nil {
+		return err
+	}
+	return c.sendTx(ctx, "transfer-subdomain", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return registry.SetOwner(opts, c.GetCombinedName(subName, parentName), owner)
+	})
+}
+
+// SubdomainOwner is used to retrieve the owner of a particular *.ipfstemporal.eth subdomain
+func (c *Client) SubdomainOwner(subName, parentName string) (common.Address, error) {
+	registry, err := ens.NewRegistry(c.ETH)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return registry.Owner(c.GetCombinedName(subName, parentName))
+}
+
+// Account returns the address of our unlocked account
+func (c *Client) Account() common.Address {
+	return c.Auth.From
+}
+
+// NormalizeLabel is used to normalise a subdomain label according to the ENS
+// normalisation rules, with strict DNS rules disallowing spaces and underscores.
+// Labels which can't be normalised, or which would create more than a single
+// level of subdomain, are rejected
+func NormalizeLabel(label string) (string, error) {
+	normalized, err := ens.NormaliseDomainStrict(label)
+	if err != nil {
+		return "", errors.New(ErrInvalidLabel)
+	}
+	if normalized == "" || strings.Contains(normalized, ".") {
+		return "", errors.New(ErrInvalidLabel)
+	}
+	return normalized, nil
+}
@@ -0,0 +1,32 @@
+package ethereum
+
+import "testing"
+
+func Test_NormalizeLabel(t *testing.T) {
+	tests := []struct {
+		label   string
+		want    string
+		wantErr bool
+	}{
+		{"alice", "alice", false},
+		{"Alice", "alice", false},
+		{"ÅSA", "åsa", false},
+		{"bob-2", "bob-2", false},
+		{"", "", true},
+		{"bad.name", "", true},
+		{"bad name", "", true},
+		{"bad_name", "", true},
+		{"*", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			got, err := NormalizeLabel(tt.label)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeLabel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("NormalizeLabel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
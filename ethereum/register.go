@@ -0,0 +1,153 @@
+package ethereum
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	ens "github.com/wealdtech/go-ens/v3"
+)
+
+const (
+	// registrationPeriod is the number of seconds names are registered for
+	registrationPeriod = int64(31536000)
+
+	// ErrNameUnavailable is an error used to indicate that a
+	// name is already registered, or can't be registered
+	ErrNameUnavailable = "name is not available for registration"
+)
+
+// NewRegistrationSecret is used to generate the secret a name registration
+// is committed to, which must be persisted until the registration is revealed
+func NewRegistrationSecret() ([32]byte, error) {
+	var secret [32]byte
+	_, err := rand.Read(secret[:])
+	return secret, err
+}
+
+// CommitName is used to send the commitment starting the registration of a
+// .eth name, waiting for it to be mined. The registration is completed by
+// RevealName once the minimum commitment interval has passed
+func (c *Client) CommitName(ctx context.Context, name string, secret [32]byte) error {
+	c.txMux.Lock()
+	defer c.txMux.Unlock()
+	controller, err := ens.NewETHController(c.ETH, "eth")
+	if err != nil {
+		return err
+	}
+	available, err := controller.IsAvailable(name)
+	if err != nil {
+		return err
+	}
+	if !available {
+		return errors.New(ErrNameUnavailable)
+	}
+	return c.sendTx(ctx, "register-name-commit", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return controller.Commit(opts, name, c.Auth.From, secret)
+	})
+}
+
+// CommitmentTime is used to retrieve the time the commitment to register
+// a name was mined, returning the zero time if there is no commitment
+func (c *Client) CommitmentTime(name string, secret [32]byte) (time.Time, error) {
+	controller, err := ens.NewETHController(c.ETH, "eth")
+	if err != nil {
+		return time.Time{}, err
+	}
+	ts, err := controller.CommitmentTime(name, c.Auth.From, secret)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ts.Sign() == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(ts.Int64(), 0), nil
+}
+
+// CommitmentIntervals is used to retrieve the minimum and maximum
+// time which may pass between a commitment and its reveal
+func (c *Client) CommitmentIntervals() (time.Duration, time.Duration, error) {
+	controller, err := ens.NewETHController(c.ETH, "eth")
+	if err != nil {
+		return 0, 0, err
+	}
+	min, err := controller.MinCommitmentInterval()
+	if err != nil {
+		return 0, 0, err
+	}
+	max, err := controller.MaxCommitmentInterval()
+	if err != nil {
+		return 0, 0, err
+	}
+	return time.Duration(min.Int64()) * time.Second, time.Duration(max.Int64()) * time.Second, nil
+}
+
+// RevealName is used to complete the registration of a committed name,
+// paying the rent for a year, and waiting for it to be mined
+func (c *Client) RevealName(ctx context.Context, name string, secret [32]byte) error {
+	c.txMux.Lock()
+	defer c.txMux.Unlock()
+	controller, err := ens.NewETHController(c.ETH, "eth")
+	if err != nil {
+		return err
+	}
+	costSec, err := controller.RentCost(name)
+	if err != nil {
+		return err
+	}
+	cost := new(big.Int).Mul(costSec, big.NewInt(registrationPeriod))
+	return c.sendTx(ctx, "register-name-reveal", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		opts.Value = cost
+		return controller.Reveal(opts, name, c.Auth.From, secret)
+	})
+}
+
+// NameRegistered is used to check whether a name is registered to our account
+func (c *Client) NameRegistered(name string) (bool, error) {
+	registry, err := ens.NewRegistry(c.ETH)
+	if err != nil {
+		return false, err
+	}
+	owner, err := registry.Owner(name)
+	if err != nil {
+		return false, err
+	}
+	return owner == c.Auth.From, nil
+}
+
+// NameExpiry is used to retrieve the time the registration of a .eth name expires
+func (c *Client) NameExpiry(name string) (time.Time, error) {
+	nm, err := ens.NewName(c.ETH, name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return nm.Expires()
+}
+
+// RenewName is used to extend the registration of a .eth name by a
+// year, waiting for the renewal to be mined and returning its hash
+func (c *Client) RenewName(ctx context.Context, name string) (string, error) {
+	c.txMux.Lock()
+	defer c.txMux.Unlock()
+	controller, err := ens.NewETHController(c.ETH, "eth")
+	if err != nil {
+		return "", err
+	}
+	costSec, err := controller.RentCost(name)
+	if err != nil {
+		return "", err
+	}
+	cost := new(big.Int).Mul(costSec, big.NewInt(registrationPeriod))
+	rcpt, err := c.Tx.Send(ctx, c.Auth, "renew-name", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		opts.Value = cost
+		return controller.Renew(opts, name)
+	})
+	if err != nil {
+		return "", err
+	}
+	return rcpt.TxHash.Hex(), nil
+}
@@ -0,0 +1,87 @@
+package ethereum
+
+import (
+	"context"
+	"time"
+
+	"github.com/RTradeLtd/Pay/tracker"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"go.uber.org/zap"
+)
+
+// blockTime is roughly the time between ethereum blocks
+const blockTime = time.Second * 15
+
+// TrackBlocks is used to subscribe to new heads, so that transactions waiting on
+// confirmations are checked once per block instead of polling our node. The
+// subscription lasts until the context is cancelled
+func (c *Client) TrackBlocks(ctx context.Context, l *zap.SugaredLogger) {
+	c.tracker = tracker.New(blockTime)
+	go c.tracker.Run(ctx, l, &headSource{c: c})
+}
+
+// headSource is a tracker.Source using the new heads subscription of our node
+type headSource struct {
+	c *Client
+}
+
+// Subscribe is used to send the number of each new head to heights. If our
+// connection doesn't support notifications, as is the case over http, our
+// node is polled for new heads instead
+func (hs *headSource) Subscribe(ctx context.Context, heights chan<- uint64) error {
+	headers := make(chan *types.Header)
+	sub, err := hs.c.ETH.SubscribeNewHead(ctx, headers)
+	if err == rpc.ErrNotificationsUnsupported {
+		poll := &tracker.PollSource{Interval: blockTime, Height: func(ctx context.Context) (uint64, error) {
+			header, err := hs.c.ETH.HeaderByNumber(ctx, nil)
+			if err != nil {
+				return 0, err
+			}
+			return header.Number.Uint64(), nil
+		}}
+		return poll.Subscribe(ctx, heights)
+	} else if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case header := <-headers:
+			select {
+			case heights <- header.Number.Uint64():
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case err := <-sub.Err():
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// seenHeight returns the height of the last block seen by the tracker, if any
+func (c *Client) seenHeight() uint64 {
+	if c.tracker != nil {
+		return c.tracker.Height()
+	}
+	return 0
+}
+
+// waitForBlock is used to wait for a block above the seen height if we are tracking
+// blocks, otherwise it pauses for roughly the duration of a block. Either returns
+// early with the error of the context once it is cancelled
+func (c *Client) waitForBlock(ctx context.Context, seen uint64) error {
+	if c.tracker != nil {
+		return c.tracker.Wait(ctx, seen)
+	}
+	timer := time.NewTimer(blockTime)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
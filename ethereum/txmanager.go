@@ -0,0 +1,349 @@
+package ethereum
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"time"
+
+	geth "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// AttemptKind denotes why a transaction was broadcast
+type AttemptKind string
+
+func (ak AttemptKind) String() string {
+	return string(ak)
+}
+
+const (
+	// AttemptSend is the first broadcast of a transaction
+	AttemptSend = AttemptKind("send")
+	// AttemptSpeedUp is a rebroadcast of a transaction with a higher gas price
+	AttemptSpeedUp = AttemptKind("speed-up")
+	// AttemptCancel is a zero value transfer to ourselves replacing a stuck transaction
+	AttemptCancel = AttemptKind("cancel")
+
+	// ErrTxCancelled is an error used to indicate that a stuck
+	// transaction was replaced by a cancellation
+	ErrTxCancelled = "transaction was cancelled after repeated attempts"
+	// ErrTxFailed is an error used to indicate that a transaction was mined but reverted
+	ErrTxFailed = "tx with incorrect status"
+	// ErrTxStuck is an error used to indicate that neither a transaction nor
+	// its cancellation was mined after repeated attempts
+	ErrTxStuck = "transaction was neither mined nor cancelled after repeated attempts"
+	// ErrGasCeiling is an error used to indicate that a transaction can't be
+	// replaced, as the gas price required to replace it exceeds our ceiling
+	ErrGasCeiling = "replacing transaction would exceed the gas price ceiling"
+)
+
+// errWaitTimeout is returned when no attempt at a transaction is mined in time
+var errWaitTimeout = errors.New("timed out waiting for transaction to be mined")
+
+var (
+	// minedPollInterval is the time waited between checks for mined transactions
+	minedPollInterval = time.Second * 5
+	// cancelGasLimit is the gas limit of a transfer to ourselves
+	cancelGasLimit = uint64(21000)
+)
+
+// TxOpts is used to configure how long we wait for transactions
+// to be mined, and how they are replaced if they aren't
+type TxOpts struct {
+	// Timeout is how long to wait for each attempt to be mined
+	Timeout time.Duration
+	// BumpPercent is the percentage the gas price is increased by on each
+	// attempt, and must be at least 10 for nodes to accept the replacement
+	BumpPercent int64
+	// MaxAttempts is the number of attempts made before cancelling the
+	// transaction, and the number of attempts made at cancelling it
+	MaxAttempts int
+	// GasCeiling bounds the gas price of replacements, and is ignored if nil
+	GasCeiling *big.Int
+}
+
+// withDefaults returns the options with defaults in place of unset fields
+func (to TxOpts) withDefaults() TxOpts {
+	if to.Timeout <= 0 {
+		to.Timeout = time.Minute * 5
+	}
+	if to.BumpPercent < 10 {
+		to.BumpPercent = 20
+	}
+	if to.MaxAttempts <= 0 {
+		to.MaxAttempts = 3
+	}
+	return to
+}
+
+// TxRecorder is used to record every attempt at getting a transaction mined
+type TxRecorder interface {
+	// RecordAttempt is used to record the broadcast of a transaction
+	RecordAttempt(operation string, kind AttemptKind, tx *types.Transaction) error
+	// RecordMined is used to record the attempt which was mined
+	RecordMined(hash common.Hash, status uint64) error
+}
+
+// txBackend is used to broadcast transactions and check whether they were mined
+type txBackend interface {
+	nonceBackend
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+// TxManager is used to send transactions and wait for them to be mined. A transaction
+// which isn't mined in time is rebroadcast with the same nonce and a bumped gas
+// price, and is cancelled once all attempts have been made, so that a single
+// underpriced transaction can't stall every transaction sent after it
+type TxManager struct {
+	backend txBackend
+	price   func(ctx context.Context) (*big.Int, error)
+	opts    TxOpts
+	// Nonces reserves the nonces of our transactions, allowing
+	// them to be sent without waiting for each other to be mined
+	Nonces *NonceManager
+	// Recorder records every attempt, and is ignored if nil
+	Recorder TxRecorder
+}
+
+// NewTxManager is used to instantiate our transaction manager, pricing
+// transactions with the given gas price function
+func NewTxManager(backend txBackend, price func(ctx context.Context) (*big.Int, error), opts TxOpts) *TxManager {
+	return &TxManager{
+		backend: backend,
+		price:   price,
+		opts:    opts.withDefaults(),
+		Nonces:  NewNonceManager(backend),
+	}
+}
+
+// Send is used to send the transaction created by send, and wait for it to be mined
+func (tm *TxManager) Send(
+	ctx context.Context,
+	auth *bind.TransactOpts,
+	operation string,
+	send func(opts *bind.TransactOpts) (*types.Transaction, error),
+) (*types.Receipt, error) {
+	price, err := tm.price(ctx)
+	if err != nil {
+		return nil, err
+	}
+	opts := *auth
+	opts.GasPrice = price
+	opts.Context = ctx
+	tx, err := tm.broadcast(ctx, &opts, send)
+	if err != nil {
+		return nil, err
+	}
+	defer tm.Nonces.Finish(auth.From)
+	tm.record(operation, AttemptSend, tx)
+	attempts := []*types.Transaction{tx}
+	for len(attempts) < tm.opts.MaxAttempts {
+		rcpt, err := tm.wait(ctx, attempts)
+		if err != errWaitTimeout {
+			return rcpt, err
+		}
+		tx, err = tm.replace(ctx, auth, tx, *tx.To(), tx.Value(), tx.Gas(), tx.Data())
+		if err != nil {
+			// an attempt mined after we stopped waiting causes the replacement to
+			// be rejected, as its nonce is too low or it is underpriced
+			if rcpt, minedErr := tm.mined(ctx, attempts); minedErr != nil || rcpt != nil {
+				return rcpt, minedErr
+			}
+			return nil, err
+		}
+		tm.record(operation, AttemptSpeedUp, tx)
+		attempts = append(attempts, tx)
+	}
+	rcpt, err := tm.wait(ctx, attempts)
+	if err != errWaitTimeout {
+		return rcpt, err
+	}
+	rcpt, cancelled, err := tm.cancel(ctx, auth, operation, attempts)
+	if err != nil {
+		return nil, err
+	}
+	// one of our attempts may still have been mined ahead of the cancellation
+	if !cancelled {
+		return rcpt, nil
+	}
+	return nil, errors.New(ErrTxCancelled)
+}
+
+// broadcast is used to send a transaction with a reserved nonce. Should the nonce have
+// been used outside of the nonce manager, the nonce is resynced and the send retried
+func (tm *TxManager) broadcast(
+	ctx context.Context,
+	opts *bind.TransactOpts,
+	send func(opts *bind.TransactOpts) (*types.Transaction, error),
+) (*types.Transaction, error) {
+	nonce, err := tm.Nonces.Reserve(ctx, opts.From)
+	if err != nil {
+		return nil, err
+	}
+	for retries := 0; ; retries++ {
+		opts.Nonce = new(big.Int).SetUint64(nonce)
+		tx, err := send(opts)
+		if err == nil {
+			return tx, nil
+		}
+		if !isNonceTooLow(err) {
+			tm.Nonces.Release(opts.From, nonce)
+			return nil, err
+		}
+		// the nonce was used, so it is finished rather than released
+		if retries >= maxNonceRetries {
+			tm.Nonces.Finish(opts.From)
+			return nil, err
+		}
+		if nonce, err = tm.Nonces.Skip(ctx, opts.From, nonce); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Cancel is used to replace a stuck transaction with a zero value transfer to
+// ourselves, freeing up its nonce, returning false if the stuck transaction
+// was mined before the cancellation
+func (tm *TxManager) Cancel(
+	ctx context.Context, auth *bind.TransactOpts, operation string, stuck *types.Transaction,
+) (bool, error) {
+	_, cancelled, err := tm.cancel(ctx, auth, operation, []*types.Transaction{stuck})
+	return cancelled, err
+}
+
+// cancel is used to replace the attempts at a transaction with a cancellation, which
+// is itself sped up until either it or one of the attempts is mined, returning the
+// receipt of the mined transaction and whether it was the cancellation. Should
+// neither be mined after MaxAttempts cancellations, ErrTxStuck is returned
+func (tm *TxManager) cancel(
+	ctx context.Context, auth *bind.TransactOpts, operation string, attempts []*types.Transaction,
+) (*types.Receipt, bool, error) {
+	previous := attempts[len(attempts)-1]
+	var cancels []*types.Transaction
+	isCancel := func(rcpt *types.Receipt) bool {
+		for _, cancel := range cancels {
+			if rcpt.TxHash == cancel.Hash() {
+				return true
+			}
+		}
+		return false
+	}
+	for len(cancels) < tm.opts.MaxAttempts {
+		tx, err := tm.replace(ctx, auth, previous, auth.From, big.NewInt(0), cancelGasLimit, nil)
+		if err != nil {
+			// as when speeding up, the replacement is rejected
+			// should an earlier attempt have been mined
+			rcpt, minedErr := tm.mined(ctx, append(cancels, attempts...))
+			if minedErr != nil {
+				return nil, false, minedErr
+			} else if rcpt != nil {
+				return rcpt, isCancel(rcpt), nil
+			}
+			return nil, false, err
+		}
+		tm.record(operation, AttemptCancel, tx)
+		cancels = append(cancels, tx)
+		previous = tx
+		rcpt, err := tm.wait(ctx, append(cancels, attempts...))
+		if err == errWaitTimeout {
+			continue
+		} else if err != nil {
+			return nil, false, err
+		}
+		return rcpt, isCancel(rcpt), nil
+	}
+	return nil, false, errors.New(ErrTxStuck)
+}
+
+// replace is used to sign and broadcast a transaction with the same nonce as
+// the previous attempt, and a gas price high enough for nodes to replace it.
+// Should that gas price exceed our ceiling, the replacement isn't sent
+func (tm *TxManager) replace(
+	ctx context.Context,
+	auth *bind.TransactOpts,
+	previous *types.Transaction,
+	to common.Address,
+	value *big.Int,
+	gasLimit uint64,
+	data []byte,
+) (*types.Transaction, error) {
+	price, err := tm.price(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bumped := new(big.Int).Mul(previous.GasPrice(), big.NewInt(100+tm.opts.BumpPercent))
+	bumped.Div(bumped, big.NewInt(100))
+	if tm.opts.GasCeiling != nil && bumped.Cmp(tm.opts.GasCeiling) > 0 {
+		return nil, errors.New(ErrGasCeiling)
+	}
+	if price.Cmp(bumped) < 0 {
+		price = bumped
+	}
+	price = clampGasPrice(price, nil, tm.opts.GasCeiling)
+	tx, err := auth.Signer(
+		types.HomesteadSigner{},
+		auth.From,
+		types.NewTransaction(previous.Nonce(), to, value, gasLimit, price, data),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := tm.backend.SendTransaction(ctx, tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// wait is used to wait for any of the attempts at a transaction to be mined,
+// returning errWaitTimeout should none be mined before the timeout
+func (tm *TxManager) wait(ctx context.Context, attempts []*types.Transaction) (*types.Receipt, error) {
+	timeout := time.NewTimer(tm.opts.Timeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(minedPollInterval)
+	defer ticker.Stop()
+	for {
+		if rcpt, err := tm.mined(ctx, attempts); err != nil || rcpt != nil {
+			return rcpt, err
+		}
+		select {
+		case <-ticker.C:
+		case <-timeout.C:
+			return nil, errWaitTimeout
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// mined is used to check whether any of the attempts at a transaction
+// has been mined, returning a nil receipt if none has
+func (tm *TxManager) mined(ctx context.Context, attempts []*types.Transaction) (*types.Receipt, error) {
+	for _, tx := range attempts {
+		rcpt, err := tm.backend.TransactionReceipt(ctx, tx.Hash())
+		if err == geth.NotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if tm.Recorder != nil {
+			tm.Recorder.RecordMined(tx.Hash(), rcpt.Status)
+		}
+		if rcpt.Status != types.ReceiptStatusSuccessful {
+			return nil, errors.New(ErrTxFailed)
+		}
+		return rcpt, nil
+	}
+	return nil, nil
+}
+
+// record is used to record an attempt. As the transaction has
+// already been broadcast, a failure to record it is ignored
+func (tm *TxManager) record(operation string, kind AttemptKind, tx *types.Transaction) {
+	if tm.Recorder != nil {
+		tm.Recorder.RecordAttempt(operation, kind, tx)
+	}
+}
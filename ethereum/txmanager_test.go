@@ -0,0 +1,175 @@
+package ethereum
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	geth "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// fakeTxBackend mines the transaction broadcast at the given index
+type fakeTxBackend struct {
+	mux    sync.Mutex
+	sent   []*types.Transaction
+	mineAt int
+	// rejectAt rejects the broadcast at the given index as its nonce is too low,
+	// mining the previous attempt only once it is rejected, 0 to disable
+	rejectAt int
+}
+
+func (fb *fakeTxBackend) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return 5, nil
+}
+
+func (fb *fakeTxBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	fb.mux.Lock()
+	defer fb.mux.Unlock()
+	if fb.rejectAt > 0 && len(fb.sent) == fb.rejectAt {
+		fb.mineAt = fb.rejectAt - 1
+		return errors.New("nonce too low")
+	}
+	fb.sent = append(fb.sent, tx)
+	return nil
+}
+
+func (fb *fakeTxBackend) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	fb.mux.Lock()
+	defer fb.mux.Unlock()
+	if fb.mineAt >= 0 && len(fb.sent) > fb.mineAt && fb.sent[fb.mineAt].Hash() == hash {
+		return &types.Receipt{TxHash: hash, Status: types.ReceiptStatusSuccessful}, nil
+	}
+	return nil, geth.NotFound
+}
+
+// fakeRecorder records the kinds of attempts made
+type fakeRecorder struct {
+	kinds []AttemptKind
+	mined []common.Hash
+}
+
+func (fr *fakeRecorder) RecordAttempt(operation string, kind AttemptKind, tx *types.Transaction) error {
+	fr.kinds = append(fr.kinds, kind)
+	return nil
+}
+
+func (fr *fakeRecorder) RecordMined(hash common.Hash, status uint64) error {
+	fr.mined = append(fr.mined, hash)
+	return nil
+}
+
+func Test_TxManager(t *testing.T) {
+	minedPollInterval = time.Millisecond
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := bind.NewKeyedTransactor(key)
+	to := common.HexToAddress("0x1")
+	tests := []struct {
+		name     string
+		mineAt   int
+		rejectAt int
+		ceiling  int64
+		wantErr  string
+		kinds    []AttemptKind
+	}{
+		{"mined", 0, 0, 0, "", []AttemptKind{AttemptSend}},
+		{"speed-up", 1, 0, 0, "", []AttemptKind{AttemptSend, AttemptSpeedUp}},
+		{"cancel", 2, 0, 0, ErrTxCancelled, []AttemptKind{AttemptSend, AttemptSpeedUp, AttemptCancel}},
+		// attempts mined once we've stopped waiting for them cause their replacement to be rejected
+		{"speed-up rejected", -1, 1, 0, "", []AttemptKind{AttemptSend}},
+		{"cancel rejected", -1, 2, 0, "", []AttemptKind{AttemptSend, AttemptSpeedUp}},
+		// cancellations are bounded, as are the gas prices of replacements
+		{"stuck", -1, 0, 0, ErrTxStuck, []AttemptKind{AttemptSend, AttemptSpeedUp, AttemptCancel, AttemptCancel}},
+		{"speed-up ceiling", -1, 0, 110, ErrGasCeiling, []AttemptKind{AttemptSend}},
+		{"cancel ceiling", 1, 0, 130, "", []AttemptKind{AttemptSend, AttemptSpeedUp}},
+		{"cancel ceiling stuck", -1, 0, 130, ErrGasCeiling, []AttemptKind{AttemptSend, AttemptSpeedUp}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fb := &fakeTxBackend{mineAt: tt.mineAt, rejectAt: tt.rejectAt}
+			fr := &fakeRecorder{}
+			opts := TxOpts{Timeout: time.Millisecond * 20, MaxAttempts: 2}
+			if tt.ceiling > 0 {
+				opts.GasCeiling = big.NewInt(tt.ceiling)
+			}
+			tm := NewTxManager(fb, func(context.Context) (*big.Int, error) {
+				return big.NewInt(100), nil
+			}, opts)
+			tm.Recorder = fr
+			_, err := tm.Send(context.Background(), auth, "test", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+				tx, err := opts.Signer(types.HomesteadSigner{}, opts.From,
+					types.NewTransaction(opts.Nonce.Uint64(), to, big.NewInt(1), 50000, opts.GasPrice, []byte("hello")))
+				if err != nil {
+					return nil, err
+				}
+				return tx, fb.SendTransaction(opts.Context, tx)
+			})
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(fr.kinds) != len(tt.kinds) {
+				t.Fatalf("recorded attempts %v, want %v", fr.kinds, tt.kinds)
+			}
+			for i := range tt.kinds {
+				if fr.kinds[i] != tt.kinds[i] {
+					t.Fatalf("recorded attempts %v, want %v", fr.kinds, tt.kinds)
+				}
+			}
+			if fb.mineAt < 0 && len(fr.mined) != 0 {
+				t.Fatal("no attempt should have been mined")
+			} else if fb.mineAt >= 0 && (len(fr.mined) != 1 || fr.mined[0] != fb.sent[fb.mineAt].Hash()) {
+				t.Fatal("mined attempt was not recorded")
+			}
+			// every attempt replaces the previous one with a bumped gas price
+			for i, tx := range fb.sent {
+				if tx.Nonce() != 5 {
+					t.Fatalf("attempt %v has nonce %v, want 5", i, tx.Nonce())
+				}
+				if i > 0 && tx.GasPrice().Cmp(new(big.Int).Div(new(big.Int).Mul(fb.sent[i-1].GasPrice(), big.NewInt(120)), big.NewInt(100))) < 0 {
+					t.Fatalf("attempt %v gas price %v was not bumped", i, tx.GasPrice())
+				}
+				if opts.GasCeiling != nil && tx.GasPrice().Cmp(opts.GasCeiling) > 0 {
+					t.Fatalf("attempt %v gas price %v exceeds the ceiling", i, tx.GasPrice())
+				}
+			}
+			if tt.mineAt == 2 && (fb.sent[2].Value().Sign() != 0 || *fb.sent[2].To() != auth.From) {
+				t.Fatal("cancellation should be a zero value transfer to ourselves")
+			}
+		})
+	}
+}
+
+func Test_TxManager_Cancelled(t *testing.T) {
+	minedPollInterval = time.Millisecond
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := bind.NewKeyedTransactor(key)
+	fb := &fakeTxBackend{mineAt: -1}
+	tm := NewTxManager(fb, func(context.Context) (*big.Int, error) {
+		return big.NewInt(100), nil
+	}, TxOpts{Timeout: time.Hour})
+	// shutdown interrupts waiting on a transaction which is never mined
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if _, err := tm.Send(ctx, auth, "test", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		tx, err := opts.Signer(types.HomesteadSigner{}, opts.From,
+			types.NewTransaction(opts.Nonce.Uint64(), auth.From, big.NewInt(1), 50000, opts.GasPrice, nil))
+		if err != nil {
+			return nil, err
+		}
+		return tx, fb.SendTransaction(opts.Context, tx)
+	}); err != context.DeadlineExceeded {
+		t.Fatalf("Send() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
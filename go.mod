@@ -14,12 +14,15 @@ require (
 	github.com/ethereum/go-ethereum v1.9.2
 	github.com/gcash/bchd v0.14.3
 	github.com/gcash/bchutil v0.0.0-20190417142952-050b747bffa0
+	github.com/golang/protobuf v1.3.1
 	github.com/grpc-ecosystem/go-grpc-middleware v1.0.0
 	github.com/jarcoal/httpmock v1.0.4 // indirect
 	github.com/jinzhu/gorm v1.9.8
 	github.com/kr/pretty v0.1.0 // indirect
-	github.com/lib/pq v1.1.1 // indirect
+	github.com/lib/pq v1.1.1
 	github.com/miguelmota/go-solidity-sha3 v0.1.0
+	github.com/mr-tron/base58 v1.1.2
+	github.com/multiformats/go-multihash v0.0.5
 	github.com/onrik/ethrpc v0.0.0-20190305112807-6b8e9c0e9a8f
 	github.com/onsi/ginkgo v1.8.0 // indirect
 	github.com/onsi/gomega v1.5.0 // indirect
@@ -0,0 +1,118 @@
+// Package jsonrpc provides a minimal JSON-RPC client over HTTP, used to
+// talk to node and wallet daemons such as bitcoind, dashd and monero-wallet-rpc
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// CodeInvalidAddressOrKey is the error code returned by bitcoind, and
+// its forks, when a requested transaction or address can not be found
+const CodeInvalidAddressOrKey = -5
+
+// Client is a JSON-RPC client
+type Client struct {
+	url  string
+	user string
+	pass string
+	hc   *http.Client
+	id   uint64
+}
+
+// Error is an error returned by the JSON-RPC server
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("json-rpc error %d: %s", e.Code, e.Message)
+}
+
+// IsCode returns whether err is a JSON-RPC error with the given code
+func IsCode(err error, code int) bool {
+	rpcErr, ok := err.(*Error)
+	return ok && rpcErr.Code == code
+}
+
+type request struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      uint64      `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type response struct {
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+// NewClient is used to instantiate our JSON-RPC client. If the url
+// contains user info, it is used for HTTP basic authentication
+func NewClient(rawURL string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{hc: &http.Client{Timeout: time.Minute}}
+	if u.User != nil {
+		c.user = u.User.Username()
+		c.pass, _ = u.User.Password()
+		u.User = nil
+	}
+	c.url = u.String()
+	return c, nil
+}
+
+// Call is used to invoke a method, decoding the result into result
+func (c *Client) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := json.Marshal(request{
+		JSONRPC: "2.0",
+		ID:      atomic.AddUint64(&c.id, 1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.pass)
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var rpcResp response
+	// bitcoind style servers return errors with a non-200 status code
+	// but still include the json-rpc error in the body
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+		return err
+	}
+	if rpcResp.Error != nil {
+		return rpcResp.Error
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(rpcResp.Result, result)
+}
@@ -0,0 +1,52 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_Call(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		switch req.Method {
+		case "getblockcount":
+			w.Write([]byte(`{"result":500,"error":null,"id":1}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"result":null,"error":{"code":-32601,"message":"Method not found"},"id":1}`))
+		}
+	}))
+	defer srv.Close()
+	c, err := NewClient("http://user:pass@" + srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var height int
+	if err := c.Call(context.Background(), "getblockcount", nil, &height); err != nil {
+		t.Fatal(err)
+	}
+	if height != 500 {
+		t.Fatal("bad height returned")
+	}
+	err = c.Call(context.Background(), "badmethod", nil, nil)
+	if rpcErr, ok := err.(*Error); !ok || rpcErr.Code != -32601 {
+		t.Fatal("expected json-rpc error, got", err)
+	}
+	c, err = NewClient("http://" + srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Call(context.Background(), "getblockcount", nil, &height); err == nil {
+		t.Fatal("error expected")
+	}
+}
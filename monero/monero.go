@@ -0,0 +1,249 @@
+// Package monero is used to process monero payments through monero-wallet-rpc.
+// The wallet only needs the view key of our account, allowing incoming transfers
+// to be verified without our spend key ever being present on the payment processor.
+// Payments are made either to a per-payment subaddress, or to an integrated address
+// in which case the transfer is matched by its payment id.
+package monero
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/RTradeLtd/Pay/jsonrpc"
+	"github.com/RTradeLtd/config/v2"
+	"go.uber.org/zap"
+)
+
+var (
+	devConfirmationCount = 1
+	// monero outputs are locked for 10 blocks after being mined,
+	// so there is no point in accepting fewer confirmations
+	prodConfirmationCount = 10
+	// ErrTxNotConfirmedUnlockTime is an error used to indicate
+	// that a transfer was not confirmed because it is still locked
+	ErrTxNotConfirmedUnlockTime = "tx is not confirmed, unlock time not passed"
+	// ErrTxNotConfirmed is a general error to indicate that
+	// a transaction is not yet confirmed
+	ErrTxNotConfirmed = "tx is not confirmed"
+	// ErrTxTooLowValue is an error used to indicate that the
+	// total value of a transaction does not match the expected value
+	ErrTxTooLowValue = "value of transaction does not match expected total value"
+	// ErrNoIncomingTransfer is an error used to indicate that the
+	// transaction does not contain a transfer to our wallet
+	ErrNoIncomingTransfer = "no incoming transfer found for transaction"
+)
+
+// piconeroPerXMR is the number of atomic units in one XMR
+const piconeroPerXMR = 1e12
+
+// Client is used to interface with monero-wallet-rpc
+type Client struct {
+	rpc               *jsonrpc.Client
+	confirmationCount int
+	dev               bool
+}
+
+// Transfer is an incoming transfer as returned by get_transfer_by_txid
+type Transfer struct {
+	TxID          string `json:"txid"`
+	Address       string `json:"address"`
+	PaymentID     string `json:"payment_id"`
+	Amount        uint64 `json:"amount"`
+	Confirmations uint64 `json:"confirmations"`
+	Height        uint64 `json:"height"`
+	UnlockTime    uint64 `json:"unlock_time"`
+	Type          string `json:"type"`
+}
+
+// NewClient is used to instantiate our monero-wallet-rpc client, connecting
+// to the wallet at cfg.Services.MoneroRPC. Since the wallet only holds our
+// view key, it is expected to be reachable locally with --disable-rpc-login
+func NewClient(cfg *config.TemporalConfig, devMode bool) (*Client, error) {
+	if cfg.Services.MoneroRPC == "" {
+		return nil, errors.New("monero rpc url not specified")
+	}
+	u, err := url.Parse(cfg.Services.MoneroRPC)
+	if err != nil {
+		return nil, err
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/json_rpc"
+	}
+	rpc, err := jsonrpc.NewClient(u.String())
+	if err != nil {
+		return nil, err
+	}
+	var confirmationCount int
+	if devMode {
+		confirmationCount = devConfirmationCount
+	} else {
+		confirmationCount = prodConfirmationCount
+	}
+	return &Client{rpc: rpc, confirmationCount: confirmationCount, dev: devMode}, nil
+}
+
+// GetTransfers is used to retrieve all transfers to our wallet made in a transaction
+func (c *Client) GetTransfers(ctx context.Context, hash string) ([]Transfer, error) {
+	var resp struct {
+		Transfer  Transfer   `json:"transfer"`
+		Transfers []Transfer `json:"transfers"`
+	}
+	if err := c.rpc.Call(ctx, "get_transfer_by_txid", map[string]interface{}{
+		"txid": hash,
+	}, &resp); err != nil {
+		return nil, err
+	}
+	// older wallets only return a single transfer
+	if len(resp.Transfers) == 0 && resp.Transfer.TxID != "" {
+		resp.Transfers = []Transfer{resp.Transfer}
+	}
+	return resp.Transfers, nil
+}
+
+// GetCurrentBlockHeight is used to retrieve the current height of the wallet
+func (c *Client) GetCurrentBlockHeight(ctx context.Context) (uint64, error) {
+	var resp struct {
+		Height uint64 `json:"height"`
+	}
+	if err := c.rpc.Call(ctx, "get_height", nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Height, nil
+}
+
+// SplitIntegratedAddress is used to extract the standard address and payment id from
+// an integrated address. If the address is not integrated, an empty payment id is returned
+func (c *Client) SplitIntegratedAddress(ctx context.Context, address string) (string, string, error) {
+	var resp struct {
+		StandardAddress string `json:"standard_address"`
+		PaymentID       string `json:"payment_id"`
+	}
+	if err := c.rpc.Call(ctx, "split_integrated_address", map[string]interface{}{
+		"integrated_address": address,
+	}, &resp); err != nil {
+		// the wallet returns an error for addresses that aren't integrated
+		if _, ok := err.(*jsonrpc.Error); ok {
+			return address, "", nil
+		}
+		return "", "", err
+	}
+	return resp.StandardAddress, resp.PaymentID, nil
+}
+
+// IsConfirmed is used to check if the transfers of a transaction are confirmed
+func (c *Client) IsConfirmed(ctx context.Context, transfers []Transfer) error {
+	if len(transfers) == 0 {
+		return errors.New(ErrNoIncomingTransfer)
+	}
+	height, err := c.GetCurrentBlockHeight(ctx)
+	if err != nil {
+		return err
+	}
+	for _, transfer := range transfers {
+		// transfers still in the mempool have a type of pool
+		if transfer.Type != "in" || transfer.Confirmations < uint64(c.confirmationCount) {
+			return errors.New(ErrTxNotConfirmed)
+		}
+		// unlock times below 500000000 are block heights, otherwise they are timestamps
+		if transfer.UnlockTime < 500000000 && transfer.UnlockTime > height {
+			return errors.New(ErrTxNotConfirmedUnlockTime)
+		}
+		if transfer.UnlockTime >= 500000000 && transfer.UnlockTime > uint64(time.Now().Unix()) {
+			return errors.New(ErrTxNotConfirmedUnlockTime)
+		}
+	}
+	return nil
+}
+
+// ProcessPaymentTx is used to process a payment transaction made to the deposit address, which
+// may either be a subaddress of our wallet or an integrated address containing a payment id
+func (c *Client) ProcessPaymentTx(ctx context.Context, l *zap.SugaredLogger, expectedValue float64, hash, depositAddress string) error {
+	address, paymentID, err := c.SplitIntegratedAddress(ctx, depositAddress)
+	if err != nil {
+		return err
+	}
+	l.Info("getting transfers from wallet")
+	transfers, err := c.GetTransfers(ctx, hash)
+	if err != nil {
+		return err
+	}
+	transfers = matchTransfers(transfers, address, paymentID)
+	if len(transfers) == 0 {
+		return errors.New(ErrNoIncomingTransfer)
+	}
+	l.Info("validating value of transfers")
+	if getTotalValueOfTransfers(transfers) < expectedValue {
+		return errors.New(ErrTxTooLowValue)
+	}
+	l.Info("checking if tx is confirmed")
+	if err := c.IsConfirmed(ctx, transfers); err == nil {
+		l.Info("tx confirmed")
+		return nil
+	}
+	l.Info("tx not confirmed, waiting for confirmations")
+	// we wait until the transaction is confirmed, or the
+	// deadline of the payment given by ctx has passed
+	for {
+		if err := c.wait(ctx); err != nil {
+			return err
+		}
+		l.Info("checking if tx is confirmed")
+		transfers, err = c.GetTransfers(ctx, hash)
+		if err != nil {
+			return err
+		}
+		if err := c.IsConfirmed(ctx, matchTransfers(transfers, address, paymentID)); err == nil {
+			l.Info("tx confirmed")
+			return nil
+		}
+		l.Info("tx not confirmed, waiting for confirmations")
+	}
+}
+
+// matchTransfers returns the transfers made to the given address, or if
+// a payment id is provided, the transfers made with that payment id
+func matchTransfers(transfers []Transfer, address, paymentID string) []Transfer {
+	var matched []Transfer
+	for _, transfer := range transfers {
+		if paymentID != "" {
+			if transfer.PaymentID != paymentID {
+				continue
+			}
+		} else if transfer.Address != address {
+			continue
+		}
+		matched = append(matched, transfer)
+	}
+	return matched
+}
+
+// getTotalValueOfTransfers returns the value of the transfers in XMR
+func getTotalValueOfTransfers(transfers []Transfer) float64 {
+	var total uint64
+	for _, transfer := range transfers {
+		total = total + transfer.Amount
+	}
+	return float64(total) / piconeroPerXMR
+}
+
+// wait is used to pause for roughly the duration of a block, returning
+// early with the error of the context once it is cancelled
+func (c *Client) wait(ctx context.Context) error {
+	timer := time.NewTimer(c.pauseDuration())
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Client) pauseDuration() time.Duration {
+	if c.dev {
+		return time.Second * 5
+	}
+	return time.Minute * 2
+}
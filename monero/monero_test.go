@@ -0,0 +1,175 @@
+package monero
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/Pay/log"
+	"github.com/RTradeLtd/config/v2"
+)
+
+var (
+	cfgPath = "../test/config.json"
+	txHash  = "c3d4b7c24a87b6b1d2d5b7f5cfd3b8e1a5a64a1f6f8fa1c6ce35f1b7b6b3c2d1"
+)
+
+// fakeWallet is a fake monero-wallet-rpc server
+type fakeWallet struct {
+	height uint64
+	// transfers returned by successive get_transfer_by_txid calls
+	transfers []string
+	calls     int
+}
+
+func (fw *fakeWallet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if r.URL.Path != "/json_rpc" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	switch req.Method {
+	case "get_height":
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": map[string]uint64{"height": fw.height}})
+	case "split_integrated_address":
+		var params map[string]string
+		json.Unmarshal(req.Params, &params)
+		if params["integrated_address"] != "integrated" {
+			w.Write([]byte(`{"error":{"code":-2,"message":"Invalid address"}}`))
+			return
+		}
+		w.Write([]byte(`{"result":{"standard_address":"standard","payment_id":"abcd"}}`))
+	case "get_transfer_by_txid":
+		transfers := fw.transfers[fw.calls]
+		if fw.calls < len(fw.transfers)-1 {
+			fw.calls++
+		}
+		w.Write([]byte(`{"result":{"transfers":` + transfers + `}}`))
+	default:
+		w.Write([]byte(`{"error":{"code":-32601,"message":"Method not found"}}`))
+	}
+}
+
+func newFakeClient(t *testing.T, fw *fakeWallet) (*Client, func()) {
+	srv := httptest.NewServer(fw)
+	cfg, err := config.LoadConfig(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Services.MoneroRPC = srv.URL
+	c, err := NewClient(cfg, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.confirmationCount = 10
+	return c, srv.Close
+}
+
+func Test_SplitIntegratedAddress(t *testing.T) {
+	c, done := newFakeClient(t, &fakeWallet{})
+	defer done()
+	address, paymentID, err := c.SplitIntegratedAddress(context.Background(), "integrated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address != "standard" || paymentID != "abcd" {
+		t.Fatal("bad address split")
+	}
+	address, paymentID, err = c.SplitIntegratedAddress(context.Background(), "subaddress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address != "subaddress" || paymentID != "" {
+		t.Fatal("bad address split")
+	}
+}
+
+func Test_IsConfirmed(t *testing.T) {
+	tests := []struct {
+		name      string
+		transfers []Transfer
+		wantErr   string
+	}{
+		{"success", []Transfer{{Type: "in", Confirmations: 10, UnlockTime: 0}}, ""},
+		{"pool", []Transfer{{Type: "pool", Confirmations: 0}}, ErrTxNotConfirmed},
+		{"confirmations", []Transfer{{Type: "in", Confirmations: 5}}, ErrTxNotConfirmed},
+		{"unlock-height", []Transfer{{Type: "in", Confirmations: 10, UnlockTime: 900}}, ErrTxNotConfirmedUnlockTime},
+		{"unlock-time", []Transfer{{Type: "in", Confirmations: 10, UnlockTime: 1 << 40}}, ErrTxNotConfirmedUnlockTime},
+		{"none", nil, ErrNoIncomingTransfer},
+	}
+	c, done := newFakeClient(t, &fakeWallet{height: 600})
+	defer done()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := c.IsConfirmed(context.Background(), tt.transfers)
+			if (err != nil) != (tt.wantErr != "") {
+				t.Fatalf("IsConfirmed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && err.Error() != tt.wantErr {
+				t.Fatal("wrong error message returned", err)
+			}
+		})
+	}
+}
+
+func Test_MatchTransfers(t *testing.T) {
+	transfers := []Transfer{
+		{Address: "sub1", Amount: 1},
+		{Address: "sub2", Amount: 2},
+		{Address: "standard", PaymentID: "abcd", Amount: 4},
+	}
+	if total := getTotalValueOfTransfers(matchTransfers(transfers, "sub2", "")); total != 2/piconeroPerXMR {
+		t.Fatal("bad subaddress total", total)
+	}
+	if total := getTotalValueOfTransfers(matchTransfers(transfers, "standard", "abcd")); total != 4/piconeroPerXMR {
+		t.Fatal("bad payment id total", total)
+	}
+}
+
+func Test_ProcessPaymentTx(t *testing.T) {
+	c, done := newFakeClient(t, &fakeWallet{height: 999, transfers: []string{
+		`[{"txid":"1","address":"sub1","amount":1000000000000,"confirmations":0,"type":"pool"}]`,
+		`[{"txid":"1","address":"sub1","amount":1000000000000,"confirmations":4,"type":"in"}]`,
+		`[{"txid":"1","address":"sub1","amount":1000000000000,"confirmations":10,"type":"in"}]`,
+	}})
+	defer done()
+	logger, err := log.NewLogger("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ProcessPaymentTx(context.Background(), logger, 1, txHash, "sub2"); err == nil {
+		t.Fatal("error expected")
+	} else if err.Error() != ErrNoIncomingTransfer {
+		t.Fatal("wrong error message returned", err)
+	}
+	if err := c.ProcessPaymentTx(context.Background(), logger, 1, txHash, "sub1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_ProcessPaymentTx_Cancelled(t *testing.T) {
+	c, done := newFakeClient(t, &fakeWallet{height: 999, transfers: []string{
+		`[{"txid":"1","address":"sub1","amount":1000000000000,"confirmations":0,"type":"pool"}]`,
+	}})
+	defer done()
+	logger, err := log.NewLogger("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the payment deadline is honoured while waiting on confirmations
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	if err := c.ProcessPaymentTx(ctx, logger, 1, txHash, "sub1"); err != context.DeadlineExceeded {
+		t.Fatalf("ProcessPaymentTx() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
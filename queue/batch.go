@@ -0,0 +1,234 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/Pay/ethereum"
+	"github.com/RTradeLtd/Pay/store"
+	"github.com/streadway/amqp"
+	"go.uber.org/zap"
+)
+
+// BatchOpts is used to configure the coalescing of ens requests into batches
+type BatchOpts struct {
+	// Window is how long requests are collected for before being
+	// submitted, a window of zero disables batching altogether
+	Window time.Duration
+	// Size is the number of requests which submits a batch
+	// before its window has passed, and is unbounded if zero
+	Size int
+}
+
+// recordUpdater is used to register subdomains and batch updates of their records
+type recordUpdater interface {
+	RegisterSubDomain(ctx context.Context, subName, parentName string) error
+	ContentHashUpdate(subName, parentName, hash string) (*ethereum.RecordUpdate, error)
+	TextUpdate(subName, parentName, key, value string) (*ethereum.RecordUpdate, error)
+	CoinAddressUpdate(subName, parentName string, coinType uint64, address string) (*ethereum.RecordUpdate, error)
+	ApplyUpdates(ctx context.Context, updates []*ethereum.RecordUpdate) []error
+}
+
+// batchedRequest is an ens request waiting to be submitted as part of a batch
+type batchedRequest struct {
+	d   amqp.Delivery
+	req ENSRequest
+	err error
+}
+
+// ensBatcher is used to coalesce the subdomain requests received over a short
+// window, so that updates of subdomains sharing a resolver are sent as a single
+// transaction. Each request is acknowledged, and its user emailed, once the
+// batch it was part of has been processed. Requests which failed are handed to
+// fail, so that transient failures are retried before their user is emailed
+type ensBatcher struct {
+	opts    BatchOpts
+	ctx     context.Context
+	wg      *sync.WaitGroup
+	subs    *subdomains
+	updater recordUpdater
+	notify  func(username string, reqType ENSRequestType, err error)
+	fail    func(d amqp.Delivery, err error)
+	l       *zap.SugaredLogger
+
+	mux     sync.Mutex
+	pending []*batchedRequest
+	timer   *time.Timer
+}
+
+// batchable returns whether requests of the given type may be batched
+func batchable(reqType ENSRequestType) bool {
+	switch reqType {
+	case ENSRegisterSubName, ENSUpdateContentHash, ENSSetText, ENSSetAddress:
+		return true
+	default:
+		return false
+	}
+}
+
+// add is used to add a request to the next batch, starting its window if it is the first
+func (eb *ensBatcher) add(d amqp.Delivery, req ENSRequest) {
+	eb.mux.Lock()
+	defer eb.mux.Unlock()
+	eb.pending = append(eb.pending, &batchedRequest{d: d, req: req})
+	if eb.opts.Size > 0 && len(eb.pending) >= eb.opts.Size {
+		eb.submitPending()
+		return
+	}
+	if eb.timer == nil {
+		eb.timer = time.AfterFunc(eb.opts.Window, eb.flush)
+	}
+}
+
+// flush is used to submit the pending batch once its window has passed
+func (eb *ensBatcher) flush() {
+	eb.mux.Lock()
+	defer eb.mux.Unlock()
+	eb.submitPending()
+}
+
+// submitPending is used to submit the pending batch in the background, and must be
+// called with mux held. Once stopped, requests are left unacknowledged so that they
+// are redelivered rather than processed while we shut down
+func (eb *ensBatcher) submitPending() {
+	if eb.timer != nil {
+		eb.timer.Stop()
+		eb.timer = nil
+	}
+	batch := eb.pending
+	eb.pending = nil
+	if len(batch) == 0 {
+		return
+	}
+	if eb.ctx.Err() != nil {
+		eb.l.Warnw("dropping ens request batch for redelivery", "requests", len(batch))
+		return
+	}
+	eb.wg.Add(1)
+	go func() {
+		defer eb.wg.Done()
+		eb.submit(batch)
+	}()
+}
+
+// submit is used to process a batch. As the registry can't batch them, subdomains
+// are registered first, concurrently, so that updates of subdomains registered
+// within the same batch find them. Record updates are then applied together
+func (eb *ensBatcher) submit(batch []*batchedRequest) {
+	eb.l.Infow("submitting ens request batch", "requests", len(batch))
+	eb.register(batch)
+	var (
+		updates  []*ethereum.RecordUpdate
+		requests []*batchedRequest
+	)
+	for _, br := range batch {
+		if br.req.Type == ENSRegisterSubName {
+			continue
+		}
+		update, err := eb.update(br.req)
+		if err != nil {
+			br.err = err
+			continue
+		}
+		updates = append(updates, update)
+		requests = append(requests, br)
+	}
+	if len(updates) > 0 {
+		for i, err := range eb.updater.ApplyUpdates(eb.ctx, updates) {
+			requests[i].err = err
+		}
+	}
+	// requests interrupted by shutdown are left unacknowledged to be redelivered
+	if eb.ctx.Err() != nil {
+		eb.l.Warnw("ens request batch interrupted, leaving it for redelivery", "requests", len(batch))
+		return
+	}
+	for _, br := range batch {
+		if br.err != nil && !rejected(br.err) && retryCount(br.d.Headers) < len(retryDelays) {
+			eb.fail(br.d, br.err)
+			continue
+		}
+		eb.notify(br.req.UserName, br.req.Type, br.err)
+		if br.err != nil {
+			eb.fail(br.d, Permanent(br.err))
+			continue
+		}
+		br.d.Ack(false)
+	}
+}
+
+// rejected is used to check whether an ens request was rejected as invalid or
+// unauthorized, rather than failing to be processed, and so would fail again if retried
+func rejected(err error) bool {
+	if IsPermanent(err) {
+		return true
+	}
+	switch err.Error() {
+	case ErrAccountDisabled, ErrSubdomainNotRegistered, ErrSubdomainTransferred, ErrSubdomainTaken,
+		store.ErrLabelTaken, ethereum.ErrInvalidLabel, ethereum.ErrInvalidContent,
+		ethereum.ErrUnsupportedTextKey, ethereum.ErrUnsupportedCoinType, ethereum.ErrInvalidAddress:
+		return true
+	default:
+		return false
+	}
+}
+
+// register is used to register the subdomains requested within a batch,
+// registering each label once should a user request it more than once
+func (eb *ensBatcher) register(batch []*batchedRequest) {
+	var (
+		subs     = make(map[string]*store.Subdomain)
+		requests = make(map[string][]*batchedRequest)
+		errs     = make(map[string]error)
+	)
+	for _, br := range batch {
+		if br.req.Type != ENSRegisterSubName {
+			continue
+		}
+		sub, err := eb.subs.claim(br.req.UserName)
+		if err != nil {
+			br.err = err
+			continue
+		}
+		subs[sub.Label] = sub
+		requests[sub.Label] = append(requests[sub.Label], br)
+	}
+	var (
+		wg  sync.WaitGroup
+		mux sync.Mutex
+	)
+	for label := range subs {
+		wg.Add(1)
+		go func(label string) {
+			defer wg.Done()
+			err := eb.updater.RegisterSubDomain(eb.ctx, label, ethereum.TemporalENSName)
+			mux.Lock()
+			errs[label] = err
+			mux.Unlock()
+		}(label)
+	}
+	wg.Wait()
+	for label, sub := range subs {
+		err := eb.subs.registered(sub, errs[label])
+		for _, br := range requests[label] {
+			br.err = err
+		}
+	}
+}
+
+// update is used to authorize a request, and create the record update it makes
+func (eb *ensBatcher) update(req ENSRequest) (*ethereum.RecordUpdate, error) {
+	sub, err := eb.subs.lookup(req.UserName)
+	if err != nil {
+		return nil, err
+	}
+	switch req.Type {
+	case ENSUpdateContentHash:
+		return eb.updater.ContentHashUpdate(sub.Label, ethereum.TemporalENSName, req.ContentHash)
+	case ENSSetText:
+		return eb.updater.TextUpdate(sub.Label, ethereum.TemporalENSName, req.TextKey, req.TextValue)
+	default:
+		return eb.updater.CoinAddressUpdate(sub.Label, ethereum.TemporalENSName, req.CoinType, req.Address)
+	}
+}
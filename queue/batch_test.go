@@ -0,0 +1,218 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/Pay/ethereum"
+	"github.com/streadway/amqp"
+	"go.uber.org/zap"
+)
+
+// fakeUpdater registers subdomains by taking ownership of them on chain
+type fakeUpdater struct {
+	mux        sync.Mutex
+	owners     fakeOwners
+	registered []string
+	// batches are the number of updates applied by each call to ApplyUpdates
+	batches []int
+}
+
+func (fu *fakeUpdater) RegisterSubDomain(ctx context.Context, subName, parentName string) error {
+	fu.mux.Lock()
+	defer fu.mux.Unlock()
+	fu.registered = append(fu.registered, subName)
+	fu.owners[subName] = fu.owners.Account()
+	return nil
+}
+
+func (fu *fakeUpdater) ContentHashUpdate(subName, parentName, hash string) (*ethereum.RecordUpdate, error) {
+	if hash == "" {
+		return nil, errors.New(ethereum.ErrInvalidContent)
+	}
+	return &ethereum.RecordUpdate{Name: subName, Operation: hash}, nil
+}
+
+func (fu *fakeUpdater) TextUpdate(subName, parentName, key, value string) (*ethereum.RecordUpdate, error) {
+	return &ethereum.RecordUpdate{Name: subName, Operation: value}, nil
+}
+
+func (fu *fakeUpdater) CoinAddressUpdate(subName, parentName string, coinType uint64, address string) (*ethereum.RecordUpdate, error) {
+	return &ethereum.RecordUpdate{Name: subName, Operation: address}, nil
+}
+
+// ApplyUpdates fails updates made with the value "revert"
+func (fu *fakeUpdater) ApplyUpdates(ctx context.Context, updates []*ethereum.RecordUpdate) []error {
+	fu.batches = append(fu.batches, len(updates))
+	errs := make([]error, len(updates))
+	for i, update := range updates {
+		if update.Operation == "revert" {
+			errs[i] = errors.New(ethereum.ErrTxFailed)
+		}
+	}
+	return errs
+}
+
+// fakeResults are the results each user was notified of, keyed by request type,
+// and the requests which failed, keyed by the error they failed with
+type fakeResults struct {
+	mux      sync.Mutex
+	results  map[string]map[ENSRequestType]error
+	failures map[string]error
+}
+
+func (fr *fakeResults) fail(d amqp.Delivery, err error) {
+	fr.mux.Lock()
+	defer fr.mux.Unlock()
+	fr.failures[err.Error()] = err
+}
+
+func (fr *fakeResults) notify(username string, reqType ENSRequestType, err error) {
+	fr.mux.Lock()
+	defer fr.mux.Unlock()
+	if fr.results[username] == nil {
+		fr.results[username] = make(map[ENSRequestType]error)
+	}
+	fr.results[username][reqType] = err
+}
+
+func newFakeBatcher(ctx context.Context, opts BatchOpts) (*ensBatcher, *fakeUpdater, *fakeResults) {
+	sd, _ := newFakeSubdomains()
+	fu := &fakeUpdater{owners: sd.owners.(fakeOwners)}
+	fr := &fakeResults{
+		results:  make(map[string]map[ENSRequestType]error),
+		failures: make(map[string]error),
+	}
+	return &ensBatcher{
+		opts:    opts,
+		ctx:     ctx,
+		wg:      &sync.WaitGroup{},
+		subs:    sd,
+		updater: fu,
+		notify:  fr.notify,
+		fail:    fr.fail,
+		l:       zap.NewNop().Sugar(),
+	}, fu, fr
+}
+
+func Test_ENSBatcher(t *testing.T) {
+	requests := []ENSRequest{
+		{Type: ENSRegisterSubName, UserName: "bob"},
+		// updates of a subdomain registered within the same batch
+		{Type: ENSUpdateContentHash, UserName: "bob", ContentHash: "/ipfs/bob"},
+		{Type: ENSSetText, UserName: "alice", TextKey: "url", TextValue: "https://alice.com"},
+		{Type: ENSSetAddress, UserName: "alice", CoinType: ethereum.CoinTypeETH, Address: "revert"},
+		{Type: ENSUpdateContentHash, UserName: "transferred", ContentHash: "/ipfs/transferred"},
+		{Type: ENSUpdateContentHash, UserName: "legacy"},
+	}
+	eb, fu, fr := newFakeBatcher(context.Background(), BatchOpts{Window: time.Hour, Size: len(requests)})
+	fa := &fakeAcknowledger{}
+	for _, req := range requests {
+		if !batchable(req.Type) {
+			t.Fatalf("%s requests should be batchable", req.Type)
+		}
+		body, err := json.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		eb.add(amqp.Delivery{Acknowledger: fa, Body: body}, req)
+	}
+	// the batch is submitted once full, rather than after its window
+	eb.wg.Wait()
+	if fa.acks != 3 {
+		t.Fatalf("requests acked %v times, want 3", fa.acks)
+	}
+	if len(fu.registered) != 1 || fu.registered[0] != "bob" {
+		t.Fatal("bad subdomains registered", fu.registered)
+	}
+	if len(fu.batches) != 1 || fu.batches[0] != 3 {
+		t.Fatal("bad update batches", fu.batches)
+	}
+	// the failed transaction is retried before alice is notified of it
+	if _, ok := fr.results["alice"][ENSSetAddress]; ok {
+		t.Fatal("alice should not be notified of a request being retried")
+	}
+	// rejected requests won't succeed if retried
+	for reason, permanent := range map[string]bool{
+		ethereum.ErrTxFailed:       false,
+		ErrSubdomainTransferred:    true,
+		ethereum.ErrInvalidContent: true,
+	} {
+		err, ok := fr.failures[reason]
+		if !ok || IsPermanent(err) != permanent {
+			t.Fatalf("request failing with %q should fail with permanent %v", reason, permanent)
+		}
+	}
+	want := map[string]map[ENSRequestType]string{
+		"bob":         {ENSRegisterSubName: "", ENSUpdateContentHash: ""},
+		"alice":       {ENSSetText: ""},
+		"transferred": {ENSUpdateContentHash: ErrSubdomainTransferred},
+		"legacy":      {ENSUpdateContentHash: ethereum.ErrInvalidContent},
+	}
+	for user, types := range want {
+		for reqType, wantErr := range types {
+			err, ok := fr.results[user][reqType]
+			if !ok {
+				t.Fatalf("%s was not notified of their %s request", user, reqType)
+			}
+			if (err == nil && wantErr != "") || (err != nil && err.Error() != wantErr) {
+				t.Fatalf("%s %s request error = %v, wantErr %v", user, reqType, err, wantErr)
+			}
+		}
+	}
+	if batchable(ENSRegisterName) || batchable(ENSTransferSubName) {
+		t.Fatal("name registrations and transfers should not be batchable")
+	}
+}
+
+func Test_ENSBatcher_Window(t *testing.T) {
+	eb, fu, fr := newFakeBatcher(context.Background(), BatchOpts{Window: time.Millisecond * 10})
+	fa := &fakeAcknowledger{}
+	eb.add(amqp.Delivery{Acknowledger: fa}, ENSRequest{Type: ENSSetText, UserName: "alice", TextValue: "a"})
+	eb.add(amqp.Delivery{Acknowledger: fa}, ENSRequest{Type: ENSSetText, UserName: "alice", TextValue: "b"})
+	time.Sleep(time.Millisecond * 100)
+	eb.wg.Wait()
+	if fa.acks != 2 {
+		t.Fatalf("requests acked %v times, want 2", fa.acks)
+	}
+	if len(fu.batches) != 1 || fu.batches[0] != 2 {
+		t.Fatal("bad update batches", fu.batches)
+	}
+	if len(fr.results["alice"]) != 1 {
+		t.Fatal("alice was not notified")
+	}
+}
+
+func Test_ENSBatcher_Retries(t *testing.T) {
+	eb, _, fr := newFakeBatcher(context.Background(), BatchOpts{Window: time.Hour, Size: 1})
+	fa := &fakeAcknowledger{}
+	// the last retry of a failing request
+	eb.add(amqp.Delivery{
+		Acknowledger: fa,
+		Headers:      amqp.Table{retryCountHeader: int32(len(retryDelays))},
+	}, ENSRequest{Type: ENSSetText, UserName: "alice", TextValue: "revert"})
+	eb.wg.Wait()
+	if err := fr.results["alice"][ENSSetText]; err == nil || err.Error() != ethereum.ErrTxFailed {
+		t.Fatalf("alice notified of %v, want %v", err, ethereum.ErrTxFailed)
+	}
+	if err := fr.failures[ethereum.ErrTxFailed]; !IsPermanent(err) {
+		t.Fatal("request should be dead-lettered once its retries are exhausted")
+	}
+}
+
+func Test_ENSBatcher_Stopped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	eb, fu, _ := newFakeBatcher(ctx, BatchOpts{Window: time.Hour, Size: 1})
+	fa := &fakeAcknowledger{}
+	eb.add(amqp.Delivery{Acknowledger: fa}, ENSRequest{Type: ENSSetText, UserName: "alice"})
+	eb.wg.Wait()
+	// left unacknowledged to be redelivered once we reconnect
+	if fa.acks != 0 || len(fu.batches) != 0 {
+		t.Fatal("requests should not be processed once stopped")
+	}
+}
@@ -9,7 +9,9 @@ import (
 
 	"github.com/RTradeLtd/Pay/ethereum"
 	"github.com/RTradeLtd/Pay/log"
+	"github.com/RTradeLtd/Pay/store"
 	"github.com/RTradeLtd/database/v2/models"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/streadway/amqp"
 )
 
@@ -19,6 +21,9 @@ func (qm *Manager) ProcessENSRequest(
 	wg *sync.WaitGroup,
 	msgs <-chan amqp.Delivery,
 ) error {
+	// background work is restarted along with the queue on reconnects
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
 	var connectionType string
 	if qm.cfg.Ethereum.Connection.INFURA.URL != "" {
 		connectionType = "infura"
@@ -27,14 +32,20 @@ func (qm *Manager) ProcessENSRequest(
 		qm.cfg.Ethereum.Connection.RPC.Port != "" {
 		connectionType = "rpc"
 	}
-	ethclient, err := ethereum.NewClient(qm.cfg, connectionType)
+	ethclient, err := ethereum.NewClientWithOpts(qm.cfg, connectionType, qm.ENSOpts)
 	if err != nil {
 		return err
 	}
 	if err := ethclient.UnlockAccountFromConfig(qm.cfg); err != nil {
 		return err
 	}
-	if err := ethclient.SetResolver(ethereum.TemporalENSName); err != nil {
+	// record every attempt at getting our transactions mined
+	ethclient.Tx.Recorder = store.NewTxAttemptManager(qm.db)
+	// transactions left pending by a previous run are accounted for by our node
+	if err := ethclient.Tx.Nonces.Sync(ctx, ethclient.Auth.From); err != nil {
+		return err
+	}
+	if err := ethclient.SetResolver(ctx, ethereum.TemporalENSName); err != nil {
 		return err
 	}
 	logger, err := log.NewLogger(qm.cfg.LogDir+"pay_ens_email_publisher.log", false)
@@ -47,12 +58,61 @@ func (qm *Manager) ProcessENSRequest(
 	}
 	usg := models.NewUsageManager(qm.db)
 	userm := models.NewUserManager(qm.db)
+	regs := &nameRegistrations{
+		ctx:       ctx,
+		wg:        wg,
+		registrar: ethclient,
+		store:     store.NewRegistrationManager(qm.db),
+		credits:   qm.RegisterCredits,
+		notify: func(username string, err error) {
+			qm.notifyENSResult(userm, qmEmail, username, ENSRegisterName, err)
+		},
+		l: qm.l,
+	}
+	if err := regs.resume(); err != nil {
+		return err
+	}
+	subs := &subdomains{
+		store:  store.NewSubdomainManager(qm.db),
+		users:  userm,
+		owners: ethclient,
+		l:      qm.l,
+	}
+	var batch *ensBatcher
+	if qm.BatchOpts.Window > 0 {
+		batch = &ensBatcher{
+			opts:    qm.BatchOpts,
+			ctx:     ctx,
+			wg:      wg,
+			subs:    subs,
+			updater: ethclient,
+			notify: func(username string, reqType ENSRequestType, err error) {
+				qm.notifyENSResult(userm, qmEmail, username, reqType, err)
+			},
+			fail: qm.Fail,
+			l:    qm.l,
+		}
+	}
+	if qm.RenewalOpts.Interval > 0 {
+		rw := &renewalWatcher{
+			opts:     qm.RenewalOpts,
+			renewer:  ethclient,
+			names:    store.NewRegistrationManager(qm.db),
+			renewals: store.NewRenewalManager(qm.db),
+			lease:    store.NewLeaseManager(qm.db),
+			holder:   leaseHolder(),
+			users:    userm,
+			publish:  func(es EmailSend) error { return qmEmail.PublishMessage(es) },
+			l:        qm.l,
+		}
+		rw.watchRenewals(ctx, wg)
+	}
 	qm.l.Info("processing ens requests")
 	for {
 		select {
 		case d := <-msgs:
 			wg.Add(1)
-			go qm.processENSRequest(d, wg, usg, userm, qmEmail, ethclient)
+			go qm.processENSRequest(ctx, d, wg, usg, userm, qmEmail, ethclient, regs, subs, batch)
 		case <-ctx.Done():
 			qm.Close()
 			wg.Done()
@@ -69,12 +129,16 @@ func (qm *Manager) ProcessENSRequest(
 }
 
 func (qm *Manager) processENSRequest(
+	ctx context.Context,
 	d amqp.Delivery,
 	wg *sync.WaitGroup,
 	usage *models.UsageManager,
 	userm *models.UserManager,
 	qmEmail *Manager,
 	ec *ethereum.Client,
+	regs *nameRegistrations,
+	subs *subdomains,
+	batch *ensBatcher,
 ) {
 	defer wg.Done()
 	qm.l.Info("new ens request message received")
@@ -84,33 +148,86 @@ func (qm *Manager) processENSRequest(
 		d.Ack(false)
 		return
 	}
-	var err error
+	// batched requests are acknowledged once their batch is processed
+	if batch != nil && batchable(req.Type) {
+		qm.l.Infow("batching ens request", "user", req.UserName, "type", req.Type)
+		batch.add(d, req)
+		return
+	}
+	var (
+		err error
+		sub *store.Subdomain
+	)
 	switch req.Type {
 	case ENSRegisterSubName:
 		qm.l.Info("registering sub domain")
-		err = ec.RegisterSubDomain(req.UserName, ethereum.TemporalENSName)
+		if sub, err = subs.claim(req.UserName); err == nil {
+			err = subs.registered(sub, ec.RegisterSubDomain(ctx, sub.Label, ethereum.TemporalENSName))
+		}
 	case ENSUpdateContentHash:
 		qm.l.Info("updating content hash")
-		err = ec.UpdateContentHash(
-			req.UserName,
-			ethereum.TemporalENSName,
-			req.ContentHash,
-		)
+		if sub, err = subs.lookup(req.UserName); err == nil {
+			err = ec.UpdateContentHash(
+				ctx,
+				sub.Label,
+				ethereum.TemporalENSName,
+				req.ContentHash,
+			)
+		}
+	case ENSSetText:
+		qm.l.Info("setting text record")
+		if sub, err = subs.lookup(req.UserName); err == nil {
+			err = ec.SetText(ctx, sub.Label, ethereum.TemporalENSName, req.TextKey, req.TextValue)
+		}
+	case ENSSetAddress:
+		qm.l.Info("setting address record")
+		if sub, err = subs.lookup(req.UserName); err == nil {
+			err = ec.SetCoinAddress(ctx, sub.Label, ethereum.TemporalENSName, req.CoinType, req.Address)
+		}
+	case ENSTransferSubName:
+		qm.l.Info("transferring sub domain")
+		if !common.IsHexAddress(req.Address) {
+			err = errors.New(ethereum.ErrInvalidAddress)
+		} else if sub, err = subs.lookup(req.UserName); err == nil {
+			err = subs.transferred(sub, ec.TransferSubDomain(ctx,
+				sub.Label, ethereum.TemporalENSName, common.HexToAddress(req.Address)))
+		}
 	case ENSRegisterName:
 		qm.l.Info("registering name")
-		// TODO(bonedaddy): re-enable
-		// err = ec.RegisterName(req.UserName + ".eth")
-		fallthrough
+		// the user is charged before committing, and emailed once the registration is revealed
+		// a registration interrupted by shutdown is resumed on the next start
+		if err = regs.register(req.UserName, req.UserName+".eth"); err == nil || ctx.Err() != nil {
+			d.Ack(false)
+			return
+		}
 	default:
 		qm.l.Errorw("unsupported request type", "user", req.UserName, "type", req.Type)
 		d.Ack(false)
 		return
 	}
+	if ctx.Err() != nil {
+		// left unacknowledged to be redelivered once we reconnect
+		qm.l.Warnw("ens request interrupted", "user", req.UserName, "type", req.Type)
+		return
+	}
+	qm.notifyENSResult(userm, qmEmail, req.UserName, req.Type, err)
+	qm.l.Info("successfully processed ens request")
+	d.Ack(false)
+}
+
+// notifyENSResult is used to email a user the result of their ens request
+func (qm *Manager) notifyENSResult(
+	userm *models.UserManager,
+	qmEmail *Manager,
+	username string,
+	reqType ENSRequestType,
+	err error,
+) {
 	qm.l.Info("searching for user")
-	user, usrErr := userm.FindByUserName(req.UserName)
+	user, usrErr := userm.FindByUserName(username)
 	if usrErr != nil {
 		// if we cant find the user, email admin for help
-		qm.l.Errorw("failed to search for user", "user", req.UserName, "type", req.Type)
+		qm.l.Errorw("failed to search for user", "user", username, "type", reqType)
 		qm.l.Warn("sending email to admin instead")
 		user = &models.User{
 			UserName:     "admin",
@@ -119,8 +236,6 @@ func (qm *Manager) processENSRequest(
 		}
 	}
 	if !user.EmailEnabled {
-		qm.l.Info("successfully processed ens request")
-		d.Ack(false)
 		return
 	}
 	qm.l.Info("sending ens request confirmation email")
@@ -130,13 +245,13 @@ func (qm *Manager) processENSRequest(
 			Subject:     "ENS Request Processing Failure",
 			Content:     fmt.Sprint("Your ens request failed due to the following error: ", err),
 			ContentType: "text/html",
-			UserNames:   []string{req.UserName},
+			UserNames:   []string{username},
 			Emails:      []string{user.EmailAddress},
 		}
 		qm.l.Errorw(
 			"failed to process ens request",
-			"user", req.UserName,
-			"type", req.Type,
+			"user", username,
+			"type", reqType,
 			"error", err,
 		)
 	} else {
@@ -144,14 +259,11 @@ func (qm *Manager) processENSRequest(
 			Subject:     "ENS Request Processed Successfully",
 			Content:     fmt.Sprintf("your ens request was successfully processed"),
 			ContentType: "text/html",
-			UserNames:   []string{req.UserName},
+			UserNames:   []string{username},
 			Emails:      []string{user.EmailAddress},
 		}
 	}
 	if err := qmEmail.PublishMessage(es); err != nil {
 		qm.l.Errorw("failed to send ens request confirmation email", "error", err)
 	}
-	qm.l.Info("successfully processed ens request")
-	d.Ack(false)
-	return
 }
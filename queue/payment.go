@@ -4,340 +4,372 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
-	"sync"
 	"time"
 
+	"github.com/RTradeLtd/Pay/bch"
+	"github.com/RTradeLtd/Pay/btc"
 	"github.com/RTradeLtd/Pay/dash"
-	"github.com/RTradeLtd/Pay/log"
-	"github.com/RTradeLtd/Pay/service"
+	"github.com/RTradeLtd/Pay/ethereum"
+	"github.com/RTradeLtd/Pay/monero"
+	"github.com/RTradeLtd/Pay/server/utils"
+	"github.com/RTradeLtd/config/v2"
 	"github.com/RTradeLtd/database/v2/models"
-	"github.com/streadway/amqp"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
 )
 
-// ProcessETHPayment is used to process ethereum and rtc based payments
-func (qm *Manager) ProcessETHPayment(ctx context.Context, wg *sync.WaitGroup, msgs <-chan amqp.Delivery) error {
-	service, err := service.NewPaymentService(ctx, qm.cfg, &service.Opts{EthereumEnabled: true}, "rpc")
+// findRetryDelay is the time waited before looking for an ethereum payment
+// transaction again, as our node may not have seen it yet
+var findRetryDelay = time.Second * 15
+
+func init() {
+	RegisterPaymentProcessor(EthPaymentConfirmationQueue, NewETHProcessor)
+	RegisterPaymentProcessor(DashPaymentConfirmationQueue, NewDASHProcessor)
+	RegisterPaymentProcessor(BitcoinCashPaymentConfirmationQueue, NewBCHProcessor)
+	RegisterPaymentProcessor(MoneroPaymentConfirmationQueue, NewXMRProcessor)
+}
+
+// ETHProcessor is used to process ethereum and rtc based payments
+type ETHProcessor struct {
+	client *ethereum.Client
+}
+
+// NewETHProcessor is used to instantiate our ethereum payment processor
+func NewETHProcessor(ctx context.Context, cfg *config.TemporalConfig) (PaymentProcessor, error) {
+	client, err := ethereum.NewClient(cfg, "rpc")
 	if err != nil {
-		return err
+		return nil, err
 	}
-	logger, err := log.NewLogger(qm.cfg.LogDir+"pay_eth_email_publisher.log", false)
-	if err != nil {
-		return err
+	return &ETHProcessor{client: client}, nil
+}
+
+// Currency returns the name of the currency being processed
+func (ep *ETHProcessor) Currency() string { return "Ethereum" }
+
+// Decode is used to parse an EthPaymentConfirmation message
+func (ep *ETHProcessor) Decode(body []byte) (*PaymentRequest, error) {
+	msg := EthPaymentConfirmation{}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, err
 	}
-	qmEmail, err := New(EmailSendQueue, qm.cfg, logger, true)
+	return &PaymentRequest{UserName: msg.UserName, PaymentNumber: msg.PaymentNumber, Message: &msg}, nil
+}
+
+// TrackBlocks is used to wake payments waiting on confirmations once per block
+func (ep *ETHProcessor) TrackBlocks(ctx context.Context, logger *zap.SugaredLogger) {
+	ep.client.TrackBlocks(ctx, logger)
+}
+
+// BlockHeight returns the current height of the chain
+func (ep *ETHProcessor) BlockHeight(ctx context.Context) (uint64, error) {
+	header, err := ep.client.ETH.HeaderByNumber(ctx, nil)
 	if err != nil {
-		return err
-	}
-	um := models.NewUserManager(qm.db)
-	qm.l.Info("processing payment confirmations")
-	for {
-		select {
-		case d := <-msgs:
-			wg.Add(1)
-			go qm.processETHPayment(d, wg, service, qmEmail, um)
-		case <-ctx.Done():
-			qm.Close()
-			wg.Done()
-			return nil
-		case msg := <-qm.ErrCh:
-			qm.Close()
-			wg.Done()
-			qm.l.Errorw(
-				"a protocol connection error stopping rabbitmq was received",
-				"error", msg.Error())
-			return errors.New(ErrReconnect)
-		}
+		return 0, err
 	}
+	return header.Number.Uint64(), nil
 }
 
-func (qm *Manager) processETHPayment(d amqp.Delivery, wg *sync.WaitGroup, service *service.PaymentService, qmEmail *Manager, um *models.UserManager) {
-	defer wg.Done()
-	qm.l.Info("new ethereum based payment message received")
-	pc := EthPaymentConfirmation{}
-	if err := json.Unmarshal(d.Body, &pc); err != nil {
-		qm.l.Error("failed to unmarshal message")
-		d.Ack(false)
-		return
-	}
-	logger := qm.l.With("user", pc.UserName).With("number", pc.PaymentNumber).With("currency", "ethereum")
-	payment, err := service.PM.FindPaymentByNumber(pc.UserName, pc.PaymentNumber)
+// TxBlockHash returns the hash of the canonical block containing a transaction
+func (ep *ETHProcessor) TxBlockHash(ctx context.Context, txHash string) (string, error) {
+	return ep.client.TxBlockHash(ctx, txHash)
+}
+
+// Verify is used to wait for an ethereum payment to be confirmed, and ensure
+// the payment event emitted by the payment contract matches the payment
+func (ep *ETHProcessor) Verify(ctx context.Context, logger *zap.SugaredLogger, req *PaymentRequest, payment *models.Payments) error {
+	if payment.Blockchain != "ethereum" {
+		return Permanent(errors.New("invalid blockchain for crypto payments"))
+	}
+	// occassionally we may be given the hash before our node can find it in the blockchain or mempool
+	// if this happens, we will wait 15 seconds before trying again. a total of 3 attempts are made
+	// after which, we stop processing this transaction
+	expected, err := expectedPayment(payment)
 	if err != nil {
-		logger.Errorw("failed to find payment message", "error", err.Error())
-		d.Ack(false)
-		return
-	}
-	switch payment.Blockchain {
-	case "ethereum":
-		// occassionally we may be given the hash before our node can find it in the blockchain or mempool
-		// if this happens, we will wait 15 seconds before trying again. a total of 3 attempts are made
-		// after which, we stop processing this transaction
-		var found bool
-		for count := 0; count < 3; count++ {
-			if err := service.Client.ProcessPaymentTx(payment.TxHash); err != nil {
-				if count < 3 {
-					logger.Warnw("failed to find payment, waiting before attempting again", "error", err.Error())
-					time.Sleep(time.Second * 15)
-					continue
-				}
-			} else {
-				found = true
-				break
+		return Permanent(err)
+	}
+	for count := 0; count < 3; count++ {
+		if count > 0 {
+			logger.Warnw("failed to find payment, waiting before attempting again", "error", err.Error())
+			select {
+			case <-time.After(findRetryDelay):
+			case <-ctx.Done():
+				return ctx.Err()
 			}
 		}
-		// make sure we were able to find the transaction
-		if !found {
-			logger.Errorw("failed to find payment transaction after 3 repeated attempts", "tx.hash", payment.TxHash)
-			d.Ack(false)
-			return
+		if err = ep.client.ProcessPaymentTx(ctx, payment.TxHash); err == nil || ctx.Err() != nil {
+			break
 		}
-	default:
-		logger.Errorw("invalid blockchain for crypto payments")
-		d.Ack(false)
-		return
-	}
-	if _, err = service.PM.ConfirmPayment(payment.TxHash); err != nil {
-		logger.Errorw("failed to confirm payment in database", "error", err.Error())
-		d.Ack(false)
-		return
-	}
-	// grant credits to the user
-	if _, err = service.UM.AddCredits(pc.UserName, payment.USDValue); err != nil {
-		logger.Errorw("failed to add credits for user", "error", err.Error())
-		d.Ack(false)
-		return
-	}
-	logger.Infow("successfully confirmed payment", "credits", payment.USDValue)
-	user, err := um.FindByUserName(payment.UserName)
-	if err != nil {
-		logger.Errorw("failed to find email for user", "error", err.Error())
-		d.Ack(false)
-		return
-	}
-	if !user.EmailEnabled {
-		logger.Warnw("user has not activated their email and won't receive notifications")
-		d.Ack(false)
-		return
-	}
-	es := EmailSend{
-		Subject:     "Ethereum Payment Confirmed",
-		Content:     fmt.Sprintf("Your ethereum payment for %v credits has been confirmed", payment.USDValue),
-		ContentType: "text/html",
-		UserNames:   []string{payment.UserName},
-		Emails:      []string{user.EmailAddress},
-	}
-	if err := qmEmail.PublishMessage(es); err != nil {
-		logger.Warnw("failed to send payment confirmation email")
-	}
-	d.Ack(false)
-	return
-}
-
-// ProcessDASHPayment is used to process dash based payments
-func (qm *Manager) ProcessDASHPayment(ctx context.Context, wg *sync.WaitGroup, msgs <-chan amqp.Delivery) error {
-	service, err := service.NewPaymentService(ctx, qm.cfg, &service.Opts{DashEnabled: true}, "rpc")
-	if err != nil {
-		return err
 	}
-	logger, err := log.NewLogger(qm.cfg.LogDir+"pay_eth_email_publisher.log", false)
 	if err != nil {
+		logger.Errorw("failed to find payment transaction after 3 repeated attempts", "tx.hash", payment.TxHash)
 		return err
 	}
-	qmEmail, err := New(EmailSendQueue, qm.cfg, logger, true)
+	// ensure the payment made through the contract is the one recorded in our database
+	event, err := ep.client.PaymentEvent(ctx, payment.TxHash)
 	if err != nil {
+		if err.Error() == ethereum.ErrNoPaymentEvent {
+			return Permanent(err)
+		}
 		return err
 	}
-	um := models.NewUserManager(qm.db)
-	qm.l.Info("processing dash payment confirmations")
-	for {
-		select {
-		case d := <-msgs:
-			wg.Add(1)
-			go qm.processDashPaymentConfirmation(d, wg, service, qmEmail, um)
-		case <-ctx.Done():
-			qm.Close()
-			wg.Done()
-			return nil
-		case msg := <-qm.ErrCh:
-			qm.Close()
-			wg.Done()
-			qm.l.Errorw(
-				"a protocol connection error stopping rabbitmq was received",
-				"error", msg.Error())
-			return errors.New(ErrReconnect)
-		}
+	if err := event.Matches(expected); err != nil {
+		return Permanent(err)
 	}
+	return nil
 }
 
-// ProcessBCHPayment is used to handle processing of BCH based payments
-func (qm *Manager) ProcessBCHPayment(ctx context.Context, wg *sync.WaitGroup, msgs <-chan amqp.Delivery) error {
-	service, err := service.NewPaymentService(ctx, qm.cfg, &service.Opts{BitcoinCashEnabled: true, BCHURL: "temporary"}, "rpc")
-	if err != nil {
-		return err
-	}
-	logger, err := log.NewLogger(qm.cfg.LogDir+"bch_email_publisher.log", false)
+// expectedPayment returns the payment event an ethereum payment must emit.
+// For ethereum payments, the deposit address is the address of the payer
+func expectedPayment(payment *models.Payments) (*ethereum.ExpectedPayment, error) {
+	method, err := ethereum.PaymentMethod(payment.Type)
 	if err != nil {
-		return err
-	}
-	qmEmail, err := New(EmailSendQueue, qm.cfg, logger, true)
-	if err != nil {
-		return err
+		return nil, err
 	}
-	qm.l.Info("processing bch payment confirmations")
-	for {
-		select {
-		case d := <-msgs:
-			wg.Add(1)
-			fmt.Println(d)
-			go qm.processBchPaymentConfirmation(ctx, d, wg, service, qmEmail)
-		case <-ctx.Done():
-			qm.Close()
-			wg.Done()
-			return nil
-		case msg := <-qm.ErrCh:
-			qm.Close()
-			wg.Done()
-			qm.l.Errorw(
-				"a protocol connection error stopping rabbitmq was received",
-				"error", msg.Error())
-			return errors.New(ErrReconnect)
-		}
+	if !common.IsHexAddress(payment.DepositAddress) {
+		return nil, errors.New("invalid payer address for ethereum payment")
 	}
+	return &ethereum.ExpectedPayment{
+		Payer:             common.HexToAddress(payment.DepositAddress),
+		PaymentNumber:     payment.Number,
+		PaymentMethod:     method,
+		ChargeAmountInWei: utils.FloatToBigInt(payment.ChargeAmount),
+	}, nil
 }
 
-func (qm *Manager) processBchPaymentConfirmation(ctx context.Context, d amqp.Delivery, wg *sync.WaitGroup, service *service.PaymentService, qmEmail *Manager) {
-	defer wg.Done()
-	qm.l.Info("new bch payment message received")
-	msg := BchPaymentConfirmation{}
-	if err := json.Unmarshal(d.Body, &msg); err != nil {
-		qm.l.Error("failed to unmarshal message", "error", err.Error())
-		d.Ack(false)
-		return
-	}
-	logger := qm.l.With("user", msg.UserName).With("number", msg.PaymentNumber).With("currency", "bch")
-	payment, err := service.PM.FindPaymentByNumber(msg.UserName, msg.PaymentNumber)
-	if err != nil {
-		logger.Errorw("failed to find payment from database", "error", err.Error())
-		d.Ack(false)
-		return
-	}
-	if err := service.BCH.ProcessPaymentTx(ctx, logger, payment.ChargeAmount, payment.TxHash, payment.DepositAddress); err != nil {
-		logger.Errorw("failed to process payment", "error", err.Error(), "tx.hash", payment.TxHash)
-		d.Ack(false)
-		return
-	}
-	logger.Infow("successfully confirmed payment", "tx.hash", payment.TxHash)
-	if _, err := service.PM.ConfirmPayment(payment.TxHash); err != nil {
-		logger.Errorw("failed to confirm payment", "error", err.Error())
-		d.Ack(false)
-		return
-	}
-	if _, err := service.UM.AddCredits(msg.UserName, payment.USDValue); err != nil {
-		logger.Errorw("failed to add credits to user", "error", err.Error())
-		d.Ack(false)
-		return
-	}
-	user, err := service.UM.FindByUserName(msg.UserName)
-	if err != nil {
-		logger.Errorw("failed to find email for user", "error", err.Error())
-		d.Ack(false)
-		return
-	}
-	if !user.EmailEnabled {
-		logger.Warnw("user has not activated their email and won't receive notifications")
-		d.Ack(false)
-		return
-	}
-	es := EmailSend{
-		Subject:     "BCH Payment Confirmed",
-		Content:     fmt.Sprintf("Your bch payment for %v credits has been confirmed", payment.USDValue),
-		ContentType: "text/html",
-		UserNames:   []string{payment.UserName},
-		Emails:      []string{user.EmailAddress},
-	}
-	if err := qmEmail.PublishMessage(es); err != nil {
-		logger.Errorw("failed to send payment confirmation email", "error", err.Error())
+// DASHProcessor is used to process dash based payments
+type DASHProcessor struct {
+	client *dash.DashClient
+}
+
+// NewDASHProcessor is used to instantiate our dash payment processor,
+// verifying transactions through chainrider
+func NewDASHProcessor(ctx context.Context, cfg *config.TemporalConfig) (PaymentProcessor, error) {
+	return NewDASHProcessorWithOpts(dash.Opts{})(ctx, cfg)
+}
+
+// NewDASHProcessorWithOpts returns the constructor for our dash payment processor,
+// allowing transactions to be verified against our own dashd node instead of chainrider
+func NewDASHProcessorWithOpts(opts dash.Opts) ProcessorConstructor {
+	return func(ctx context.Context, cfg *config.TemporalConfig) (PaymentProcessor, error) {
+		client, err := dash.NewDashClient(cfg, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &DASHProcessor{client: client}, nil
 	}
-	d.Ack(false)
-	return
 }
 
-func (qm *Manager) processDashPaymentConfirmation(d amqp.Delivery, wg *sync.WaitGroup, service *service.PaymentService, qmEmail *Manager, um *models.UserManager) {
-	defer wg.Done()
-	qm.l.Info("new dash payment message received")
+// Currency returns the name of the currency being processed
+func (dp *DASHProcessor) Currency() string { return "DASH" }
+
+// Decode is used to parse a DashPaymentConfirmation message
+func (dp *DASHProcessor) Decode(body []byte) (*PaymentRequest, error) {
 	msg := DashPaymentConfirmation{}
-	if err := json.Unmarshal(d.Body, &msg); err != nil {
-		qm.l.Error("failed to unmarshal message", "error", err.Error())
-		d.Ack(false)
-		return
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, err
 	}
-	logger := qm.l.With("user", msg.UserName).With("number", msg.PaymentNumber).With("currency", "dash")
-	paymentForward, err := service.Dash.C.GetPaymentForwardByID(msg.PaymentForwardID)
-	if err != nil {
-		logger.Errorw("failed to get payment forward by id", "error", err.Error())
-		d.Ack(false)
-		return
+	return &PaymentRequest{UserName: msg.UserName, PaymentNumber: msg.PaymentNumber, Message: &msg}, nil
+}
+
+// TrackBlocks is used to wake payments waiting on confirmations once per block
+func (dp *DASHProcessor) TrackBlocks(ctx context.Context, logger *zap.SugaredLogger) {
+	dp.client.TrackBlocks(ctx, logger)
+}
+
+// BlockHeight returns the current height of the chain
+func (dp *DASHProcessor) BlockHeight(ctx context.Context) (uint64, error) {
+	height, err := dp.client.Backend.BlockHeight()
+	return uint64(height), err
+}
+
+// TxBlockHash returns the hash of the canonical block containing a transaction
+func (dp *DASHProcessor) TxBlockHash(ctx context.Context, txHash string) (string, error) {
+	return dp.client.TxBlockHash(txHash)
+}
+
+// Verify is used to wait for the transactions made through a payment forward,
+// or directly to the deposit address, to cover the charge amount of a payment
+func (dp *DASHProcessor) Verify(ctx context.Context, logger *zap.SugaredLogger, req *PaymentRequest, payment *models.Payments) error {
+	msg := req.Message.(*DashPaymentConfirmation)
+	if msg.PaymentForwardID == "" {
+		if payment.DepositAddress == "" {
+			return Permanent(errors.New("no payment forward or deposit address for dash payment"))
+		}
+		return dp.client.ProcessDepositPayment(ctx, &dash.ProcessPaymentOpts{
+			Number:         payment.Number,
+			ChargeAmount:   payment.ChargeAmount,
+			DepositAddress: payment.DepositAddress,
+		}, logger)
 	}
-	payment, err := service.PM.FindPaymentByNumber(msg.UserName, msg.PaymentNumber)
+	paymentForward, err := dp.client.C.GetPaymentForwardByID(msg.PaymentForwardID)
 	if err != nil {
-		logger.Errorw("failed to search for payment by number", "error", err.Error())
-		d.Ack(false)
-		return
+		return err
 	}
 	opts := dash.ProcessPaymentOpts{
 		Number:         payment.Number,
 		ChargeAmount:   payment.ChargeAmount,
 		PaymentForward: paymentForward,
 	}
-	if err = service.Dash.ProcessPayment(&opts, qm.l.With("user", msg.UserName)); err != nil {
-		logger.Errorw("failed to process dash payment", "error", err.Error())
-		d.Ack(false)
-		return
+	if err = dp.client.ProcessPayment(ctx, &opts, logger); err != nil {
+		return err
 	}
 	// during processing, the user may have sent additional payments so need to re-grab them
-	paymentForward, err = service.Dash.C.GetPaymentForwardByID(msg.PaymentForwardID)
+	paymentForward, err = dp.client.C.GetPaymentForwardByID(msg.PaymentForwardID)
 	if err != nil {
-		logger.Errorw("failed to get payment forward by id", "error", err.Error())
-		d.Ack(false)
-		return
+		return err
 	}
 	if len(paymentForward.ProcessedTxs) == 0 {
-		logger.Errorw("no processed transactions detected", "error", err.Error())
-		d.Ack(false)
-		return
+		return errors.New("no processed transactions detected")
 	}
-	if _, err = service.PM.ConfirmPayment(payment.TxHash); err != nil {
-		logger.Errorw("failed to confirm payment", "error", err.Error())
-		d.Ack(false)
-		return
+	return nil
+}
+
+// BCHProcessor is used to process bitcoin cash based payments
+type BCHProcessor struct {
+	client *bch.Client
+}
+
+// NewBCHProcessor is used to instantiate our bitcoin cash payment processor
+func NewBCHProcessor(ctx context.Context, cfg *config.TemporalConfig) (PaymentProcessor, error) {
+	client, err := bch.NewClient(ctx, cfg, false)
+	if err != nil {
+		return nil, err
 	}
-	if _, err = service.UM.AddCredits(msg.UserName, payment.USDValue); err != nil {
-		logger.Errorw("failed to add credits to user", "error", err.Error())
-		d.Ack(false)
-		return
+	return &BCHProcessor{client: client}, nil
+}
+
+// Currency returns the name of the currency being processed
+func (bp *BCHProcessor) Currency() string { return "BCH" }
+
+// Decode is used to parse a BchPaymentConfirmation message
+func (bp *BCHProcessor) Decode(body []byte) (*PaymentRequest, error) {
+	msg := BchPaymentConfirmation{}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, err
 	}
-	logger.Infow("successfully confirmed payment", "credits", payment.USDValue)
-	user, err := um.FindByUserName(payment.UserName)
-	if err != nil {
-		logger.Errorw("failed to find email for user", "error", err.Error())
-		d.Ack(false)
-		return
+	return &PaymentRequest{UserName: msg.UserName, PaymentNumber: msg.PaymentNumber, Message: &msg}, nil
+}
+
+// TrackBlocks is used to wake payments waiting on confirmations once per block
+func (bp *BCHProcessor) TrackBlocks(ctx context.Context, logger *zap.SugaredLogger) {
+	bp.client.TrackBlocks(ctx, logger)
+}
+
+// BlockHeight returns the current height of the chain
+func (bp *BCHProcessor) BlockHeight(ctx context.Context) (uint64, error) {
+	height, err := bp.client.GetCurrentBlockHeight(ctx)
+	return uint64(height), err
+}
+
+// TxBlockHash returns the hash of the canonical block containing a transaction
+func (bp *BCHProcessor) TxBlockHash(ctx context.Context, txHash string) (string, error) {
+	return bp.client.TxBlockHash(ctx, txHash)
+}
+
+// Verify is used to wait for a bitcoin cash payment to be confirmed
+func (bp *BCHProcessor) Verify(ctx context.Context, logger *zap.SugaredLogger, req *PaymentRequest, payment *models.Payments) error {
+	err := bp.client.ProcessPaymentTx(ctx, logger, payment.ChargeAmount, payment.TxHash, payment.DepositAddress)
+	if err != nil && err.Error() == bch.ErrTxTooLowValue {
+		return Permanent(err)
+	}
+	return err
+}
+
+// BTCProcessor is used to process bitcoin based payments
+type BTCProcessor struct {
+	client *btc.Client
+}
+
+// NewBTCProcessor returns the constructor for our bitcoin payment processor.
+// As bitcoind isn't part of our temporal configuration, the json-rpc url of
+// the node, including credentials, must be provided. The processor is not
+// registered by default, and must be registered for BitcoinPaymentConfirmationQueue
+func NewBTCProcessor(url string, devMode bool) ProcessorConstructor {
+	return func(ctx context.Context, cfg *config.TemporalConfig) (PaymentProcessor, error) {
+		if url == "" {
+			return nil, errors.New("bitcoin rpc url not specified")
+		}
+		client, err := btc.NewClient(url, devMode)
+		if err != nil {
+			return nil, err
+		}
+		return &BTCProcessor{client: client}, nil
 	}
-	if !user.EmailEnabled {
-		logger.Warnw("user has not activated their email and won't receive notifications")
-		d.Ack(false)
-		return
+}
+
+// Currency returns the name of the currency being processed
+func (bp *BTCProcessor) Currency() string { return "BTC" }
+
+// Decode is used to parse a BtcPaymentConfirmation message
+func (bp *BTCProcessor) Decode(body []byte) (*PaymentRequest, error) {
+	msg := BtcPaymentConfirmation{}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, err
 	}
-	es := EmailSend{
-		Subject:     "DASH Payment Confirmed",
-		Content:     fmt.Sprintf("Your dash payment for %v credits has been confirmed", payment.USDValue),
-		ContentType: "text/html",
-		UserNames:   []string{payment.UserName},
-		Emails:      []string{user.EmailAddress},
+	return &PaymentRequest{UserName: msg.UserName, PaymentNumber: msg.PaymentNumber, Message: &msg}, nil
+}
+
+// BlockHeight returns the current height of the chain
+func (bp *BTCProcessor) BlockHeight(ctx context.Context) (uint64, error) {
+	height, err := bp.client.GetCurrentBlockHeight(ctx)
+	return uint64(height), err
+}
+
+// TrackBlocks is used to wake payments waiting on confirmations once per block
+func (bp *BTCProcessor) TrackBlocks(ctx context.Context, logger *zap.SugaredLogger) {
+	bp.client.TrackBlocks(ctx, logger)
+}
+
+// TxBlockHash returns the hash of the canonical block containing a transaction
+func (bp *BTCProcessor) TxBlockHash(ctx context.Context, txHash string) (string, error) {
+	return bp.client.TxBlockHash(ctx, txHash)
+}
+
+// Verify is used to wait for a bitcoin payment to be confirmed
+func (bp *BTCProcessor) Verify(ctx context.Context, logger *zap.SugaredLogger, req *PaymentRequest, payment *models.Payments) error {
+	err := bp.client.ProcessPaymentTx(ctx, logger, payment.ChargeAmount, payment.TxHash, payment.DepositAddress)
+	if err != nil && err.Error() == btc.ErrTxTooLowValue {
+		return Permanent(err)
+	}
+	return err
+}
+
+// XMRProcessor is used to process monero based payments
+type XMRProcessor struct {
+	client *monero.Client
+}
+
+// NewXMRProcessor is used to instantiate our monero payment processor
+func NewXMRProcessor(ctx context.Context, cfg *config.TemporalConfig) (PaymentProcessor, error) {
+	client, err := monero.NewClient(cfg, false)
+	if err != nil {
+		return nil, err
 	}
-	if err := qmEmail.PublishMessage(es); err != nil {
-		logger.Errorw("failed to send payment confirmation email", "error", err.Error())
+	return &XMRProcessor{client: client}, nil
+}
+
+// Currency returns the name of the currency being processed
+func (xp *XMRProcessor) Currency() string { return "XMR" }
+
+// Decode is used to parse a XmrPaymentConfirmation message
+func (xp *XMRProcessor) Decode(body []byte) (*PaymentRequest, error) {
+	msg := XmrPaymentConfirmation{}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, err
+	}
+	return &PaymentRequest{UserName: msg.UserName, PaymentNumber: msg.PaymentNumber, Message: &msg}, nil
+}
+
+// BlockHeight returns the current height of the chain
+func (xp *XMRProcessor) BlockHeight(ctx context.Context) (uint64, error) {
+	return xp.client.GetCurrentBlockHeight(ctx)
+}
+
+// Verify is used to wait for a monero payment to be confirmed
+func (xp *XMRProcessor) Verify(ctx context.Context, logger *zap.SugaredLogger, req *PaymentRequest, payment *models.Payments) error {
+	err := xp.client.ProcessPaymentTx(ctx, logger, payment.ChargeAmount, payment.TxHash, payment.DepositAddress)
+	if err != nil && err.Error() == monero.ErrTxTooLowValue {
+		return Permanent(err)
 	}
-	d.Ack(false)
-	return
+	return err
 }
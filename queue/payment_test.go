@@ -0,0 +1,40 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/RTradeLtd/Pay/ethereum"
+	"github.com/RTradeLtd/database/v2/models"
+)
+
+func Test_ExpectedPayment(t *testing.T) {
+	tests := []struct {
+		name    string
+		payment models.Payments
+		method  uint8
+		wantErr bool
+	}{
+		{"eth", models.Payments{Type: "eth", DepositAddress: "0x7E4A2359c745A982a54653128085eAC69E446DE1"}, ethereum.PaymentMethodETH, false},
+		{"rtc", models.Payments{Type: "rtc", DepositAddress: "0x7E4A2359c745A982a54653128085eAC69E446DE1"}, ethereum.PaymentMethodRTC, false},
+		{"type", models.Payments{Type: "xmr", DepositAddress: "0x7E4A2359c745A982a54653128085eAC69E446DE1"}, 0, true},
+		{"payer", models.Payments{Type: "eth", DepositAddress: "hello"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.payment.Number = 5
+			tt.payment.ChargeAmount = 0.5
+			expected, err := expectedPayment(&tt.payment)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expectedPayment() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if expected.PaymentMethod != tt.method || expected.PaymentNumber != 5 ||
+				expected.ChargeAmountInWei.String() != "500000000000000000" ||
+				expected.Payer.String() != tt.payment.DepositAddress {
+				t.Fatal("bad expected payment returned", expected)
+			}
+		})
+	}
+}
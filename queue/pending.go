@@ -0,0 +1,155 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/Pay/store"
+	"github.com/RTradeLtd/config/v2"
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+// ErrPaymentExpired is an error used to indicate that
+// a payment did not confirm before its deadline
+const ErrPaymentExpired = "payment did not confirm before its deadline"
+
+// paymentDeadline is how long after a payment is first seen
+// we will keep waiting for it to confirm, across all retries
+var paymentDeadline = time.Hour * 6
+
+// HeightReporter is implemented by payment processors able to report the
+// current height of their chain, which is recorded when a payment is first seen
+type HeightReporter interface {
+	BlockHeight(ctx context.Context) (uint64, error)
+}
+
+// pendingStore is used to persist the state of pending payments
+type pendingStore interface {
+	FindPending(username string, number int64) (*store.PendingPayment, error)
+	CreatePending(queue string, payment *models.Payments, message []byte, firstSeenBlock uint64, deadline time.Time) (*store.PendingPayment, error)
+	UpdateStatus(pending *store.PendingPayment, status store.PaymentStatus, reason string) error
+	StartAttempt(pending *store.PendingPayment) error
+	FindUnfinished(queue string) ([]store.PendingPayment, error)
+	RecordBlock(pending *store.PendingPayment, blockHash string) error
+	RecordMissing(pending *store.PendingPayment, checks int) error
+	FindConfirmedSince(queue string, since time.Time) ([]store.PendingPayment, error)
+}
+
+// inFlight holds the payments currently being verified by this process, so that
+// a recovered payment isn't verified twice alongside its redelivered message
+var inFlight sync.Map
+
+// startInFlight is used to mark a payment as being verified, returning
+// false if it is already being verified
+func startInFlight(queue Queue, username string, number int64) (func(), bool) {
+	key := fmt.Sprintf("%s/%s/%d", queue, username, number)
+	if _, loaded := inFlight.LoadOrStore(key, struct{}{}); loaded {
+		return nil, false
+	}
+	return func() { inFlight.Delete(key) }, true
+}
+
+// trackPayment is used to retrieve the pending state of a payment,
+// creating it if this is the first time the payment has been seen
+func (qm *Manager) trackPayment(
+	ctx context.Context,
+	processor PaymentProcessor,
+	pending pendingStore,
+	payment *models.Payments,
+	message []byte,
+) (*store.PendingPayment, error) {
+	state, err := pending.FindPending(payment.UserName, payment.Number)
+	if err == nil {
+		return state, nil
+	} else if !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	var height uint64
+	if hr, ok := processor.(HeightReporter); ok {
+		if height, err = hr.BlockHeight(ctx); err != nil {
+			qm.l.Warnw("failed to get block height", "error", err.Error())
+			height = 0
+		}
+	}
+	return pending.CreatePending(qm.QueueName.String(), payment, message, height, time.Now().Add(paymentDeadline))
+}
+
+// recordBlock is used to record the block containing the transaction of a verified
+// payment, so that it can be watched for reorgs. As the payment has been verified,
+// failures are only logged
+func (qm *Manager) recordBlock(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	processor PaymentProcessor,
+	pending pendingStore,
+	state *store.PendingPayment,
+	payment *models.Payments,
+) {
+	rc, ok := processor.(ReorgChecker)
+	if !ok || payment.TxHash == "" {
+		return
+	}
+	blockHash, err := rc.TxBlockHash(ctx, payment.TxHash)
+	if err != nil {
+		logger.Warnw("failed to get block of payment transaction", "error", err.Error())
+		return
+	}
+	// transactions locked through instantsend may be confirmed before being mined
+	if blockHash == "" {
+		return
+	}
+	if err := pending.RecordBlock(state, blockHash); err != nil {
+		logger.Warnw("failed to record block of payment transaction", "error", err.Error())
+	}
+}
+
+// RecoverPayments is used at startup to resume tracking payments that were pending
+// when the worker consuming the queue last stopped. Payments past their deadline are
+// expired, while those whose last attempt is older than the longest retry delay have
+// their original message published to the queue again. More recent payments may still
+// be unacked or waiting in a retry queue, so are left to be redelivered by the broker.
+// Should the original delivery also be redelivered, the duplicate is harmless as
+// settlement is recorded in the payment ledger
+func RecoverPayments(queue Queue, cfg *config.TemporalConfig, db *gorm.DB, logger *zap.SugaredLogger) error {
+	qm, err := New(queue, cfg, logger, true)
+	if err != nil {
+		return err
+	}
+	defer qm.Close()
+	return qm.recoverPayments(store.NewPendingManager(db), func(message []byte) error {
+		return qm.PublishMessage(json.RawMessage(message))
+	})
+}
+
+// recoverPayments is used to expire or republish the unfinished payments of our queue
+func (qm *Manager) recoverPayments(pending pendingStore, publish func([]byte) error) error {
+	unfinished, err := pending.FindUnfinished(qm.QueueName.String())
+	if err != nil {
+		return err
+	}
+	for i := range unfinished {
+		state := &unfinished[i]
+		logger := qm.l.With("user", state.UserName).With("number", state.Number)
+		if time.Now().After(state.Deadline) {
+			logger.Warn("pending payment expired while worker was stopped")
+			if err := pending.UpdateStatus(state, store.StatusExpired, ErrPaymentExpired); err != nil {
+				return err
+			}
+			continue
+		}
+		if time.Since(state.LastAttemptAt) < maxRetryDelay() {
+			logger.Infow("pending payment may still be redelivered, not resuming", "last_attempt", state.LastAttemptAt)
+			continue
+		}
+		logger.Infow("resuming pending payment", "status", state.Status, "first_seen_block", state.FirstSeenBlock)
+		if err := publish(state.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/Pay/log"
+	"github.com/RTradeLtd/Pay/store"
+	"github.com/RTradeLtd/config/v2"
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/streadway/amqp"
+	"go.uber.org/zap"
+)
+
+// PaymentRequest is a decoded payment confirmation message
+type PaymentRequest struct {
+	UserName      string
+	PaymentNumber int64
+	// Message is the decoded queue message, allowing processors
+	// to access any blockchain specific fields it contains
+	Message interface{}
+}
+
+// PaymentProcessor is used to verify payments made on a particular blockchain.
+// The confirmation, crediting and notification of a payment once it
+// has been verified is shared between all processors.
+type PaymentProcessor interface {
+	// Currency returns the name of the currency being processed,
+	// which is used in logs and notifications
+	Currency() string
+	// Decode is used to parse a payment confirmation message
+	Decode(body []byte) (*PaymentRequest, error)
+	// Verify is used to ensure that a payment has been made on-chain,
+	// and that the amount paid covers the payment's charge amount.
+	// It blocks until the payment has enough confirmations.
+	Verify(ctx context.Context, logger *zap.SugaredLogger, req *PaymentRequest, payment *models.Payments) error
+}
+
+// BlockTracker is implemented by payment processors able to track new blocks,
+// allowing payments waiting on confirmations to be woken once per block by a
+// single subscription rather than each polling the chain
+type BlockTracker interface {
+	// TrackBlocks is used to track new blocks until the context is cancelled
+	TrackBlocks(ctx context.Context, logger *zap.SugaredLogger)
+}
+
+// ProcessorConstructor is used to create the payment processor for a queue
+type ProcessorConstructor func(ctx context.Context, cfg *config.TemporalConfig) (PaymentProcessor, error)
+
+// paymentFinder is used to lookup the payment a message refers to
+type paymentFinder interface {
+	FindPaymentByNumber(username string, number int64) (*models.Payments, error)
+}
+
+var (
+	processors   = make(map[Queue]ProcessorConstructor)
+	processorMux sync.RWMutex
+)
+
+// RegisterPaymentProcessor is used to register the processor
+// that will handle messages sent to the given queue
+func RegisterPaymentProcessor(queue Queue, constructor ProcessorConstructor) {
+	processorMux.Lock()
+	defer processorMux.Unlock()
+	processors[queue] = constructor
+}
+
+// paymentProcessor returns the processor constructor registered for a queue
+func paymentProcessor(queue Queue) (ProcessorConstructor, bool) {
+	processorMux.RLock()
+	defer processorMux.RUnlock()
+	constructor, ok := processors[queue]
+	return constructor, ok
+}
+
+// ProcessPayments is used to process payment confirmations using the given processor
+func (qm *Manager) ProcessPayments(ctx context.Context, wg *sync.WaitGroup, msgs <-chan amqp.Delivery, processor PaymentProcessor) error {
+	currency := strings.ToLower(processor.Currency())
+	logger, err := log.NewLogger(qm.cfg.LogDir+"pay_"+currency+"_email_publisher.log", false)
+	if err != nil {
+		return err
+	}
+	qmEmail, err := New(EmailSendQueue, qm.cfg, logger, true)
+	if err != nil {
+		return err
+	}
+	pm := models.NewPaymentManager(qm.db)
+	ledger := store.NewLedgerManager(qm.db)
+	pending := store.NewPendingManager(qm.db)
+	notify := qm.paymentNotifier(qmEmail, models.NewUserManager(qm.db), processor.Currency())
+	if bt, ok := processor.(BlockTracker); ok {
+		// stop tracking once we return, as a new processor
+		// is created whenever the queue reconnects
+		trackCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		bt.TrackBlocks(trackCtx, qm.l)
+	}
+	qm.l.Infow("processing payment confirmations", "currency", currency)
+	for {
+		select {
+		case d := <-msgs:
+			wg.Add(1)
+			go func(d amqp.Delivery) {
+				defer wg.Done()
+				qm.processPayment(ctx, d, processor, pm, ledger, pending, notify)
+			}(d)
+		case <-ctx.Done():
+			qm.Close()
+			wg.Done()
+			return nil
+		case msg := <-qm.ErrCh:
+			qm.Close()
+			wg.Done()
+			qm.l.Errorw(
+				"a protocol connection error stopping rabbitmq was received",
+				"error", msg.Error())
+			return errors.New(ErrReconnect)
+		}
+	}
+}
+
+// processPayment is used to verify and settle a single payment
+func (qm *Manager) processPayment(
+	ctx context.Context,
+	d amqp.Delivery,
+	processor PaymentProcessor,
+	pm paymentFinder,
+	ledger paymentLedger,
+	pending pendingStore,
+	notify paymentNotifier,
+) {
+	currency := strings.ToLower(processor.Currency())
+	qm.l.Infow("new payment message received", "currency", currency)
+	req, err := processor.Decode(d.Body)
+	if err != nil {
+		qm.l.Errorw("failed to unmarshal message", "error", err.Error())
+		qm.Fail(d, Permanent(err))
+		return
+	}
+	logger := qm.l.With("user", req.UserName).With("number", req.PaymentNumber).With("currency", currency)
+	payment, err := pm.FindPaymentByNumber(req.UserName, req.PaymentNumber)
+	if err != nil {
+		logger.Errorw("failed to find payment from database", "error", err.Error())
+		qm.Fail(d, err)
+		return
+	}
+	credited, err := ledger.HasStep(payment.UserName, payment.Number, store.StepCredited)
+	if err != nil {
+		logger.Errorw("failed to search payment ledger", "error", err.Error())
+		qm.Fail(d, err)
+		return
+	}
+	state, err := qm.trackPayment(ctx, processor, pending, payment, d.Body)
+	if err != nil {
+		logger.Errorw("failed to track pending payment", "error", err.Error())
+		qm.Fail(d, err)
+		return
+	}
+	// a reversed payment must not be confirmed again
+	if state.Status == store.StatusReversed.String() {
+		logger.Warnw("payment already finished", "status", state.Status)
+		qm.Fail(d, Permanent(errors.New(state.Reason)))
+		return
+	}
+	// a payment we've already credited has been verified, so only
+	// the remaining settlement steps need to be performed
+	if credited {
+		logger.Info("payment already credited, resuming settlement")
+	} else {
+		if state.Finished() && state.Status != store.StatusConfirmed.String() {
+			logger.Warnw("payment already finished", "status", state.Status)
+			qm.Fail(d, Permanent(errors.New(state.Reason)))
+			return
+		}
+		if time.Now().After(state.Deadline) {
+			qm.expirePayment(d, logger, pending, state)
+			return
+		}
+		done, ok := startInFlight(qm.QueueName, payment.UserName, payment.Number)
+		if !ok {
+			logger.Info("payment is already being verified, dropping duplicate message")
+			d.Ack(false)
+			return
+		}
+		defer done()
+		if err := pending.StartAttempt(state); err != nil {
+			logger.Errorw("failed to update pending payment", "error", err.Error())
+			qm.Fail(d, err)
+			return
+		}
+		// the deadline is shared by all attempts at verifying the payment
+		verifyCtx, cancel := context.WithDeadline(ctx, state.Deadline)
+		err := processor.Verify(verifyCtx, logger, req, payment)
+		cancel()
+		if err != nil {
+			logger.Errorw("failed to verify payment", "error", err.Error(), "tx.hash", payment.TxHash)
+			if time.Now().After(state.Deadline) {
+				qm.expirePayment(d, logger, pending, state)
+				return
+			}
+			if IsPermanent(err) {
+				if err := pending.UpdateStatus(state, store.StatusFailed, err.Error()); err != nil {
+					logger.Errorw("failed to update pending payment", "error", err.Error())
+				}
+			}
+			qm.Fail(d, err)
+			return
+		}
+		qm.recordBlock(ctx, logger, processor, pending, state, payment)
+	}
+	if err := settlePayment(ledger, payment, notify); err != nil {
+		logger.Errorw("failed to settle payment", "error", err.Error())
+		qm.Fail(d, err)
+		return
+	}
+	if err := pending.UpdateStatus(state, store.StatusConfirmed, ""); err != nil {
+		// the payment has been settled, so this is only logged
+		logger.Errorw("failed to update pending payment", "error", err.Error())
+	}
+	logger.Infow("successfully confirmed payment", "credits", payment.USDValue, "tx.hash", payment.TxHash)
+	d.Ack(false)
+}
+
+// expirePayment is used to record that a payment did not confirm before its deadline
+func (qm *Manager) expirePayment(d amqp.Delivery, logger *zap.SugaredLogger, pending pendingStore, state *store.PendingPayment) {
+	logger.Warnw("payment did not confirm before its deadline", "deadline", state.Deadline)
+	if err := pending.UpdateStatus(state, store.StatusExpired, ErrPaymentExpired); err != nil {
+		logger.Errorw("failed to update pending payment", "error", err.Error())
+		qm.Fail(d, err)
+		return
+	}
+	qm.Fail(d, Permanent(errors.New(ErrPaymentExpired)))
+}
@@ -0,0 +1,280 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/Pay/store"
+	"github.com/RTradeLtd/config/v2"
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/jinzhu/gorm"
+	"github.com/streadway/amqp"
+	"go.uber.org/zap"
+)
+
+type fakeProcessor struct {
+	verified int
+}
+
+// fakeReorgProcessor is a processor able to locate the block of a transaction
+type fakeReorgProcessor struct {
+	fakeProcessor
+	// blocks containing each transaction, a missing transaction has been dropped
+	blocks map[string]string
+}
+
+func (fp *fakeReorgProcessor) TxBlockHash(ctx context.Context, txHash string) (string, error) {
+	return fp.blocks[txHash], nil
+}
+
+func (fp *fakeProcessor) Currency() string { return "Fake" }
+
+func (fp *fakeProcessor) Decode(body []byte) (*PaymentRequest, error) {
+	msg := EthPaymentConfirmation{}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, err
+	}
+	return &PaymentRequest{UserName: msg.UserName, PaymentNumber: msg.PaymentNumber, Message: &msg}, nil
+}
+
+func (fp *fakeProcessor) Verify(ctx context.Context, logger *zap.SugaredLogger, req *PaymentRequest, payment *models.Payments) error {
+	fp.verified++
+	return nil
+}
+
+type fakeFinder map[int64]*models.Payments
+
+func (ff fakeFinder) FindPaymentByNumber(username string, number int64) (*models.Payments, error) {
+	return ff[number], nil
+}
+
+type fakePending map[int64]*store.PendingPayment
+
+func (fp fakePending) FindPending(username string, number int64) (*store.PendingPayment, error) {
+	if pending, ok := fp[number]; ok {
+		return pending, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (fp fakePending) CreatePending(queue string, payment *models.Payments, message []byte, firstSeenBlock uint64, deadline time.Time) (*store.PendingPayment, error) {
+	fp[payment.Number] = &store.PendingPayment{
+		Number:         payment.Number,
+		UserName:       payment.UserName,
+		Queue:          queue,
+		Status:         store.StatusSeen.String(),
+		FirstSeenBlock: int64(firstSeenBlock),
+		Deadline:       deadline,
+		Message:        message,
+		LastAttemptAt:  time.Now(),
+	}
+	return fp[payment.Number], nil
+}
+
+func (fp fakePending) UpdateStatus(pending *store.PendingPayment, status store.PaymentStatus, reason string) error {
+	pending.Status = status.String()
+	pending.Reason = reason
+	// FindUnfinished returns copies, so the stored entry is updated too
+	fp[pending.Number].Status = pending.Status
+	fp[pending.Number].Reason = pending.Reason
+	return nil
+}
+
+func (fp fakePending) StartAttempt(pending *store.PendingPayment) error {
+	pending.Status = store.StatusConfirming.String()
+	pending.Reason = ""
+	pending.LastAttemptAt = time.Now()
+	fp[pending.Number].Status = pending.Status
+	fp[pending.Number].Reason = pending.Reason
+	fp[pending.Number].LastAttemptAt = pending.LastAttemptAt
+	return nil
+}
+
+func (fp fakePending) FindUnfinished(queue string) ([]store.PendingPayment, error) {
+	var unfinished []store.PendingPayment
+	for _, pending := range fp {
+		if pending.Queue == queue && !pending.Finished() {
+			unfinished = append(unfinished, *pending)
+		}
+	}
+	return unfinished, nil
+}
+
+func (fp fakePending) RecordBlock(pending *store.PendingPayment, blockHash string) error {
+	if pending.ConfirmedAt == nil {
+		now := time.Now()
+		pending.ConfirmedAt = &now
+	}
+	pending.BlockHash = blockHash
+	pending.MissingChecks = 0
+	fp[pending.Number].ConfirmedAt = pending.ConfirmedAt
+	fp[pending.Number].BlockHash = pending.BlockHash
+	fp[pending.Number].MissingChecks = 0
+	return nil
+}
+
+func (fp fakePending) RecordMissing(pending *store.PendingPayment, checks int) error {
+	pending.MissingChecks = checks
+	fp[pending.Number].MissingChecks = checks
+	return nil
+}
+
+func (fp fakePending) FindConfirmedSince(queue string, since time.Time) ([]store.PendingPayment, error) {
+	var confirmed []store.PendingPayment
+	for _, pending := range fp {
+		watched := pending.Status == store.StatusConfirmed.String() || pending.Status == store.StatusReversed.String()
+		if pending.Queue == queue && watched && pending.BlockHash != "" && pending.ConfirmedAt.After(since) {
+			confirmed = append(confirmed, *pending)
+		}
+	}
+	return confirmed, nil
+}
+
+type fakeAcknowledger struct {
+	acks int
+}
+
+func (fa *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	fa.acks++
+	return nil
+}
+
+func (fa *fakeAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error { return nil }
+
+func (fa *fakeAcknowledger) Reject(tag uint64, requeue bool) error { return nil }
+
+func Test_ProcessPayment(t *testing.T) {
+	qm := &Manager{l: zap.NewNop().Sugar()}
+	payment := &models.Payments{UserName: "testuser", Number: 1, TxHash: "0x1", USDValue: 10}
+	body, err := json.Marshal(EthPaymentConfirmation{UserName: "testuser", PaymentNumber: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := &fakeReorgProcessor{blocks: map[string]string{"0x1": "0xb1"}}
+	fl := newFakeLedger()
+	fa := &fakeAcknowledger{}
+	pending := fakePending{}
+	d := amqp.Delivery{Acknowledger: fa, Body: body}
+	qm.processPayment(context.Background(), d, fp, fakeFinder{1: payment}, fl, pending, fl.notify)
+	// redelivery of a credited payment should not be verified again
+	qm.processPayment(context.Background(), d, fp, fakeFinder{1: payment}, fl, pending, fl.notify)
+	if fp.verified != 1 {
+		t.Fatalf("payment verified %v times, want 1", fp.verified)
+	}
+	if fa.acks != 2 {
+		t.Fatalf("delivery acked %v times, want 2", fa.acks)
+	}
+	if fl.credits != payment.USDValue {
+		t.Fatalf("user credited %v, want %v", fl.credits, payment.USDValue)
+	}
+	if pending[1].Status != store.StatusConfirmed.String() {
+		t.Fatalf("pending payment status %v, want %v", pending[1].Status, store.StatusConfirmed)
+	}
+	if pending[1].BlockHash != "0xb1" {
+		t.Fatalf("pending payment block %v, want 0xb1", pending[1].BlockHash)
+	}
+}
+
+func Test_ProcessPayment_Expired(t *testing.T) {
+	qm := &Manager{l: zap.NewNop().Sugar()}
+	payment := &models.Payments{UserName: "testuser", Number: 1, TxHash: "0x1", USDValue: 10}
+	body, err := json.Marshal(EthPaymentConfirmation{UserName: "testuser", PaymentNumber: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := &fakeProcessor{}
+	fl := newFakeLedger()
+	// the deadline persisted from a previous run has passed
+	pending := fakePending{1: &store.PendingPayment{
+		Number:   1,
+		UserName: "testuser",
+		Status:   store.StatusConfirming.String(),
+		Deadline: time.Now().Add(-time.Minute),
+	}}
+	d := amqp.Delivery{Acknowledger: &fakeAcknowledger{}, Body: body}
+	// the manager has no channel, so Fail panics when
+	// republishing the message to the dead-letter queue
+	func() {
+		defer func() { recover() }()
+		qm.processPayment(context.Background(), d, fp, fakeFinder{1: payment}, fl, pending, fl.notify)
+	}()
+	if fp.verified != 0 {
+		t.Fatal("expired payment should not be verified")
+	}
+	if pending[1].Status != store.StatusExpired.String() {
+		t.Fatalf("pending payment status %v, want %v", pending[1].Status, store.StatusExpired)
+	}
+	if fl.credits != 0 {
+		t.Fatal("expired payment should not be credited")
+	}
+}
+
+func Test_RecoverPayments(t *testing.T) {
+	qm := &Manager{l: zap.NewNop().Sugar(), QueueName: EthPaymentConfirmationQueue}
+	stale := time.Now().Add(-maxRetryDelay() - time.Minute)
+	pending := fakePending{
+		1: {Number: 1, Queue: EthPaymentConfirmationQueue.String(), Status: store.StatusConfirming.String(),
+			Deadline: time.Now().Add(time.Hour), Message: []byte("1"), LastAttemptAt: stale},
+		2: {Number: 2, Queue: EthPaymentConfirmationQueue.String(), Status: store.StatusSeen.String(),
+			Deadline: time.Now().Add(-time.Hour), Message: []byte("2")},
+		3: {Number: 3, Queue: EthPaymentConfirmationQueue.String(), Status: store.StatusConfirmed.String(),
+			Deadline: time.Now().Add(time.Hour), Message: []byte("3")},
+		4: {Number: 4, Queue: DashPaymentConfirmationQueue.String(), Status: store.StatusSeen.String(),
+			Deadline: time.Now().Add(time.Hour), Message: []byte("4"), LastAttemptAt: stale},
+		// attempted recently, so may still be unacked or waiting in a retry queue
+		5: {Number: 5, Queue: EthPaymentConfirmationQueue.String(), Status: store.StatusConfirming.String(),
+			Deadline: time.Now().Add(time.Hour), Message: []byte("5"), LastAttemptAt: time.Now()},
+	}
+	var published []string
+	if err := qm.recoverPayments(pending, func(message []byte) error {
+		published = append(published, string(message))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(published) != 1 || published[0] != "1" {
+		t.Fatal("bad messages published", published)
+	}
+	if pending[2].Status != store.StatusExpired.String() {
+		t.Fatalf("pending payment status %v, want %v", pending[2].Status, store.StatusExpired)
+	}
+}
+
+func Test_StartInFlight(t *testing.T) {
+	done, ok := startInFlight(EthPaymentConfirmationQueue, "testuser", 1)
+	if !ok {
+		t.Fatal("payment should not be in flight")
+	}
+	if _, ok := startInFlight(EthPaymentConfirmationQueue, "testuser", 1); ok {
+		t.Fatal("payment should be in flight")
+	}
+	done()
+	if _, ok := startInFlight(EthPaymentConfirmationQueue, "testuser", 1); !ok {
+		t.Fatal("payment should not be in flight")
+	}
+}
+
+func Test_RegisterPaymentProcessor(t *testing.T) {
+	for _, queue := range []Queue{
+		EthPaymentConfirmationQueue,
+		DashPaymentConfirmationQueue,
+		BitcoinCashPaymentConfirmationQueue,
+		MoneroPaymentConfirmationQueue,
+	} {
+		if _, ok := paymentProcessor(queue); !ok {
+			t.Fatalf("no processor registered for %s", queue)
+		}
+	}
+	if _, ok := paymentProcessor(ENSRequestQueue); ok {
+		t.Fatal("unexpected processor registered for ens queue")
+	}
+	fake := Queue("fake-payment-confirmation-queue")
+	RegisterPaymentProcessor(fake, func(context.Context, *config.TemporalConfig) (PaymentProcessor, error) {
+		return &fakeProcessor{}, nil
+	})
+	if _, ok := paymentProcessor(fake); !ok {
+		t.Fatal("processor was not registered")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/jinzhu/gorm"
 	"go.uber.org/zap"
 
+	"github.com/RTradeLtd/Pay/ethereum"
 	"github.com/RTradeLtd/config/v2"
 	"github.com/streadway/amqp"
 )
@@ -27,6 +28,15 @@ type Manager struct {
 	ErrCh        chan *amqp.Error
 	QueueName    Queue
 	ExchangeName string
+	// ENSOpts configures the ethereum client used to process ens requests
+	ENSOpts ethereum.Opts
+	// RegisterCredits is the number of credits charged for registering a
+	// .eth name, and names can't be registered unless it is positive
+	RegisterCredits float64
+	// RenewalOpts configures the monitoring of our ens names for expiry
+	RenewalOpts RenewalOpts
+	// BatchOpts configures the coalescing of ens requests into batches
+	BatchOpts BatchOpts
 }
 
 // New is used to instantiate a new connection to rabbitmq as a publisher or consumer
@@ -118,12 +128,12 @@ func (qm *Manager) declareQueue() error {
 	}
 	qm.l.Info("queue declared")
 	qm.queue = &q
-	return nil
+	return qm.declareRetryTopology()
 }
 
 // ConsumeMessages is used to consume messages that are sent to the queue
-// Question, do we really want to ack messages that fail to be processed?
-// Perhaps the error was temporary, and we allow it to be retried?
+// Messages that fail to be processed are handed to Fail, which retries
+// transient failures and dead-letters permanent ones
 func (qm *Manager) ConsumeMessages(ctx context.Context, wg *sync.WaitGroup, db *gorm.DB, cfg *config.TemporalConfig) error {
 	// embed database into queue manager
 	qm.db = db
@@ -145,14 +155,16 @@ func (qm *Manager) ConsumeMessages(ctx context.Context, wg *sync.WaitGroup, db *
 		return err
 	}
 
+	// payment queues are handled by their registered processor
+	if newProcessor, ok := paymentProcessor(qm.QueueName); ok {
+		processor, err := newProcessor(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		return qm.ProcessPayments(ctx, wg, msgs, processor)
+	}
 	// check the queue name
 	switch qm.QueueName {
-	case DashPaymentConfirmationQueue:
-		return qm.ProcessDASHPayment(ctx, wg, msgs)
-	case EthPaymentConfirmationQueue:
-		return qm.ProcessETHPayment(ctx, wg, msgs)
-	case BitcoinCashPaymentConfirmationQueue:
-		return qm.ProcessBCHPayment(ctx, wg, msgs)
 	case ENSRequestQueue:
 		return qm.ProcessENSRequest(ctx, wg, msgs)
 	default:
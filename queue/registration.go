@@ -0,0 +1,249 @@
+package queue
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/Pay/ethereum"
+	"github.com/RTradeLtd/Pay/store"
+	"go.uber.org/zap"
+)
+
+// ErrRegistrationDisabled is an error used to indicate that no price is
+// configured for .eth names, so they can't be registered
+const ErrRegistrationDisabled = "registration of .eth names is disabled"
+
+// revealDelay is waited beyond the minimum commitment interval before revealing,
+// so that the reveal isn't mined in a block timestamped before the interval passed
+var revealDelay = time.Minute
+
+// nameRegistrar is used to send the transactions of a two stage name registration
+type nameRegistrar interface {
+	CommitName(ctx context.Context, name string, secret [32]byte) error
+	CommitmentTime(name string, secret [32]byte) (time.Time, error)
+	CommitmentIntervals() (time.Duration, time.Duration, error)
+	RevealName(ctx context.Context, name string, secret [32]byte) error
+	NameRegistered(name string) (bool, error)
+}
+
+// registrationStore is used to persist the state of name registrations
+type registrationStore interface {
+	CreateRegistration(username, name, secret string) (*store.NameRegistration, error)
+	ChargeRegistration(reg *store.NameRegistration, credits float64) error
+	RefundRegistration(reg *store.NameRegistration) error
+	RecordCommit(reg *store.NameRegistration, committedAt, revealAfter time.Time) error
+	UpdateRegistrationStatus(reg *store.NameRegistration, status store.RegistrationStatus, reason string) error
+	FindUnfinishedRegistrations() ([]store.NameRegistration, error)
+}
+
+// nameRegistrations is used to register .eth names. Rather than waiting out the
+// commitment interval while processing a request, the commitment is persisted and
+// its reveal scheduled, allowing registrations to resume after a restart. Users are
+// charged for a registration before committing to it, and refunded should it fail
+type nameRegistrations struct {
+	ctx       context.Context
+	wg        *sync.WaitGroup
+	registrar nameRegistrar
+	store     registrationStore
+	// credits is the price of a registration, which must be positive
+	credits float64
+	// notify is used to email the user once their registration completes
+	notify func(username string, err error)
+	l      *zap.SugaredLogger
+}
+
+// register is used to commit to the registration of a name, scheduling its reveal
+func (nr *nameRegistrations) register(username, name string) error {
+	if nr.credits <= 0 {
+		return errors.New(ErrRegistrationDisabled)
+	}
+	secret, err := ethereum.NewRegistrationSecret()
+	if err != nil {
+		return err
+	}
+	// the secret is persisted before committing, so that a commitment
+	// mined while we restart can still be revealed
+	reg, err := nr.store.CreateRegistration(username, name, hex.EncodeToString(secret[:]))
+	if err != nil {
+		return err
+	}
+	return nr.commit(reg, secret)
+}
+
+// resume is used to resume the registrations left unfinished by a previous run
+func (nr *nameRegistrations) resume() error {
+	regs, err := nr.store.FindUnfinishedRegistrations()
+	if err != nil {
+		return err
+	}
+	for i := range regs {
+		reg := &regs[i]
+		logger := nr.l.With("user", reg.UserName).With("name", reg.Name)
+		if reg.RefundDue() {
+			logger.Info("resuming registration refund")
+			nr.refund(reg)
+			continue
+		}
+		secret, err := decodeSecret(reg.Secret)
+		if err != nil {
+			logger.Errorw("failed to decode registration secret", "error", err.Error())
+			nr.fail(reg, err)
+			continue
+		}
+		switch store.RegistrationStatus(reg.Status) {
+		case store.RegistrationCommitting:
+			committedAt, err := nr.registrar.CommitmentTime(reg.Name, secret)
+			if err != nil {
+				return err
+			}
+			if committedAt.IsZero() {
+				// the commitment was never mined, so it is sent again
+				logger.Info("resuming registration commitment")
+				nr.wg.Add(1)
+				go func() {
+					defer nr.wg.Done()
+					if err := nr.commit(reg, secret); err != nil {
+						nr.notify(reg.UserName, err)
+					}
+				}()
+				continue
+			}
+			if err := nr.committed(reg, committedAt); err != nil {
+				return err
+			}
+		case store.RegistrationCommitted:
+			logger.Infow("resuming registration reveal", "reveal.after", reg.RevealAfter)
+			nr.schedule(reg, secret)
+		}
+	}
+	return nil
+}
+
+// commit is used to charge the user for a registration, unless they already have
+// been, and send its commitment, waiting for it to be mined
+func (nr *nameRegistrations) commit(reg *store.NameRegistration, secret [32]byte) error {
+	if reg.Charged == 0 {
+		err := errors.New(ErrRegistrationDisabled)
+		if nr.credits > 0 {
+			err = nr.store.ChargeRegistration(reg, nr.credits)
+		}
+		if err != nil {
+			nr.fail(reg, err)
+			return err
+		}
+	}
+	if err := nr.registrar.CommitName(nr.ctx, reg.Name, secret); err != nil {
+		// a commitment interrupted by shutdown is resumed on the next start
+		if nr.ctx.Err() == nil {
+			nr.fail(reg, err)
+		}
+		return err
+	}
+	committedAt, err := nr.registrar.CommitmentTime(reg.Name, secret)
+	if err != nil {
+		return err
+	}
+	if committedAt.IsZero() {
+		err = errors.New("commitment not found after being mined")
+		nr.fail(reg, err)
+		return err
+	}
+	return nr.committed(reg, committedAt)
+}
+
+// committed is used to record a mined commitment, scheduling its reveal
+func (nr *nameRegistrations) committed(reg *store.NameRegistration, committedAt time.Time) error {
+	minInterval, _, err := nr.registrar.CommitmentIntervals()
+	if err != nil {
+		return err
+	}
+	if err := nr.store.RecordCommit(reg, committedAt, committedAt.Add(minInterval+revealDelay)); err != nil {
+		return err
+	}
+	secret, err := decodeSecret(reg.Secret)
+	if err != nil {
+		return err
+	}
+	nr.schedule(reg, secret)
+	return nil
+}
+
+// schedule is used to reveal a registration once its commitment interval has passed
+func (nr *nameRegistrations) schedule(reg *store.NameRegistration, secret [32]byte) {
+	nr.wg.Add(1)
+	go func() {
+		defer nr.wg.Done()
+		timer := time.NewTimer(time.Until(*reg.RevealAfter))
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			nr.reveal(reg, secret)
+		case <-nr.ctx.Done():
+			// the reveal is resumed on the next start
+		}
+	}()
+}
+
+// reveal is used to complete a registration, notifying the user of the result
+func (nr *nameRegistrations) reveal(reg *store.NameRegistration, secret [32]byte) {
+	logger := nr.l.With("user", reg.UserName).With("name", reg.Name)
+	// the reveal may have been mined before a restart
+	registered, err := nr.registrar.NameRegistered(reg.Name)
+	if err == nil && !registered {
+		logger.Info("revealing name registration")
+		err = nr.registrar.RevealName(nr.ctx, reg.Name, secret)
+	}
+	if err != nil && nr.ctx.Err() != nil {
+		// the reveal is resumed on the next start, as it may yet be mined
+		logger.Warnw("name registration reveal interrupted", "error", err.Error())
+		return
+	}
+	if err != nil {
+		logger.Errorw("failed to reveal name registration", "error", err.Error())
+		nr.fail(reg, err)
+		nr.notify(reg.UserName, err)
+		return
+	}
+	if err := nr.store.UpdateRegistrationStatus(reg, store.RegistrationRegistered, ""); err != nil {
+		logger.Errorw("failed to update name registration", "error", err.Error())
+	}
+	logger.Info("registered name")
+	nr.notify(reg.UserName, nil)
+}
+
+// fail is used to mark a registration as failed, refunding the user
+// and allowing the registration to be requested again
+func (nr *nameRegistrations) fail(reg *store.NameRegistration, cause error) {
+	if err := nr.store.UpdateRegistrationStatus(reg, store.RegistrationFailed, cause.Error()); err != nil {
+		nr.l.Errorw("failed to update name registration",
+			"name", reg.Name, "error", err.Error())
+		return
+	}
+	nr.refund(reg)
+}
+
+// refund is used to refund the credits charged for a failed registration.
+// A failed refund is retried when registrations are next resumed
+func (nr *nameRegistrations) refund(reg *store.NameRegistration) {
+	if err := nr.store.RefundRegistration(reg); err != nil {
+		nr.l.Errorw("failed to refund name registration",
+			"name", reg.Name, "user", reg.UserName, "credits", reg.Charged, "error", err.Error())
+	}
+}
+
+// decodeSecret is used to decode a persisted registration secret
+func decodeSecret(encoded string) ([32]byte, error) {
+	var secret [32]byte
+	decoded, err := hex.DecodeString(encoded)
+	if err != nil {
+		return secret, err
+	}
+	if len(decoded) != len(secret) {
+		return secret, errors.New("registration secret must be 32 bytes")
+	}
+	copy(secret[:], decoded)
+	return secret, nil
+}
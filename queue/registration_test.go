@@ -0,0 +1,256 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/Pay/store"
+	"go.uber.org/zap"
+)
+
+// fakeRegistrar records the commitments and reveals of names
+type fakeRegistrar struct {
+	mux        sync.Mutex
+	committed  map[string]time.Time
+	registered map[string]bool
+	reveals    int
+	// revealErr fails every reveal
+	revealErr error
+}
+
+func (fr *fakeRegistrar) CommitName(ctx context.Context, name string, secret [32]byte) error {
+	fr.mux.Lock()
+	defer fr.mux.Unlock()
+	fr.committed[name] = time.Now()
+	return nil
+}
+
+func (fr *fakeRegistrar) CommitmentTime(name string, secret [32]byte) (time.Time, error) {
+	fr.mux.Lock()
+	defer fr.mux.Unlock()
+	return fr.committed[name], nil
+}
+
+func (fr *fakeRegistrar) CommitmentIntervals() (time.Duration, time.Duration, error) {
+	return 0, time.Hour, nil
+}
+
+func (fr *fakeRegistrar) RevealName(ctx context.Context, name string, secret [32]byte) error {
+	fr.mux.Lock()
+	defer fr.mux.Unlock()
+	if fr.revealErr != nil {
+		return fr.revealErr
+	}
+	fr.reveals++
+	fr.registered[name] = true
+	return nil
+}
+
+func (fr *fakeRegistrar) NameRegistered(name string) (bool, error) {
+	fr.mux.Lock()
+	defer fr.mux.Unlock()
+	return fr.registered[name], nil
+}
+
+type fakeRegistrations struct {
+	mux  sync.Mutex
+	regs map[string]*store.NameRegistration
+	// credits held by each user
+	credits map[string]float64
+}
+
+func (fr *fakeRegistrations) CreateRegistration(username, name, secret string) (*store.NameRegistration, error) {
+	fr.mux.Lock()
+	defer fr.mux.Unlock()
+	fr.regs[name] = &store.NameRegistration{
+		UserName: username, Name: name, Secret: secret, Status: store.RegistrationCommitting.String(),
+	}
+	return fr.regs[name], nil
+}
+
+func (fr *fakeRegistrations) ChargeRegistration(reg *store.NameRegistration, credits float64) error {
+	fr.mux.Lock()
+	defer fr.mux.Unlock()
+	if fr.credits[reg.UserName] < credits {
+		return errors.New("unable to remove credits, would result in negative balance")
+	}
+	fr.credits[reg.UserName] -= credits
+	reg.Charged = credits
+	fr.regs[reg.Name].Charged = credits
+	return nil
+}
+
+func (fr *fakeRegistrations) RefundRegistration(reg *store.NameRegistration) error {
+	fr.mux.Lock()
+	defer fr.mux.Unlock()
+	if !reg.RefundDue() {
+		return nil
+	}
+	fr.credits[reg.UserName] += reg.Charged
+	reg.Refunded = true
+	fr.regs[reg.Name].Refunded = true
+	return nil
+}
+
+func (fr *fakeRegistrations) RecordCommit(reg *store.NameRegistration, committedAt, revealAfter time.Time) error {
+	fr.mux.Lock()
+	defer fr.mux.Unlock()
+	reg.Status = store.RegistrationCommitted.String()
+	reg.CommittedAt = &committedAt
+	reg.RevealAfter = &revealAfter
+	return nil
+}
+
+func (fr *fakeRegistrations) UpdateRegistrationStatus(reg *store.NameRegistration, status store.RegistrationStatus, reason string) error {
+	fr.mux.Lock()
+	defer fr.mux.Unlock()
+	reg.Status = status.String()
+	reg.Reason = reason
+	fr.regs[reg.Name].Status = reg.Status
+	return nil
+}
+
+func (fr *fakeRegistrations) FindUnfinishedRegistrations() ([]store.NameRegistration, error) {
+	fr.mux.Lock()
+	defer fr.mux.Unlock()
+	var regs []store.NameRegistration
+	for _, reg := range fr.regs {
+		if !reg.Finished() || reg.RefundDue() {
+			regs = append(regs, *reg)
+		}
+	}
+	return regs, nil
+}
+
+func newFakeNameRegistrations(fr *fakeRegistrar, fs *fakeRegistrations) (*nameRegistrations, *[]string) {
+	var notified []string
+	var mux sync.Mutex
+	return &nameRegistrations{
+		ctx:       context.Background(),
+		wg:        &sync.WaitGroup{},
+		registrar: fr,
+		store:     fs,
+		credits:   10,
+		notify: func(username string, err error) {
+			mux.Lock()
+			defer mux.Unlock()
+			if err != nil {
+				username += ":" + err.Error()
+			}
+			notified = append(notified, username)
+		},
+		l: zap.NewNop().Sugar(),
+	}, &notified
+}
+
+func Test_NameRegistrations(t *testing.T) {
+	revealDelay = 0
+	fr := &fakeRegistrar{committed: map[string]time.Time{}, registered: map[string]bool{}}
+	fs := &fakeRegistrations{
+		regs:    map[string]*store.NameRegistration{},
+		credits: map[string]float64{"testuser": 15, "pooruser": 5},
+	}
+	nr, notified := newFakeNameRegistrations(fr, fs)
+	if err := nr.register("testuser", "testuser.eth"); err != nil {
+		t.Fatal(err)
+	}
+	nr.wg.Wait()
+	if fs.regs["testuser.eth"].Status != store.RegistrationRegistered.String() {
+		t.Fatalf("registration status %v, want %v", fs.regs["testuser.eth"].Status, store.RegistrationRegistered)
+	}
+	if len(*notified) != 1 || (*notified)[0] != "testuser" {
+		t.Fatal("bad notifications", *notified)
+	}
+	if fs.credits["testuser"] != 5 {
+		t.Fatalf("user has %v credits, want 5", fs.credits["testuser"])
+	}
+	// users without enough credits can't commit to a registration
+	if err := nr.register("pooruser", "pooruser.eth"); err == nil {
+		t.Fatal("expected error registering without enough credits")
+	}
+	if len(fr.committed) != 1 || fs.regs["pooruser.eth"].Status != store.RegistrationFailed.String() {
+		t.Fatal("registration without enough credits should not be committed")
+	}
+	// registrations are refused without a price
+	nr.credits = 0
+	if err := nr.register("testuser", "other.eth"); err == nil || err.Error() != ErrRegistrationDisabled {
+		t.Fatalf("register() error = %v, wantErr %v", err, ErrRegistrationDisabled)
+	}
+}
+
+func Test_NameRegistrations_Refund(t *testing.T) {
+	revealDelay = 0
+	fr := &fakeRegistrar{
+		committed: map[string]time.Time{}, registered: map[string]bool{}, revealErr: errors.New("name taken"),
+	}
+	fs := &fakeRegistrations{
+		regs:    map[string]*store.NameRegistration{},
+		credits: map[string]float64{"testuser": 10},
+	}
+	nr, notified := newFakeNameRegistrations(fr, fs)
+	if err := nr.register("testuser", "testuser.eth"); err != nil {
+		t.Fatal(err)
+	}
+	nr.wg.Wait()
+	reg := fs.regs["testuser.eth"]
+	if reg.Status != store.RegistrationFailed.String() || !reg.Refunded {
+		t.Fatal("failed registration should be refunded", reg)
+	}
+	if fs.credits["testuser"] != 10 {
+		t.Fatalf("user has %v credits, want 10", fs.credits["testuser"])
+	}
+	if len(*notified) != 1 || (*notified)[0] != "testuser:name taken" {
+		t.Fatal("bad notifications", *notified)
+	}
+}
+
+func Test_NameRegistrations_Resume(t *testing.T) {
+	revealDelay = 0
+	secret := "0000000000000000000000000000000000000000000000000000000000000001"
+	past := time.Now().Add(-time.Minute)
+	fr := &fakeRegistrar{
+		committed:  map[string]time.Time{"mined.eth": past},
+		registered: map[string]bool{"revealed.eth": true},
+	}
+	fs := &fakeRegistrations{credits: map[string]float64{"unmined": 10}, regs: map[string]*store.NameRegistration{
+		// the commitment was never mined, and the user was never charged
+		"unmined.eth": {UserName: "unmined", Name: "unmined.eth", Secret: secret,
+			Status: store.RegistrationCommitting.String()},
+		// the commitment was mined before it was recorded
+		"mined.eth": {UserName: "mined", Name: "mined.eth", Secret: secret,
+			Status: store.RegistrationCommitting.String(), Charged: 10},
+		// the registration failed before the user was refunded
+		"refund.eth": {UserName: "refund", Name: "refund.eth", Secret: secret,
+			Status: store.RegistrationFailed.String(), Charged: 10},
+		// the reveal was mined before it was recorded
+		"revealed.eth": {UserName: "revealed", Name: "revealed.eth", Secret: secret,
+			Status: store.RegistrationCommitted.String(), RevealAfter: &past},
+		"bad.eth": {UserName: "bad", Name: "bad.eth", Secret: "bad",
+			Status: store.RegistrationCommitted.String(), RevealAfter: &past},
+	}}
+	nr, notified := newFakeNameRegistrations(fr, fs)
+	if err := nr.resume(); err != nil {
+		t.Fatal(err)
+	}
+	nr.wg.Wait()
+	for _, name := range []string{"unmined.eth", "mined.eth", "revealed.eth"} {
+		if fs.regs[name].Status != store.RegistrationRegistered.String() {
+			t.Fatalf("%s registration status %v, want %v", name, fs.regs[name].Status, store.RegistrationRegistered)
+		}
+	}
+	if fs.regs["bad.eth"].Status != store.RegistrationFailed.String() {
+		t.Fatalf("registration status %v, want %v", fs.regs["bad.eth"].Status, store.RegistrationFailed)
+	}
+	if fr.reveals != 2 {
+		t.Fatalf("revealed %v registrations, want 2", fr.reveals)
+	}
+	if fs.credits["unmined"] != 0 || fs.credits["refund"] != 10 || !fs.regs["refund.eth"].Refunded {
+		t.Fatal("bad credits after resuming", fs.credits)
+	}
+	if len(*notified) != 3 {
+		t.Fatal("bad notifications", *notified)
+	}
+}
@@ -0,0 +1,274 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/Pay/ethereum"
+	"github.com/RTradeLtd/Pay/store"
+	"github.com/RTradeLtd/database/v2/models"
+	"go.uber.org/zap"
+)
+
+// RenewalOpts is used to configure the monitoring of our ens names for expiry
+type RenewalOpts struct {
+	// Interval is the time waited between checks, an
+	// interval of zero disables monitoring altogether
+	Interval time.Duration
+	// Warning is how long before a name expires its owner is emailed
+	Warning time.Duration
+	// AutoRenew renews names once they are within the warning period,
+	// charging users the given number of credits for each renewal
+	AutoRenew bool
+	Credits   float64
+	// AdminEmail is emailed about the expiry of ipfstemporal.eth
+	AdminEmail string
+}
+
+// renewalLease is the lease held by the ens consumer watching our names for expiry
+const renewalLease = "ens-renewals"
+
+// renewalGrace is how long a renewal interrupted by a restart is left pending,
+// allowing a renewal transaction which was still being mined to be included
+var renewalGrace = time.Hour
+
+// nameRenewer is used to check and extend the registration of names
+type nameRenewer interface {
+	NameExpiry(name string) (time.Time, error)
+	RenewName(ctx context.Context, name string) (string, error)
+}
+
+// registeredNames is used to find the names registered for users,
+// and record the expiry their owners were last warned about
+type registeredNames interface {
+	FindRegistered() ([]store.NameRegistration, error)
+	RecordWarning(reg *store.NameRegistration, expiry time.Time) error
+}
+
+// renewalStore is used to persist the renewals of names, charging their owners
+type renewalStore interface {
+	StartRenewal(name, username string, expiry time.Time, credits float64) (*store.NameRenewal, bool, error)
+	FinishRenewal(renewal *store.NameRenewal, txHash string) error
+	RefundRenewal(renewal *store.NameRenewal) error
+	FindPendingRenewals() ([]store.NameRenewal, error)
+}
+
+// leaseAcquirer is used to ensure only a single consumer watches our names
+type leaseAcquirer interface {
+	Acquire(name, holder string, ttl time.Duration) (bool, error)
+}
+
+// renewalUsers is used to find the owners of names
+type renewalUsers interface {
+	FindByUserName(username string) (*models.User, error)
+}
+
+// renewalWatcher is used to check ipfstemporal.eth, and the names registered
+// for users, for expiry, emailing owners and optionally renewing names
+type renewalWatcher struct {
+	opts     RenewalOpts
+	renewer  nameRenewer
+	names    registeredNames
+	renewals renewalStore
+	// lease is held by the watcher performing checks, identified by holder
+	lease   leaseAcquirer
+	holder  string
+	users   renewalUsers
+	publish func(es EmailSend) error
+	l       *zap.SugaredLogger
+	// notified is the expiry ipfstemporal.eth was last warned about. As it
+	// has no registration, the warning is repeated after a restart
+	notified time.Time
+}
+
+// watchRenewals is used to periodically check our names for expiry until the context
+// is cancelled. Every ens consumer runs a watcher, but only the holder of the renewal
+// lease performs checks, so that names are renewed and owners warned only once
+func (rw *renewalWatcher) watchRenewals(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(rw.opts.Interval)
+		defer ticker.Stop()
+		for {
+			// the lease outlives the interval, so that it is kept between checks
+			if held, err := rw.lease.Acquire(renewalLease, rw.holder, rw.opts.Interval*2); err != nil {
+				rw.l.Errorw("failed to acquire ens renewal lease", "error", err.Error())
+			} else if held {
+				if err := rw.check(ctx, time.Now()); err != nil {
+					rw.l.Errorw("failed to check ens names for expiry", "error", err.Error())
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// check is used to settle interrupted renewals, and check the expiry of every name we manage
+func (rw *renewalWatcher) check(ctx context.Context, now time.Time) error {
+	pending, err := rw.renewals.FindPendingRenewals()
+	if err != nil {
+		return err
+	}
+	for i := range pending {
+		renewal := &pending[i]
+		if now.Sub(renewal.UpdatedAt) < renewalGrace {
+			continue
+		}
+		logger := rw.l.With("name", renewal.Name).With("user", renewal.UserName)
+		logger.Info("settling interrupted renewal")
+		if err := rw.settle(renewal); err != nil {
+			logger.Errorw("failed to settle renewal", "error", err.Error())
+		}
+	}
+	rw.checkName(ctx, now, ethereum.TemporalENSName, nil)
+	regs, err := rw.names.FindRegistered()
+	if err != nil {
+		return err
+	}
+	for i := range regs {
+		rw.checkName(ctx, now, regs[i].Name, &regs[i])
+	}
+	return nil
+}
+
+// checkName is used to check the expiry of a name, renewing it or warning its owner
+// once within the warning period. Names without a registration are our own
+func (rw *renewalWatcher) checkName(ctx context.Context, now time.Time, name string, reg *store.NameRegistration) {
+	var username string
+	if reg != nil {
+		username = reg.UserName
+	}
+	logger := rw.l.With("name", name).With("user", username)
+	expiry, err := rw.renewer.NameExpiry(name)
+	if err != nil {
+		logger.Errorw("failed to get name expiry", "error", err.Error())
+		return
+	}
+	if expiry.Sub(now) > rw.opts.Warning {
+		return
+	}
+	if rw.opts.AutoRenew {
+		var credits float64
+		if username != "" {
+			credits = rw.opts.Credits
+		}
+		renewal, started, err := rw.renewals.StartRenewal(name, username, expiry, credits)
+		switch {
+		case err != nil:
+			logger.Errorw("failed to start renewal", "error", err.Error())
+		case !started && renewal.Status == store.RenewalPending.String():
+			logger.Info("renewal of name already in progress")
+			return
+		case !started && renewal.Status == store.RenewalRenewed.String():
+			return
+		case started:
+			logger.Infow("renewing name", "expiry", expiry)
+			if err := rw.renew(ctx, renewal); err != nil {
+				logger.Errorw("failed to renew name", "error", err.Error())
+				break
+			}
+			rw.email(logger, username, "ENS Name Renewed",
+				fmt.Sprintf("Your ens name %s, which was due to expire on %s, has been renewed for a year",
+					name, expiry.Format(time.RFC1123)))
+			return
+		}
+	}
+	if reg == nil && rw.notified.Equal(expiry) {
+		return
+	}
+	if reg != nil && reg.WarnedExpiry != nil && reg.WarnedExpiry.Equal(expiry) {
+		return
+	}
+	rw.email(logger, username, "ENS Name Expiring",
+		fmt.Sprintf("Your ens name %s expires on %s, and must be renewed to remain yours",
+			name, expiry.Format(time.RFC1123)))
+	if reg == nil {
+		rw.notified = expiry
+	} else if err := rw.names.RecordWarning(reg, expiry); err != nil {
+		logger.Errorw("failed to record name expiry warning", "error", err.Error())
+	}
+}
+
+// renew is used to send the renewal of a name its owner has been charged for.
+// Should the renewal fail, it is settled against the expiry of the name, unless
+// it was interrupted by shutdown, in which case it is left pending as it may yet
+// be mined, and settled once the grace period has passed
+func (rw *renewalWatcher) renew(ctx context.Context, renewal *store.NameRenewal) error {
+	txHash, err := rw.renewer.RenewName(ctx, renewal.Name)
+	if err == nil {
+		return rw.renewals.FinishRenewal(renewal, txHash)
+	}
+	if ctx.Err() != nil {
+		return err
+	}
+	if settleErr := rw.settle(renewal); settleErr != nil {
+		return errors.New(err.Error() + ", and failed to settle renewal: " + settleErr.Error())
+	}
+	// the renewal may have been mined even though we failed to wait for it
+	if renewal.Status == store.RenewalRenewed.String() {
+		return nil
+	}
+	return err
+}
+
+// settle is used to settle a renewal which failed or was interrupted. Should the name
+// have been extended beyond the expiry it was renewed from, the renewal succeeded,
+// otherwise the owner is refunded the credits they were charged
+func (rw *renewalWatcher) settle(renewal *store.NameRenewal) error {
+	expiry, err := rw.renewer.NameExpiry(renewal.Name)
+	if err != nil {
+		return err
+	}
+	if expiry.After(renewal.Expiry) {
+		return rw.renewals.FinishRenewal(renewal, renewal.TxHash)
+	}
+	return rw.renewals.RefundRenewal(renewal)
+}
+
+// email is used to email the owner of a name, or the admin for our own names
+func (rw *renewalWatcher) email(logger *zap.SugaredLogger, username, subject, content string) {
+	es := EmailSend{Subject: subject, Content: content, ContentType: "text/html"}
+	if username == "" {
+		if rw.opts.AdminEmail == "" {
+			return
+		}
+		es.Emails = []string{rw.opts.AdminEmail}
+	} else {
+		user, err := rw.users.FindByUserName(username)
+		if err != nil {
+			logger.Errorw("failed to search for user", "error", err.Error())
+			return
+		}
+		if !user.EmailEnabled {
+			logger.Warn("user has not activated their email and won't receive notifications")
+			return
+		}
+		es.UserNames = []string{username}
+		es.Emails = []string{user.EmailAddress}
+	}
+	if err := rw.publish(es); err != nil {
+		logger.Errorw("failed to send name expiry email", "error", err.Error())
+	}
+}
+
+// leaseHolder is used to generate an identifier for this consumer when holding leases
+func leaseHolder() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
@@ -0,0 +1,328 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/Pay/ethereum"
+	"github.com/RTradeLtd/Pay/store"
+	"github.com/RTradeLtd/database/v2/models"
+	"go.uber.org/zap"
+)
+
+// fakeRenewer extends names by a year, failing for names in fail. Names
+// in mined fail to renew, but are extended as the transaction was mined
+type fakeRenewer struct {
+	expiries map[string]time.Time
+	fail     map[string]bool
+	mined    map[string]bool
+}
+
+func (fr *fakeRenewer) NameExpiry(name string) (time.Time, error) {
+	return fr.expiries[name], nil
+}
+
+func (fr *fakeRenewer) RenewName(ctx context.Context, name string) (string, error) {
+	if fr.fail[name] {
+		return "", errors.New("renewal failed")
+	}
+	fr.expiries[name] = fr.expiries[name].Add(time.Hour * 24 * 365)
+	if fr.mined[name] {
+		return "", errors.New("timed out waiting for renewal")
+	}
+	return "0x" + name, nil
+}
+
+type fakeRegistered struct {
+	regs []store.NameRegistration
+}
+
+func (fr *fakeRegistered) FindRegistered() ([]store.NameRegistration, error) {
+	regs := make([]store.NameRegistration, len(fr.regs))
+	copy(regs, fr.regs)
+	return regs, nil
+}
+
+func (fr *fakeRegistered) RecordWarning(reg *store.NameRegistration, expiry time.Time) error {
+	for i := range fr.regs {
+		if fr.regs[i].Name == reg.Name {
+			fr.regs[i].WarnedExpiry = &expiry
+		}
+	}
+	reg.WarnedExpiry = &expiry
+	return nil
+}
+
+type fakeUsers map[string]*models.User
+
+func (fu fakeUsers) FindByUserName(username string) (*models.User, error) {
+	return fu[username], nil
+}
+
+func (fu fakeUsers) AddCredits(username string, credits float64) (*models.User, error) {
+	fu[username].Credits += credits
+	return fu[username], nil
+}
+
+func (fu fakeUsers) RemoveCredits(username string, credits float64) (*models.User, error) {
+	if fu[username].Credits < credits {
+		return nil, errors.New("unable to remove credits, would result in negative balance")
+	}
+	fu[username].Credits -= credits
+	return fu[username], nil
+}
+
+// fakeRenewals keeps renewals in memory, charging users from a fakeUsers
+type fakeRenewals struct {
+	users    fakeUsers
+	renewals []*store.NameRenewal
+}
+
+func (fr *fakeRenewals) StartRenewal(name, username string, expiry time.Time, credits float64) (*store.NameRenewal, bool, error) {
+	var renewal *store.NameRenewal
+	for _, existing := range fr.renewals {
+		if existing.Name == name && existing.Expiry.Equal(expiry) {
+			if existing.Status != store.RenewalRefunded.String() {
+				cp := *existing
+				return &cp, false, nil
+			}
+			renewal = existing
+		}
+	}
+	var charged float64
+	if username != "" && credits > 0 {
+		if _, err := fr.users.RemoveCredits(username, credits); err != nil {
+			return nil, false, err
+		}
+		charged = credits
+	}
+	if renewal == nil {
+		renewal = &store.NameRenewal{Name: name, Expiry: expiry, UserName: username}
+		renewal.ID = uint(len(fr.renewals) + 1)
+		fr.renewals = append(fr.renewals, renewal)
+	}
+	renewal.Status, renewal.Charged = store.RenewalPending.String(), charged
+	renewal.UpdatedAt = time.Now()
+	cp := *renewal
+	return &cp, true, nil
+}
+
+func (fr *fakeRenewals) FinishRenewal(renewal *store.NameRenewal, txHash string) error {
+	renewal.Status, renewal.TxHash = store.RenewalRenewed.String(), txHash
+	fr.renewals[renewal.ID-1].Status, fr.renewals[renewal.ID-1].TxHash = renewal.Status, txHash
+	return nil
+}
+
+func (fr *fakeRenewals) RefundRenewal(renewal *store.NameRenewal) error {
+	stored := fr.renewals[renewal.ID-1]
+	if stored.Status != store.RenewalPending.String() {
+		return nil
+	}
+	if stored.Charged > 0 {
+		fr.users.AddCredits(stored.UserName, stored.Charged)
+	}
+	stored.Status = store.RenewalRefunded.String()
+	renewal.Status = stored.Status
+	return nil
+}
+
+func (fr *fakeRenewals) FindPendingRenewals() ([]store.NameRenewal, error) {
+	var pending []store.NameRenewal
+	for _, renewal := range fr.renewals {
+		if renewal.Status == store.RenewalPending.String() {
+			pending = append(pending, *renewal)
+		}
+	}
+	return pending, nil
+}
+
+// fakeLease is a single lease shared between watchers
+type fakeLease struct {
+	mux     sync.Mutex
+	holder  string
+	expires time.Time
+}
+
+func (fl *fakeLease) Acquire(name, holder string, ttl time.Duration) (bool, error) {
+	fl.mux.Lock()
+	defer fl.mux.Unlock()
+	if fl.holder != "" && fl.holder != holder && time.Now().Before(fl.expires) {
+		return false, nil
+	}
+	fl.holder, fl.expires = holder, time.Now().Add(ttl)
+	return true, nil
+}
+
+func newFakeRenewalWatcher(opts RenewalOpts, expiries map[string]time.Time, renewer *fakeRenewer) (*renewalWatcher, fakeUsers, *[]EmailSend) {
+	var sent []EmailSend
+	users := fakeUsers{
+		"expiring": {UserName: "expiring", EmailAddress: "expiring@example.com", EmailEnabled: true, Credits: 10},
+		"broke":    {UserName: "broke", EmailAddress: "broke@example.com", EmailEnabled: true, Credits: 1},
+		"failing":  {UserName: "failing", EmailAddress: "failing@example.com", EmailEnabled: true, Credits: 10},
+		"mined":    {UserName: "mined", EmailAddress: "mined@example.com", EmailEnabled: true, Credits: 10},
+		"later":    {UserName: "later", EmailAddress: "later@example.com", EmailEnabled: true, Credits: 10},
+	}
+	if renewer == nil {
+		renewer = &fakeRenewer{}
+	}
+	renewer.expiries = expiries
+	return &renewalWatcher{
+		opts:    opts,
+		renewer: renewer,
+		names: &fakeRegistered{regs: []store.NameRegistration{
+			{UserName: "expiring", Name: "expiring.eth"},
+			{UserName: "broke", Name: "broke.eth"},
+			{UserName: "failing", Name: "failing.eth"},
+			{UserName: "mined", Name: "mined.eth"},
+			{UserName: "later", Name: "later.eth"},
+		}},
+		renewals: &fakeRenewals{users: users},
+		lease:    &fakeLease{},
+		holder:   leaseHolder(),
+		users:    users,
+		publish: func(es EmailSend) error {
+			sent = append(sent, es)
+			return nil
+		},
+		l: zap.NewNop().Sugar(),
+	}, users, &sent
+}
+
+func Test_RenewalWatcher(t *testing.T) {
+	now := time.Now()
+	soon, later := now.Add(time.Hour*24), now.Add(time.Hour*24*365)
+	expiries := func() map[string]time.Time {
+		return map[string]time.Time{
+			ethereum.TemporalENSName: soon,
+			"expiring.eth":           soon,
+			"broke.eth":              soon,
+			"failing.eth":            soon,
+			"mined.eth":              soon,
+			"later.eth":              later,
+		}
+	}
+	subjects := func(sent []EmailSend) map[string]string {
+		subjects := map[string]string{}
+		for _, es := range sent {
+			subjects[es.UserNames[0]] = es.Subject
+		}
+		return subjects
+	}
+	t.Run("Warn", func(t *testing.T) {
+		rw, _, sent := newFakeRenewalWatcher(RenewalOpts{
+			Warning: time.Hour * 24 * 30, AdminEmail: "admin@example.com",
+		}, expiries(), nil)
+		// owners are warned once about each expiry
+		for i := 0; i < 2; i++ {
+			if err := rw.check(context.Background(), now); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(*sent) != 5 {
+			t.Fatalf("sent %v emails, want 5", len(*sent))
+		}
+		if (*sent)[0].Emails[0] != "admin@example.com" {
+			t.Fatal("admin should be warned about our own name")
+		}
+		// warnings are persisted, so a restarted watcher only warns about our own name
+		restarted := *rw
+		restarted.notified = time.Time{}
+		if err := restarted.check(context.Background(), now); err != nil {
+			t.Fatal(err)
+		}
+		if len(*sent) != 6 || (*sent)[5].Emails[0] != "admin@example.com" {
+			t.Fatalf("sent %v emails after restart, want 6", len(*sent))
+		}
+	})
+	t.Run("AutoRenew", func(t *testing.T) {
+		rw, users, sent := newFakeRenewalWatcher(RenewalOpts{
+			Warning: time.Hour * 24 * 30, AutoRenew: true, Credits: 5,
+		}, expiries(), &fakeRenewer{
+			fail:  map[string]bool{"failing.eth": true},
+			mined: map[string]bool{"mined.eth": true},
+		})
+		// owners are only charged once for each expiry
+		for i := 0; i < 2; i++ {
+			if err := rw.check(context.Background(), now); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// the renewal of mined.eth failed, but extended the name, so it isn't refunded
+		for name, want := range map[string]float64{"expiring": 5, "broke": 1, "failing": 10, "mined": 5, "later": 10} {
+			if users[name].Credits != want {
+				t.Fatalf("%s has %v credits, want %v", name, users[name].Credits, want)
+			}
+		}
+		// renewals which couldn't be paid for, or failed, fall back to warning the owner
+		want := map[string]string{
+			"expiring": "ENS Name Renewed",
+			"broke":    "ENS Name Expiring",
+			"failing":  "ENS Name Expiring",
+			"mined":    "ENS Name Renewed",
+		}
+		got := subjects(*sent)
+		if len(*sent) != len(want) || len(got) != len(want) {
+			t.Fatal("bad emails sent", got)
+		}
+		for user, subject := range want {
+			if got[user] != subject {
+				t.Fatalf("%s was sent %q, want %q", user, got[user], subject)
+			}
+		}
+	})
+	t.Run("Interrupted", func(t *testing.T) {
+		rw, users, _ := newFakeRenewalWatcher(RenewalOpts{
+			Warning: time.Hour * 24 * 30, AutoRenew: true, Credits: 5,
+		}, expiries(), nil)
+		renewals := rw.renewals.(*fakeRenewals)
+		// renewals charged for before a restart, one of which was mined
+		for _, username := range []string{"expiring", "failing"} {
+			if _, _, err := renewals.StartRenewal(username+".eth", username, soon, 5); err != nil {
+				t.Fatal(err)
+			}
+		}
+		rw.renewer.(*fakeRenewer).expiries["expiring.eth"] = later
+		// renewals within the grace period are left pending
+		if err := rw.check(context.Background(), now); err != nil {
+			t.Fatal(err)
+		}
+		if users["expiring"].Credits != 5 || users["failing"].Credits != 5 {
+			t.Fatal("renewals settled within the grace period")
+		}
+		if err := rw.check(context.Background(), now.Add(renewalGrace * 2)); err != nil {
+			t.Fatal(err)
+		}
+		if users["expiring"].Credits != 5 {
+			t.Fatal("mined renewal was refunded")
+		}
+		if renewals.renewals[0].Status != store.RenewalRenewed.String() {
+			t.Fatal("mined renewal was not finished")
+		}
+		// the unrenewed name is refunded, and renewed again from the same expiry
+		if renewals.renewals[1].Status != store.RenewalRenewed.String() {
+			t.Fatal("interrupted renewal was not restarted")
+		}
+		if users["failing"].Credits != 5 {
+			t.Fatalf("failing has %v credits, want 5", users["failing"].Credits)
+		}
+	})
+	t.Run("Lease", func(t *testing.T) {
+		opts := RenewalOpts{Interval: time.Hour, Warning: time.Hour * 24 * 30, AdminEmail: "admin@example.com"}
+		first, _, firstSent := newFakeRenewalWatcher(opts, expiries(), nil)
+		second, _, secondSent := newFakeRenewalWatcher(opts, expiries(), nil)
+		second.lease = first.lease
+		ctx, cancel := context.WithCancel(context.Background())
+		wg := &sync.WaitGroup{}
+		first.watchRenewals(ctx, wg)
+		second.watchRenewals(ctx, wg)
+		cancel()
+		wg.Wait()
+		// only the holder of the lease checks our names
+		if len(*firstSent)+len(*secondSent) != 5 {
+			t.Fatalf("sent %v and %v emails, want 5 in total", len(*firstSent), len(*secondSent))
+		}
+	})
+}
@@ -0,0 +1,318 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/Pay/store"
+	"github.com/RTradeLtd/config/v2"
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+// ErrPaymentReversed is an error used to indicate that the transaction
+// of a confirmed payment was dropped from the chain by a reorg
+const ErrPaymentReversed = "payment transaction was dropped from the chain by a reorg"
+
+// ReorgChecker is implemented by payment processors able to locate the block
+// containing a transaction, allowing confirmed payments to be watched for reorgs
+type ReorgChecker interface {
+	// TxBlockHash returns the hash of the canonical block containing the transaction,
+	// or an empty hash if the transaction is no longer part of the chain
+	TxBlockHash(ctx context.Context, txHash string) (string, error)
+}
+
+// ReorgOpts is used to configure the watching of confirmed payments for reorgs
+type ReorgOpts struct {
+	// Window is how long after confirmation a payment is watched,
+	// a window of zero disables watching altogether
+	Window time.Duration
+	// Interval is the time waited between checks
+	Interval time.Duration
+	// MissingChecks is the number of consecutive checks which must find a
+	// transaction missing before its payment is reversed, as transactions
+	// may briefly return to the mempool while a reorg is resolved
+	MissingChecks int
+	// AdminEmail is notified whenever a payment is reversed or reinstated
+	AdminEmail string
+}
+
+// creditReverser is used to debit the credits granted for a payment,
+// and grant them again should its transaction be mined once more
+type creditReverser interface {
+	ReverseCredit(payment *models.Payments) error
+	ReinstateCredit(payment *models.Payments) error
+}
+
+// reorgWatcher is used to check that the transactions of recently
+// confirmed payments are still part of the chain
+type reorgWatcher struct {
+	queue   Queue
+	checker ReorgChecker
+	pm      paymentFinder
+	ledger  creditReverser
+	pending pendingStore
+	// missingChecks is the number of consecutive checks
+	// finding a transaction missing before it is reversed
+	missingChecks    int
+	notifyReversed   paymentNotifier
+	notifyReinstated paymentNotifier
+	l                *zap.SugaredLogger
+}
+
+// WatchReorgs is used to periodically check that the transactions of payments
+// confirmed on a queue within the reorg window are still part of the chain.
+// Should a reorg drop a transaction, the payment is marked as reversed, the
+// credits granted for it are debited, and both the user and admin are emailed.
+// Should the transaction of a reversed payment be mined again within the window,
+// its credits are granted once more. Payments without a transaction hash, such as those made through a dash
+// payment forward or locked through InstantSend, can't be watched
+func WatchReorgs(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	queue Queue,
+	cfg *config.TemporalConfig,
+	db *gorm.DB,
+	logger *zap.SugaredLogger,
+	opts ReorgOpts,
+) error {
+	if opts.Window <= 0 {
+		return nil
+	}
+	if opts.Interval <= 0 {
+		return errors.New("reorg check interval must be positive")
+	}
+	if opts.MissingChecks <= 0 {
+		return errors.New("reorg missing checks must be positive")
+	}
+	newProcessor, ok := paymentProcessor(queue)
+	if !ok {
+		return errors.New("no payment processor registered for queue")
+	}
+	processor, err := newProcessor(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	checker, ok := processor.(ReorgChecker)
+	if !ok {
+		logger.Warnw("payment processor is unable to detect reorgs", "queue", queue.String())
+		return nil
+	}
+	qmEmail, err := New(EmailSendQueue, cfg, logger, true)
+	if err != nil {
+		return err
+	}
+	um := models.NewUserManager(db)
+	rw := &reorgWatcher{
+		queue:            queue,
+		checker:          checker,
+		pm:               models.NewPaymentManager(db),
+		ledger:           store.NewLedgerManager(db),
+		pending:          store.NewPendingManager(db),
+		missingChecks:    opts.MissingChecks,
+		notifyReversed:   reversalNotifier(qmEmail, um, logger, processor.Currency(), opts.AdminEmail),
+		notifyReinstated: reinstatementNotifier(qmEmail, um, logger, processor.Currency(), opts.AdminEmail),
+		l:                logger.With("queue", queue.String()),
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer qmEmail.Close()
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := rw.check(ctx, time.Now().Add(-opts.Window)); err != nil {
+					rw.l.Errorw("failed to check confirmed payments for reorgs", "error", err.Error())
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// check is used to check the payments confirmed since the given time. Payments whose
+// transaction has been missing from the chain for enough consecutive checks are reversed,
+// while reversed payments whose transaction has been mined again are reinstated. A
+// transaction which was mined again in another block is still paid, so only its block
+// is updated
+func (rw *reorgWatcher) check(ctx context.Context, since time.Time) error {
+	confirmed, err := rw.pending.FindConfirmedSince(rw.queue.String(), since)
+	if err != nil {
+		return err
+	}
+	for i := range confirmed {
+		state := &confirmed[i]
+		if state.TxHash == "" {
+			continue
+		}
+		logger := rw.l.With("user", state.UserName).With("number", state.Number).With("tx.hash", state.TxHash)
+		blockHash, err := rw.checker.TxBlockHash(ctx, state.TxHash)
+		if err != nil {
+			logger.Warnw("failed to get block of payment transaction", "error", err.Error())
+			continue
+		}
+		reversed := state.Status == store.StatusReversed.String()
+		switch {
+		case reversed && blockHash != "":
+			if err := rw.reinstate(logger, state, blockHash); err != nil {
+				// the ledger makes reinstatement idempotent, so it is retried on the next check
+				logger.Errorw("failed to reinstate payment", "error", err.Error())
+			}
+		case reversed:
+			continue
+		case blockHash == "":
+			// the transaction may only have been returned to the mempool while
+			// the reorg is resolved, so it is only reversed once it stays missing
+			missing := state.MissingChecks + 1
+			if missing < rw.missingChecks {
+				logger.Warnw("payment transaction missing from the chain", "block", state.BlockHash, "checks", missing)
+				if err := rw.pending.RecordMissing(state, missing); err != nil {
+					logger.Errorw("failed to update pending payment", "error", err.Error())
+				}
+				continue
+			}
+			if err := rw.reverse(logger, state); err != nil {
+				// the ledger makes reversal idempotent, so it is retried on the next check
+				logger.Errorw("failed to reverse payment", "error", err.Error())
+			}
+		case blockHash == state.BlockHash:
+			if state.MissingChecks > 0 {
+				if err := rw.pending.RecordBlock(state, blockHash); err != nil {
+					logger.Errorw("failed to update pending payment", "error", err.Error())
+				}
+			}
+		default:
+			logger.Warnw("payment transaction moved to another block by a reorg",
+				"old.block", state.BlockHash, "new.block", blockHash)
+			if err := rw.pending.RecordBlock(state, blockHash); err != nil {
+				logger.Errorw("failed to update pending payment", "error", err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// reverse is used to debit the credits of a payment dropped by a reorg
+func (rw *reorgWatcher) reverse(logger *zap.SugaredLogger, state *store.PendingPayment) error {
+	logger.Warnw("payment transaction dropped from the chain by a reorg", "block", state.BlockHash)
+	payment, err := rw.pm.FindPaymentByNumber(state.UserName, state.Number)
+	if err != nil {
+		return err
+	}
+	if err := rw.ledger.ReverseCredit(payment); err != nil {
+		return err
+	}
+	if err := rw.pending.UpdateStatus(state, store.StatusReversed, ErrPaymentReversed); err != nil {
+		return err
+	}
+	// the credits have been debited, so a failed notification is only logged
+	if err := rw.notifyReversed(payment); err != nil {
+		logger.Errorw("failed to send reversal notification", "error", err.Error())
+	}
+	logger.Infow("reversed payment", "credits", payment.USDValue)
+	return nil
+}
+
+// reinstate is used to grant the credits of a reversed payment
+// again, once its transaction has been mined in the given block
+func (rw *reorgWatcher) reinstate(logger *zap.SugaredLogger, state *store.PendingPayment, blockHash string) error {
+	logger.Warnw("reversed payment transaction mined again", "block", blockHash)
+	payment, err := rw.pm.FindPaymentByNumber(state.UserName, state.Number)
+	if err != nil {
+		return err
+	}
+	if err := rw.ledger.ReinstateCredit(payment); err != nil {
+		return err
+	}
+	if err := rw.pending.UpdateStatus(state, store.StatusConfirmed, ""); err != nil {
+		return err
+	}
+	if err := rw.pending.RecordBlock(state, blockHash); err != nil {
+		return err
+	}
+	// the credits have been granted, so a failed notification is only logged
+	if err := rw.notifyReinstated(payment); err != nil {
+		logger.Errorw("failed to send reinstatement notification", "error", err.Error())
+	}
+	logger.Infow("reinstated payment", "credits", payment.USDValue)
+	return nil
+}
+
+// reversalNotifier returns a notifier which emails the user, and
+// the admin, that a payment in the given currency was reversed
+func reversalNotifier(
+	qmEmail *Manager, um *models.UserManager, l *zap.SugaredLogger, currency, adminEmail string,
+) paymentNotifier {
+	return reorgNotifier(qmEmail, um, l, adminEmail, currency+" Payment Reversed",
+		func(payment *models.Payments) string {
+			return fmt.Sprintf("Payment %d of user %s for %v credits was reversed as transaction %s was dropped by a reorg",
+				payment.Number, payment.UserName, payment.USDValue, payment.TxHash)
+		},
+		func(payment *models.Payments) string {
+			return fmt.Sprintf("Your %s payment for %v credits was reversed as its transaction was dropped from the blockchain, and the credits have been removed from your account",
+				strings.ToLower(currency), payment.USDValue)
+		},
+	)
+}
+
+// reinstatementNotifier returns a notifier which emails the user, and the
+// admin, that a reversed payment in the given currency was reinstated
+func reinstatementNotifier(
+	qmEmail *Manager, um *models.UserManager, l *zap.SugaredLogger, currency, adminEmail string,
+) paymentNotifier {
+	return reorgNotifier(qmEmail, um, l, adminEmail, currency+" Payment Reinstated",
+		func(payment *models.Payments) string {
+			return fmt.Sprintf("Payment %d of user %s for %v credits was reinstated as transaction %s was mined again",
+				payment.Number, payment.UserName, payment.USDValue, payment.TxHash)
+		},
+		func(payment *models.Payments) string {
+			return fmt.Sprintf("Your reversed %s payment for %v credits has been mined again, and the credits have been returned to your account",
+				strings.ToLower(currency), payment.USDValue)
+		},
+	)
+}
+
+// reorgNotifier returns a notifier which emails the admin, if any, and the
+// user, with the given subject and the content generated for each of them
+func reorgNotifier(
+	qmEmail *Manager, um *models.UserManager, l *zap.SugaredLogger, adminEmail, subject string,
+	adminContent, userContent func(payment *models.Payments) string,
+) paymentNotifier {
+	return func(payment *models.Payments) error {
+		if adminEmail != "" {
+			if err := qmEmail.PublishMessage(EmailSend{
+				Subject:     subject,
+				Content:     adminContent(payment),
+				ContentType: "text/html",
+				Emails:      []string{adminEmail},
+			}); err != nil {
+				return err
+			}
+		}
+		user, err := um.FindByUserName(payment.UserName)
+		if err != nil {
+			return err
+		}
+		if !user.EmailEnabled {
+			l.Warnw("user has not activated their email and won't receive notifications",
+				"user", payment.UserName)
+			return nil
+		}
+		return qmEmail.PublishMessage(EmailSend{
+			Subject:     subject,
+			Content:     userContent(payment),
+			ContentType: "text/html",
+			UserNames:   []string{payment.UserName},
+			Emails:      []string{user.EmailAddress},
+		})
+	}
+}
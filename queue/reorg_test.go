@@ -0,0 +1,150 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/Pay/store"
+	"github.com/RTradeLtd/database/v2/models"
+	"go.uber.org/zap"
+)
+
+func Test_ReorgWatcher(t *testing.T) {
+	confirmedAt := time.Now().Add(-time.Minute)
+	newState := func(number int64, txHash, blockHash string) *store.PendingPayment {
+		return &store.PendingPayment{
+			Number: number, UserName: "testuser", Queue: EthPaymentConfirmationQueue.String(),
+			Status: store.StatusConfirmed.String(), TxHash: txHash, BlockHash: blockHash, ConfirmedAt: &confirmedAt,
+		}
+	}
+	pending := fakePending{
+		1: newState(1, "0x1", "0xb1"),
+		2: newState(2, "0x2", "0xb2"),
+		3: newState(3, "0x3", "0xb3"),
+		4: newState(4, "0x4", "0xb4"),
+	}
+	payments := fakeFinder{
+		1: {UserName: "testuser", Number: 1, TxHash: "0x1", USDValue: 10},
+		2: {UserName: "testuser", Number: 2, TxHash: "0x2", USDValue: 10},
+		3: {UserName: "testuser", Number: 3, TxHash: "0x3", USDValue: 10},
+		4: {UserName: "testuser", Number: 4, TxHash: "0x4", USDValue: 10},
+	}
+	fl := newFakeLedger()
+	fl.steps[store.StepCredited] = true
+	fl.credits = 40
+	// 0x1 is unchanged, 0x2 was mined again in another block, 0x3 was
+	// dropped, and 0x4 is briefly returned to the mempool
+	checker := &fakeReorgProcessor{blocks: map[string]string{"0x1": "0xb1", "0x2": "0xc2"}}
+	rw := &reorgWatcher{
+		queue:            EthPaymentConfirmationQueue,
+		checker:          checker,
+		pm:               payments,
+		ledger:           fl,
+		pending:          pending,
+		missingChecks:    3,
+		notifyReversed:   fl.notify,
+		notifyReinstated: fl.notify,
+		l:                zap.NewNop().Sugar(),
+	}
+	for i := 0; i < 2; i++ {
+		if err := rw.check(context.Background(), time.Now().Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// missing transactions are only reversed once they stay missing
+	if pending[3].Status != store.StatusConfirmed.String() || pending[3].MissingChecks != 2 {
+		t.Fatal("payment should not be reversed before enough missing checks", pending[3])
+	}
+	checker.blocks["0x4"] = "0xb4"
+	for i := 0; i < 2; i++ {
+		if err := rw.check(context.Background(), time.Now().Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pending[1].Status != store.StatusConfirmed.String() || pending[1].BlockHash != "0xb1" {
+		t.Fatal("unchanged payment should not be updated", pending[1])
+	}
+	if pending[2].Status != store.StatusConfirmed.String() || pending[2].BlockHash != "0xc2" {
+		t.Fatal("payment mined in another block should have its block updated", pending[2])
+	}
+	if pending[3].Status != store.StatusReversed.String() {
+		t.Fatalf("pending payment status %v, want %v", pending[3].Status, store.StatusReversed)
+	}
+	if pending[4].Status != store.StatusConfirmed.String() || pending[4].MissingChecks != 0 {
+		t.Fatal("payment returned to the chain should not be reversed", pending[4])
+	}
+	// the reversed payment is only debited and notified once
+	if fl.credits != 30 || fl.emails != 1 {
+		t.Fatalf("user has %v credits and %v emails, want 30 and 1", fl.credits, fl.emails)
+	}
+}
+
+func Test_ReorgWatcher_Reinstate(t *testing.T) {
+	confirmedAt := time.Now().Add(-time.Minute)
+	pending := fakePending{1: {
+		Number: 1, UserName: "testuser", Queue: EthPaymentConfirmationQueue.String(),
+		Status: store.StatusConfirmed.String(), TxHash: "0x1", BlockHash: "0xb1", ConfirmedAt: &confirmedAt,
+	}}
+	fl := newFakeLedger()
+	fl.steps[store.StepCredited] = true
+	fl.credits = 10
+	checker := &fakeReorgProcessor{blocks: map[string]string{}}
+	rw := &reorgWatcher{
+		queue:            EthPaymentConfirmationQueue,
+		checker:          checker,
+		pm:               fakeFinder{1: &models.Payments{UserName: "testuser", Number: 1, TxHash: "0x1", USDValue: 10}},
+		ledger:           fl,
+		pending:          pending,
+		missingChecks:    1,
+		notifyReversed:   fl.notify,
+		notifyReinstated: fl.notify,
+		l:                zap.NewNop().Sugar(),
+	}
+	if err := rw.check(context.Background(), time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if pending[1].Status != store.StatusReversed.String() || fl.credits != 0 {
+		t.Fatal("dropped payment should be reversed", pending[1])
+	}
+	// the transaction is mined again in another block
+	checker.blocks["0x1"] = "0xc1"
+	for i := 0; i < 2; i++ {
+		if err := rw.check(context.Background(), time.Now().Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pending[1].Status != store.StatusConfirmed.String() || pending[1].BlockHash != "0xc1" {
+		t.Fatal("payment mined again should be reinstated", pending[1])
+	}
+	if fl.credits != 10 || fl.emails != 2 || fl.steps[store.StepReversed] {
+		t.Fatalf("user has %v credits and %v emails, want 10 and 2", fl.credits, fl.emails)
+	}
+}
+
+func Test_ReorgWatcher_Window(t *testing.T) {
+	confirmedAt := time.Now().Add(-time.Hour)
+	pending := fakePending{1: {
+		Number: 1, UserName: "testuser", Queue: EthPaymentConfirmationQueue.String(),
+		Status: store.StatusConfirmed.String(), TxHash: "0x1", BlockHash: "0xb1", ConfirmedAt: &confirmedAt,
+	}}
+	fl := newFakeLedger()
+	rw := &reorgWatcher{
+		queue:            EthPaymentConfirmationQueue,
+		checker:          &fakeReorgProcessor{},
+		pm:               fakeFinder{1: &models.Payments{UserName: "testuser", Number: 1, TxHash: "0x1"}},
+		ledger:           fl,
+		pending:          pending,
+		missingChecks:    1,
+		notifyReversed:   fl.notify,
+		notifyReinstated: fl.notify,
+		l:                zap.NewNop().Sugar(),
+	}
+	// the payment was confirmed before the window started
+	if err := rw.check(context.Background(), time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if pending[1].Status != store.StatusConfirmed.String() {
+		t.Fatal("payment outside of the window should not be reversed")
+	}
+}
@@ -0,0 +1,226 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// retryCountHeader records how many times a message has been retried
+	retryCountHeader = "x-retry-count"
+	// errorHeader records the reason a message was retried or dead-lettered
+	errorHeader = "x-error"
+)
+
+// retryDelays is the backoff schedule used for redelivering messages that
+// failed due to a transient error. Once every delay has been used, the
+// message is routed to the dead-letter queue instead.
+var retryDelays = []time.Duration{
+	time.Second * 30,
+	time.Minute * 2,
+	time.Minute * 10,
+	time.Minute * 30,
+	time.Hour,
+}
+
+// permanentError wraps an error that will never succeed on retry
+type permanentError struct {
+	err error
+}
+
+func (pe *permanentError) Error() string {
+	return pe.err.Error()
+}
+
+func (pe *permanentError) Unwrap() error {
+	return pe.err
+}
+
+// Permanent marks err as permanent, causing the message being processed
+// to be sent straight to the dead-letter queue rather than retried
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// IsPermanent is used to check whether an error should not be retried.
+// Errors explicitly marked with Permanent, as well as missing database
+// records, are considered permanent. Everything else is transient.
+func IsPermanent(err error) bool {
+	var pe *permanentError
+	if errors.As(err, &pe) {
+		return true
+	}
+	return gorm.IsRecordNotFoundError(err)
+}
+
+// retryExchange returns the name of the exchange used to route retries
+func (qt Queue) retryExchange() string {
+	return qt.String() + ".retry"
+}
+
+// retryQueue returns the name of the queue holding messages for the given retry attempt
+func (qt Queue) retryQueue(attempt int) string {
+	return fmt.Sprintf("%s.retry.%d", qt.String(), attempt)
+}
+
+// deadLetterExchange returns the name of the exchange used to route dead letters
+func (qt Queue) deadLetterExchange() string {
+	return qt.String() + ".dlx"
+}
+
+// DeadLetterQueue returns the name of the queue holding messages that could not be processed
+func (qt Queue) DeadLetterQueue() string {
+	return qt.String() + ".dead"
+}
+
+// declareRetryTopology is used to declare the retry and dead-letter exchanges and queues
+// for our queue. Each retry attempt has its own queue whose message TTL matches the backoff
+// delay for that attempt; once the TTL expires, messages are dead-lettered back onto our queue
+func (qm *Manager) declareRetryTopology() error {
+	if err := qm.channel.ExchangeDeclare(
+		qm.QueueName.retryExchange(), // name
+		"direct",                     // kind
+		true,                         // durable
+		false,                        // auto-delete
+		false,                        // internal
+		false,                        // no-wait
+		nil,                          // arguments
+	); err != nil {
+		return err
+	}
+	for attempt, delay := range retryDelays {
+		name := qm.QueueName.retryQueue(attempt)
+		if _, err := qm.channel.QueueDeclare(
+			name,  // name
+			true,  // durable
+			false, // delete when unused
+			false, // exclusive
+			false, // no-wait
+			amqp.Table{
+				"x-message-ttl":             int64(delay / time.Millisecond),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": qm.QueueName.String(),
+			},
+		); err != nil {
+			return err
+		}
+		if err := qm.channel.QueueBind(
+			name,                         // queue
+			name,                         // routing key
+			qm.QueueName.retryExchange(), // exchange
+			false,                        // no-wait
+			nil,                          // arguments
+		); err != nil {
+			return err
+		}
+	}
+	if err := qm.channel.ExchangeDeclare(
+		qm.QueueName.deadLetterExchange(), // name
+		"fanout",                          // kind
+		true,                              // durable
+		false,                             // auto-delete
+		false,                             // internal
+		false,                             // no-wait
+		nil,                               // arguments
+	); err != nil {
+		return err
+	}
+	if _, err := qm.channel.QueueDeclare(
+		qm.QueueName.DeadLetterQueue(), // name
+		true,                           // durable
+		false,                          // delete when unused
+		false,                          // exclusive
+		false,                          // no-wait
+		nil,                            // arguments
+	); err != nil {
+		return err
+	}
+	if err := qm.channel.QueueBind(
+		qm.QueueName.DeadLetterQueue(),    // queue
+		"",                                // routing key
+		qm.QueueName.deadLetterExchange(), // exchange
+		false,                             // no-wait
+		nil,                               // arguments
+	); err != nil {
+		return err
+	}
+	qm.l.Info("retry and dead-letter queues declared")
+	return nil
+}
+
+// Fail is used to handle a message that could not be processed. Transient errors
+// are scheduled for redelivery with an increasing delay, while permanent errors,
+// and messages that have exhausted their retries, are sent to the dead-letter queue.
+// The reason for the failure is recorded in the message headers. The original
+// delivery is only acknowledged once the message has been safely republished.
+func (qm *Manager) Fail(d amqp.Delivery, err error) {
+	attempt := retryCount(d.Headers)
+	var exchange, key string
+	if IsPermanent(err) || attempt >= len(retryDelays) {
+		exchange = qm.QueueName.deadLetterExchange()
+		qm.l.Errorw("sending message to dead-letter queue",
+			"error", err, "retries", attempt)
+	} else {
+		exchange = qm.QueueName.retryExchange()
+		key = qm.QueueName.retryQueue(attempt)
+		qm.l.Warnw("scheduling message for retry",
+			"error", err, "retries", attempt, "delay", retryDelays[attempt])
+	}
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[retryCountHeader] = int32(attempt + 1)
+	headers[errorHeader] = err.Error()
+	if pubErr := qm.channel.Publish(
+		exchange, // exchange
+		key,      // routing key
+		false,    // mandatory
+		false,    // immediate
+		amqp.Publishing{
+			Headers:      headers,
+			DeliveryMode: amqp.Persistent,
+			ContentType:  d.ContentType,
+			Body:         d.Body,
+		},
+	); pubErr != nil {
+		// we failed to republish the message, so requeue
+		// it to ensure that it isn't lost
+		qm.l.Errorw("failed to republish message, requeueing", "error", pubErr)
+		d.Nack(false, true)
+		return
+	}
+	d.Ack(false)
+}
+
+// maxRetryDelay returns the longest time a message may wait in a retry queue
+func maxRetryDelay() time.Duration {
+	var max time.Duration
+	for _, delay := range retryDelays {
+		if delay > max {
+			max = delay
+		}
+	}
+	return max
+}
+
+// retryCount returns the number of retries recorded in the message headers
+func retryCount(headers amqp.Table) int {
+	switch v := headers[retryCountHeader].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	default:
+		return 0
+	}
+}
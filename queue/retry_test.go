@@ -0,0 +1,62 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/streadway/amqp"
+)
+
+func TestIsPermanent(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"transient", errors.New("connection refused"), false},
+		{"permanent", Permanent(errors.New("bad message")), true},
+		{"wrapped-permanent", fmt.Errorf("processing: %w", Permanent(errors.New("bad message"))), true},
+		{"record-not-found", gorm.ErrRecordNotFound, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPermanent(tt.err); got != tt.want {
+				t.Fatalf("IsPermanent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if Permanent(nil) != nil {
+		t.Fatal("expected nil error")
+	}
+}
+
+func TestRetryCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers amqp.Table
+		want    int
+	}{
+		{"none", nil, 0},
+		{"int32", amqp.Table{retryCountHeader: int32(2)}, 2},
+		{"int64", amqp.Table{retryCountHeader: int64(3)}, 3},
+		{"garbage", amqp.Table{retryCountHeader: "4"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryCount(tt.headers); got != tt.want {
+				t.Fatalf("retryCount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueNames(t *testing.T) {
+	if name := EthPaymentConfirmationQueue.retryQueue(1); name != "eth-payment-confirmation-queue.retry.1" {
+		t.Fatal("bad retry queue name", name)
+	}
+	if name := EthPaymentConfirmationQueue.DeadLetterQueue(); name != "eth-payment-confirmation-queue.dead" {
+		t.Fatal("bad dead-letter queue name", name)
+	}
+}
@@ -0,0 +1,65 @@
+package queue
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/RTradeLtd/Pay/store"
+	"github.com/RTradeLtd/database/v2/models"
+)
+
+// paymentLedger is the durable record of settlement steps
+// used to make payment confirmations idempotent
+type paymentLedger interface {
+	HasStep(username string, number int64, step store.PaymentStep) (bool, error)
+	RecordStep(payment *models.Payments, step store.PaymentStep) error
+	ConfirmAndCredit(payment *models.Payments) error
+}
+
+// paymentNotifier is used to let a user know their payment was confirmed
+type paymentNotifier func(payment *models.Payments) error
+
+// settlePayment is used to confirm a verified payment, credit the user
+// and notify them. Every step is recorded in the ledger, so a payment
+// that is replayed after a crash only has its remaining steps performed.
+// Crediting happens exactly once, while the notification is sent at least once.
+func settlePayment(ledger paymentLedger, payment *models.Payments, notify paymentNotifier) error {
+	if err := ledger.ConfirmAndCredit(payment); err != nil {
+		return err
+	}
+	notified, err := ledger.HasStep(payment.UserName, payment.Number, store.StepNotified)
+	if err != nil {
+		return err
+	}
+	if notified {
+		return nil
+	}
+	if err := notify(payment); err != nil {
+		return err
+	}
+	return ledger.RecordStep(payment, store.StepNotified)
+}
+
+// paymentNotifier returns a notifier which emails the user
+// that their payment in the given currency was confirmed
+func (qm *Manager) paymentNotifier(qmEmail *Manager, um *models.UserManager, currency string) paymentNotifier {
+	return func(payment *models.Payments) error {
+		user, err := um.FindByUserName(payment.UserName)
+		if err != nil {
+			return err
+		}
+		if !user.EmailEnabled {
+			qm.l.Warnw("user has not activated their email and won't receive notifications",
+				"user", payment.UserName)
+			return nil
+		}
+		return qmEmail.PublishMessage(EmailSend{
+			Subject: currency + " Payment Confirmed",
+			Content: fmt.Sprintf("Your %s payment for %v credits has been confirmed",
+				strings.ToLower(currency), payment.USDValue),
+			ContentType: "text/html",
+			UserNames:   []string{payment.UserName},
+			Emails:      []string{user.EmailAddress},
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/RTradeLtd/Pay/store"
+	"github.com/RTradeLtd/database/v2/models"
+)
+
+// errCrash is used to simulate the worker being killed
+var errCrash = errors.New("worker killed")
+
+// fakeLedger is an in-memory ledger which simulates the worker being
+// killed once a given number of operations have been performed
+type fakeLedger struct {
+	steps     map[store.PaymentStep]bool
+	confirmed bool
+	credits   float64
+	emails    int
+	// the operation at which to crash, or -1 to never crash
+	crashAt int
+	ops     int
+}
+
+func newFakeLedger() *fakeLedger {
+	return &fakeLedger{steps: make(map[store.PaymentStep]bool), crashAt: -1}
+}
+
+func (fl *fakeLedger) tick() {
+	if fl.ops == fl.crashAt {
+		panic(errCrash)
+	}
+	fl.ops++
+}
+
+func (fl *fakeLedger) HasStep(username string, number int64, step store.PaymentStep) (bool, error) {
+	fl.tick()
+	return fl.steps[step], nil
+}
+
+func (fl *fakeLedger) RecordStep(payment *models.Payments, step store.PaymentStep) error {
+	fl.tick()
+	fl.steps[step] = true
+	return nil
+}
+
+// ConfirmAndCredit mirrors the transactional behaviour of the real ledger,
+// all updates are applied together or not at all
+func (fl *fakeLedger) ConfirmAndCredit(payment *models.Payments) error {
+	fl.tick()
+	if fl.steps[store.StepCredited] {
+		return nil
+	}
+	fl.confirmed = true
+	fl.credits += payment.USDValue
+	fl.steps[store.StepCredited] = true
+	return nil
+}
+
+func (fl *fakeLedger) ReverseCredit(payment *models.Payments) error {
+	fl.tick()
+	if !fl.steps[store.StepCredited] || fl.steps[store.StepReversed] {
+		return nil
+	}
+	fl.confirmed = false
+	fl.credits -= payment.USDValue
+	fl.steps[store.StepReversed] = true
+	return nil
+}
+
+func (fl *fakeLedger) ReinstateCredit(payment *models.Payments) error {
+	fl.tick()
+	if !fl.steps[store.StepReversed] {
+		return nil
+	}
+	fl.confirmed = true
+	fl.credits += payment.USDValue
+	delete(fl.steps, store.StepReversed)
+	return nil
+}
+
+func (fl *fakeLedger) notify(payment *models.Payments) error {
+	fl.tick()
+	fl.emails++
+	return nil
+}
+
+// run settles the payment, recovering from a simulated crash
+func (fl *fakeLedger) run(payment *models.Payments) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	return settlePayment(fl, payment, fl.notify)
+}
+
+func Test_SettlePayment_Crash(t *testing.T) {
+	payment := &models.Payments{UserName: "testuser", Number: 1, TxHash: "0x1", USDValue: 10}
+	// a full run performs 4 operations: credit, check notified, notify, record notified.
+	// crash the worker before each one, and replay the delivery
+	for crashAt := 0; crashAt < 4; crashAt++ {
+		fl := newFakeLedger()
+		fl.crashAt = crashAt
+		if err := fl.run(payment); err != errCrash {
+			t.Fatalf("crash %v: expected worker to be killed, got %v", crashAt, err)
+		}
+		// simulate redelivery to a freshly started worker
+		fl.crashAt = -1
+		if err := fl.run(payment); err != nil {
+			t.Fatalf("crash %v: replay failed: %v", crashAt, err)
+		}
+		// replaying a fully settled payment must be a no-op
+		if err := fl.run(payment); err != nil {
+			t.Fatalf("crash %v: second replay failed: %v", crashAt, err)
+		}
+		if !fl.confirmed {
+			t.Fatalf("crash %v: payment not confirmed", crashAt)
+		}
+		if fl.credits != payment.USDValue {
+			t.Fatalf("crash %v: user credited %v, want %v", crashAt, fl.credits, payment.USDValue)
+		}
+		if !fl.steps[store.StepNotified] {
+			t.Fatalf("crash %v: user not notified", crashAt)
+		}
+		if fl.emails == 0 || fl.emails > 2 {
+			t.Fatalf("crash %v: user sent %v emails", crashAt, fl.emails)
+		}
+	}
+}
+
+func Test_SettlePayment_NotifyFailure(t *testing.T) {
+	payment := &models.Payments{UserName: "testuser", Number: 1, TxHash: "0x1", USDValue: 10}
+	fl := newFakeLedger()
+	if err := settlePayment(fl, payment, func(*models.Payments) error {
+		return errors.New("email unavailable")
+	}); err == nil {
+		t.Fatal("error expected")
+	}
+	if fl.steps[store.StepNotified] {
+		t.Fatal("notification should not be recorded")
+	}
+	if err := settlePayment(fl, payment, fl.notify); err != nil {
+		t.Fatal(err)
+	}
+	if fl.credits != payment.USDValue {
+		t.Fatalf("user credited %v, want %v", fl.credits, payment.USDValue)
+	}
+}
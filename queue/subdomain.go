@@ -0,0 +1,188 @@
+package queue
+
+import (
+	"errors"
+
+	"github.com/RTradeLtd/Pay/ethereum"
+	"github.com/RTradeLtd/Pay/store"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+const (
+	// ErrAccountDisabled is an error used to indicate that
+	// the account of the user making a request is disabled
+	ErrAccountDisabled = "user account is disabled"
+	// ErrSubdomainNotRegistered is an error used to indicate that
+	// the subdomain of the requesting user hasn't been registered
+	ErrSubdomainNotRegistered = "subdomain has not been registered"
+	// ErrSubdomainTransferred is an error used to indicate that the subdomain
+	// of the requesting user was transferred, and can no longer be managed by us
+	ErrSubdomainTransferred = "subdomain has been transferred and is no longer managed by us"
+	// ErrSubdomainTaken is an error used to indicate that the label of a
+	// subdomain is owned on chain by someone other than us
+	ErrSubdomainTaken = "subdomain label is owned by another account"
+)
+
+// subdomainStore is used to persist the subdomains issued to users
+type subdomainStore interface {
+	FindSubdomainByUser(username string) (*store.Subdomain, error)
+	ClaimSubdomain(username, label string) (*store.Subdomain, error)
+	UpdateSubdomainStatus(sub *store.Subdomain, status store.SubdomainStatus) error
+	ReleaseSubdomain(sub *store.Subdomain) error
+}
+
+// subdomainOwners is used to find the on chain owner of subdomains
+type subdomainOwners interface {
+	SubdomainOwner(subName, parentName string) (common.Address, error)
+	Account() common.Address
+}
+
+// accountChecker is used to check whether a user account is enabled
+type accountChecker interface {
+	CheckIfUserAccountEnabled(username string) (bool, error)
+}
+
+// subdomains is used to issue *.ipfstemporal.eth subdomains to users, and
+// authorize requests to manage them. Labels are derived from the username,
+// normalised, and recorded against the user they were issued to, so that users
+// whose names normalise to the same label can't overwrite each other
+type subdomains struct {
+	store  subdomainStore
+	users  accountChecker
+	owners subdomainOwners
+	l      *zap.SugaredLogger
+}
+
+// claim is used to claim the label of a user's subdomain ahead of its registration,
+// checking on chain that the label isn't owned by anyone else before gas is spent
+func (sd *subdomains) claim(username string) (*store.Subdomain, error) {
+	if err := sd.enabled(username); err != nil {
+		return nil, err
+	}
+	sub, err := sd.store.FindSubdomainByUser(username)
+	if err == nil {
+		// registering again is allowed, repairing a partial registration
+		if store.SubdomainStatus(sub.Status) == store.SubdomainTransferred {
+			return nil, errors.New(ErrSubdomainTransferred)
+		}
+	} else if gorm.IsRecordNotFoundError(err) {
+		label, err := ethereum.NormalizeLabel(username)
+		if err != nil {
+			return nil, err
+		}
+		if sub, err = sd.store.ClaimSubdomain(username, label); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+	owner, err := sd.owners.SubdomainOwner(sub.Label, ethereum.TemporalENSName)
+	if err != nil {
+		return nil, err
+	}
+	if owner != sd.owners.Account() && owner != (common.Address{}) {
+		// the label can never be registered, so the claim is released
+		return nil, sd.registered(sub, errors.New(ErrSubdomainTaken))
+	}
+	return sub, nil
+}
+
+// lookup is used to find the subdomain of a user, checking that we still
+// manage it on their behalf. Subdomains registered before they were recorded
+// are recorded on first use, provided we own them on chain
+func (sd *subdomains) lookup(username string) (*store.Subdomain, error) {
+	if err := sd.enabled(username); err != nil {
+		return nil, err
+	}
+	sub, err := sd.store.FindSubdomainByUser(username)
+	if gorm.IsRecordNotFoundError(err) {
+		return sd.backfill(username)
+	} else if err != nil {
+		return nil, err
+	}
+	switch store.SubdomainStatus(sub.Status) {
+	case store.SubdomainTransferred:
+		return nil, errors.New(ErrSubdomainTransferred)
+	case store.SubdomainClaimed:
+		return nil, errors.New(ErrSubdomainNotRegistered)
+	}
+	if err := sd.managed(sub.Label); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// backfill is used to record a subdomain registered before subdomains were recorded.
+// Those subdomains were registered with the raw username as their label, so only a
+// username which is already normalised can have registered it, and a user whose name
+// merely normalises to an existing label can't take over someone else's subdomain
+func (sd *subdomains) backfill(username string) (*store.Subdomain, error) {
+	label, err := ethereum.NormalizeLabel(username)
+	if err != nil {
+		return nil, err
+	}
+	if label != username {
+		return nil, errors.New(ErrSubdomainNotRegistered)
+	}
+	if err := sd.managed(label); err != nil {
+		return nil, err
+	}
+	sub, err := sd.store.ClaimSubdomain(username, label)
+	if err != nil {
+		return nil, err
+	}
+	sd.l.Infow("recorded existing subdomain", "user", username, "label", label)
+	return sub, sd.store.UpdateSubdomainStatus(sub, store.SubdomainRegistered)
+}
+
+// registered is used to record the result of registering a subdomain,
+// releasing the label of a failed registration so it may be claimed again
+func (sd *subdomains) registered(sub *store.Subdomain, err error) error {
+	if err == nil {
+		return sd.store.UpdateSubdomainStatus(sub, store.SubdomainRegistered)
+	}
+	if store.SubdomainStatus(sub.Status) == store.SubdomainClaimed {
+		if releaseErr := sd.store.ReleaseSubdomain(sub); releaseErr != nil {
+			sd.l.Errorw("failed to release subdomain", "label", sub.Label, "error", releaseErr.Error())
+		}
+	}
+	return err
+}
+
+// transferred is used to record the result of transferring a subdomain
+func (sd *subdomains) transferred(sub *store.Subdomain, err error) error {
+	if err != nil {
+		return err
+	}
+	return sd.store.UpdateSubdomainStatus(sub, store.SubdomainTransferred)
+}
+
+// enabled is used to check that the account of a user is enabled
+func (sd *subdomains) enabled(username string) error {
+	enabled, err := sd.users.CheckIfUserAccountEnabled(username)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return errors.New(ErrAccountDisabled)
+	}
+	return nil
+}
+
+// managed is used to check that we own a subdomain on chain, and so can manage it
+func (sd *subdomains) managed(label string) error {
+	owner, err := sd.owners.SubdomainOwner(label, ethereum.TemporalENSName)
+	if err != nil {
+		return err
+	}
+	switch owner {
+	case sd.owners.Account():
+		return nil
+	case common.Address{}:
+		return errors.New(ErrSubdomainNotRegistered)
+	default:
+		return errors.New(ErrSubdomainTransferred)
+	}
+}
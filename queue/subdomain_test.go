@@ -0,0 +1,176 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/RTradeLtd/Pay/store"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+type fakeAccounts map[string]bool
+
+func (fa fakeAccounts) CheckIfUserAccountEnabled(username string) (bool, error) {
+	return fa[username], nil
+}
+
+// fakeOwners are the on chain owners of subdomains, keyed by their label
+type fakeOwners map[string]common.Address
+
+func (fo fakeOwners) SubdomainOwner(subName, parentName string) (common.Address, error) {
+	return fo[subName], nil
+}
+
+func (fo fakeOwners) Account() common.Address {
+	return common.HexToAddress("0x1")
+}
+
+// fakeSubdomains are the issued subdomains, keyed by their label
+type fakeSubdomains map[string]*store.Subdomain
+
+func (fs fakeSubdomains) FindSubdomainByUser(username string) (*store.Subdomain, error) {
+	for _, sub := range fs {
+		if sub.UserName == username {
+			return sub, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (fs fakeSubdomains) ClaimSubdomain(username, label string) (*store.Subdomain, error) {
+	if sub, ok := fs[label]; ok {
+		if sub.UserName != username {
+			return nil, errors.New(store.ErrLabelTaken)
+		}
+		return sub, nil
+	}
+	fs[label] = &store.Subdomain{Label: label, UserName: username, Status: store.SubdomainClaimed.String()}
+	return fs[label], nil
+}
+
+func (fs fakeSubdomains) UpdateSubdomainStatus(sub *store.Subdomain, status store.SubdomainStatus) error {
+	sub.Status = status.String()
+	return nil
+}
+
+func (fs fakeSubdomains) ReleaseSubdomain(sub *store.Subdomain) error {
+	delete(fs, sub.Label)
+	return nil
+}
+
+func newFakeSubdomains() (*subdomains, fakeSubdomains) {
+	fs := fakeSubdomains{
+		"alice":       {Label: "alice", UserName: "alice", Status: store.SubdomainRegistered.String()},
+		"transferred": {Label: "transferred", UserName: "transferred", Status: store.SubdomainTransferred.String()},
+	}
+	return &subdomains{
+		store: fs,
+		users: fakeAccounts{
+			"alice": true, "Alice": true, "bob": true, "legacy": true, "Legacy": true,
+			"squatted": true, "transferred": true, "bad.name": true,
+		},
+		owners: fakeOwners{
+			"alice":       common.HexToAddress("0x1"),
+			"legacy":      common.HexToAddress("0x1"),
+			"squatted":    common.HexToAddress("0x2"),
+			"transferred": common.HexToAddress("0x2"),
+		},
+		l: zap.NewNop().Sugar(),
+	}, fs
+}
+
+func Test_Subdomains_Claim(t *testing.T) {
+	tests := []struct {
+		name      string
+		user      string
+		wantLabel string
+		wantErr   string
+	}{
+		{"New", "bob", "bob", ""},
+		{"Existing", "alice", "alice", ""},
+		// normalises to the label issued to alice
+		{"Conflicting", "Alice", "", store.ErrLabelTaken},
+		{"OwnedOnChain", "squatted", "", ErrSubdomainTaken},
+		{"Transferred", "transferred", "", ErrSubdomainTransferred},
+		{"InvalidLabel", "bad.name", "", "invalid subdomain label"},
+		{"Disabled", "disabled", "", ErrAccountDisabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd, fs := newFakeSubdomains()
+			sub, err := sd.claim(tt.user)
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Fatalf("claim() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && sub.Label != tt.wantLabel {
+				t.Fatalf("claim() label = %v, want %v", sub.Label, tt.wantLabel)
+			}
+			// a label which can't be registered isn't left claimed
+			if tt.wantErr == ErrSubdomainTaken {
+				if _, ok := fs[tt.user]; ok {
+					t.Fatal("claim should have been released")
+				}
+			}
+		})
+	}
+}
+
+func Test_Subdomains_Lookup(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    string
+		wantErr string
+	}{
+		{"Registered", "alice", ""},
+		// registered before subdomains were recorded
+		{"Legacy", "legacy", ""},
+		// only normalises to the label of a subdomain registered before they were recorded
+		{"LegacyNormalised", "Legacy", ErrSubdomainNotRegistered},
+		{"Unregistered", "bob", ErrSubdomainNotRegistered},
+		{"Transferred", "transferred", ErrSubdomainTransferred},
+		{"Disabled", "disabled", ErrAccountDisabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd, fs := newFakeSubdomains()
+			_, err := sd.lookup(tt.user)
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Fatalf("lookup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.user == "legacy" && fs["legacy"].Status != store.SubdomainRegistered.String() {
+				t.Fatal("legacy subdomain should have been recorded")
+			}
+			if tt.user == "Legacy" {
+				if _, ok := fs["legacy"]; ok {
+					t.Fatal("legacy subdomain should not have been recorded")
+				}
+			}
+		})
+	}
+}
+
+func Test_Subdomains_Registered(t *testing.T) {
+	sd, fs := newFakeSubdomains()
+	sub, err := sd.claim("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a failed registration releases the label
+	if err := sd.registered(sub, errors.New("tx failed")); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, ok := fs["bob"]; ok {
+		t.Fatal("claim should have been released")
+	}
+	if sub, err = sd.claim("bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sd.registered(sub, nil); err != nil {
+		t.Fatal(err)
+	}
+	if fs["bob"].Status != store.SubdomainRegistered.String() {
+		t.Fatal("subdomain should be registered")
+	}
+}
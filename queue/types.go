@@ -18,6 +18,10 @@ var (
 	EthPaymentConfirmationQueue Queue = "eth-payment-confirmation-queue"
 	// BitcoinCashPaymentConfirmationQueue is a queue used to handle confirming bitcoin cash payments
 	BitcoinCashPaymentConfirmationQueue Queue = "bitcoin-cash-payment-confirmation-queue"
+	// BitcoinPaymentConfirmationQueue is a queue used to handle confirming bitcoin payments
+	BitcoinPaymentConfirmationQueue Queue = "bitcoin-payment-confirmation-queue"
+	// MoneroPaymentConfirmationQueue is a queue used to handle confirming monero payments
+	MoneroPaymentConfirmationQueue Queue = "monero-payment-confirmation-queue"
 	// ErrReconnect is an error emitted when a protocol connection error occurs
 	// It is used to signal reconnect of queue consumers and publishers
 	ErrReconnect = "protocol connection error, reconnect"
@@ -29,7 +33,8 @@ type EthPaymentConfirmation struct {
 	PaymentNumber int64  `json:"payment_number"`
 }
 
-// DashPaymentConfirmation is a message used to signal processing of a dash payment
+// DashPaymentConfirmation is a message used to signal processing of a dash payment.
+// If PaymentForwardID is empty, the payment is expected at the payment's deposit address
 type DashPaymentConfirmation struct {
 	UserName         string `json:"user_name"`
 	PaymentForwardID string `json:"payment_forward_id"`
@@ -42,6 +47,18 @@ type BchPaymentConfirmation struct {
 	PaymentNumber int64  `json:"payment_number"`
 }
 
+// BtcPaymentConfirmation is used to confirm a bitcoin based payment
+type BtcPaymentConfirmation struct {
+	UserName      string `json:"user_name"`
+	PaymentNumber int64  `json:"payment_number"`
+}
+
+// XmrPaymentConfirmation is used to confirm a monero based payment
+type XmrPaymentConfirmation struct {
+	UserName      string `json:"user_name"`
+	PaymentNumber int64  `json:"payment_number"`
+}
+
 // EmailSend is a helper struct used to contained formatted content ot send as an email
 type EmailSend struct {
 	Subject     string   `json:"subject"`
@@ -65,6 +82,12 @@ const (
 	ENSRegisterSubName = ENSRequestType("regsiter-sub-name")
 	// ENSUpdateContentHash is used to update the content hash for a record
 	ENSUpdateContentHash = ENSRequestType("update-content-hash")
+	// ENSSetText is used to set a text record of a subdomain
+	ENSSetText = ENSRequestType("set-text")
+	// ENSSetAddress is used to set an address record of a subdomain
+	ENSSetAddress = ENSRequestType("set-address")
+	// ENSTransferSubName is used to transfer ownership of a subdomain to the user
+	ENSTransferSubName = ENSRequestType("transfer-sub-name")
 )
 
 // ENSRequest is used to process an ens api request
@@ -72,4 +95,12 @@ type ENSRequest struct {
 	Type        ENSRequestType `json:"type"`
 	UserName    string         `json:"user_name"`
 	ContentHash string         `json:"content_hash"`
+	// TextKey and TextValue are the text record set by set-text requests
+	TextKey   string `json:"text_key,omitempty"`
+	TextValue string `json:"text_value,omitempty"`
+	// CoinType is the SLIP-44 coin type of the address set by set-address requests
+	CoinType uint64 `json:"coin_type,omitempty"`
+	// Address is the address set by set-address requests, or
+	// the new owner of the subdomain for transfer-sub-name requests
+	Address string `json:"address,omitempty"`
 }
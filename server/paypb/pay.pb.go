@@ -0,0 +1,744 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: pay.proto
+
+package paypb
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+// DepositAddressRequest is a request for the deposit address of a payment
+type DepositAddressRequest struct {
+	// blockchain is one of bch, btc or dash
+	Blockchain           string   `protobuf:"bytes,1,opt,name=blockchain,proto3" json:"blockchain,omitempty"`
+	UserName             string   `protobuf:"bytes,2,opt,name=userName,proto3" json:"userName,omitempty"`
+	PaymentNumber        int64    `protobuf:"varint,3,opt,name=paymentNumber,proto3" json:"paymentNumber,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DepositAddressRequest) Reset()         { *m = DepositAddressRequest{} }
+func (m *DepositAddressRequest) String() string { return proto.CompactTextString(m) }
+func (*DepositAddressRequest) ProtoMessage()    {}
+func (*DepositAddressRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0564d675d5c516e0, []int{0}
+}
+
+func (m *DepositAddressRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DepositAddressRequest.Unmarshal(m, b)
+}
+func (m *DepositAddressRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DepositAddressRequest.Marshal(b, m, deterministic)
+}
+func (m *DepositAddressRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DepositAddressRequest.Merge(m, src)
+}
+func (m *DepositAddressRequest) XXX_Size() int {
+	return xxx_messageInfo_DepositAddressRequest.Size(m)
+}
+func (m *DepositAddressRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_DepositAddressRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DepositAddressRequest proto.InternalMessageInfo
+
+func (m *DepositAddressRequest) GetBlockchain() string {
+	if m != nil {
+		return m.Blockchain
+	}
+	return ""
+}
+
+func (m *DepositAddressRequest) GetUserName() string {
+	if m != nil {
+		return m.UserName
+	}
+	return ""
+}
+
+func (m *DepositAddressRequest) GetPaymentNumber() int64 {
+	if m != nil {
+		return m.PaymentNumber
+	}
+	return 0
+}
+
+// DepositAddressResponse contains the derived deposit address
+type DepositAddressResponse struct {
+	Address string `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	// index is the derivation index of the address on the external chain
+	Index                uint32   `protobuf:"varint,2,opt,name=index,proto3" json:"index,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DepositAddressResponse) Reset()         { *m = DepositAddressResponse{} }
+func (m *DepositAddressResponse) String() string { return proto.CompactTextString(m) }
+func (*DepositAddressResponse) ProtoMessage()    {}
+func (*DepositAddressResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0564d675d5c516e0, []int{1}
+}
+
+func (m *DepositAddressResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DepositAddressResponse.Unmarshal(m, b)
+}
+func (m *DepositAddressResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DepositAddressResponse.Marshal(b, m, deterministic)
+}
+func (m *DepositAddressResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DepositAddressResponse.Merge(m, src)
+}
+func (m *DepositAddressResponse) XXX_Size() int {
+	return xxx_messageInfo_DepositAddressResponse.Size(m)
+}
+func (m *DepositAddressResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_DepositAddressResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DepositAddressResponse proto.InternalMessageInfo
+
+func (m *DepositAddressResponse) GetAddress() string {
+	if m != nil {
+		return m.Address
+	}
+	return ""
+}
+
+func (m *DepositAddressResponse) GetIndex() uint32 {
+	if m != nil {
+		return m.Index
+	}
+	return 0
+}
+
+// TypedSignRequest is a request for a signed typed payment message
+type TypedSignRequest struct {
+	Address       string `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	PaymentMethod uint32 `protobuf:"varint,2,opt,name=paymentMethod,proto3" json:"paymentMethod,omitempty"`
+	// paymentNumber and chargeAmount are base 10 integers
+	PaymentNumber string `protobuf:"bytes,3,opt,name=paymentNumber,proto3" json:"paymentNumber,omitempty"`
+	ChargeAmount  string `protobuf:"bytes,4,opt,name=chargeAmount,proto3" json:"chargeAmount,omitempty"`
+	// expiresIn is the number of seconds the message is valid for,
+	// defaulting to and at most the validity configured by the server
+	ExpiresIn            int64    `protobuf:"varint,5,opt,name=expiresIn,proto3" json:"expiresIn,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TypedSignRequest) Reset()         { *m = TypedSignRequest{} }
+func (m *TypedSignRequest) String() string { return proto.CompactTextString(m) }
+func (*TypedSignRequest) ProtoMessage()    {}
+func (*TypedSignRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0564d675d5c516e0, []int{2}
+}
+
+func (m *TypedSignRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TypedSignRequest.Unmarshal(m, b)
+}
+func (m *TypedSignRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TypedSignRequest.Marshal(b, m, deterministic)
+}
+func (m *TypedSignRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TypedSignRequest.Merge(m, src)
+}
+func (m *TypedSignRequest) XXX_Size() int {
+	return xxx_messageInfo_TypedSignRequest.Size(m)
+}
+func (m *TypedSignRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_TypedSignRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TypedSignRequest proto.InternalMessageInfo
+
+func (m *TypedSignRequest) GetAddress() string {
+	if m != nil {
+		return m.Address
+	}
+	return ""
+}
+
+func (m *TypedSignRequest) GetPaymentMethod() uint32 {
+	if m != nil {
+		return m.PaymentMethod
+	}
+	return 0
+}
+
+func (m *TypedSignRequest) GetPaymentNumber() string {
+	if m != nil {
+		return m.PaymentNumber
+	}
+	return ""
+}
+
+func (m *TypedSignRequest) GetChargeAmount() string {
+	if m != nil {
+		return m.ChargeAmount
+	}
+	return ""
+}
+
+func (m *TypedSignRequest) GetExpiresIn() int64 {
+	if m != nil {
+		return m.ExpiresIn
+	}
+	return 0
+}
+
+// TypedSignResponse contains a signed typed payment message
+type TypedSignResponse struct {
+	// hash is the hex encoded EIP-712 digest which was signed
+	Hash string `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+	R    string `protobuf:"bytes,2,opt,name=r,proto3" json:"r,omitempty"`
+	S    string `protobuf:"bytes,3,opt,name=s,proto3" json:"s,omitempty"`
+	V    uint32 `protobuf:"varint,4,opt,name=v,proto3" json:"v,omitempty"`
+	// sig is the hex encoded 65 byte signature, with a v of 27 or 28
+	Sig string `protobuf:"bytes,5,opt,name=sig,proto3" json:"sig,omitempty"`
+	// signer is the address of the payment key which signed the message
+	Signer string `protobuf:"bytes,6,opt,name=signer,proto3" json:"signer,omitempty"`
+	// expiry is the unix time the message is valid until
+	Expiry int64 `protobuf:"varint,7,opt,name=expiry,proto3" json:"expiry,omitempty"`
+	// name, version, chainId and verifyingContract are the EIP-712 domain
+	Name                 string   `protobuf:"bytes,8,opt,name=name,proto3" json:"name,omitempty"`
+	Version              string   `protobuf:"bytes,9,opt,name=version,proto3" json:"version,omitempty"`
+	ChainId              string   `protobuf:"bytes,10,opt,name=chainId,proto3" json:"chainId,omitempty"`
+	VerifyingContract    string   `protobuf:"bytes,11,opt,name=verifyingContract,proto3" json:"verifyingContract,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TypedSignResponse) Reset()         { *m = TypedSignResponse{} }
+func (m *TypedSignResponse) String() string { return proto.CompactTextString(m) }
+func (*TypedSignResponse) ProtoMessage()    {}
+func (*TypedSignResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0564d675d5c516e0, []int{3}
+}
+
+func (m *TypedSignResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TypedSignResponse.Unmarshal(m, b)
+}
+func (m *TypedSignResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TypedSignResponse.Marshal(b, m, deterministic)
+}
+func (m *TypedSignResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TypedSignResponse.Merge(m, src)
+}
+func (m *TypedSignResponse) XXX_Size() int {
+	return xxx_messageInfo_TypedSignResponse.Size(m)
+}
+func (m *TypedSignResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_TypedSignResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TypedSignResponse proto.InternalMessageInfo
+
+func (m *TypedSignResponse) GetHash() string {
+	if m != nil {
+		return m.Hash
+	}
+	return ""
+}
+
+func (m *TypedSignResponse) GetR() string {
+	if m != nil {
+		return m.R
+	}
+	return ""
+}
+
+func (m *TypedSignResponse) GetS() string {
+	if m != nil {
+		return m.S
+	}
+	return ""
+}
+
+func (m *TypedSignResponse) GetV() uint32 {
+	if m != nil {
+		return m.V
+	}
+	return 0
+}
+
+func (m *TypedSignResponse) GetSig() string {
+	if m != nil {
+		return m.Sig
+	}
+	return ""
+}
+
+func (m *TypedSignResponse) GetSigner() string {
+	if m != nil {
+		return m.Signer
+	}
+	return ""
+}
+
+func (m *TypedSignResponse) GetExpiry() int64 {
+	if m != nil {
+		return m.Expiry
+	}
+	return 0
+}
+
+func (m *TypedSignResponse) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *TypedSignResponse) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+func (m *TypedSignResponse) GetChainId() string {
+	if m != nil {
+		return m.ChainId
+	}
+	return ""
+}
+
+func (m *TypedSignResponse) GetVerifyingContract() string {
+	if m != nil {
+		return m.VerifyingContract
+	}
+	return ""
+}
+
+// IssuedSignaturesRequest filters the signed payment messages returned,
+// with empty fields matching any message
+type IssuedSignaturesRequest struct {
+	PaymentNumber string `protobuf:"bytes,1,opt,name=paymentNumber,proto3" json:"paymentNumber,omitempty"`
+	Address       string `protobuf:"bytes,2,opt,name=address,proto3" json:"address,omitempty"`
+	// since is the unix time messages must be signed at or after
+	Since int64 `protobuf:"varint,3,opt,name=since,proto3" json:"since,omitempty"`
+	// limit defaults to 100
+	Limit                uint32   `protobuf:"varint,4,opt,name=limit,proto3" json:"limit,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *IssuedSignaturesRequest) Reset()         { *m = IssuedSignaturesRequest{} }
+func (m *IssuedSignaturesRequest) String() string { return proto.CompactTextString(m) }
+func (*IssuedSignaturesRequest) ProtoMessage()    {}
+func (*IssuedSignaturesRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0564d675d5c516e0, []int{4}
+}
+
+func (m *IssuedSignaturesRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_IssuedSignaturesRequest.Unmarshal(m, b)
+}
+func (m *IssuedSignaturesRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_IssuedSignaturesRequest.Marshal(b, m, deterministic)
+}
+func (m *IssuedSignaturesRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_IssuedSignaturesRequest.Merge(m, src)
+}
+func (m *IssuedSignaturesRequest) XXX_Size() int {
+	return xxx_messageInfo_IssuedSignaturesRequest.Size(m)
+}
+func (m *IssuedSignaturesRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_IssuedSignaturesRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_IssuedSignaturesRequest proto.InternalMessageInfo
+
+func (m *IssuedSignaturesRequest) GetPaymentNumber() string {
+	if m != nil {
+		return m.PaymentNumber
+	}
+	return ""
+}
+
+func (m *IssuedSignaturesRequest) GetAddress() string {
+	if m != nil {
+		return m.Address
+	}
+	return ""
+}
+
+func (m *IssuedSignaturesRequest) GetSince() int64 {
+	if m != nil {
+		return m.Since
+	}
+	return 0
+}
+
+func (m *IssuedSignaturesRequest) GetLimit() uint32 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+// IssuedSignaturesResponse contains the signed payment messages matching a request
+type IssuedSignaturesResponse struct {
+	Signatures           []*IssuedSignature `protobuf:"bytes,1,rep,name=signatures,proto3" json:"signatures,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *IssuedSignaturesResponse) Reset()         { *m = IssuedSignaturesResponse{} }
+func (m *IssuedSignaturesResponse) String() string { return proto.CompactTextString(m) }
+func (*IssuedSignaturesResponse) ProtoMessage()    {}
+func (*IssuedSignaturesResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0564d675d5c516e0, []int{5}
+}
+
+func (m *IssuedSignaturesResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_IssuedSignaturesResponse.Unmarshal(m, b)
+}
+func (m *IssuedSignaturesResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_IssuedSignaturesResponse.Marshal(b, m, deterministic)
+}
+func (m *IssuedSignaturesResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_IssuedSignaturesResponse.Merge(m, src)
+}
+func (m *IssuedSignaturesResponse) XXX_Size() int {
+	return xxx_messageInfo_IssuedSignaturesResponse.Size(m)
+}
+func (m *IssuedSignaturesResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_IssuedSignaturesResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_IssuedSignaturesResponse proto.InternalMessageInfo
+
+func (m *IssuedSignaturesResponse) GetSignatures() []*IssuedSignature {
+	if m != nil {
+		return m.Signatures
+	}
+	return nil
+}
+
+// IssuedSignature is a signed payment message
+type IssuedSignature struct {
+	PaymentNumber string `protobuf:"bytes,1,opt,name=paymentNumber,proto3" json:"paymentNumber,omitempty"`
+	Address       string `protobuf:"bytes,2,opt,name=address,proto3" json:"address,omitempty"`
+	PaymentMethod uint32 `protobuf:"varint,3,opt,name=paymentMethod,proto3" json:"paymentMethod,omitempty"`
+	ChargeAmount  string `protobuf:"bytes,4,opt,name=chargeAmount,proto3" json:"chargeAmount,omitempty"`
+	// mode is either prefixed or typed
+	Mode     string `protobuf:"bytes,5,opt,name=mode,proto3" json:"mode,omitempty"`
+	Signer   string `protobuf:"bytes,6,opt,name=signer,proto3" json:"signer,omitempty"`
+	Hash     string `protobuf:"bytes,7,opt,name=hash,proto3" json:"hash,omitempty"`
+	IssuedAt int64  `protobuf:"varint,8,opt,name=issuedAt,proto3" json:"issuedAt,omitempty"`
+	// expiry is zero for messages which never expire
+	Expiry               int64    `protobuf:"varint,9,opt,name=expiry,proto3" json:"expiry,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *IssuedSignature) Reset()         { *m = IssuedSignature{} }
+func (m *IssuedSignature) String() string { return proto.CompactTextString(m) }
+func (*IssuedSignature) ProtoMessage()    {}
+func (*IssuedSignature) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0564d675d5c516e0, []int{6}
+}
+
+func (m *IssuedSignature) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_IssuedSignature.Unmarshal(m, b)
+}
+func (m *IssuedSignature) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_IssuedSignature.Marshal(b, m, deterministic)
+}
+func (m *IssuedSignature) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_IssuedSignature.Merge(m, src)
+}
+func (m *IssuedSignature) XXX_Size() int {
+	return xxx_messageInfo_IssuedSignature.Size(m)
+}
+func (m *IssuedSignature) XXX_DiscardUnknown() {
+	xxx_messageInfo_IssuedSignature.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_IssuedSignature proto.InternalMessageInfo
+
+func (m *IssuedSignature) GetPaymentNumber() string {
+	if m != nil {
+		return m.PaymentNumber
+	}
+	return ""
+}
+
+func (m *IssuedSignature) GetAddress() string {
+	if m != nil {
+		return m.Address
+	}
+	return ""
+}
+
+func (m *IssuedSignature) GetPaymentMethod() uint32 {
+	if m != nil {
+		return m.PaymentMethod
+	}
+	return 0
+}
+
+func (m *IssuedSignature) GetChargeAmount() string {
+	if m != nil {
+		return m.ChargeAmount
+	}
+	return ""
+}
+
+func (m *IssuedSignature) GetMode() string {
+	if m != nil {
+		return m.Mode
+	}
+	return ""
+}
+
+func (m *IssuedSignature) GetSigner() string {
+	if m != nil {
+		return m.Signer
+	}
+	return ""
+}
+
+func (m *IssuedSignature) GetHash() string {
+	if m != nil {
+		return m.Hash
+	}
+	return ""
+}
+
+func (m *IssuedSignature) GetIssuedAt() int64 {
+	if m != nil {
+		return m.IssuedAt
+	}
+	return 0
+}
+
+func (m *IssuedSignature) GetExpiry() int64 {
+	if m != nil {
+		return m.Expiry
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*DepositAddressRequest)(nil), "paypb.DepositAddressRequest")
+	proto.RegisterType((*DepositAddressResponse)(nil), "paypb.DepositAddressResponse")
+	proto.RegisterType((*TypedSignRequest)(nil), "paypb.TypedSignRequest")
+	proto.RegisterType((*TypedSignResponse)(nil), "paypb.TypedSignResponse")
+	proto.RegisterType((*IssuedSignaturesRequest)(nil), "paypb.IssuedSignaturesRequest")
+	proto.RegisterType((*IssuedSignaturesResponse)(nil), "paypb.IssuedSignaturesResponse")
+	proto.RegisterType((*IssuedSignature)(nil), "paypb.IssuedSignature")
+}
+
+func init() { proto.RegisterFile("pay.proto", fileDescriptor_0564d675d5c516e0) }
+
+var fileDescriptor_0564d675d5c516e0 = []byte{
+	// 603 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x54, 0x4d, 0x6f, 0xd4, 0x30,
+	0x10, 0x25, 0x9b, 0x7e, 0x65, 0xda, 0x8a, 0xd6, 0xd0, 0xd6, 0x5a, 0x95, 0x52, 0x45, 0x20, 0x7a,
+	0x40, 0xbb, 0x52, 0x91, 0xb8, 0x17, 0x90, 0x4a, 0xa5, 0xb6, 0xaa, 0x42, 0x0f, 0x88, 0x9b, 0x37,
+	0x19, 0x12, 0x8b, 0xc6, 0x09, 0xb6, 0xb3, 0x6a, 0x8e, 0x1c, 0x38, 0x70, 0xe2, 0xff, 0xf0, 0xeb,
+	0x50, 0x1c, 0x6f, 0x9a, 0x4d, 0x76, 0x25, 0x24, 0x6e, 0x7e, 0x6f, 0x9c, 0xf9, 0x78, 0xf3, 0x62,
+	0xf0, 0x72, 0x56, 0x8e, 0x72, 0x99, 0xe9, 0x8c, 0xac, 0xe6, 0xac, 0xcc, 0x27, 0x7e, 0x09, 0x7b,
+	0x1f, 0x30, 0xcf, 0x14, 0xd7, 0x67, 0x51, 0x24, 0x51, 0xa9, 0x00, 0xbf, 0x17, 0xa8, 0x34, 0x39,
+	0x02, 0x98, 0xdc, 0x65, 0xe1, 0xb7, 0x30, 0x61, 0x5c, 0x50, 0xe7, 0xd8, 0x39, 0xf1, 0x82, 0x16,
+	0x43, 0x86, 0xb0, 0x51, 0x28, 0x94, 0xd7, 0x2c, 0x45, 0x3a, 0x30, 0xd1, 0x06, 0x93, 0x17, 0xb0,
+	0x9d, 0xb3, 0x32, 0x45, 0xa1, 0xaf, 0x8b, 0x74, 0x82, 0x92, 0xba, 0xc7, 0xce, 0x89, 0x1b, 0xcc,
+	0x93, 0xfe, 0x47, 0xd8, 0xef, 0x96, 0x56, 0x79, 0x26, 0x14, 0x12, 0x0a, 0xeb, 0xac, 0xa6, 0x6c,
+	0xe1, 0x19, 0x24, 0x4f, 0x61, 0x95, 0x8b, 0x08, 0xef, 0x4d, 0xc9, 0xed, 0xa0, 0x06, 0xfe, 0x1f,
+	0x07, 0x76, 0x6e, 0xcb, 0x1c, 0xa3, 0x4f, 0x3c, 0x16, 0xb3, 0x01, 0x96, 0x27, 0x79, 0x68, 0xef,
+	0x0a, 0x75, 0x92, 0x45, 0x36, 0xd9, 0x3c, 0xb9, 0x78, 0x08, 0xaf, 0x33, 0x04, 0xf1, 0x61, 0x2b,
+	0x4c, 0x98, 0x8c, 0xf1, 0x2c, 0xcd, 0x0a, 0xa1, 0xe9, 0x8a, 0xb9, 0x34, 0xc7, 0x91, 0x43, 0xf0,
+	0xf0, 0x3e, 0xe7, 0x12, 0xd5, 0x85, 0xa0, 0xab, 0x46, 0x8a, 0x07, 0xc2, 0xff, 0x35, 0x80, 0xdd,
+	0x56, 0xf3, 0x56, 0x02, 0x02, 0x2b, 0x09, 0x53, 0x89, 0x6d, 0xdd, 0x9c, 0xc9, 0x16, 0x38, 0xd2,
+	0x6a, 0xed, 0xc8, 0x0a, 0x29, 0xdb, 0x93, 0xa3, 0x2a, 0x34, 0x35, 0xc5, 0xb7, 0x03, 0x67, 0x4a,
+	0x76, 0xc0, 0x55, 0x3c, 0x36, 0xb5, 0xbc, 0xa0, 0x3a, 0x92, 0x7d, 0x58, 0x53, 0x3c, 0x16, 0x28,
+	0xe9, 0x9a, 0x21, 0x2d, 0xaa, 0x78, 0xd3, 0x4a, 0x49, 0xd7, 0x4d, 0x63, 0x16, 0x55, 0xf5, 0x45,
+	0xb5, 0xda, 0x8d, 0xba, 0x7e, 0x75, 0xae, 0x14, 0x9d, 0xa2, 0x54, 0x3c, 0x13, 0xd4, 0xab, 0x15,
+	0xb5, 0xb0, 0x8a, 0x18, 0x57, 0x5c, 0x44, 0x14, 0xea, 0x88, 0x85, 0xe4, 0x35, 0xec, 0x4e, 0x51,
+	0xf2, 0xaf, 0x25, 0x17, 0xf1, 0xfb, 0x4c, 0x68, 0xc9, 0x42, 0x4d, 0x37, 0xcd, 0x9d, 0x7e, 0xc0,
+	0xff, 0xe9, 0xc0, 0xc1, 0x85, 0x52, 0x45, 0x2d, 0x06, 0xd3, 0x85, 0xc4, 0xc6, 0x90, 0xbd, 0x7d,
+	0x38, 0x8b, 0xf6, 0xd1, 0xda, 0xfa, 0xa0, 0x67, 0x1d, 0xc5, 0x45, 0x88, 0xd6, 0x8c, 0x35, 0xa8,
+	0xd8, 0x3b, 0x9e, 0x72, 0x6d, 0xb5, 0xab, 0x81, 0x1f, 0x00, 0xed, 0xb7, 0x61, 0x37, 0xf3, 0x16,
+	0x40, 0x35, 0x2c, 0x75, 0x8e, 0xdd, 0x93, 0xcd, 0xd3, 0xfd, 0x91, 0xf9, 0x9b, 0x46, 0x9d, 0x8f,
+	0x82, 0xd6, 0x4d, 0xff, 0xf7, 0x00, 0x1e, 0x77, 0xe2, 0xff, 0x3d, 0x53, 0xcf, 0xc9, 0xee, 0x22,
+	0x27, 0xff, 0x8b, 0x47, 0x09, 0xac, 0xa4, 0x59, 0x84, 0xd6, 0x32, 0xe6, 0xbc, 0xd4, 0x33, 0x33,
+	0x6f, 0xae, 0xb7, 0xbc, 0x39, 0x84, 0x0d, 0x6e, 0x86, 0x3b, 0xd3, 0xc6, 0x33, 0x6e, 0xd0, 0xe0,
+	0x96, 0xc7, 0xbc, 0xb6, 0xc7, 0x4e, 0x7f, 0x0c, 0xc0, 0xbd, 0x61, 0x25, 0x09, 0x60, 0xf7, 0x1c,
+	0xf5, 0xfc, 0x5b, 0x40, 0x0e, 0xad, 0xa4, 0x0b, 0x5f, 0xa7, 0xe1, 0xb3, 0x25, 0xd1, 0x7a, 0x47,
+	0xfe, 0x23, 0x72, 0x09, 0x7b, 0xe7, 0xa8, 0x9b, 0xff, 0x0a, 0xa3, 0x2b, 0x54, 0x8a, 0xc5, 0x48,
+	0x0e, 0xec, 0x97, 0xdd, 0xf7, 0x62, 0x48, 0xfb, 0x81, 0x26, 0xdb, 0x67, 0x78, 0x72, 0x8e, 0xba,
+	0x6b, 0x09, 0x72, 0xb4, 0x78, 0xed, 0x4d, 0x97, 0xcf, 0x97, 0xc6, 0x67, 0x99, 0xdf, 0xbd, 0xfa,
+	0xf2, 0x32, 0xe6, 0x3a, 0x29, 0x26, 0xa3, 0x30, 0x4b, 0xc7, 0xc1, 0xad, 0x64, 0x11, 0x5e, 0xea,
+	0x68, 0x7c, 0xc3, 0xca, 0xb1, 0x42, 0x39, 0x45, 0x39, 0x36, 0x39, 0x26, 0x6b, 0xe6, 0xd9, 0x7e,
+	0xf3, 0x77, 0x00, 0xc5, 0x52, 0xca, 0xc2, 0xc3, 0x05, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// PayClient is the client API for Pay service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type PayClient interface {
+	// GetDepositAddress derives a fresh deposit address for a payment
+	GetDepositAddress(ctx context.Context, in *DepositAddressRequest, opts ...grpc.CallOption) (*DepositAddressResponse, error)
+	// GetTypedSignedMessage signs an EIP-712 typed payment message, which unlike
+	// the messages of Signer.GetSignedMessage is bound to our payment contract
+	// and expires
+	GetTypedSignedMessage(ctx context.Context, in *TypedSignRequest, opts ...grpc.CallOption) (*TypedSignResponse, error)
+	// GetIssuedSignatures returns the payment messages we have signed, most recent first
+	GetIssuedSignatures(ctx context.Context, in *IssuedSignaturesRequest, opts ...grpc.CallOption) (*IssuedSignaturesResponse, error)
+}
+
+type payClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewPayClient(cc *grpc.ClientConn) PayClient {
+	return &payClient{cc}
+}
+
+func (c *payClient) GetDepositAddress(ctx context.Context, in *DepositAddressRequest, opts ...grpc.CallOption) (*DepositAddressResponse, error) {
+	out := new(DepositAddressResponse)
+	err := c.cc.Invoke(ctx, "/paypb.Pay/GetDepositAddress", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *payClient) GetTypedSignedMessage(ctx context.Context, in *TypedSignRequest, opts ...grpc.CallOption) (*TypedSignResponse, error) {
+	out := new(TypedSignResponse)
+	err := c.cc.Invoke(ctx, "/paypb.Pay/GetTypedSignedMessage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *payClient) GetIssuedSignatures(ctx context.Context, in *IssuedSignaturesRequest, opts ...grpc.CallOption) (*IssuedSignaturesResponse, error) {
+	out := new(IssuedSignaturesResponse)
+	err := c.cc.Invoke(ctx, "/paypb.Pay/GetIssuedSignatures", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PayServer is the server API for Pay service.
+type PayServer interface {
+	// GetDepositAddress derives a fresh deposit address for a payment
+	GetDepositAddress(context.Context, *DepositAddressRequest) (*DepositAddressResponse, error)
+	// GetTypedSignedMessage signs an EIP-712 typed payment message, which unlike
+	// the messages of Signer.GetSignedMessage is bound to our payment contract
+	// and expires
+	GetTypedSignedMessage(context.Context, *TypedSignRequest) (*TypedSignResponse, error)
+	// GetIssuedSignatures returns the payment messages we have signed, most recent first
+	GetIssuedSignatures(context.Context, *IssuedSignaturesRequest) (*IssuedSignaturesResponse, error)
+}
+
+func RegisterPayServer(s *grpc.Server, srv PayServer) {
+	s.RegisterService(&_Pay_serviceDesc, srv)
+}
+
+func _Pay_GetDepositAddress_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DepositAddressRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PayServer).GetDepositAddress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/paypb.Pay/GetDepositAddress",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PayServer).GetDepositAddress(ctx, req.(*DepositAddressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Pay_GetTypedSignedMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TypedSignRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PayServer).GetTypedSignedMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/paypb.Pay/GetTypedSignedMessage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PayServer).GetTypedSignedMessage(ctx, req.(*TypedSignRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Pay_GetIssuedSignatures_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IssuedSignaturesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PayServer).GetIssuedSignatures(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/paypb.Pay/GetIssuedSignatures",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PayServer).GetIssuedSignatures(ctx, req.(*IssuedSignaturesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Pay_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "paypb.Pay",
+	HandlerType: (*PayServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetDepositAddress",
+			Handler:    _Pay_GetDepositAddress_Handler,
+		},
+		{
+			MethodName: "GetTypedSignedMessage",
+			Handler:    _Pay_GetTypedSignedMessage_Handler,
+		},
+		{
+			MethodName: "GetIssuedSignatures",
+			Handler:    _Pay_GetIssuedSignatures_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "pay.proto",
+}
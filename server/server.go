@@ -2,31 +2,114 @@ package server
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"math"
 	"math/big"
 	"net"
 	"strconv"
 	"sync"
+	"time"
 
+	"github.com/RTradeLtd/Pay/deposit"
+	"github.com/RTradeLtd/Pay/server/paypb"
 	"github.com/RTradeLtd/Pay/signer"
+	"github.com/RTradeLtd/Pay/store"
 	"github.com/RTradeLtd/config/v2"
 	pb "github.com/RTradeLtd/grpc/pay"
 	"github.com/RTradeLtd/grpc/pay/request"
 	"github.com/RTradeLtd/grpc/pay/response"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/jinzhu/gorm"
 	"go.uber.org/zap"
 	context "golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // Server defines our server interface
 type Server struct {
 	PS *signer.PaymentSigner
+	// Derivers are used to derive deposit addresses, keyed by blockchain
+	Derivers map[string]*deposit.Deriver
+	DM       *store.DepositManager
+	// Domain is the EIP-712 domain typed payment messages are signed for
+	Domain signer.TypedDomain
+	// TypedExpiry is the longest time typed payment messages are valid for
+	TypedExpiry time.Duration
+	// Signatures records the payment messages we sign
+	Signatures SignatureStore
+	l          *zap.SugaredLogger
 }
 
+// SignatureStore is used to record the payment messages we sign, and
+// to refuse to sign a payment number again with different details
+type SignatureStore interface {
+	ReservePayment(number, address string, method int64, chargeAmount string) error
+	RecordSignature(sig *store.IssuedSignature) error
+	FindSignatures(filter store.SignatureFilter) ([]store.IssuedSignature, error)
+}
+
+// Opts are used to configure the optional services of our grpc server
+type Opts struct {
+	// XPubs are the account extended public keys used
+	// to derive deposit addresses, keyed by blockchain
+	XPubs map[string]string
+	// DB is used to record signed payment messages and track issued deposit addresses
+	DB      *gorm.DB
+	DevMode bool
+	// Signer selects the signer of payment messages, which must hold
+	// a different key to the one used for our ens transactions
+	Signer signer.Opts
+	// NextSigner selects the key payment messages are signed with from
+	// RotateAt, and is ignored if RotateAt is zero. The payment contract
+	// must accept both keys until RotationOverlap has passed
+	NextSigner      signer.Opts
+	RotateAt        time.Time
+	RotationOverlap time.Duration
+	// Contract is used to check at startup that the
+	// payment contract accepts our payment keys
+	Contract signer.SignerChecker
+	// ENSSigner is the remote signer our ens transactions may be sent
+	// from, which must not hold any of our payment keys
+	ENSSigner signer.Opts
+	// TypedDomain is the EIP-712 domain typed payment messages are signed for.
+	// Its verifying contract defaults to the payment contract in our config,
+	// and typed payment messages aren't signed without it and TypedExpiry
+	TypedDomain signer.TypedDomain
+	// TypedExpiry is the longest time typed payment messages are valid for
+	TypedExpiry time.Duration
+}
+
+const (
+	// ErrSharedPaymentKey is an error used to indicate that no payment key was
+	// configured, which would leave payments signed with our ens key
+	ErrSharedPaymentKey = "a payment signing key separate from the ens key must be configured"
+	// ErrNoPaymentContract is an error used to indicate that we can't
+	// check which keys the payment contract accepts
+	ErrNoPaymentContract = "payment contract is required to check our payment keys"
+	// ErrInvalidTypedDomain is an error used to indicate that typed payment
+	// messages can't be signed as their domain or expiry is not configured
+	ErrInvalidTypedDomain = "typed payment messages require a chain id, verifying contract and expiry"
+	// ErrNoDatabase is an error used to indicate that
+	// we can't record the payment messages we sign
+	ErrNoDatabase = "database is required to record signed payment messages"
+	// ErrENSPaymentKey is an error used to indicate that one of
+	// our payment keys is the key of our ens account
+	ErrENSPaymentKey = "payment signing key must not be the ens account key"
+	// ErrNoENSAccount is an error used to indicate that we can't check
+	// our payment keys differ from our ens account, as it isn't configured
+	ErrNoENSAccount = "ens account address, key file or remote signer is required to check our payment keys"
+)
+
 // RunServer is used to initialize and run our grpc payment server
-func RunServer(ctx context.Context, wg *sync.WaitGroup, cfg config.TemporalConfig, logger *zap.SugaredLogger) error {
+func RunServer(ctx context.Context, wg *sync.WaitGroup, cfg config.TemporalConfig, logger *zap.SugaredLogger, opts Opts) error {
+	if opts.DB == nil {
+		return errors.New(ErrNoDatabase)
+	}
 	url := cfg.Pay.Address + ":" + cfg.Pay.Port
 	lis, err := net.Listen(cfg.Protocol, url)
 	if err != nil {
@@ -42,13 +125,40 @@ func RunServer(ctx context.Context, wg *sync.WaitGroup, cfg config.TemporalConfi
 		return err
 	}
 	// generate our signer
-	s, err := signer.NewPaymentSigner(&cfg)
+	s, err := paymentSigner(ctx, cfg, opts)
 	if err != nil {
 		return err
 	}
-	serverService := &Server{PS: s}
+	logger.Infow("signing payment messages", "address", s.Active().Address().Hex())
+	domain := opts.TypedDomain
+	if domain.VerifyingContract == (common.Address{}) {
+		domain.VerifyingContract = common.HexToAddress(cfg.Ethereum.Contracts.PaymentContractAddress)
+	}
+	serverService := &Server{
+		PS:          s,
+		Derivers:    make(map[string]*deposit.Deriver),
+		Domain:      domain,
+		TypedExpiry: opts.TypedExpiry,
+		Signatures:  store.NewSignatureManager(opts.DB),
+		l:           logger,
+	}
+	for blockchain, xpub := range opts.XPubs {
+		if xpub == "" {
+			continue
+		}
+		d, err := deposit.NewDeriver(blockchain, xpub, opts.DevMode)
+		if err != nil {
+			return err
+		}
+		serverService.Derivers[blockchain] = d
+		serverService.DM = store.NewDepositManager(opts.DB)
+	}
+	if !serverService.typedConfigured() {
+		logger.Warn("typed payment messages disabled: " + ErrInvalidTypedDomain)
+	}
 	gServer := grpc.NewServer(serverOpts...)
 	pb.RegisterSignerServer(gServer, serverService)
+	paypb.RegisterPayServer(gServer, serverService)
 	// allow for graceful closure if context is cancelled
 	wg.Add(1)
 	go func() {
@@ -67,9 +177,112 @@ func RunServer(ctx context.Context, wg *sync.WaitGroup, cfg config.TemporalConfi
 	return gServer.Serve(lis)
 }
 
+// paymentSigner is used to generate our payment signer, checking
+// that the payment contract accepts each of our payment keys, and
+// refusing to start should any of them be the key of our ens account
+func paymentSigner(ctx context.Context, cfg config.TemporalConfig, opts Opts) (*signer.PaymentSigner, error) {
+	if !opts.Signer.Configured() {
+		return nil, errors.New(ErrSharedPaymentKey)
+	}
+	if opts.Contract == nil {
+		return nil, errors.New(ErrNoPaymentContract)
+	}
+	s, err := signer.NewPaymentSignerWithOpts(&cfg, opts.Signer)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.RotateAt.IsZero() {
+		if !opts.NextSigner.Configured() {
+			return nil, errors.New(ErrSharedPaymentKey)
+		}
+		next, err := signer.New(&cfg, opts.NextSigner)
+		if err != nil {
+			return nil, err
+		}
+		s.Rotation = &signer.Rotation{Next: next, At: opts.RotateAt, Overlap: opts.RotationOverlap}
+	}
+	accounts, err := ensAccounts(cfg, opts.ENSSigner)
+	if err != nil {
+		return nil, err
+	}
+	keys := []signer.Signer{s.Signer}
+	if s.Rotation != nil {
+		keys = append(keys, s.Rotation.Next)
+	}
+	for _, key := range keys {
+		for _, ens := range accounts {
+			if key.Address() == ens {
+				return nil, fmt.Errorf("%s %s", ErrENSPaymentKey, ens.Hex())
+			}
+		}
+	}
+	if err := s.CheckAccepted(ctx, opts.Contract); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ensAccounts is used to find the addresses our ens transactions may be sent
+// from, being the account in our config and the account of our remote signer.
+// Key files are never decrypted, as their address is stored alongside the key
+func ensAccounts(cfg config.TemporalConfig, remote signer.Opts) ([]common.Address, error) {
+	var accounts []common.Address
+	account := cfg.Ethereum.Account
+	switch {
+	case account.Address != "":
+		if !common.IsHexAddress(account.Address) {
+			return nil, errors.New(ErrNoENSAccount)
+		}
+		accounts = append(accounts, common.HexToAddress(account.Address))
+	case account.KeyFile != "":
+		address, err := keyFileAddress(account.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, address)
+	}
+	switch {
+	case remote.RemoteAccount != "":
+		if !common.IsHexAddress(remote.RemoteAccount) {
+			return nil, errors.New(ErrNoENSAccount)
+		}
+		accounts = append(accounts, common.HexToAddress(remote.RemoteAccount))
+	case remote.RemoteURL != "":
+		// the remote signer defaults to its first account
+		rs, err := signer.NewRemoteSigner(remote.RemoteURL, "")
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, rs.Address())
+		rs.Close()
+	}
+	if len(accounts) == 0 {
+		return nil, errors.New(ErrNoENSAccount)
+	}
+	return accounts, nil
+}
+
+// keyFileAddress is used to read the address of a key file as generated by geth
+func keyFileAddress(keyFile string) (common.Address, error) {
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return common.Address{}, err
+	}
+	var key struct {
+		Address string `json:"address"`
+	}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return common.Address{}, err
+	}
+	if !common.IsHexAddress(key.Address) {
+		return common.Address{}, errors.New(ErrNoENSAccount)
+	}
+	return common.HexToAddress(key.Address), nil
+}
+
 // GetSignedMessage allows the caller (client) to request a signed message
 func (s *Server) GetSignedMessage(ctx context.Context, req *request.SignRequest) (*response.SignResponse, error) {
-	fmt.Println("message received, processing...")
+	s.l.Infow("payment message requested", "address", req.Address, "number", req.Number)
 	addr := req.Address
 	method := req.Method
 	number := req.Number
@@ -87,12 +300,26 @@ func (s *Server) GetSignedMessage(ctx context.Context, req *request.SignRequest)
 	if !valid {
 		return nil, errors.New("failed to convert charge amount from string to big int")
 	}
-	fmt.Println("signing payment message")
+	if err := s.reservePayment(addrTyped, methodUint8, numberBig, chargeAmountBig); err != nil {
+		return nil, err
+	}
 	msg, err := s.PS.GenerateSignedPaymentMessagePrefixed(
 		addrTyped, methodUint8, numberBig, chargeAmountBig,
 	)
 	if err != nil {
-		fmt.Println("failed to generate signed payment message ", err.Error())
+		s.l.Errorw("failed to generate signed payment message", "number", number, "error", err.Error())
+		return nil, err
+	}
+	if err := s.Signatures.RecordSignature(&store.IssuedSignature{
+		PaymentNumber: numberBig.String(),
+		Address:       addrTyped.Hex(),
+		Method:        int64(methodUint8),
+		ChargeAmount:  chargeAmountBig.String(),
+		Mode:          store.SignaturePrefixed.String(),
+		Signer:        s.PS.Active().Address().Hex(),
+		Hash:          hex.EncodeToString(msg.H[:]),
+		IssuedAt:      time.Now(),
+	}); err != nil {
 		return nil, err
 	}
 	hEncoded := hex.EncodeToString(msg.H[:])
@@ -110,6 +337,145 @@ func (s *Server) GetSignedMessage(ctx context.Context, req *request.SignRequest)
 		Hash:    hashEncoded,
 		Sig:     sigEncoded,
 	}
-	fmt.Println("processing finished")
+	s.l.Infow("signed payment message", "number", number)
 	return res, nil
 }
+
+// GetDepositAddress allows the caller (client) to request a fresh deposit address for a payment
+func (s *Server) GetDepositAddress(ctx context.Context, req *paypb.DepositAddressRequest) (*paypb.DepositAddressResponse, error) {
+	d, ok := s.Derivers[req.GetBlockchain()]
+	if !ok {
+		return nil, fmt.Errorf("deposit addresses not supported for blockchain %s", req.GetBlockchain())
+	}
+	if req.GetUserName() == "" {
+		return nil, errors.New("user name must be provided")
+	}
+	addr, err := s.DM.NewAddress(d, req.GetUserName(), req.GetPaymentNumber())
+	if err != nil {
+		return nil, err
+	}
+	return &paypb.DepositAddressResponse{
+		Address: addr.Address,
+		Index:   uint32(addr.DerivationIndex),
+	}, nil
+}
+
+// GetTypedSignedMessage allows the caller (client) to request a signed EIP-712 typed payment message
+func (s *Server) GetTypedSignedMessage(ctx context.Context, req *paypb.TypedSignRequest) (*paypb.TypedSignResponse, error) {
+	if !s.typedConfigured() {
+		return nil, status.Error(codes.FailedPrecondition, ErrInvalidTypedDomain)
+	}
+	if !common.IsHexAddress(req.GetAddress()) {
+		return nil, errors.New("invalid payer address")
+	}
+	if req.GetPaymentMethod() > math.MaxUint8 {
+		return nil, errors.New("invalid payment method")
+	}
+	numberBig, valid := new(big.Int).SetString(req.GetPaymentNumber(), 10)
+	if !valid {
+		return nil, errors.New("failed to convert payment number to big int")
+	}
+	chargeAmountBig, valid := new(big.Int).SetString(req.GetChargeAmount(), 10)
+	if !valid {
+		return nil, errors.New("failed to convert charge amount from string to big int")
+	}
+	expiresIn := s.TypedExpiry
+	if req.GetExpiresIn() < 0 {
+		return nil, errors.New("expiry must not be negative")
+	}
+	if requested := time.Duration(req.GetExpiresIn()) * time.Second; requested > 0 && requested < expiresIn {
+		expiresIn = requested
+	}
+	addrTyped, method := common.HexToAddress(req.GetAddress()), uint8(req.GetPaymentMethod())
+	if err := s.reservePayment(addrTyped, method, numberBig, chargeAmountBig); err != nil {
+		return nil, err
+	}
+	msg, err := s.PS.GenerateTypedPaymentMessage(
+		s.Domain, addrTyped, method, numberBig, chargeAmountBig, time.Now().Add(expiresIn),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Signatures.RecordSignature(&store.IssuedSignature{
+		PaymentNumber: numberBig.String(),
+		Address:       addrTyped.Hex(),
+		Method:        int64(method),
+		ChargeAmount:  chargeAmountBig.String(),
+		Mode:          store.SignatureTyped.String(),
+		Signer:        msg.Signer.Hex(),
+		Hash:          hex.EncodeToString(msg.H[:]),
+		IssuedAt:      time.Now(),
+		ExpiresAt:     &msg.Expiry,
+	}); err != nil {
+		return nil, err
+	}
+	return &paypb.TypedSignResponse{
+		Hash:              hex.EncodeToString(msg.H[:]),
+		R:                 hex.EncodeToString(msg.R[:]),
+		S:                 hex.EncodeToString(msg.S[:]),
+		V:                 uint32(msg.V),
+		Sig:               hex.EncodeToString(msg.Sig),
+		Signer:            msg.Signer.Hex(),
+		Expiry:            msg.Expiry.Unix(),
+		Name:              msg.Domain.Name,
+		Version:           msg.Domain.Version,
+		ChainId:           msg.Domain.ChainID.String(),
+		VerifyingContract: msg.Domain.VerifyingContract.Hex(),
+	}, nil
+}
+
+// typedConfigured is used to check that we have the domain
+// and expiry needed to sign typed payment messages
+func (s *Server) typedConfigured() bool {
+	return s.Domain.ChainID != nil && s.Domain.ChainID.Sign() > 0 &&
+		s.Domain.VerifyingContract != (common.Address{}) && s.TypedExpiry > 0
+}
+
+// GetIssuedSignatures allows the caller (client) to audit the payment messages we have signed
+func (s *Server) GetIssuedSignatures(ctx context.Context, req *paypb.IssuedSignaturesRequest) (*paypb.IssuedSignaturesResponse, error) {
+	filter := store.SignatureFilter{Limit: int(req.GetLimit())}
+	if req.GetPaymentNumber() != "" {
+		numberBig, valid := new(big.Int).SetString(req.GetPaymentNumber(), 10)
+		if !valid {
+			return nil, errors.New("failed to convert payment number to big int")
+		}
+		filter.PaymentNumber = numberBig.String()
+	}
+	if req.GetAddress() != "" {
+		if !common.IsHexAddress(req.GetAddress()) {
+			return nil, errors.New("invalid payer address")
+		}
+		filter.Address = common.HexToAddress(req.GetAddress()).Hex()
+	}
+	if req.GetSince() > 0 {
+		filter.Since = time.Unix(req.GetSince(), 0)
+	}
+	sigs, err := s.Signatures.FindSignatures(filter)
+	if err != nil {
+		return nil, err
+	}
+	res := &paypb.IssuedSignaturesResponse{}
+	for _, sig := range sigs {
+		issued := &paypb.IssuedSignature{
+			PaymentNumber: sig.PaymentNumber,
+			Address:       sig.Address,
+			PaymentMethod: uint32(sig.Method),
+			ChargeAmount:  sig.ChargeAmount,
+			Mode:          sig.Mode,
+			Signer:        sig.Signer,
+			Hash:          sig.Hash,
+			IssuedAt:      sig.IssuedAt.Unix(),
+		}
+		if sig.ExpiresAt != nil {
+			issued.Expiry = sig.ExpiresAt.Unix()
+		}
+		res.Signatures = append(res.Signatures, issued)
+	}
+	return res, nil
+}
+
+// reservePayment is used to bind a payment number to the details we are about
+// to sign it with, refusing to sign it again with a different address or amount
+func (s *Server) reservePayment(address common.Address, method uint8, number, chargeAmount *big.Int) error {
+	return s.Signatures.ReservePayment(number.String(), address.Hex(), int64(method), chargeAmount.String())
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/Pay/server/paypb"
+	"github.com/RTradeLtd/Pay/signer"
+	"github.com/RTradeLtd/Pay/store"
+	"github.com/RTradeLtd/config/v2"
+	"github.com/RTradeLtd/grpc/pay/request"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"go.uber.org/zap"
+	context "golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeSignatures are the signed payments, keyed by their payment number, and the issued signatures
+type fakeSignatures struct {
+	payments map[string]store.SignedPayment
+	issued   []store.IssuedSignature
+}
+
+func (fs *fakeSignatures) ReservePayment(number, address string, method int64, chargeAmount string) error {
+	if p, ok := fs.payments[number]; ok {
+		if p.Address != address || p.Method != method || p.ChargeAmount != chargeAmount {
+			return errors.New(store.ErrPaymentMismatch)
+		}
+		return nil
+	}
+	fs.payments[number] = store.SignedPayment{Number: number, Address: address, Method: method, ChargeAmount: chargeAmount}
+	return nil
+}
+
+func (fs *fakeSignatures) RecordSignature(sig *store.IssuedSignature) error {
+	fs.issued = append(fs.issued, *sig)
+	return nil
+}
+
+func (fs *fakeSignatures) FindSignatures(filter store.SignatureFilter) ([]store.IssuedSignature, error) {
+	var sigs []store.IssuedSignature
+	for i := len(fs.issued) - 1; i >= 0; i-- {
+		if filter.PaymentNumber == "" || fs.issued[i].PaymentNumber == filter.PaymentNumber {
+			sigs = append(sigs, fs.issued[i])
+		}
+	}
+	return sigs, nil
+}
+
+func newTestServer(t *testing.T) *Server {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Server{
+		PS: &signer.PaymentSigner{Signer: signer.NewKeySigner(key)},
+		Domain: signer.TypedDomain{
+			Name: "Pay", Version: "1", ChainID: big.NewInt(1), VerifyingContract: common.HexToAddress("0x3"),
+		},
+		TypedExpiry: time.Hour,
+		Signatures:  &fakeSignatures{payments: make(map[string]store.SignedPayment)},
+		l:           zap.NewNop().Sugar(),
+	}
+}
+
+func TestServer_Signatures(t *testing.T) {
+	s := newTestServer(t)
+	payer := common.HexToAddress("0x2").Hex()
+	if _, err := s.GetSignedMessage(context.Background(), &request.SignRequest{
+		Address: payer, Method: "0", Number: "1", ChargeAmount: "100",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// the same payment may be signed again, in either mode
+	if _, err := s.GetTypedSignedMessage(context.Background(), &paypb.TypedSignRequest{
+		Address: payer, PaymentMethod: 0, PaymentNumber: "1", ChargeAmount: "100", ExpiresIn: 60,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		req  *request.SignRequest
+	}{
+		{"Amount", &request.SignRequest{Address: payer, Method: "0", Number: "1", ChargeAmount: "1"}},
+		{"Address", &request.SignRequest{Address: common.HexToAddress("0x4").Hex(), Method: "0", Number: "1", ChargeAmount: "100"}},
+		{"Method", &request.SignRequest{Address: payer, Method: "1", Number: "1", ChargeAmount: "100"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.GetSignedMessage(context.Background(), tt.req); err == nil || err.Error() != store.ErrPaymentMismatch {
+				t.Fatalf("GetSignedMessage() error = %v, wantErr %v", err, store.ErrPaymentMismatch)
+			}
+		})
+	}
+	res, err := s.GetIssuedSignatures(context.Background(), &paypb.IssuedSignaturesRequest{PaymentNumber: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.GetSignatures()) != 2 {
+		t.Fatalf("GetIssuedSignatures() returned %v signatures, want 2", len(res.GetSignatures()))
+	}
+	typed := res.GetSignatures()[0]
+	if typed.GetMode() != store.SignatureTyped.String() || typed.GetExpiry() == 0 || typed.GetAddress() != payer {
+		t.Fatalf("unexpected typed signature %v", typed)
+	}
+	if prefixed := res.GetSignatures()[1]; prefixed.GetMode() != store.SignaturePrefixed.String() || prefixed.GetExpiry() != 0 {
+		t.Fatalf("unexpected prefixed signature %v", prefixed)
+	}
+}
+
+func TestServer_TypedUnconfigured(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(s *Server)
+	}{
+		{"ChainID", func(s *Server) { s.Domain.ChainID = nil }},
+		{"ZeroChainID", func(s *Server) { s.Domain.ChainID = big.NewInt(0) }},
+		{"VerifyingContract", func(s *Server) { s.Domain.VerifyingContract = common.Address{} }},
+		{"Expiry", func(s *Server) { s.TypedExpiry = 0 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			tt.modify(s)
+			_, err := s.GetTypedSignedMessage(context.Background(), &paypb.TypedSignRequest{
+				Address: common.HexToAddress("0x2").Hex(), PaymentMethod: 0, PaymentNumber: "1", ChargeAmount: "100",
+			})
+			if status.Code(err) != codes.FailedPrecondition {
+				t.Fatalf("GetTypedSignedMessage() error = %v, want %v", err, codes.FailedPrecondition)
+			}
+			// prefixed payment messages are still signed
+			if _, err := s.GetSignedMessage(context.Background(), &request.SignRequest{
+				Address: common.HexToAddress("0x2").Hex(), Method: "0", Number: "1", ChargeAmount: "100",
+			}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+type fakeChecker struct{}
+
+func (fc fakeChecker) PaymentSignerAccepted(ctx context.Context, address common.Address) (bool, error) {
+	return true, nil
+}
+
+// newTestKeyFile is used to write a key file as generated by geth, returning its path and address
+func newTestKeyFile(t *testing.T, dir string) (string, common.Address) {
+	pk, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP).ImportECDSA(pk, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return account.URL.Path, account.Address
+}
+
+func Test_PaymentSigner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pay-keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	paymentKey, paymentAddress := newTestKeyFile(t, dir)
+	nextKey, nextAddress := newTestKeyFile(t, dir)
+	ensKey, _ := newTestKeyFile(t, dir)
+	tests := []struct {
+		name       string
+		ensAddress string
+		ensKey     string
+		ensRemote  string
+		wantErr    string
+	}{
+		{"Separate", "", ensKey, "", ""},
+		{"SeparateAddress", common.HexToAddress("0x1").Hex(), "", "", ""},
+		{"SeparateRemote", "", ensKey, common.HexToAddress("0x1").Hex(), ""},
+		{"ActiveAddress", paymentAddress.Hex(), "", "", ErrENSPaymentKey + " " + paymentAddress.Hex()},
+		{"ActiveKeyFile", "", paymentKey, "", ErrENSPaymentKey + " " + paymentAddress.Hex()},
+		{"NextKeyFile", "", nextKey, "", ErrENSPaymentKey + " " + nextAddress.Hex()},
+		{"ActiveRemote", "", ensKey, paymentAddress.Hex(), ErrENSPaymentKey + " " + paymentAddress.Hex()},
+		{"NextRemote", "", "", nextAddress.Hex(), ErrENSPaymentKey + " " + nextAddress.Hex()},
+		{"InvalidAddress", "ens", "", "", ErrNoENSAccount},
+		{"InvalidRemote", "", ensKey, "ens", ErrNoENSAccount},
+		{"Unconfigured", "", "", "", ErrNoENSAccount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg config.TemporalConfig
+			cfg.Ethereum.Account.Address = tt.ensAddress
+			cfg.Ethereum.Account.KeyFile = tt.ensKey
+			// the ens key file is never decrypted
+			cfg.Ethereum.Account.KeyPass = "wrong"
+			var ensSigner signer.Opts
+			if tt.ensRemote != "" {
+				ensSigner = signer.Opts{RemoteURL: "unused", RemoteAccount: tt.ensRemote}
+			}
+			_, err := paymentSigner(context.Background(), cfg, Opts{
+				Signer:     signer.Opts{KeyFile: paymentKey, KeyPass: "password"},
+				ENSSigner:  ensSigner,
+				NextSigner: signer.Opts{KeyFile: nextKey, KeyPass: "password"},
+				RotateAt:   time.Now().Add(time.Hour),
+				Contract:   fakeChecker{},
+			})
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Fatalf("paymentSigner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+// Package settings provides the configuration of Pay's own services. It is read from
+// the "pay_services" section of the Temporal configuration file, alongside the
+// TemporalConfig shared with the rest of Temporal
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"time"
+)
+
+// Settings configures the services run by Pay
+type Settings struct {
+	// AdminEmail is notified of reversed payments and expiring ens names,
+	// defaulting to the sendgrid sender address
+	AdminEmail string   `json:"admin_email"`
+	Nodes      Nodes    `json:"nodes"`
+	Dash       Dash     `json:"dash"`
+	XPubs      XPubs    `json:"xpubs"`
+	Reorg      Reorg    `json:"reorg"`
+	Ethereum   Ethereum `json:"ethereum"`
+	ENS        ENS      `json:"ens"`
+	Signer     Signer   `json:"signer"`
+}
+
+// Nodes configures the blockchain nodes payments are verified against
+type Nodes struct {
+	// BTC is the json-rpc url of a bitcoind node, including credentials
+	BTC string `json:"btc_rpc"`
+}
+
+// Dash configures the backend dash payments are verified through. Payment
+// forwards are always managed through chainrider, with the api key of the
+// TemporalConfig
+type Dash struct {
+	// Backend is either chainrider or dashd, defaulting to chainrider
+	Backend string `json:"backend"`
+	// RPC is the json-rpc url of our dashd node, including
+	// credentials, and is required by the dashd backend
+	RPC string `json:"rpc"`
+}
+
+// XPubs are the account extended public keys deposit addresses are derived from
+type XPubs struct {
+	BCH  string `json:"bch"`
+	BTC  string `json:"btc"`
+	DASH string `json:"dash"`
+}
+
+// Reorg configures the watcher of confirmed payments for reorgs
+type Reorg struct {
+	// Window is how long confirmed payments are watched for, 0 to disable
+	Window Duration `json:"window"`
+	// Interval is the time between checks of confirmed payments
+	Interval Duration `json:"interval"`
+	// MissingChecks is the number of consecutive checks which must
+	// find a transaction missing before its payment is reversed
+	MissingChecks int `json:"missing_checks"`
+}
+
+// Ethereum configures the pricing and replacement of our ens transactions
+type Ethereum struct {
+	// GasOracle is either node or percentile, defaulting to node
+	GasOracle string `json:"gas_oracle"`
+	// GasBlocks and GasPercentile configure the percentile gas price oracle
+	GasBlocks     int `json:"gas_blocks"`
+	GasPercentile int `json:"gas_percentile"`
+	// GasFloor and GasCeiling bound gas prices in gwei, 0 to disable
+	GasFloor   uint64 `json:"gas_floor_gwei"`
+	GasCeiling uint64 `json:"gas_ceiling_gwei"`
+	// TxTimeout is the time waited for a transaction to be mined before speeding it up
+	TxTimeout Duration `json:"tx_timeout"`
+	// TxBump is the percentage the gas price of a stuck transaction is increased by
+	TxBump int64 `json:"tx_bump_percent"`
+	// TxAttempts is the number of attempts at mining a transaction before cancelling it
+	TxAttempts int `json:"tx_attempts"`
+	// Signer selects a remote signer holding our ens key,
+	// in place of the key file in the TemporalConfig
+	Signer RemoteSigner `json:"signer"`
+}
+
+// ENS configures the processing of ens requests
+type ENS struct {
+	// RenewInterval is the time between checks of ens names for expiry, 0 to disable
+	RenewInterval Duration `json:"renew_interval"`
+	// RenewWarning is how long before expiry the owner of an ens name is emailed
+	RenewWarning Duration `json:"renew_warning"`
+	// AutoRenew renews names about to expire, charging RenewCredits for each renewal
+	AutoRenew    bool    `json:"auto_renew"`
+	RenewCredits float64 `json:"renew_credits"`
+	// RegisterCredits is charged for each .eth name registration,
+	// and names can't be registered unless it is positive
+	RegisterCredits float64 `json:"register_credits"`
+	// BatchWindow is the time requests are collected for before being
+	// submitted as a batch, 0 to disable
+	BatchWindow Duration `json:"batch_window"`
+	// BatchSize is the number of requests which submits a batch early,
+	// at most the consumer prefetch of 10
+	BatchSize int `json:"batch_size"`
+}
+
+// Signer configures the keys payment messages are signed with, which
+// must be separate from the ens key in the TemporalConfig
+type Signer struct {
+	Key Key `json:"key"`
+	// Next is the key payment messages are signed with from RotateAt,
+	// an RFC3339 time. Rotation is disabled if RotateAt is empty
+	Next     Key    `json:"next"`
+	RotateAt string `json:"rotate_at"`
+	// RotateOverlap is the time after rotating that the
+	// payment contract must still accept the previous key
+	RotateOverlap Duration `json:"rotate_overlap"`
+	Typed         Typed    `json:"typed"`
+}
+
+// Key selects a signing key, held either by a remote signer or in a key file
+type Key struct {
+	RemoteSigner
+	// KeyFile and KeyPass are a key file as generated by geth and its
+	// password, used when no remote signer is given
+	KeyFile string `json:"key_file"`
+	KeyPass string `json:"key_pass"`
+}
+
+// RemoteSigner selects an account of a clef compatible remote signer
+type RemoteSigner struct {
+	// URL is the endpoint of the signer, such as its ipc socket
+	URL string `json:"url"`
+	// Account defaults to the first account of the signer
+	Account string `json:"account"`
+}
+
+// Typed configures the EIP-712 domain and expiry of typed payment messages
+type Typed struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	ChainID int64  `json:"chain_id"`
+	// VerifyingContract defaults to the payment contract in the TemporalConfig
+	VerifyingContract string `json:"verifying_contract"`
+	// Expiry is the longest time typed payment messages are valid for
+	Expiry Duration `json:"expiry"`
+}
+
+// Duration is a time.Duration given in configuration as a string, such as "15s"
+type Duration time.Duration
+
+// Duration returns d as a time.Duration
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+// MarshalJSON encodes d as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes d from a string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.New("durations must be given as a string, such as \"15s\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Load is used to load our settings from the "pay_services" section of the
+// Temporal configuration file at configPath, with defaults for unset fields
+func Load(configPath string) (*Settings, error) {
+	raw, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Settings *Settings `json:"pay_services"`
+	}
+	file.Settings = Default()
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, err
+	}
+	return file.Settings, nil
+}
+
+// Default returns our default settings
+func Default() *Settings {
+	return &Settings{
+		Dash: Dash{Backend: "chainrider"},
+		Reorg: Reorg{
+			Window:        Duration(time.Hour * 24),
+			Interval:      Duration(time.Minute * 10),
+			MissingChecks: 3,
+		},
+		Ethereum: Ethereum{
+			GasBlocks:     20,
+			GasPercentile: 60,
+			TxTimeout:     Duration(time.Minute * 5),
+			TxBump:        20,
+			TxAttempts:    3,
+		},
+		ENS: ENS{
+			RenewInterval: Duration(time.Hour * 24),
+			RenewWarning:  Duration(time.Hour * 24 * 30),
+			BatchWindow:   Duration(time.Second * 15),
+			BatchSize:     10,
+		},
+		Signer: Signer{
+			RotateOverlap: Duration(time.Hour * 24 * 7),
+			Typed: Typed{
+				Name:    "RTrade Pay",
+				Version: "1",
+				ChainID: 1,
+				Expiry:  Duration(time.Hour),
+			},
+		},
+	}
+}
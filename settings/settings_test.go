@@ -0,0 +1,40 @@
+package settings
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+const cfgPath = "../test/config.json"
+
+func TestLoad(t *testing.T) {
+	s, err := Load(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// given settings override the defaults
+	if s.Signer.Key.KeyFile == "" || s.Signer.Typed.ChainID != 4 {
+		t.Fatalf("unexpected signer settings %+v", s.Signer)
+	}
+	// while unset settings keep them
+	if s.Signer.Typed.Expiry.Duration() != time.Hour || s.ENS.RenewWarning.Duration() != time.Hour*24*30 {
+		t.Fatalf("defaults were not kept, got %+v", s)
+	}
+	if _, err := Load("./doesnotexist.json"); err == nil {
+		t.Fatal("expected error loading missing config")
+	}
+}
+
+func TestDuration(t *testing.T) {
+	var d Duration
+	if err := json.Unmarshal([]byte(`"90s"`), &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Duration() != time.Second*90 {
+		t.Fatalf("Duration() = %v, want 90s", d.Duration())
+	}
+	if err := json.Unmarshal([]byte(`90`), &d); err == nil {
+		t.Fatal("expected error decoding duration given as a number")
+	}
+}
@@ -0,0 +1,105 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"io/ioutil"
+
+	"github.com/RTradeLtd/config/v2"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core"
+)
+
+// Signer is used to sign with a key which need not be held by our process.
+// Signatures are 65 bytes in the [R || S || V] format, with V of 0 or 1
+type Signer interface {
+	// Address returns the address of the signing key
+	Address() common.Address
+	// SignText signs data prefixed with "\x19Ethereum Signed Message:\n" and its length
+	SignText(data []byte) ([]byte, error)
+	// SignTx signs a transaction. Remote signers may sign using the chain
+	// they are configured with, rather than the given transaction signer
+	SignTx(signer types.Signer, tx *types.Transaction) (*types.Transaction, error)
+	// SignTypedData signs the EIP-712 digest of typed data
+	SignTypedData(data core.TypedData) ([]byte, error)
+}
+
+// Opts is used to select the signer holding our key
+type Opts struct {
+	// RemoteURL is the endpoint of a clef compatible signer, such as the path
+	// of its ipc socket. When empty, a key file is decrypted instead
+	RemoteURL string
+	// RemoteAccount is the account of the remote signer to sign with,
+	// defaulting to the first account it lists
+	RemoteAccount string
+	// KeyFile and KeyPass are a key file as generated by geth and its
+	// password, used in place of the key file in our config
+	KeyFile string
+	KeyPass string
+}
+
+// Configured returns whether opts select a key other than the one in our config
+func (o Opts) Configured() bool {
+	return o.RemoteURL != "" || o.KeyFile != ""
+}
+
+// New is used to create the signer selected by opts
+func New(cfg *config.TemporalConfig, opts Opts) (Signer, error) {
+	if opts.RemoteURL != "" {
+		return NewRemoteSigner(opts.RemoteURL, opts.RemoteAccount)
+	}
+	if opts.KeyFile != "" {
+		return NewKeystoreSigner(opts.KeyFile, opts.KeyPass)
+	}
+	return NewKeystoreSigner(cfg.Ethereum.Account.KeyFile, cfg.Ethereum.Account.KeyPass)
+}
+
+// KeySigner is a Signer holding its private key in memory
+type KeySigner struct {
+	key *ecdsa.PrivateKey
+}
+
+// NewKeySigner is used to create a signer from a private key
+func NewKeySigner(key *ecdsa.PrivateKey) *KeySigner {
+	return &KeySigner{key: key}
+}
+
+// NewKeystoreSigner is used to create a signer from a key file as generated by geth
+func NewKeystoreSigner(keyFile, keyPass string) (*KeySigner, error) {
+	fileBytes, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := keystore.DecryptKey(fileBytes, keyPass)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeySigner(pk.PrivateKey), nil
+}
+
+// Address returns the address of our key
+func (ks *KeySigner) Address() common.Address {
+	return crypto.PubkeyToAddress(ks.key.PublicKey)
+}
+
+// SignText signs data with the ethereum signed message prefix
+func (ks *KeySigner) SignText(data []byte) ([]byte, error) {
+	return crypto.Sign(accounts.TextHash(data), ks.key)
+}
+
+// SignTx signs a transaction with the given transaction signer
+func (ks *KeySigner) SignTx(signer types.Signer, tx *types.Transaction) (*types.Transaction, error) {
+	return types.SignTx(tx, signer, ks.key)
+}
+
+// SignTypedData signs the EIP-712 digest of typed data
+func (ks *KeySigner) SignTypedData(data core.TypedData) ([]byte, error) {
+	hash, err := TypedDataHash(data)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Sign(hash, ks.key)
+}
@@ -0,0 +1,186 @@
+package signer
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core"
+)
+
+const (
+	// ErrNoRemoteAccounts is an error used to indicate that
+	// a remote signer has no accounts for us to sign with
+	ErrNoRemoteAccounts = "remote signer has no accounts"
+	// ErrRemoteAccountNotFound is an error used to indicate that the
+	// account we were configured with isn't held by the remote signer
+	ErrRemoteAccountNotFound = "account not held by remote signer"
+	// ErrBadRemoteSignature is an error used to indicate that
+	// a remote signer returned a malformed signature
+	ErrBadRemoteSignature = "remote signer returned a malformed signature"
+	// ErrRemoteTxMismatch is an error used to indicate that a remote
+	// signer returned a different transaction to the one we asked it to sign
+	ErrRemoteTxMismatch = "remote signer signed a different transaction"
+)
+
+// remoteTimeout is how long we wait on each request to a remote signer,
+// which may require approval before responding
+var remoteTimeout = time.Minute * 2
+
+// RemoteSigner is a Signer whose key is held by a clef compatible signer,
+// so that it never enters our process. Requests are made to the signer's
+// external api, and may need to be approved by its rules or operator
+type RemoteSigner struct {
+	client  *rpc.Client
+	account common.Address
+}
+
+// remoteTxArgs are the transaction fields sent to account_signTransaction
+type remoteTxArgs struct {
+	From     common.Address  `json:"from"`
+	To       *common.Address `json:"to"`
+	Gas      hexutil.Uint64  `json:"gas"`
+	GasPrice hexutil.Big     `json:"gasPrice"`
+	Value    hexutil.Big     `json:"value"`
+	Nonce    hexutil.Uint64  `json:"nonce"`
+	Data     *hexutil.Bytes  `json:"data"`
+}
+
+// remoteTxResult is the response of account_signTransaction
+type remoteTxResult struct {
+	Raw hexutil.Bytes `json:"raw"`
+}
+
+// NewRemoteSigner is used to connect to a clef compatible signer, such as through
+// the path of its ipc socket, signing with the given account or, if empty, the
+// first account it lists
+func NewRemoteSigner(url, account string) (*RemoteSigner, error) {
+	client, err := rpc.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := newRemoteSigner(client, account)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return rs, nil
+}
+
+// newRemoteSigner is used to select the account of a remote signer to sign with
+func newRemoteSigner(client *rpc.Client, account string) (*RemoteSigner, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), remoteTimeout)
+	defer cancel()
+	var listed []common.Address
+	if err := client.CallContext(ctx, &listed, "account_list"); err != nil {
+		return nil, err
+	}
+	if len(listed) == 0 {
+		return nil, errors.New(ErrNoRemoteAccounts)
+	}
+	if account == "" {
+		return &RemoteSigner{client: client, account: listed[0]}, nil
+	}
+	for _, addr := range listed {
+		if addr == common.HexToAddress(account) {
+			return &RemoteSigner{client: client, account: addr}, nil
+		}
+	}
+	return nil, errors.New(ErrRemoteAccountNotFound)
+}
+
+// Address returns the address of the remote account we sign with
+func (rs *RemoteSigner) Address() common.Address {
+	return rs.account
+}
+
+// SignText signs data with the ethereum signed message prefix, which
+// the remote signer applies to data signed as text/plain
+func (rs *RemoteSigner) SignText(data []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), remoteTimeout)
+	defer cancel()
+	var sig hexutil.Bytes
+	if err := rs.client.CallContext(
+		ctx, &sig, "account_signData", "text/plain", rs.account, hexutil.Bytes(data),
+	); err != nil {
+		return nil, err
+	}
+	return normalizeSignature(sig)
+}
+
+// SignTx signs a transaction with the remote signer, which signs
+// for the chain it is configured with rather than the given signer
+func (rs *RemoteSigner) SignTx(signer types.Signer, tx *types.Transaction) (*types.Transaction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), remoteTimeout)
+	defer cancel()
+	data := hexutil.Bytes(tx.Data())
+	args := remoteTxArgs{
+		From:     rs.account,
+		Gas:      hexutil.Uint64(tx.Gas()),
+		GasPrice: hexutil.Big(*tx.GasPrice()),
+		Value:    hexutil.Big(*tx.Value()),
+		Nonce:    hexutil.Uint64(tx.Nonce()),
+		To:       tx.To(),
+		Data:     &data,
+	}
+	var res remoteTxResult
+	if err := rs.client.CallContext(ctx, &res, "account_signTransaction", args); err != nil {
+		return nil, err
+	}
+	signed := new(types.Transaction)
+	if err := rlp.DecodeBytes(res.Raw, signed); err != nil {
+		return nil, err
+	}
+	// the signer's rules or operator may have modified the transaction
+	if signed.Nonce() != tx.Nonce() || signed.Gas() != tx.Gas() || signed.GasPrice().Cmp(tx.GasPrice()) != 0 ||
+		signed.Value().Cmp(tx.Value()) != 0 || !sameRecipient(signed.To(), tx.To()) ||
+		string(signed.Data()) != string(tx.Data()) {
+		return nil, errors.New(ErrRemoteTxMismatch)
+	}
+	return signed, nil
+}
+
+// SignTypedData signs the EIP-712 digest of typed data with the remote signer,
+// which is able to display the typed fields for approval
+func (rs *RemoteSigner) SignTypedData(data core.TypedData) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), remoteTimeout)
+	defer cancel()
+	var sig hexutil.Bytes
+	if err := rs.client.CallContext(ctx, &sig, "account_signTypedData", rs.account, data); err != nil {
+		return nil, err
+	}
+	return normalizeSignature(sig)
+}
+
+// Close is used to close our connection to the remote signer
+func (rs *RemoteSigner) Close() {
+	rs.client.Close()
+}
+
+// normalizeSignature is used to convert a signature with a V of 27 or 28 to one of 0 or 1
+func normalizeSignature(sig []byte) ([]byte, error) {
+	if len(sig) != 65 {
+		return nil, errors.New(ErrBadRemoteSignature)
+	}
+	sig = append([]byte(nil), sig...)
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	if sig[64] > 1 {
+		return nil, errors.New(ErrBadRemoteSignature)
+	}
+	return sig, nil
+}
+
+// sameRecipient returns whether two transactions are sent to the same address
+func sameRecipient(a, b *common.Address) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,144 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core"
+)
+
+// fakeClef is a local stand-in for the external api of clef
+type fakeClef struct {
+	key     *ecdsa.PrivateKey
+	chainID *big.Int
+}
+
+func (fc *fakeClef) List() []common.Address {
+	return []common.Address{crypto.PubkeyToAddress(fc.key.PublicKey)}
+}
+
+func (fc *fakeClef) SignData(contentType string, addr common.MixedcaseAddress, data hexutil.Bytes) (hexutil.Bytes, error) {
+	sig, err := crypto.Sign(accounts.TextHash(data), fc.key)
+	if err != nil {
+		return nil, err
+	}
+	// clef returns text signatures with a V of 27 or 28
+	sig[64] += 27
+	return sig, nil
+}
+
+func (fc *fakeClef) SignTypedData(addr common.MixedcaseAddress, data core.TypedData) (hexutil.Bytes, error) {
+	hash, err := TypedDataHash(data)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := crypto.Sign(hash, fc.key)
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27
+	return sig, nil
+}
+
+// TxArgs and TxResult are the arguments and result of account_signTransaction,
+// which must be exported for the method to be served
+type (
+	TxArgs   remoteTxArgs
+	TxResult remoteTxResult
+)
+
+func (fc *fakeClef) SignTransaction(args TxArgs) (*TxResult, error) {
+	tx := types.NewTransaction(
+		uint64(args.Nonce), *args.To, args.Value.ToInt(), uint64(args.Gas), args.GasPrice.ToInt(), *args.Data)
+	signed, err := types.SignTx(tx, types.NewEIP155Signer(fc.chainID), fc.key)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := rlp.EncodeToBytes(signed)
+	if err != nil {
+		return nil, err
+	}
+	return &TxResult{Raw: raw}, nil
+}
+
+func newFakeRemoteSigner(t *testing.T, account string) (*RemoteSigner, *fakeClef, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc := &fakeClef{key: key, chainID: big.NewInt(1)}
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", fc); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := newRemoteSigner(rpc.DialInProc(server), account)
+	return rs, fc, err
+}
+
+func TestRemoteSigner(t *testing.T) {
+	rs, fc, err := newFakeRemoteSigner(t, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	ks := NewKeySigner(fc.key)
+	if rs.Address() != ks.Address() {
+		t.Fatalf("remote signer address %s, want %s", rs.Address().Hex(), ks.Address().Hex())
+	}
+	data := crypto.Keccak256([]byte("payment"))
+	remoteSig, err := rs.SignText(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	localSig, err := ks.SignText(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(remoteSig, localSig) {
+		t.Fatalf("remote signature %x, want %x", remoteSig, localSig)
+	}
+	tx := types.NewTransaction(5, common.HexToAddress("0x1"), big.NewInt(1), 21000, big.NewInt(1), []byte{0x1})
+	signed, err := rs.SignTx(types.HomesteadSigner{}, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, err := types.Sender(types.NewEIP155Signer(fc.chainID), signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sender != rs.Address() || signed.Nonce() != tx.Nonce() {
+		t.Fatal("transaction was not signed by the remote account")
+	}
+	ps := &PaymentSigner{Signer: rs}
+	if _, err := ps.GenerateSignedPaymentMessagePrefixed(
+		common.HexToAddress("0x2"), 0, big.NewInt(1), big.NewInt(1),
+	); err != nil {
+		t.Fatal(err)
+	}
+	domain := TypedDomain{Name: "Pay", Version: "1", ChainID: fc.chainID, VerifyingContract: common.HexToAddress("0x3")}
+	msg, err := ps.GenerateTypedPaymentMessage(
+		domain, common.HexToAddress("0x2"), 0, big.NewInt(1), big.NewInt(1), time.Now().Add(time.Hour),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Signer != rs.Address() {
+		t.Fatalf("typed message signer %s, want %s", msg.Signer.Hex(), rs.Address().Hex())
+	}
+}
+
+func TestRemoteSigner_Account(t *testing.T) {
+	if _, _, err := newFakeRemoteSigner(t, "0x1"); err == nil || err.Error() != ErrRemoteAccountNotFound {
+		t.Fatalf("newRemoteSigner() error = %v, wantErr %v", err, ErrRemoteAccountNotFound)
+	}
+}
@@ -0,0 +1,75 @@
+package signer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrSignerNotAccepted is an error used to indicate that the payment
+// contract doesn't accept payment messages signed by one of our keys
+const ErrSignerNotAccepted = "payment contract does not accept messages signed by"
+
+// Rotation is used to rotate our payment key, signing with the next key from the
+// given time. The payment contract must accept both keys from before the switch
+// until the overlap has passed, so that messages signed shortly before the
+// switch can still be used to pay
+type Rotation struct {
+	Next    Signer
+	At      time.Time
+	Overlap time.Duration
+}
+
+// SignerChecker is used to check which addresses the payment
+// contract accepts payment messages to be signed by
+type SignerChecker interface {
+	PaymentSignerAccepted(ctx context.Context, address common.Address) (bool, error)
+}
+
+// Active returns the signer payment messages are currently signed with
+func (ps *PaymentSigner) Active() Signer {
+	return ps.active(time.Now())
+}
+
+// Required returns the addresses the payment contract must currently accept
+func (ps *PaymentSigner) Required() []common.Address {
+	return ps.required(time.Now())
+}
+
+// CheckAccepted is used to check that the payment contract accepts
+// the addresses of the keys we currently sign, or have recently
+// signed, payment messages with
+func (ps *PaymentSigner) CheckAccepted(ctx context.Context, checker SignerChecker) error {
+	for _, address := range ps.Required() {
+		accepted, err := checker.PaymentSignerAccepted(ctx, address)
+		if err != nil {
+			return err
+		}
+		if !accepted {
+			return fmt.Errorf("%s %s", ErrSignerNotAccepted, address.Hex())
+		}
+	}
+	return nil
+}
+
+// active returns the signer payment messages are signed with at the given time
+func (ps *PaymentSigner) active(now time.Time) Signer {
+	if ps.Rotation != nil && !now.Before(ps.Rotation.At) {
+		return ps.Rotation.Next
+	}
+	return ps.Signer
+}
+
+// required returns the addresses the payment contract must accept at the given
+// time. Both keys are required ahead of the switch, so that it can't fail
+func (ps *PaymentSigner) required(now time.Time) []common.Address {
+	if ps.Rotation == nil {
+		return []common.Address{ps.Signer.Address()}
+	}
+	if now.Before(ps.Rotation.At.Add(ps.Rotation.Overlap)) {
+		return []common.Address{ps.Signer.Address(), ps.Rotation.Next.Address()}
+	}
+	return []common.Address{ps.Rotation.Next.Address()}
+}
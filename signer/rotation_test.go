@@ -0,0 +1,90 @@
+package signer
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// fakeChecker are the addresses accepted by the payment contract
+type fakeChecker map[common.Address]bool
+
+func (fc fakeChecker) PaymentSignerAccepted(ctx context.Context, address common.Address) (bool, error) {
+	return fc[address], nil
+}
+
+func newTestKeySigner(t *testing.T) *KeySigner {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewKeySigner(key)
+}
+
+func TestPaymentSigner_Rotation(t *testing.T) {
+	current, next := newTestKeySigner(t), newTestKeySigner(t)
+	at := time.Now()
+	ps := &PaymentSigner{Signer: current, Rotation: &Rotation{Next: next, At: at, Overlap: time.Hour}}
+	tests := []struct {
+		name         string
+		now          time.Time
+		wantActive   common.Address
+		wantRequired []common.Address
+	}{
+		{"BeforeRotation", at.Add(-time.Minute), current.Address(), []common.Address{current.Address(), next.Address()}},
+		{"DuringOverlap", at.Add(time.Minute), next.Address(), []common.Address{current.Address(), next.Address()}},
+		{"AfterOverlap", at.Add(time.Hour), next.Address(), []common.Address{next.Address()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if active := ps.active(tt.now).Address(); active != tt.wantActive {
+				t.Fatalf("active() = %s, want %s", active.Hex(), tt.wantActive.Hex())
+			}
+			required := ps.required(tt.now)
+			if len(required) != len(tt.wantRequired) {
+				t.Fatalf("required() = %v, want %v", required, tt.wantRequired)
+			}
+			for i := range required {
+				if required[i] != tt.wantRequired[i] {
+					t.Fatalf("required() = %v, want %v", required, tt.wantRequired)
+				}
+			}
+		})
+	}
+}
+
+func TestPaymentSigner_CheckAccepted(t *testing.T) {
+	current, next := newTestKeySigner(t), newTestKeySigner(t)
+	ps := &PaymentSigner{Signer: current}
+	if err := ps.CheckAccepted(context.Background(), fakeChecker{current.Address(): true}); err != nil {
+		t.Fatal(err)
+	}
+	// the next key must be accepted ahead of the rotation
+	ps.Rotation = &Rotation{Next: next, At: time.Now().Add(time.Hour), Overlap: time.Hour}
+	err := ps.CheckAccepted(context.Background(), fakeChecker{current.Address(): true})
+	if err == nil || !strings.HasPrefix(err.Error(), ErrSignerNotAccepted) {
+		t.Fatalf("CheckAccepted() error = %v, wantErr %v", err, ErrSignerNotAccepted)
+	}
+	if err := ps.CheckAccepted(
+		context.Background(), fakeChecker{current.Address(): true, next.Address(): true},
+	); err != nil {
+		t.Fatal(err)
+	}
+	// messages are signed with the current key until the rotation
+	msg, err := ps.GenerateSignedPaymentMessagePrefixed(common.HexToAddress("0x2"), 0, big.NewInt(1), big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := crypto.SigToPub(msg.Hash, append(msg.Sig, msg.V-27))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crypto.PubkeyToAddress(*pub) != current.Address() {
+		t.Fatal("message should be signed with the current key")
+	}
+}
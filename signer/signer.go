@@ -1,23 +1,21 @@
 package signer
 
 import (
-	"crypto/ecdsa"
 	"errors"
-	"fmt"
-	"io/ioutil"
 	"math/big"
 
 	"github.com/RTradeLtd/config/v2"
-	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	solsha3 "github.com/miguelmota/go-solidity-sha3"
 )
 
 // PaymentSigner is used to signed payment messages
-// and holds the ecdsa private key we used
+// and holds the signer of our payment key
 type PaymentSigner struct {
-	Key *ecdsa.PrivateKey
+	Signer Signer
+	// Rotation rotates our payment key, and is ignored if nil
+	Rotation *Rotation
 }
 
 // SignedMessage is the response to a message signing request
@@ -37,21 +35,17 @@ type SignedMessage struct {
 // NewPaymentSigner is used to generate our helper struct for signing payments
 // keyFilePath is the path to a key as generated by geth
 func NewPaymentSigner(cfg *config.TemporalConfig) (*PaymentSigner, error) {
+	return NewPaymentSignerWithOpts(cfg, Opts{})
+}
 
-	fileBytes, err := ioutil.ReadFile(
-		cfg.Ethereum.Account.KeyFile,
-	)
+// NewPaymentSignerWithOpts is used to generate our helper struct for
+// signing payments, allowing the key to be held by a remote signer
+func NewPaymentSignerWithOpts(cfg *config.TemporalConfig, opts Opts) (*PaymentSigner, error) {
+	s, err := New(cfg, opts)
 	if err != nil {
 		return nil, err
 	}
-	pk, err := keystore.DecryptKey(
-		fileBytes,
-		cfg.Ethereum.Account.KeyPass,
-	)
-	if err != nil {
-		return nil, err
-	}
-	return &PaymentSigner{Key: pk.PrivateKey}, nil
+	return &PaymentSigner{Signer: s}, nil
 }
 
 // GenerateSignedPaymentMessagePrefixed generates a signed payment message. The format is slightly different and involves
@@ -65,7 +59,9 @@ func (ps *PaymentSigner) GenerateSignedPaymentMessagePrefixed(ethAddress common.
 		solsha3.Uint256(chargeAmountInWei),
 	)
 	hashPrefixed := solsha3.SoliditySHA3WithPrefix(hashToSign)
-	sig, err := crypto.Sign(hashPrefixed, ps.Key)
+	// the signer applies the same prefix to the hash it is given
+	active := ps.Active()
+	sig, err := active.SignText(hashToSign)
 	if err != nil {
 		return nil, err
 	}
@@ -103,12 +99,13 @@ func (ps *PaymentSigner) GenerateSignedPaymentMessagePrefixed(ethAddress common.
 
 	// Here we do an off-chain validation to ensure that when validated on-chain the transaction won't rever
 	// however for some reason, the data isn't validating on-chain
-	pub := ps.Key.PublicKey
-	compressedKey := crypto.CompressPubkey(&pub)
-	valid := crypto.VerifySignature(compressedKey, msg.Hash, msg.Sig)
-	if !valid {
+	pub, err := crypto.SigToPub(hashPrefixed, sig)
+	if err != nil {
+		return nil, err
+	}
+	valid := crypto.VerifySignature(crypto.CompressPubkey(pub), msg.Hash, msg.Sig)
+	if !valid || crypto.PubkeyToAddress(*pub) != active.Address() {
 		return nil, errors.New("failed to validate signature off-chain")
 	}
-	fmt.Println("successfully validated signature")
 	return msg, nil
 }
@@ -0,0 +1,152 @@
+package signer
+
+import (
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core"
+)
+
+const (
+	// PaymentPrimaryType is the EIP-712 primary type of our typed payment messages
+	PaymentPrimaryType = "Payment"
+
+	// ErrInvalidExpiry is an error used to indicate that a typed
+	// payment message would expire before it was signed
+	ErrInvalidExpiry = "payment message expiry must be in the future"
+)
+
+// paymentTypes are the EIP-712 types of our typed payment messages
+var paymentTypes = core.Types{
+	"EIP712Domain": {
+		{Name: "name", Type: "string"},
+		{Name: "version", Type: "string"},
+		{Name: "chainId", Type: "uint256"},
+		{Name: "verifyingContract", Type: "address"},
+	},
+	PaymentPrimaryType: {
+		{Name: "payer", Type: "address"},
+		{Name: "paymentNumber", Type: "uint256"},
+		{Name: "paymentMethod", Type: "uint8"},
+		{Name: "chargeAmountInWei", Type: "uint256"},
+		{Name: "expiry", Type: "uint256"},
+	},
+}
+
+// TypedDomain is the EIP-712 domain typed payment messages are signed for,
+// binding them to a single deployment of the payment contract on a single chain
+type TypedDomain struct {
+	Name              string
+	Version           string
+	ChainID           *big.Int
+	VerifyingContract common.Address
+}
+
+// TypedMessage is a signed EIP-712 typed payment message
+type TypedMessage struct {
+	H             [32]byte
+	R             [32]byte
+	S             [32]byte
+	V             uint8
+	Signer        common.Address
+	Address       common.Address
+	PaymentMethod uint8
+	PaymentNumber *big.Int
+	ChargeAmount  *big.Int
+	Expiry        time.Time
+	Domain        TypedDomain
+	// Sig is the 65 byte [R || S || V] signature, with V of 27 or 28
+	Sig []byte
+}
+
+// TypedPaymentData is used to build the EIP-712 typed data of a payment message
+func TypedPaymentData(
+	domain TypedDomain,
+	ethAddress common.Address,
+	paymentMethod uint8,
+	paymentNumber, chargeAmountInWei *big.Int,
+	expiry time.Time,
+) core.TypedData {
+	return core.TypedData{
+		Types:       paymentTypes,
+		PrimaryType: PaymentPrimaryType,
+		Domain: core.TypedDataDomain{
+			Name:              domain.Name,
+			Version:           domain.Version,
+			ChainId:           (*math.HexOrDecimal256)(new(big.Int).Set(domain.ChainID)),
+			VerifyingContract: domain.VerifyingContract.Hex(),
+		},
+		Message: core.TypedDataMessage{
+			"payer":             ethAddress.Hex(),
+			"paymentNumber":     paymentNumber.String(),
+			"paymentMethod":     big.NewInt(int64(paymentMethod)).String(),
+			"chargeAmountInWei": chargeAmountInWei.String(),
+			"expiry":            big.NewInt(expiry.Unix()).String(),
+		},
+	}
+}
+
+// TypedDataHash returns the EIP-712 digest of typed data, which is what is signed
+func TypedDataHash(data core.TypedData) ([]byte, error) {
+	domainSeparator, err := data.HashStruct("EIP712Domain", data.Domain.Map())
+	if err != nil {
+		return nil, err
+	}
+	dataHash, err := data.HashStruct(data.PrimaryType, data.Message)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Keccak256([]byte{0x19, 0x01}, domainSeparator, dataHash), nil
+}
+
+// GenerateTypedPaymentMessage generates a signed EIP-712 typed payment message. Unlike
+// prefixed payment messages, typed messages are bound to the domain of a single payment
+// contract deployment, and can't be used once they have expired
+func (ps *PaymentSigner) GenerateTypedPaymentMessage(
+	domain TypedDomain,
+	ethAddress common.Address,
+	paymentMethod uint8,
+	paymentNumber, chargeAmountInWei *big.Int,
+	expiry time.Time,
+) (*TypedMessage, error) {
+	if !expiry.After(time.Now()) {
+		return nil, errors.New(ErrInvalidExpiry)
+	}
+	data := TypedPaymentData(domain, ethAddress, paymentMethod, paymentNumber, chargeAmountInWei, expiry)
+	hash, err := TypedDataHash(data)
+	if err != nil {
+		return nil, err
+	}
+	active := ps.Active()
+	sig, err := active.SignTypedData(data)
+	if err != nil {
+		return nil, err
+	}
+	// ensure the signature will recover to our key when validated on-chain
+	pub, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return nil, err
+	}
+	if crypto.PubkeyToAddress(*pub) != active.Address() {
+		return nil, errors.New("failed to validate signature off-chain")
+	}
+	msg := &TypedMessage{
+		V:             sig[64] + 27,
+		Signer:        active.Address(),
+		Address:       ethAddress,
+		PaymentMethod: paymentMethod,
+		PaymentNumber: paymentNumber,
+		ChargeAmount:  chargeAmountInWei,
+		Expiry:        time.Unix(expiry.Unix(), 0),
+		Domain:        domain,
+	}
+	copy(msg.H[:], hash)
+	copy(msg.R[:], sig[:32])
+	copy(msg.S[:], sig[32:64])
+	msg.Sig = append(sig[:64:64], msg.V)
+	return msg, nil
+}
@@ -0,0 +1,56 @@
+package signer
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core"
+)
+
+func TestPaymentSigner_GenerateTypedPaymentMessage(t *testing.T) {
+	ks := newTestKeySigner(t)
+	ps := &PaymentSigner{Signer: ks}
+	domain := TypedDomain{Name: "Pay", Version: "1", ChainID: big.NewInt(1), VerifyingContract: common.HexToAddress("0x3")}
+	payer := common.HexToAddress("0x2")
+	expiry := time.Now().Add(time.Hour)
+	if _, err := ps.GenerateTypedPaymentMessage(
+		domain, payer, 0, big.NewInt(1), big.NewInt(1), time.Now().Add(-time.Second),
+	); err == nil || err.Error() != ErrInvalidExpiry {
+		t.Fatalf("GenerateTypedPaymentMessage() error = %v, wantErr %v", err, ErrInvalidExpiry)
+	}
+	msg, err := ps.GenerateTypedPaymentMessage(domain, payer, 0, big.NewInt(1), big.NewInt(1), expiry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := crypto.SigToPub(msg.H[:], append(msg.Sig[:64:64], msg.V-27))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crypto.PubkeyToAddress(*pub) != ks.Address() {
+		t.Fatal("typed message should recover to the signing key")
+	}
+	// messages must not be valid for any other domain or expiry
+	otherChain := domain
+	otherChain.ChainID = big.NewInt(4)
+	otherContract := domain
+	otherContract.VerifyingContract = common.HexToAddress("0x4")
+	for name, data := range map[string]core.TypedData{
+		"ChainID":  TypedPaymentData(otherChain, payer, 0, big.NewInt(1), big.NewInt(1), expiry),
+		"Contract": TypedPaymentData(otherContract, payer, 0, big.NewInt(1), big.NewInt(1), expiry),
+		"Expiry":   TypedPaymentData(domain, payer, 0, big.NewInt(1), big.NewInt(1), expiry.Add(time.Second)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			hash, err := TypedDataHash(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(hash, msg.H[:]) {
+				t.Fatal("typed data hash should differ")
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"errors"
+
+	"github.com/RTradeLtd/Pay/deposit"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// ErrAddressReuse is an error used to indicate a derived address was already issued
+const ErrAddressReuse = "derived address has already been issued"
+
+// depositAttempts is the number of times issuing an address
+// is attempted, should it race other requests for its index
+const depositAttempts = 5
+
+// DepositAddress records a deposit address derived for a payment. Derivation
+// indexes and addresses are unique, so an address is never issued twice
+type DepositAddress struct {
+	gorm.Model
+	Blockchain      string `gorm:"type:varchar(255);unique_index:idx_deposit_address_index;unique_index:idx_deposit_address_payment"`
+	DerivationIndex int64  `gorm:"type:bigint;unique_index:idx_deposit_address_index"`
+	Address         string `gorm:"type:varchar(255);unique_index"`
+	UserName        string `gorm:"type:varchar(255);unique_index:idx_deposit_address_payment"`
+	PaymentNumber   int64  `gorm:"type:integer;unique_index:idx_deposit_address_payment"`
+}
+
+// DepositManager is used to interact with issued deposit addresses
+type DepositManager struct {
+	DB *gorm.DB
+}
+
+// NewDepositManager is used to generate our deposit address manager helper
+func NewDepositManager(db *gorm.DB) *DepositManager {
+	return &DepositManager{DB: db}
+}
+
+// NewAddress is used to issue the deposit address for a payment, deriving it from
+// the index following the last one issued for the blockchain. If an address was
+// already issued for the payment, it is returned instead. Should two requests race
+// each other for the same index, the unique indexes ensure only one of them succeeds,
+// and the other is retried, deriving its address from the index following the winner
+func (dm *DepositManager) NewAddress(d *deposit.Deriver, username string, number int64) (*DepositAddress, error) {
+	for attempt := 1; ; attempt++ {
+		entry, err := dm.newAddress(d, username, number)
+		if err != nil && uniqueViolation(err) && attempt < depositAttempts {
+			continue
+		}
+		return entry, err
+	}
+}
+
+// newAddress is used to make a single attempt at issuing the deposit address for a payment
+func (dm *DepositManager) newAddress(d *deposit.Deriver, username string, number int64) (*DepositAddress, error) {
+	tx := dm.DB.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	existing := &DepositAddress{}
+	if check := tx.Where(
+		"blockchain = ? AND user_name = ? AND payment_number = ?",
+		d.Blockchain(), username, number,
+	).First(existing); check.Error == nil {
+		tx.Rollback()
+		return existing, nil
+	} else if !gorm.IsRecordNotFoundError(check.Error) {
+		tx.Rollback()
+		return nil, check.Error
+	}
+	var next uint32
+	last := &DepositAddress{}
+	if check := tx.Where("blockchain = ?", d.Blockchain()).Order("derivation_index desc").First(last); check.Error == nil {
+		next = uint32(last.DerivationIndex) + 1
+	} else if !gorm.IsRecordNotFoundError(check.Error) {
+		tx.Rollback()
+		return nil, check.Error
+	}
+	index, address, err := d.Next(next)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	var count int
+	if check := tx.Model(&DepositAddress{}).Where("address = ?", address).Count(&count); check.Error != nil {
+		tx.Rollback()
+		return nil, check.Error
+	} else if count > 0 {
+		tx.Rollback()
+		return nil, errors.New(ErrAddressReuse)
+	}
+	entry := &DepositAddress{
+		Blockchain:      d.Blockchain(),
+		DerivationIndex: int64(index),
+		Address:         address,
+		UserName:        username,
+		PaymentNumber:   number,
+	}
+	if err := tx.Create(entry).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return entry, tx.Commit().Error
+}
+
+// uniqueViolation is used to check whether err is the violation of a unique index
+func uniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/RTradeLtd/Pay/deposit"
+	"github.com/lib/pq"
+)
+
+const xpub = "xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw"
+
+func TestDepositManager_NewAddress(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+	d, err := deposit.NewDeriver(deposit.BTC, xpub, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm := NewDepositManager(db)
+	username := newTestUser(t, db).UserName
+	// concurrent requests race each other for the next index
+	var (
+		wg        sync.WaitGroup
+		mux       sync.Mutex
+		addresses = make(map[string]int64)
+	)
+	for number := int64(1); number <= 4; number++ {
+		wg.Add(1)
+		go func(number int64) {
+			defer wg.Done()
+			entry, err := dm.NewAddress(d, username, number)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mux.Lock()
+			addresses[entry.Address] = entry.PaymentNumber
+			mux.Unlock()
+		}(number)
+	}
+	wg.Wait()
+	if len(addresses) != 4 {
+		t.Fatalf("issued %v distinct addresses, want 4", len(addresses))
+	}
+	// the address issued for a payment is returned again
+	entry, err := dm.NewAddress(d, username, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addresses[entry.Address] != 1 {
+		t.Fatal("a new address was issued for an existing payment")
+	}
+}
+
+func Test_UniqueViolation(t *testing.T) {
+	if !uniqueViolation(&pq.Error{Code: "23505"}) {
+		t.Fatal("unique violation not detected")
+	}
+	if uniqueViolation(&pq.Error{Code: "23503"}) || uniqueViolation(errors.New(ErrAddressReuse)) {
+		t.Fatal("unexpected unique violation")
+	}
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Lease grants a single process the right to perform a task, such as watching
+// our ens names for expiry, until it expires. The holder extends the lease
+// while it is running, and should it stop, another process takes over once
+// the lease has expired
+type Lease struct {
+	gorm.Model
+	Name      string `gorm:"type:varchar(255);unique"`
+	Holder    string `gorm:"type:varchar(255)"`
+	ExpiresAt time.Time
+}
+
+// LeaseManager is used to interact with leases
+type LeaseManager struct {
+	DB *gorm.DB
+}
+
+// NewLeaseManager is used to generate our lease manager helper
+func NewLeaseManager(db *gorm.DB) *LeaseManager {
+	return &LeaseManager{DB: db}
+}
+
+// Acquire is used to acquire or extend the named lease for the given holder,
+// returning false if the lease is held by another holder and hasn't expired
+func (lm *LeaseManager) Acquire(name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	check := lm.DB.Model(&Lease{}).Where(
+		"name = ? AND (holder = ? OR expires_at < ?)", name, holder, now,
+	).Updates(map[string]interface{}{
+		"holder":     holder,
+		"expires_at": now.Add(ttl),
+	})
+	if check.Error != nil {
+		return false, check.Error
+	}
+	if check.RowsAffected > 0 {
+		return true, nil
+	}
+	// the unique index on lease names guarantees that should the lease not
+	// exist yet, only one of the holders racing to create it succeeds
+	if create := lm.DB.Create(&Lease{Name: name, Holder: holder, ExpiresAt: now.Add(ttl)}); create.Error != nil {
+		var count int
+		if exists := lm.DB.Model(&Lease{}).Where("name = ?", name).Count(&count); exists.Error != nil || count == 0 {
+			return false, create.Error
+		}
+		return false, nil
+	}
+	return true, nil
+}
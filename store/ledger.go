@@ -0,0 +1,203 @@
+package store
+
+import (
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/jinzhu/gorm"
+)
+
+// PaymentStep denotes a step of the payment confirmation pipeline
+type PaymentStep string
+
+func (ps PaymentStep) String() string {
+	return string(ps)
+}
+
+const (
+	// StepCredited is recorded once a payment has been confirmed
+	// and the user has been granted credits for it
+	StepCredited = PaymentStep("credited")
+	// StepNotified is recorded once the user has been notified
+	// that their payment was confirmed
+	StepNotified = PaymentStep("notified")
+	// StepReversed is recorded once the credits granted for a payment
+	// have been debited, after its transaction was dropped by a reorg
+	StepReversed = PaymentStep("reversed")
+)
+
+// PaymentLedger records a completed step of the payment confirmation pipeline.
+// A payment can only ever have one entry per step, which allows replayed
+// deliveries to skip any work that has already been done
+type PaymentLedger struct {
+	gorm.Model
+	Number   int64  `gorm:"type:integer;unique_index:idx_payment_ledger_step"`
+	UserName string `gorm:"type:varchar(255);unique_index:idx_payment_ledger_step"`
+	Step     string `gorm:"type:varchar(255);unique_index:idx_payment_ledger_step"`
+	TxHash   string `gorm:"type:varchar(255)"`
+}
+
+// LedgerManager is used to interact with the payment ledger
+type LedgerManager struct {
+	DB *gorm.DB
+}
+
+// NewLedgerManager is used to generate our ledger manager helper
+func NewLedgerManager(db *gorm.DB) *LedgerManager {
+	return &LedgerManager{DB: db}
+}
+
+// HasStep is used to check whether a step has been completed for a payment
+func (lm *LedgerManager) HasStep(username string, number int64, step PaymentStep) (bool, error) {
+	return hasStep(lm.DB, username, number, step)
+}
+
+// RecordStep is used to record that a step has been completed for a payment
+func (lm *LedgerManager) RecordStep(payment *models.Payments, step PaymentStep) error {
+	return recordStep(lm.DB, payment, step)
+}
+
+// ConfirmAndCredit is used to mark a payment as confirmed and grant the user
+// credits for it. Both updates, along with the ledger entry, are performed in
+// a single transaction so that the user is credited exactly once, even if the
+// same payment is processed again after a crash.
+func (lm *LedgerManager) ConfirmAndCredit(payment *models.Payments) error {
+	tx := lm.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if credited, err := hasStep(tx, payment.UserName, payment.Number, StepCredited); err != nil {
+		tx.Rollback()
+		return err
+	} else if credited {
+		tx.Rollback()
+		return nil
+	}
+	if _, err := models.NewPaymentManager(tx).ConfirmPayment(payment.TxHash); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := models.NewUserManager(tx).AddCredits(payment.UserName, payment.USDValue); err != nil {
+		tx.Rollback()
+		return err
+	}
+	// the unique index on the ledger guarantees that if two deliveries
+	// race each other, only one of them is able to commit
+	if err := recordStep(tx, payment, StepCredited); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// ReverseCredit is used to debit the credits granted for a payment whose
+// transaction was dropped from the chain by a reorg, and mark the payment as
+// unconfirmed. As with crediting, the updates and the ledger entry are performed
+// in a single transaction so that the user is debited at most once. Should the
+// user have already spent the credits, their balance is left negative, so that
+// the debt is settled by the credits of their next payment
+func (lm *LedgerManager) ReverseCredit(payment *models.Payments) error {
+	tx := lm.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	// a payment that was never credited has nothing to debit
+	if credited, err := hasStep(tx, payment.UserName, payment.Number, StepCredited); err != nil {
+		tx.Rollback()
+		return err
+	} else if !credited {
+		tx.Rollback()
+		return nil
+	}
+	if reversed, err := hasStep(tx, payment.UserName, payment.Number, StepReversed); err != nil {
+		tx.Rollback()
+		return err
+	} else if reversed {
+		tx.Rollback()
+		return nil
+	}
+	if err := debitCredits(tx, payment.UserName, payment.USDValue); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if check := tx.Model(payment).Update("confirmed", false); check.Error != nil {
+		tx.Rollback()
+		return check.Error
+	}
+	if err := recordStep(tx, payment, StepReversed); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// ReinstateCredit is used to grant the credits of a reversed payment again, once its
+// transaction has been mined in another block, and mark the payment as confirmed. The
+// reversal is removed from the ledger so that the payment may be reversed again should
+// its transaction be dropped once more
+func (lm *LedgerManager) ReinstateCredit(payment *models.Payments) error {
+	tx := lm.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if reversed, err := hasStep(tx, payment.UserName, payment.Number, StepReversed); err != nil {
+		tx.Rollback()
+		return err
+	} else if !reversed {
+		tx.Rollback()
+		return nil
+	}
+	if _, err := models.NewUserManager(tx).AddCredits(payment.UserName, payment.USDValue); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if check := tx.Model(payment).Update("confirmed", true); check.Error != nil {
+		tx.Rollback()
+		return check.Error
+	}
+	// the entry is deleted permanently, as a soft deleted entry would
+	// still hold the unique index of the step
+	if check := tx.Unscoped().Where(
+		"user_name = ? AND number = ? AND step = ?",
+		payment.UserName, payment.Number, StepReversed.String(),
+	).Delete(&PaymentLedger{}); check.Error != nil {
+		tx.Rollback()
+		return check.Error
+	}
+	return tx.Commit().Error
+}
+
+// debitCredits is used to debit credits from a user, without the check against a negative
+// balance made by the user manager. Users of an organization have the amount owed by
+// their organization increased instead, as with the user manager
+func debitCredits(db *gorm.DB, username string, credits float64) error {
+	um := models.NewUserManager(db)
+	user, err := um.FindByUserName(username)
+	if err != nil {
+		return err
+	}
+	if user.Organization != "" {
+		_, err := um.RemoveCredits(username, credits)
+		return err
+	}
+	return db.Model(user).Update("credits", gorm.Expr("credits - ?", credits)).Error
+}
+
+func hasStep(db *gorm.DB, username string, number int64, step PaymentStep) (bool, error) {
+	var count int
+	if check := db.Model(&PaymentLedger{}).Where(
+		"user_name = ? AND number = ? AND step = ?",
+		username, number, step.String(),
+	).Count(&count); check.Error != nil {
+		return false, check.Error
+	}
+	return count > 0, nil
+}
+
+func recordStep(db *gorm.DB, payment *models.Payments, step PaymentStep) error {
+	entry := PaymentLedger{
+		Number:   payment.Number,
+		UserName: payment.UserName,
+		Step:     step.String(),
+		TxHash:   payment.TxHash,
+	}
+	return db.Create(&entry).Error
+}
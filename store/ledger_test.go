@@ -0,0 +1,54 @@
+package store
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/RTradeLtd/database/v2/models"
+)
+
+func TestLedgerManager_ConfirmAndCredit(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+	user := newTestUser(t, db)
+	payment, err := models.NewPaymentManager(db).NewPayment(
+		1, "0xdeposit", "0x"+user.UserName, 10, 0.1, "eth", "eth", user.UserName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lm := NewLedgerManager(db)
+	if err := lm.ConfirmAndCredit(payment); err != nil {
+		t.Fatal(err)
+	}
+	// the payment is redelivered after a crash, and raced by a concurrent delivery
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			redelivered := *payment
+			lm.ConfirmAndCredit(&redelivered)
+		}()
+	}
+	wg.Wait()
+	if err := lm.ConfirmAndCredit(payment); err != nil {
+		t.Fatal(err)
+	}
+	credited, err := models.NewUserManager(db).FindByUserName(user.UserName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credited.Credits != user.Credits+payment.USDValue {
+		t.Fatalf("user has %v credits, want %v", credited.Credits, user.Credits+payment.USDValue)
+	}
+	confirmed, err := models.NewPaymentManager(db).FindPaymentByNumber(user.UserName, payment.Number)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !confirmed.Confirmed {
+		t.Fatal("payment should be confirmed")
+	}
+	if ok, err := lm.HasStep(user.UserName, payment.Number, StepCredited); err != nil || !ok {
+		t.Fatal("credit should be recorded in the ledger", err)
+	}
+}
@@ -0,0 +1,182 @@
+package store
+
+import (
+	"time"
+
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/jinzhu/gorm"
+)
+
+// PaymentStatus denotes the tracking status of a pending payment
+type PaymentStatus string
+
+func (ps PaymentStatus) String() string {
+	return string(ps)
+}
+
+const (
+	// StatusSeen is set when a payment confirmation is first received
+	StatusSeen = PaymentStatus("seen")
+	// StatusConfirming is set while we wait for the payment to confirm
+	StatusConfirming = PaymentStatus("confirming")
+	// StatusConfirmed is set once the payment has been confirmed and settled
+	StatusConfirmed = PaymentStatus("confirmed")
+	// StatusFailed is set when the payment can never be confirmed
+	StatusFailed = PaymentStatus("failed")
+	// StatusExpired is set when the payment did not confirm before its deadline
+	StatusExpired = PaymentStatus("expired")
+	// StatusReversed is set when the transaction of a confirmed payment
+	// was dropped from the chain by a reorg, and its credits were debited
+	StatusReversed = PaymentStatus("reversed")
+)
+
+// PendingPayment tracks the state of a payment from the moment its confirmation
+// message is first received, allowing tracking to resume where it left off, and
+// against the original deadline, should the worker processing it restart
+type PendingPayment struct {
+	gorm.Model
+	Number   int64  `gorm:"type:integer;unique_index:idx_pending_payment"`
+	UserName string `gorm:"type:varchar(255);unique_index:idx_pending_payment"`
+	// Queue is the queue the payment confirmation was received on
+	Queue  string `gorm:"type:varchar(255);index"`
+	Status string `gorm:"type:varchar(255)"`
+	TxHash string `gorm:"type:varchar(255)"`
+	// FirstSeenBlock is the height of the chain when the payment was first seen
+	FirstSeenBlock int64
+	Deadline       time.Time
+	// Message is the original confirmation message, used to resume tracking
+	Message []byte
+	// Reason is the error which caused the payment to fail, expire or be reversed
+	Reason string `gorm:"type:text"`
+	// BlockHash is the hash of the block containing the transaction when
+	// the payment was confirmed, which is watched for reorgs
+	BlockHash   string `gorm:"type:varchar(255)"`
+	ConfirmedAt *time.Time
+	// MissingChecks is the number of consecutive reorg checks
+	// which found the transaction missing from the chain
+	MissingChecks int
+	// LastAttemptAt is when the payment was last seen or verified,
+	// used to tell whether its message may still be awaiting redelivery
+	LastAttemptAt time.Time
+}
+
+// Finished returns whether the payment has reached a final status
+func (pp *PendingPayment) Finished() bool {
+	switch PaymentStatus(pp.Status) {
+	case StatusConfirmed, StatusFailed, StatusExpired, StatusReversed:
+		return true
+	}
+	return false
+}
+
+// PendingManager is used to interact with pending payments
+type PendingManager struct {
+	DB *gorm.DB
+}
+
+// NewPendingManager is used to generate our pending payment manager helper
+func NewPendingManager(db *gorm.DB) *PendingManager {
+	return &PendingManager{DB: db}
+}
+
+// FindPending is used to find the pending payment state of a payment
+func (pm *PendingManager) FindPending(username string, number int64) (*PendingPayment, error) {
+	pending := &PendingPayment{}
+	if check := pm.DB.Where(
+		"user_name = ? AND number = ?", username, number,
+	).First(pending); check.Error != nil {
+		return nil, check.Error
+	}
+	return pending, nil
+}
+
+// CreatePending is used to start tracking a payment
+func (pm *PendingManager) CreatePending(
+	queue string, payment *models.Payments, message []byte, firstSeenBlock uint64, deadline time.Time,
+) (*PendingPayment, error) {
+	pending := &PendingPayment{
+		Number:         payment.Number,
+		UserName:       payment.UserName,
+		Queue:          queue,
+		Status:         StatusSeen.String(),
+		TxHash:         payment.TxHash,
+		FirstSeenBlock: int64(firstSeenBlock),
+		Deadline:       deadline,
+		Message:        message,
+		LastAttemptAt:  time.Now(),
+	}
+	if check := pm.DB.Create(pending); check.Error != nil {
+		return nil, check.Error
+	}
+	return pending, nil
+}
+
+// UpdateStatus is used to update the status of a pending payment
+func (pm *PendingManager) UpdateStatus(pending *PendingPayment, status PaymentStatus, reason string) error {
+	pending.Status = status.String()
+	pending.Reason = reason
+	return pm.DB.Model(pending).Updates(map[string]interface{}{
+		"status": pending.Status,
+		"reason": pending.Reason,
+	}).Error
+}
+
+// StartAttempt is used to record the start of an attempt at verifying a pending payment
+func (pm *PendingManager) StartAttempt(pending *PendingPayment) error {
+	pending.Status = StatusConfirming.String()
+	pending.Reason = ""
+	pending.LastAttemptAt = time.Now()
+	return pm.DB.Model(pending).Updates(map[string]interface{}{
+		"status":          pending.Status,
+		"reason":          pending.Reason,
+		"last_attempt_at": pending.LastAttemptAt,
+	}).Error
+}
+
+// FindUnfinished is used to find the payments received on a queue which haven't reached a final status
+func (pm *PendingManager) FindUnfinished(queue string) ([]PendingPayment, error) {
+	var pending []PendingPayment
+	if check := pm.DB.Where(
+		"queue = ? AND status IN (?)", queue, []string{StatusSeen.String(), StatusConfirming.String()},
+	).Find(&pending); check.Error != nil {
+		return nil, check.Error
+	}
+	return pending, nil
+}
+
+// RecordBlock is used to record the block containing the transaction of a confirmed
+// payment. The confirmation time is only set the first time a block is recorded, so
+// that a transaction mined again in another block isn't watched for longer.
+// As the transaction is part of the chain, its missing checks are reset
+func (pm *PendingManager) RecordBlock(pending *PendingPayment, blockHash string) error {
+	updates := map[string]interface{}{"block_hash": blockHash, "missing_checks": 0}
+	if pending.ConfirmedAt == nil {
+		now := time.Now()
+		pending.ConfirmedAt = &now
+		updates["confirmed_at"] = now
+	}
+	pending.BlockHash = blockHash
+	pending.MissingChecks = 0
+	return pm.DB.Model(pending).Updates(updates).Error
+}
+
+// RecordMissing is used to record the number of consecutive reorg
+// checks which found the transaction of a payment missing
+func (pm *PendingManager) RecordMissing(pending *PendingPayment, checks int) error {
+	pending.MissingChecks = checks
+	return pm.DB.Model(pending).Update("missing_checks", checks).Error
+}
+
+// FindConfirmedSince is used to find the payments received on a queue which
+// were confirmed in a known block after the given time, including those since
+// reversed, as their transaction may yet be mined again
+func (pm *PendingManager) FindConfirmedSince(queue string, since time.Time) ([]PendingPayment, error) {
+	var confirmed []PendingPayment
+	if check := pm.DB.Where(
+		"queue = ? AND status IN (?) AND block_hash <> '' AND confirmed_at > ?",
+		queue, []string{StatusConfirmed.String(), StatusReversed.String()}, since,
+	).Find(&confirmed); check.Error != nil {
+		return nil, check.Error
+	}
+	return confirmed, nil
+}
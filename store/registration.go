@@ -0,0 +1,207 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/jinzhu/gorm"
+)
+
+// RegistrationStatus denotes the stage a name registration has reached
+type RegistrationStatus string
+
+func (rs RegistrationStatus) String() string {
+	return string(rs)
+}
+
+const (
+	// RegistrationCommitting is set once the secret has been stored, before the commitment is mined
+	RegistrationCommitting = RegistrationStatus("committing")
+	// RegistrationCommitted is set once the commitment is mined, while we wait to reveal it
+	RegistrationCommitted = RegistrationStatus("committed")
+	// RegistrationRegistered is set once the reveal is mined, and the name is ours
+	RegistrationRegistered = RegistrationStatus("registered")
+	// RegistrationFailed is set when the registration can never complete
+	RegistrationFailed = RegistrationStatus("failed")
+
+	// ErrRegistrationExists is an error used to indicate that a name
+	// is already registered, or in the process of being registered
+	ErrRegistrationExists = "name is already registered or being registered"
+)
+
+// NameRegistration tracks the two stage registration of a .eth name, persisting
+// the secret committed to so that the registration can be revealed, and resumed
+// should the worker processing it restart
+type NameRegistration struct {
+	gorm.Model
+	UserName string `gorm:"type:varchar(255)"`
+	Name     string `gorm:"type:varchar(255);unique"`
+	// Secret is the hex encoded secret the commitment was made to
+	Secret string `gorm:"type:varchar(255)"`
+	Status string `gorm:"type:varchar(255)"`
+	// CommittedAt is the time the commitment was mined
+	CommittedAt *time.Time
+	// RevealAfter is the earliest time the registration is revealed
+	RevealAfter *time.Time
+	// Reason is the error which caused the registration to fail
+	Reason string `gorm:"type:text"`
+	// Charged is the number of credits the user was charged for the
+	// registration, which are refunded should the registration fail
+	Charged  float64 `gorm:"type:float;default:0"`
+	Refunded bool    `gorm:"type:boolean"`
+	// WarnedExpiry is the last expiry the owner was warned about
+	WarnedExpiry *time.Time
+}
+
+// Finished returns whether the registration has reached a final status
+func (nr *NameRegistration) Finished() bool {
+	switch RegistrationStatus(nr.Status) {
+	case RegistrationRegistered, RegistrationFailed:
+		return true
+	}
+	return false
+}
+
+// RefundDue returns whether the registration failed without refunding the user
+func (nr *NameRegistration) RefundDue() bool {
+	return RegistrationStatus(nr.Status) == RegistrationFailed && nr.Charged > 0 && !nr.Refunded
+}
+
+// RegistrationManager is used to interact with name registrations
+type RegistrationManager struct {
+	DB *gorm.DB
+}
+
+// NewRegistrationManager is used to generate our name registration manager helper
+func NewRegistrationManager(db *gorm.DB) *RegistrationManager {
+	return &RegistrationManager{DB: db}
+}
+
+// CreateRegistration is used to start tracking the registration of a name. A name
+// whose previous registration failed, and was refunded, is registered again with
+// a new secret
+func (rm *RegistrationManager) CreateRegistration(username, name, secret string) (*NameRegistration, error) {
+	reg := &NameRegistration{}
+	check := rm.DB.Where("name = ?", name).First(reg)
+	if check.Error != nil && !check.RecordNotFound() {
+		return nil, check.Error
+	}
+	if check.Error == nil && (RegistrationStatus(reg.Status) != RegistrationFailed || reg.RefundDue()) {
+		return nil, errors.New(ErrRegistrationExists)
+	}
+	reg.UserName = username
+	reg.Name = name
+	reg.Secret = secret
+	reg.Status = RegistrationCommitting.String()
+	reg.CommittedAt = nil
+	reg.RevealAfter = nil
+	reg.Reason = ""
+	reg.Charged = 0
+	reg.Refunded = false
+	if check := rm.DB.Save(reg); check.Error != nil {
+		return nil, check.Error
+	}
+	return reg, nil
+}
+
+// ChargeRegistration is used to charge the user the given number of credits for a
+// registration. The charge is recorded in the same transaction as the credits are
+// removed, so that the user is charged exactly once
+func (rm *RegistrationManager) ChargeRegistration(reg *NameRegistration, credits float64) error {
+	tx := rm.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if _, err := models.NewUserManager(tx).RemoveCredits(reg.UserName, credits); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if check := tx.Model(reg).Update("charged", credits); check.Error != nil {
+		tx.Rollback()
+		return check.Error
+	}
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	reg.Charged = credits
+	return nil
+}
+
+// RefundRegistration is used to refund the credits charged for a failed
+// registration. As with charging, the user is refunded exactly once
+func (rm *RegistrationManager) RefundRegistration(reg *NameRegistration) error {
+	if !reg.RefundDue() {
+		return nil
+	}
+	tx := rm.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if _, err := models.NewUserManager(tx).AddCredits(reg.UserName, reg.Charged); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if check := tx.Model(reg).Update("refunded", true); check.Error != nil {
+		tx.Rollback()
+		return check.Error
+	}
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	reg.Refunded = true
+	return nil
+}
+
+// RecordCommit is used to record that the commitment of a registration was mined
+func (rm *RegistrationManager) RecordCommit(reg *NameRegistration, committedAt, revealAfter time.Time) error {
+	reg.Status = RegistrationCommitted.String()
+	reg.CommittedAt = &committedAt
+	reg.RevealAfter = &revealAfter
+	return rm.DB.Model(reg).Updates(map[string]interface{}{
+		"status":       reg.Status,
+		"committed_at": committedAt,
+		"reveal_after": revealAfter,
+	}).Error
+}
+
+// UpdateRegistrationStatus is used to update the status of a registration
+func (rm *RegistrationManager) UpdateRegistrationStatus(reg *NameRegistration, status RegistrationStatus, reason string) error {
+	reg.Status = status.String()
+	reg.Reason = reason
+	return rm.DB.Model(reg).Updates(map[string]interface{}{
+		"status": reg.Status,
+		"reason": reg.Reason,
+	}).Error
+}
+
+// RecordWarning is used to record that the owner of a name was warned about its expiry
+func (rm *RegistrationManager) RecordWarning(reg *NameRegistration, expiry time.Time) error {
+	reg.WarnedExpiry = &expiry
+	return rm.DB.Model(reg).Update("warned_expiry", expiry).Error
+}
+
+// FindUnfinishedRegistrations is used to find the registrations which haven't reached
+// a final status, along with failed registrations whose user is yet to be refunded
+func (rm *RegistrationManager) FindUnfinishedRegistrations() ([]NameRegistration, error) {
+	var regs []NameRegistration
+	if check := rm.DB.Where(
+		"status IN (?)", []string{RegistrationCommitting.String(), RegistrationCommitted.String()},
+	).Or(
+		"status = ? AND charged > 0 AND refunded = ?", RegistrationFailed.String(), false,
+	).Find(&regs); check.Error != nil {
+		return nil, check.Error
+	}
+	return regs, nil
+}
+
+// FindRegistered is used to find the names which have been registered
+func (rm *RegistrationManager) FindRegistered() ([]NameRegistration, error) {
+	var regs []NameRegistration
+	if check := rm.DB.Where(
+		"status = ?", RegistrationRegistered.String(),
+	).Find(&regs); check.Error != nil {
+		return nil, check.Error
+	}
+	return regs, nil
+}
@@ -0,0 +1,165 @@
+package store
+
+import (
+	"time"
+
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/jinzhu/gorm"
+)
+
+// RenewalStatus denotes the stage a name renewal has reached
+type RenewalStatus string
+
+func (rs RenewalStatus) String() string {
+	return string(rs)
+}
+
+const (
+	// RenewalPending is set once the owner has been charged, while the renewal is sent
+	RenewalPending = RenewalStatus("pending")
+	// RenewalRenewed is set once the name has been extended
+	RenewalRenewed = RenewalStatus("renewed")
+	// RenewalRefunded is set once the owner of a name which
+	// couldn't be renewed has been refunded
+	RenewalRefunded = RenewalStatus("refunded")
+)
+
+// NameRenewal records the renewal of a name from a given expiry. A name can only
+// ever have one renewal per expiry, so that its owner is charged exactly once, and
+// a renewal interrupted by a restart can be settled against the name's expiry
+type NameRenewal struct {
+	gorm.Model
+	Name string `gorm:"type:varchar(255);unique_index:idx_name_renewal"`
+	// Expiry is the expiry of the name when the renewal was started
+	Expiry time.Time `gorm:"unique_index:idx_name_renewal"`
+	// UserName is the owner of the name, and is empty for our own names
+	UserName string `gorm:"type:varchar(255)"`
+	Status   string `gorm:"type:varchar(255);index"`
+	// Charged is the number of credits the owner was charged for the renewal
+	Charged float64 `gorm:"type:float;default:0"`
+	// TxHash is the hash of the mined renewal transaction
+	TxHash string `gorm:"type:varchar(255)"`
+}
+
+// RenewalManager is used to interact with name renewals
+type RenewalManager struct {
+	DB *gorm.DB
+}
+
+// NewRenewalManager is used to generate our name renewal manager helper
+func NewRenewalManager(db *gorm.DB) *RenewalManager {
+	return &RenewalManager{DB: db}
+}
+
+// StartRenewal is used to start the renewal of a name from the given expiry, charging
+// its owner the given number of credits. Should a pending or completed renewal from
+// the expiry already exist, it is returned instead, and false is returned, while a
+// refunded renewal is started again
+func (rm *RenewalManager) StartRenewal(name, username string, expiry time.Time, credits float64) (*NameRenewal, bool, error) {
+	renewal := &NameRenewal{}
+	check := rm.DB.Where("name = ? AND expiry = ?", name, expiry).First(renewal)
+	if check.Error == nil && renewal.Status != RenewalRefunded.String() {
+		return renewal, false, nil
+	} else if check.Error != nil && !check.RecordNotFound() {
+		return nil, false, check.Error
+	}
+	tx := rm.DB.Begin()
+	if tx.Error != nil {
+		return nil, false, tx.Error
+	}
+	var charged float64
+	if username != "" && credits > 0 {
+		if _, err := models.NewUserManager(tx).RemoveCredits(username, credits); err != nil {
+			tx.Rollback()
+			return nil, false, err
+		}
+		charged = credits
+	}
+	if renewal.ID != 0 {
+		// the status is only updated if the renewal is still refunded, so
+		// that if two renewals race each other, only one charges the owner
+		restart := tx.Model(&NameRenewal{}).Where(
+			"id = ? AND status = ?", renewal.ID, RenewalRefunded.String(),
+		).Updates(map[string]interface{}{
+			"status":  RenewalPending.String(),
+			"charged": charged,
+		})
+		if restart.Error != nil || restart.RowsAffected == 0 {
+			tx.Rollback()
+			return renewal, false, restart.Error
+		}
+		renewal.Status, renewal.Charged = RenewalPending.String(), charged
+	} else {
+		renewal = &NameRenewal{
+			Name:     name,
+			Expiry:   expiry,
+			UserName: username,
+			Status:   RenewalPending.String(),
+			Charged:  charged,
+		}
+		// the unique index on renewals guarantees that if two renewals
+		// race each other, only one of them is able to charge the owner
+		if check := tx.Create(renewal); check.Error != nil {
+			tx.Rollback()
+			return nil, false, check.Error
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, false, err
+	}
+	return renewal, true, nil
+}
+
+// FinishRenewal is used to record that a name was renewed by the given transaction
+func (rm *RenewalManager) FinishRenewal(renewal *NameRenewal, txHash string) error {
+	renewal.Status = RenewalRenewed.String()
+	renewal.TxHash = txHash
+	return rm.DB.Model(renewal).Updates(map[string]interface{}{
+		"status":  renewal.Status,
+		"tx_hash": renewal.TxHash,
+	}).Error
+}
+
+// RefundRenewal is used to refund the owner of a name which couldn't be renewed.
+// The refund is recorded in the same transaction as the credits are added, so
+// that the owner is refunded exactly once
+func (rm *RenewalManager) RefundRenewal(renewal *NameRenewal) error {
+	tx := rm.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	// the status is only updated if the renewal is still pending
+	check := tx.Model(&NameRenewal{}).Where(
+		"id = ? AND status = ?", renewal.ID, RenewalPending.String(),
+	).Update("status", RenewalRefunded.String())
+	if check.Error != nil {
+		tx.Rollback()
+		return check.Error
+	}
+	if check.RowsAffected == 0 {
+		tx.Rollback()
+		return nil
+	}
+	if renewal.Charged > 0 {
+		if _, err := models.NewUserManager(tx).AddCredits(renewal.UserName, renewal.Charged); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	renewal.Status = RenewalRefunded.String()
+	return nil
+}
+
+// FindPendingRenewals is used to find the renewals which are yet to be settled
+func (rm *RenewalManager) FindPendingRenewals() ([]NameRenewal, error) {
+	var renewals []NameRenewal
+	if check := rm.DB.Where(
+		"status = ?", RenewalPending.String(),
+	).Find(&renewals); check.Error != nil {
+		return nil, check.Error
+	}
+	return renewals, nil
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// SignatureMode denotes the scheme a payment message was signed with
+type SignatureMode string
+
+func (sm SignatureMode) String() string {
+	return string(sm)
+}
+
+const (
+	// SignaturePrefixed is recorded for messages signed with the
+	// ethereum signed message prefix, which never expire
+	SignaturePrefixed = SignatureMode("prefixed")
+	// SignatureTyped is recorded for EIP-712 typed payment messages
+	SignatureTyped = SignatureMode("typed")
+
+	// ErrPaymentMismatch is an error used to indicate that a payment number
+	// was already signed for with a different address, method or amount
+	ErrPaymentMismatch = "payment number has already been signed with a different address, method or amount"
+
+	// defaultSignatureLimit is the number of signatures returned by an audit query without a limit
+	defaultSignatureLimit = 100
+)
+
+// SignedPayment binds a payment number to the details it was first signed with.
+// Payment numbers are unique, so a payment number can only ever be signed for a
+// single address, method and amount
+type SignedPayment struct {
+	gorm.Model
+	// Number and ChargeAmount are base 10 integers
+	Number       string `gorm:"type:varchar(255);unique"`
+	Address      string `gorm:"type:varchar(255)"`
+	Method       int64  `gorm:"type:integer"`
+	ChargeAmount string `gorm:"type:varchar(255)"`
+}
+
+// IssuedSignature records a payment message signature returned to a caller.
+// A payment number may have several, as the same message can be signed again
+type IssuedSignature struct {
+	gorm.Model
+	PaymentNumber string `gorm:"type:varchar(255);index"`
+	Address       string `gorm:"type:varchar(255);index"`
+	Method        int64  `gorm:"type:integer"`
+	ChargeAmount  string `gorm:"type:varchar(255)"`
+	Mode          string `gorm:"type:varchar(255)"`
+	// Signer is the address of the payment key the message was signed with
+	Signer   string    `gorm:"type:varchar(255)"`
+	Hash     string    `gorm:"type:varchar(255)"`
+	IssuedAt time.Time `gorm:"index"`
+	// ExpiresAt is nil for messages which never expire
+	ExpiresAt *time.Time
+}
+
+// SignatureFilter selects the issued signatures returned by an audit query.
+// Zero fields match any signature
+type SignatureFilter struct {
+	PaymentNumber string
+	Address       string
+	Since         time.Time
+	// Limit defaults to 100
+	Limit int
+}
+
+// SignatureManager is used to interact with issued payment signatures
+type SignatureManager struct {
+	DB *gorm.DB
+}
+
+// NewSignatureManager is used to generate our signature manager helper
+func NewSignatureManager(db *gorm.DB) *SignatureManager {
+	return &SignatureManager{DB: db}
+}
+
+// ReservePayment is used to bind a payment number to the details it is being
+// signed with, failing if it was already signed with different details
+func (sm *SignatureManager) ReservePayment(number, address string, method int64, chargeAmount string) error {
+	existing := &SignedPayment{}
+	if check := sm.DB.Where("number = ?", number).First(existing); check.Error == nil {
+		if existing.Address != address || existing.Method != method || existing.ChargeAmount != chargeAmount {
+			return errors.New(ErrPaymentMismatch)
+		}
+		return nil
+	} else if !gorm.IsRecordNotFoundError(check.Error) {
+		return check.Error
+	}
+	// the unique index on payment numbers guarantees that if two requests
+	// race each other to sign a payment number, only one of them succeeds
+	return sm.DB.Create(&SignedPayment{
+		Number:       number,
+		Address:      address,
+		Method:       method,
+		ChargeAmount: chargeAmount,
+	}).Error
+}
+
+// RecordSignature is used to record a signature returned to a caller
+func (sm *SignatureManager) RecordSignature(sig *IssuedSignature) error {
+	return sm.DB.Create(sig).Error
+}
+
+// FindSignatures is used to find issued signatures, most recent first
+func (sm *SignatureManager) FindSignatures(filter SignatureFilter) ([]IssuedSignature, error) {
+	query := sm.DB
+	if filter.PaymentNumber != "" {
+		query = query.Where("payment_number = ?", filter.PaymentNumber)
+	}
+	if filter.Address != "" {
+		query = query.Where("address = ?", filter.Address)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("issued_at >= ?", filter.Since)
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultSignatureLimit
+	}
+	var sigs []IssuedSignature
+	if check := query.Order("issued_at desc").Limit(limit).Find(&sigs); check.Error != nil {
+		return nil, check.Error
+	}
+	return sigs, nil
+}
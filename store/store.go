@@ -0,0 +1,26 @@
+// Package store provides the database models and helpers
+// used by Pay to persist its own processing state
+package store
+
+import "github.com/jinzhu/gorm"
+
+// Migrate runs migrations for all models managed by Pay
+func Migrate(db *gorm.DB) error {
+	for _, t := range []interface{}{
+		&PaymentLedger{},
+		&DepositAddress{},
+		&PendingPayment{},
+		&TxAttempt{},
+		&NameRegistration{},
+		&NameRenewal{},
+		&Lease{},
+		&Subdomain{},
+		&SignedPayment{},
+		&IssuedSignature{},
+	} {
+		if check := db.AutoMigrate(t); check.Error != nil {
+			return check.Error
+		}
+	}
+	return nil
+}
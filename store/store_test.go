@@ -0,0 +1,42 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/config/v2"
+	"github.com/RTradeLtd/database/v2"
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/jinzhu/gorm"
+)
+
+const cfgPath = "../test/config.json"
+
+// newTestDB is used to connect to, and migrate, the test database
+// in our config, skipping the test should it be unavailable. The
+// caller is responsible for closing the connection
+func newTestDB(t *testing.T) *gorm.DB {
+	cfg, err := config.LoadConfig(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbm, err := database.New(cfg, database.Options{SSLModeDisable: true, RunMigrations: true})
+	if err != nil {
+		t.Skipf("test database unavailable, skipping: %v", err)
+	}
+	if err := Migrate(dbm.DB); err != nil {
+		t.Fatal(err)
+	}
+	return dbm.DB
+}
+
+// newTestUser is used to create a user with a unique name in the test database
+func newTestUser(t *testing.T, db *gorm.DB) *models.User {
+	username := fmt.Sprintf("pay-test-%d", time.Now().UnixNano())
+	user, err := models.NewUserManager(db).NewUserAccount(username, "password123", username+"@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
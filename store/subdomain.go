@@ -0,0 +1,96 @@
+package store
+
+import (
+	"errors"
+
+	"github.com/jinzhu/gorm"
+)
+
+// SubdomainStatus denotes the state of an issued subdomain
+type SubdomainStatus string
+
+func (ss SubdomainStatus) String() string {
+	return string(ss)
+}
+
+const (
+	// SubdomainClaimed is set once a label is reserved for a user, before it is registered
+	SubdomainClaimed = SubdomainStatus("claimed")
+	// SubdomainRegistered is set once the subdomain is registered, and managed by us
+	SubdomainRegistered = SubdomainStatus("registered")
+	// SubdomainTransferred is set once ownership of the subdomain is transferred to the user
+	SubdomainTransferred = SubdomainStatus("transferred")
+
+	// ErrLabelTaken is an error used to indicate that a
+	// subdomain label has been issued to another user
+	ErrLabelTaken = "subdomain label has been issued to another user"
+)
+
+// Subdomain records a *.ipfstemporal.eth subdomain issued to a user. Each
+// user is issued a single subdomain, and each label is issued to a single user
+type Subdomain struct {
+	gorm.Model
+	// Label is the normalised label of the subdomain
+	Label    string `gorm:"type:varchar(255);unique"`
+	UserName string `gorm:"type:varchar(255);unique"`
+	Status   string `gorm:"type:varchar(255)"`
+}
+
+// SubdomainManager is used to interact with issued subdomains
+type SubdomainManager struct {
+	DB *gorm.DB
+}
+
+// NewSubdomainManager is used to generate our subdomain manager helper
+func NewSubdomainManager(db *gorm.DB) *SubdomainManager {
+	return &SubdomainManager{DB: db}
+}
+
+// FindSubdomainByUser is used to find the subdomain issued to a user
+func (sm *SubdomainManager) FindSubdomainByUser(username string) (*Subdomain, error) {
+	sub := &Subdomain{}
+	if check := sm.DB.Where("user_name = ?", username).First(sub); check.Error != nil {
+		return nil, check.Error
+	}
+	return sub, nil
+}
+
+// FindSubdomainByLabel is used to find the subdomain issued with a label
+func (sm *SubdomainManager) FindSubdomainByLabel(label string) (*Subdomain, error) {
+	sub := &Subdomain{}
+	if check := sm.DB.Where("label = ?", label).First(sub); check.Error != nil {
+		return nil, check.Error
+	}
+	return sub, nil
+}
+
+// ClaimSubdomain is used to reserve a label for a user, failing if
+// the label has already been issued to another user
+func (sm *SubdomainManager) ClaimSubdomain(username, label string) (*Subdomain, error) {
+	existing, err := sm.FindSubdomainByLabel(label)
+	if err == nil && existing.UserName != username {
+		return nil, errors.New(ErrLabelTaken)
+	} else if err == nil {
+		return existing, nil
+	} else if !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	sub := &Subdomain{Label: label, UserName: username, Status: SubdomainClaimed.String()}
+	// the unique index on labels guarantees that if two users
+	// race each other to claim a label, only one succeeds
+	if check := sm.DB.Create(sub); check.Error != nil {
+		return nil, check.Error
+	}
+	return sub, nil
+}
+
+// UpdateSubdomainStatus is used to update the status of a subdomain
+func (sm *SubdomainManager) UpdateSubdomainStatus(sub *Subdomain, status SubdomainStatus) error {
+	sub.Status = status.String()
+	return sm.DB.Model(sub).Update("status", sub.Status).Error
+}
+
+// ReleaseSubdomain is used to release the claim on a label which failed to register
+func (sm *SubdomainManager) ReleaseSubdomain(sub *Subdomain) error {
+	return sm.DB.Unscoped().Delete(sub).Error
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"github.com/RTradeLtd/Pay/ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jinzhu/gorm"
+)
+
+// TxAttempt records a broadcast of one of our ethereum transactions. Every
+// attempt at getting an operation mined, whether the original broadcast,
+// a speed-up or a cancellation, shares the nonce of the original
+type TxAttempt struct {
+	gorm.Model
+	// Operation is the operation the transaction performs, ie set-resolver
+	Operation string `gorm:"type:varchar(255)"`
+	Kind      string `gorm:"type:varchar(255)"`
+	Nonce     uint64 `gorm:"index"`
+	Hash      string `gorm:"type:varchar(255);unique"`
+	// GasPrice is denominated in wei
+	GasPrice string `gorm:"type:varchar(255)"`
+	Mined    bool
+	// Status is the status of the receipt once mined
+	Status uint64
+}
+
+// TxAttemptManager is used to interact with transaction attempts
+type TxAttemptManager struct {
+	DB *gorm.DB
+}
+
+// NewTxAttemptManager is used to generate our transaction attempt manager helper
+func NewTxAttemptManager(db *gorm.DB) *TxAttemptManager {
+	return &TxAttemptManager{DB: db}
+}
+
+// RecordAttempt is used to record the broadcast of a transaction
+func (tm *TxAttemptManager) RecordAttempt(operation string, kind ethereum.AttemptKind, tx *types.Transaction) error {
+	return tm.DB.Create(&TxAttempt{
+		Operation: operation,
+		Kind:      kind.String(),
+		Nonce:     tx.Nonce(),
+		Hash:      tx.Hash().String(),
+		GasPrice:  tx.GasPrice().String(),
+	}).Error
+}
+
+// RecordMined is used to record the attempt which was mined
+func (tm *TxAttemptManager) RecordMined(hash common.Hash, status uint64) error {
+	return tm.DB.Model(&TxAttempt{}).Where("hash = ?", hash.String()).Updates(map[string]interface{}{
+		"mined":  true,
+		"status": status,
+	}).Error
+}
+
+// FindAttempts is used to find every attempt made with a nonce
+func (tm *TxAttemptManager) FindAttempts(nonce uint64) ([]TxAttempt, error) {
+	var attempts []TxAttempt
+	if check := tm.DB.Where("nonce = ?", nonce).Order("id").Find(&attempts); check.Error != nil {
+		return nil, check.Error
+	}
+	return attempts, nil
+}
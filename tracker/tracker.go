@@ -0,0 +1,145 @@
+// Package tracker provides a shared confirmation tracker. Rather than each pending
+// payment polling its node on a timer, a single block subscription per chain wakes
+// every payment waiting on confirmations whenever a new block is seen.
+package tracker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// resubscribeDelay is the time waited before resubscribing after a subscription fails
+var resubscribeDelay = time.Second * 30
+
+// Source is used to subscribe to the new blocks of a chain
+type Source interface {
+	// Subscribe sends the height of each new block to heights, until
+	// the context is cancelled or the subscription fails
+	Subscribe(ctx context.Context, heights chan<- uint64) error
+}
+
+// Tracker is used to wake goroutines waiting on confirmations whenever a new block is seen
+type Tracker struct {
+	mux    sync.Mutex
+	height uint64
+	// block is closed, and replaced, whenever a new block is seen
+	block chan struct{}
+	// fallback is the longest a waiter sleeps without a new block, so that
+	// pending payments are still checked while the subscription is down
+	fallback time.Duration
+}
+
+// New is used to instantiate our tracker, with waiters sleeping
+// for at most the fallback duration if no new block is seen
+func New(fallback time.Duration) *Tracker {
+	return &Tracker{block: make(chan struct{}), fallback: fallback}
+}
+
+// Run is used to subscribe to new blocks from the source, resubscribing
+// whenever the subscription fails, until the context is cancelled
+func (t *Tracker) Run(ctx context.Context, l *zap.SugaredLogger, src Source) {
+	for {
+		heights := make(chan uint64)
+		errCh := make(chan error, 1)
+		subCtx, cancel := context.WithCancel(ctx)
+		go func() { errCh <- src.Subscribe(subCtx, heights) }()
+	RECV:
+		for {
+			select {
+			case height := <-heights:
+				t.Notify(height)
+			case err := <-errCh:
+				if ctx.Err() == nil {
+					l.Warnw("block subscription failed, resubscribing", "error", err)
+				}
+				break RECV
+			}
+		}
+		cancel()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(resubscribeDelay):
+		}
+	}
+}
+
+// Notify is used to signal that a block at the given height was seen, waking all
+// waiters. Heights at or below the highest block seen so far are ignored
+func (t *Tracker) Notify(height uint64) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if height <= t.height {
+		return
+	}
+	t.height = height
+	close(t.block)
+	t.block = make(chan struct{})
+}
+
+// Height returns the height of the highest block seen
+func (t *Tracker) Height() uint64 {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	return t.height
+}
+
+// Wait blocks until a block above the given height is seen, the fallback duration
+// elapses, or the context is cancelled in which case its error is returned. Callers
+// should pass the height returned by Height before checking their payment, so that
+// a block arriving during the check isn't missed
+func (t *Tracker) Wait(ctx context.Context, after uint64) error {
+	t.mux.Lock()
+	if t.height > after {
+		t.mux.Unlock()
+		return nil
+	}
+	block := t.block
+	t.mux.Unlock()
+	timer := time.NewTimer(t.fallback)
+	defer timer.Stop()
+	select {
+	case <-block:
+		return nil
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// PollSource is a Source for chains whose nodes can't push new blocks to us,
+// polling the current height once per interval on behalf of all waiters
+type PollSource struct {
+	Interval time.Duration
+	Height   func(ctx context.Context) (uint64, error)
+}
+
+// Subscribe is used to poll for new blocks until the context is cancelled or polling fails
+func (ps *PollSource) Subscribe(ctx context.Context, heights chan<- uint64) error {
+	var last uint64
+	ticker := time.NewTicker(ps.Interval)
+	defer ticker.Stop()
+	for {
+		height, err := ps.Height(ctx)
+		if err != nil {
+			return err
+		}
+		if height != last {
+			last = height
+			select {
+			case heights <- height:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
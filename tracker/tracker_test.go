@@ -0,0 +1,98 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func Test_Wait(t *testing.T) {
+	tr := New(time.Hour)
+	var wg sync.WaitGroup
+	// every waiter should be woken by a single block
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := tr.Wait(context.Background(), 0); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// give the waiters a chance to start waiting
+	time.Sleep(time.Millisecond * 50)
+	tr.Notify(10)
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("waiters were not woken")
+	}
+	if tr.Height() != 10 {
+		t.Fatal("bad height", tr.Height())
+	}
+	// stale blocks should be ignored
+	tr.Notify(9)
+	if tr.Height() != 10 {
+		t.Fatal("bad height", tr.Height())
+	}
+}
+
+func Test_Wait_Fallback(t *testing.T) {
+	tr := New(time.Millisecond * 10)
+	if err := tr.Wait(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	// blocks seen before waiting should not be missed
+	tr = New(time.Hour)
+	tr.Notify(1)
+	if err := tr.Wait(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := New(time.Hour).Wait(ctx, 0); err != context.Canceled {
+		t.Fatal("expected context error", err)
+	}
+}
+
+func Test_Run(t *testing.T) {
+	resubscribeDelay = time.Millisecond
+	var (
+		mux   sync.Mutex
+		polls int
+	)
+	src := &PollSource{Interval: time.Millisecond, Height: func(ctx context.Context) (uint64, error) {
+		mux.Lock()
+		defer mux.Unlock()
+		polls++
+		// fail every third poll to exercise resubscription
+		if polls%3 == 0 {
+			return 0, errors.New("node unavailable")
+		}
+		return uint64(polls), nil
+	}}
+	tr := New(time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tr.Run(ctx, zap.NewNop().Sugar(), src)
+		close(done)
+	}()
+	for height := tr.Height(); height < 10; height = tr.Height() {
+		if err := tr.Wait(ctx, height); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("tracker did not stop")
+	}
+}